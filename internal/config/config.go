@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +14,25 @@ import (
 type AuthConfig struct {
 	AllowRegistration bool
 	JWTSecret         string
+	AccessTokenTTL    int // in minutes
+	RefreshTokenTTL   int // in days, extended each time the refresh token is used
+
+	// EncryptionKey protects the secrets the server has to read back (Subsonic passwords,
+	// scrobble tokens, TOTP keys); it is required and kept separate from JWTSecret
+	EncryptionKey string
+
+	// PasswordMinLength and PasswordCheckBreached make up the policy for new passwords
+	PasswordMinLength     int
+	PasswordCheckBreached bool
+
+	// LoginMaxFailures and LoginMaxFailuresPerIP are the failed logins allowed per username
+	// and per client IP before a temporary lockout; attempts are slowed down before that
+	LoginMaxFailures      int
+	LoginMaxFailuresPerIP int
+	LoginLockout          int // in minutes
+
+	// RequireAdmin2FA makes admins set up two-factor authentication before they can log in
+	RequireAdmin2FA bool
 }
 
 // Config holds the application configuration
@@ -21,6 +41,7 @@ type Config struct {
 	Database DatabaseConfig
 	Music    MusicConfig
 	Auth     AuthConfig
+	Scrobble ScrobbleConfig
 }
 
 // ServerConfig holds the server configuration
@@ -31,6 +52,10 @@ type ServerConfig struct {
 	TLS      bool
 	CertFile string
 	KeyFile  string
+
+	// TrustedProxies are the reverse proxy addresses or CIDRs whose X-Forwarded-For header
+	// is used for the client IP; with none, the connection's remote address is used
+	TrustedProxies []string
 }
 
 // Address returns the server address in host:port format
@@ -52,6 +77,34 @@ type MusicConfig struct {
 	ScanInterval   int // in minutes
 	AllowedFormats []string
 	LyricsAPIURL   string
+	// ScanHash enables content fingerprints so moved or renamed files keep their song ID
+	ScanHash bool
+	// Watch enables filesystem notifications in addition to periodic scanning
+	Watch         bool
+	WatchDebounce int // in milliseconds
+	// ArtistSeparators and GenreSeparators split multi-value tags such as "Artist A; Artist B"
+	ArtistSeparators []string
+	GenreSeparators  []string
+
+	// TranscodeCommands maps an output format (mp3, opus, aac) to a command template.
+	// %s is replaced with the input file path and %b with the bitrate in kbps.
+	TranscodeCommands      map[string]string
+	TranscodeDefaultFormat string
+	TranscodeCacheDir      string
+	TranscodeCacheSize     int // in MB
+}
+
+// ScrobbleConfig holds the configuration for forwarding plays to external scrobbling services
+type ScrobbleConfig struct {
+	// ListenBrainzURL is the default API base URL for ListenBrainz-compatible accounts
+	// (ListenBrainz itself, Maloja, Koito); accounts may override it
+	ListenBrainzURL string
+	// LastFMURL is the default API endpoint for Last.fm-compatible accounts
+	LastFMURL       string
+	LastFMAPIKey    string
+	LastFMAPISecret string
+	RetryInterval   int // base delay before retrying a failed submission, in seconds
+	MaxAttempts     int // submissions failing this many times are dropped
 }
 
 // LoadConfig loads configuration from environment variables or defaults
@@ -80,6 +133,8 @@ func loadConfigFromEnv() *Config {
 			TLS:      getEnvBoolOrDefault("SERVER_TLS", false),
 			CertFile: getEnvOrDefault("SERVER_CERT_FILE", ""),
 			KeyFile:  getEnvOrDefault("SERVER_KEY_FILE", ""),
+
+			TrustedProxies: getEnvListOrDefault("TRUSTED_PROXIES", nil),
 		},
 		Database: DatabaseConfig{
 			Path:            getEnvOrDefault("DATABASE_PATH", "./data/melogo.db"),
@@ -88,14 +143,48 @@ func loadConfigFromEnv() *Config {
 			ConnMaxLifetime: getEnvIntOrDefault("DATABASE_CONN_MAX_LIFETIME", 60), // 60 minutes
 		},
 		Music: MusicConfig{
-			Directory:      getEnvOrDefault("MUSIC_DIRECTORY", "./music"),
-			ScanInterval:   getEnvIntOrDefault("MUSIC_SCAN_INTERVAL", 5), // 5 minutes
-			AllowedFormats: []string{".mp3", ".wav", ".flac", ".m4a", ".aac", ".ogg"},
-			LyricsAPIURL:   getEnvOrDefault("LYRICS_API_URL", "https://api.lrc.cx"),
+			Directory:        getEnvOrDefault("MUSIC_DIRECTORY", "./music"),
+			ScanInterval:     getEnvIntOrDefault("MUSIC_SCAN_INTERVAL", 5), // 5 minutes
+			AllowedFormats:   []string{".mp3", ".wav", ".flac", ".m4a", ".aac", ".ogg"},
+			LyricsAPIURL:     getEnvOrDefault("LYRICS_API_URL", "https://api.lrc.cx"),
+			ScanHash:         getEnvBoolOrDefault("MUSIC_SCAN_HASH", true),
+			Watch:            getEnvBoolOrDefault("MUSIC_WATCH", false),
+			WatchDebounce:    getEnvIntOrDefault("MUSIC_WATCH_DEBOUNCE", 2000), // 2 seconds
+			ArtistSeparators: getEnvListOrDefault("MUSIC_ARTIST_SEPARATORS", []string{";", "/", "feat.", "&"}),
+			GenreSeparators:  getEnvListOrDefault("MUSIC_GENRE_SEPARATORS", []string{";", "/"}),
+			TranscodeCommands: map[string]string{
+				"mp3":  getEnvAllowEmpty("TRANSCODE_MP3_COMMAND", "ffmpeg -i %s -map 0:a:0 -b:a %bk -v 0 -f mp3 -"),
+				"opus": getEnvAllowEmpty("TRANSCODE_OPUS_COMMAND", "ffmpeg -i %s -map 0:a:0 -b:a %bk -v 0 -c:a libopus -f opus -"),
+				"aac":  getEnvAllowEmpty("TRANSCODE_AAC_COMMAND", "ffmpeg -i %s -map 0:a:0 -b:a %bk -v 0 -c:a aac -f adts -"),
+			},
+			TranscodeDefaultFormat: getEnvOrDefault("TRANSCODE_DEFAULT_FORMAT", "mp3"),
+			TranscodeCacheDir:      getEnvOrDefault("TRANSCODE_CACHE_DIR", "./data/transcode"),
+			TranscodeCacheSize:     getEnvIntOrDefault("TRANSCODE_CACHE_SIZE", 512), // 512 MB
 		},
 		Auth: AuthConfig{
 			AllowRegistration: getEnvBoolOrDefault("ALLOW_REGISTRATION", true),
 			JWTSecret:         getEnvOrDefault("JWT_SECRET", "melogo-secret-key-change-in-production"),
+			AccessTokenTTL:    getEnvIntOrDefault("ACCESS_TOKEN_TTL", 15),  // 15 minutes
+			RefreshTokenTTL:   getEnvIntOrDefault("REFRESH_TOKEN_TTL", 30), // 30 days
+
+			EncryptionKey: getEnvOrDefault("ENCRYPTION_KEY", ""),
+
+			PasswordMinLength:     getEnvIntOrDefault("PASSWORD_MIN_LENGTH", 8),
+			PasswordCheckBreached: getEnvBoolOrDefault("PASSWORD_CHECK_BREACHED", true),
+
+			LoginMaxFailures:      getEnvIntOrDefault("LOGIN_MAX_FAILURES", 10),
+			LoginMaxFailuresPerIP: getEnvIntOrDefault("LOGIN_MAX_FAILURES_PER_IP", 50),
+			LoginLockout:          getEnvIntOrDefault("LOGIN_LOCKOUT", 15), // 15 minutes
+
+			RequireAdmin2FA: getEnvBoolOrDefault("REQUIRE_ADMIN_2FA", false),
+		},
+		Scrobble: ScrobbleConfig{
+			ListenBrainzURL: getEnvOrDefault("SCROBBLE_LISTENBRAINZ_URL", "https://api.listenbrainz.org"),
+			LastFMURL:       getEnvOrDefault("SCROBBLE_LASTFM_URL", "https://ws.audioscrobbler.com/2.0/"),
+			LastFMAPIKey:    getEnvOrDefault("SCROBBLE_LASTFM_API_KEY", ""),
+			LastFMAPISecret: getEnvOrDefault("SCROBBLE_LASTFM_API_SECRET", ""),
+			RetryInterval:   getEnvIntOrDefault("SCROBBLE_RETRY_INTERVAL", 60), // 1 minute
+			MaxAttempts:     getEnvIntOrDefault("SCROBBLE_MAX_ATTEMPTS", 20),
 		},
 	}
 
@@ -104,6 +193,11 @@ func loadConfigFromEnv() *Config {
 		fmt.Printf("Warning: Failed to create music directory: %v\n", err)
 	}
 
+	// Ensure transcode cache directory exists
+	if err := os.MkdirAll(cfg.Music.TranscodeCacheDir, 0755); err != nil {
+		fmt.Printf("Warning: Failed to create transcode cache directory: %v\n", err)
+	}
+
 	// Ensure database directory exists
 	dbDir := filepath.Dir(cfg.Database.Path)
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
@@ -121,6 +215,22 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvAllowEmpty 与 getEnvOrDefault 相同，但显式设置为空值时返回空字符串
+func getEnvAllowEmpty(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvListOrDefault 读取以空白分隔的列表，显式设置为空值时返回空列表
+func getEnvListOrDefault(key string, defaultValue []string) []string {
+	if value, ok := os.LookupEnv(key); ok {
+		return strings.Fields(value)
+	}
+	return defaultValue
+}
+
 func getEnvIntOrDefault(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -172,6 +172,12 @@ func AdminUpdateSong(c *gin.Context) {
 		return
 	}
 
+	// 重新关联艺术家和专辑
+	if err := services.GlobalMusicScanner.LinkSongEntities(songID); err != nil {
+		errorHandler.HandleInternalServerError(c, "更新歌曲信息失败", err)
+		return
+	}
+
 	// 使用新的元数据进行歌词和封面的刮削
 	if services.GlobalMusicScanner != nil && services.GlobalMusicScanner.LyricsScraper != nil {
 		// 刮削歌词和封面
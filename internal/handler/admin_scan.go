@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scanEventInterval SSE推送扫描状态的最小间隔
+const scanEventInterval = 500 * time.Millisecond
+
+// AdminStartScan 管理员触发音乐库扫描
+func AdminStartScan(c *gin.Context) {
+	if services.GlobalMusicScanner == nil {
+		errorHandler.HandleInternalServerError(c, "音乐扫描器未初始化", nil)
+		return
+	}
+
+	var req model.StartScanRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+			return
+		}
+	}
+
+	opts := services.ScanOptions{Path: req.Path, Trigger: services.ScanTriggerAdmin}
+	switch req.Mode {
+	case "", "incremental":
+	case "full":
+		opts.Full = true
+	default:
+		errorHandler.HandleBadRequest(c, "扫描模式只能是 full 或 incremental", nil)
+		return
+	}
+
+	err := services.GlobalMusicScanner.StartScan(opts)
+	switch {
+	case errors.Is(err, services.ErrScanInProgress):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "已有扫描正在进行",
+			"status": services.GlobalMusicScanner.GetScanStatus(),
+		})
+		return
+	case errors.Is(err, services.ErrInvalidScanPath):
+		errorHandler.HandleBadRequest(c, "扫描路径不存在或不在音乐目录中", err)
+		return
+	case err != nil:
+		errorHandler.HandleInternalServerError(c, "启动扫描失败", err)
+		return
+	}
+
+	errorHandler.HandleSuccess(c, http.StatusAccepted, gin.H{
+		"message": "扫描已开始",
+		"status":  services.GlobalMusicScanner.GetScanStatus(),
+	})
+}
+
+// AdminGetScanStatus 管理员获取扫描状态
+func AdminGetScanStatus(c *gin.Context) {
+	if services.GlobalMusicScanner == nil {
+		errorHandler.HandleInternalServerError(c, "音乐扫描器未初始化", nil)
+		return
+	}
+
+	errorHandler.HandleOK(c, services.GlobalMusicScanner.GetScanStatus())
+}
+
+// AdminScanEvents 以SSE推送扫描状态，连接建立时立即推送一次当前状态
+func AdminScanEvents(c *gin.Context) {
+	scanner := services.GlobalMusicScanner
+	if scanner == nil {
+		errorHandler.HandleInternalServerError(c, "音乐扫描器未初始化", nil)
+		return
+	}
+
+	updates, unsubscribe := scanner.WatchScanStatus()
+	defer unsubscribe()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// 扫描进行中时定期推送以刷新耗时，空闲时作为心跳保持连接
+	ticker := time.NewTicker(scanEventInterval)
+	defer ticker.Stop()
+	heartbeat := 0
+	changed := false
+
+	c.SSEvent("status", scanner.GetScanStatus())
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-updates:
+			changed = true
+			return true
+		case <-ticker.C:
+		}
+
+		status := scanner.GetScanStatus()
+		heartbeat++
+		if changed || status.Running || heartbeat >= 30 {
+			c.SSEvent("status", status)
+			changed = false
+			heartbeat = 0
+		}
+		return true
+	})
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"melogo/internal/i18n"
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminUsersPage 管理员用户管理页面
+func AdminUsersPage(c *gin.Context) {
+	i18n.HTML(c, http.StatusOK, "users.html", gin.H{
+		"title": "管理员 - 用户管理",
+	})
+}
+
+// AdminListUsers 管理员获取用户列表（支持分页，q 按用户名或邮箱过滤）
+func AdminListUsers(c *gin.Context) {
+	page, limit, offset := parsePagination(c, 20, 100)
+	users, total, err := userService.ListUsers(c.Query("q"), limit, offset)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取用户列表失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"users":      users,
+		"pagination": paginationInfo(page, limit, total),
+	})
+}
+
+// AdminCreateUser 管理员创建用户
+func AdminCreateUser(c *gin.Context) {
+	var req model.AdminCreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	user, err := userService.CreateUser(req.Username, req.Email, req.Password, req.IsAdmin)
+	if err != nil {
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+		return
+	}
+
+	errorHandler.HandleCreated(c, gin.H{
+		"message": "创建成功",
+		"user":    user,
+	})
+}
+
+// AdminUpdateUser 管理员设置或取消管理员、禁用或启用用户
+func AdminUpdateUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的用户ID", err)
+		return
+	}
+
+	var req model.AdminUpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	if currentID, _ := middleware.GetCurrentUserID(c); currentID == userID && req.IsDisabled != nil && *req.IsDisabled {
+		errorHandler.HandleBadRequest(c, "不能禁用当前登录的账号", nil)
+		return
+	}
+
+	if req.IsAdmin != nil {
+		if err := userService.SetUserAdmin(userID, *req.IsAdmin); err != nil {
+			handleAdminUserError(c, "更新用户失败", err)
+			return
+		}
+	}
+	if req.IsDisabled != nil {
+		if err := userService.SetUserDisabled(userID, *req.IsDisabled); err != nil {
+			handleAdminUserError(c, "更新用户失败", err)
+			return
+		}
+	}
+
+	user, err := userService.GetUserByID(userID)
+	if err != nil {
+		handleAdminUserError(c, "获取用户失败", services.ErrUserNotFound)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message": "更新成功",
+		"user":    user,
+	})
+}
+
+// AdminResetUserPassword 管理员重置用户密码
+func AdminResetUserPassword(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的用户ID", err)
+		return
+	}
+
+	var req model.AdminResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	if err := userService.ResetPassword(userID, req.Password); err != nil {
+		handleAdminUserError(c, "重置密码失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "密码已重置"})
+}
+
+// AdminDeleteUser 管理员删除用户及其播放列表、收藏和播放记录
+func AdminDeleteUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的用户ID", err)
+		return
+	}
+
+	if currentID, _ := middleware.GetCurrentUserID(c); currentID == userID {
+		errorHandler.HandleBadRequest(c, "不能删除当前登录的账号", nil)
+		return
+	}
+
+	if err := userService.DeleteUser(userID); err != nil {
+		handleAdminUserError(c, "删除用户失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "删除成功"})
+}
+
+// handleAdminUserError 用户不存在返回404，最后一个管理员返回409，密码不符合要求返回400，其他错误返回500
+func handleAdminUserError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		errorHandler.HandleNotFound(c, err.Error())
+	case errors.Is(err, services.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, utils.ErrWeakPassword):
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+	default:
+		errorHandler.HandleInternalServerError(c, message, err)
+	}
+}
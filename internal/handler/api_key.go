@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"errors"
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var apiKeyService *services.APIKeyService
+
+// InitAPIKeyHandler 初始化API密钥处理器
+func InitAPIKeyHandler(service *services.APIKeyService) {
+	apiKeyService = service
+	utils.NewLogger().Info("API key handler initialized")
+}
+
+// ListAPIKeys 获取当前用户的API密钥（不包含密钥本身）
+func ListAPIKeys(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	keys, err := apiKeyService.ListAPIKeys(userID)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取API密钥失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"api_keys": keys,
+	})
+}
+
+// CreateAPIKey 创建API密钥，密钥只在响应中出现一次
+func CreateAPIKey(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	var req model.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	apiKey, key, err := apiKeyService.CreateAPIKey(userID, req.Name, req.Scopes)
+	if err != nil {
+		if errors.Is(err, services.ErrAdminScopeForbidden) {
+			errorHandler.HandleForbidden(c, err.Error())
+			return
+		}
+		errorHandler.HandleInternalServerError(c, "创建API密钥失败", err)
+		return
+	}
+
+	errorHandler.HandleCreated(c, gin.H{
+		"message": "创建成功，请立即保存密钥，之后将无法再次查看",
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+// RevokeAPIKey 吊销API密钥
+func RevokeAPIKey(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的API密钥ID", err)
+		return
+	}
+
+	if err := apiKeyService.RevokeAPIKey(userID, keyID); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			errorHandler.HandleNotFound(c, err.Error())
+			return
+		}
+		errorHandler.HandleInternalServerError(c, "吊销API密钥失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "已吊销"})
+}
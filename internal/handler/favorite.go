@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"melogo/internal/middleware"
 	"melogo/internal/model"
 	"melogo/internal/services"
@@ -21,7 +22,7 @@ func InitFavoriteHandler(service *services.FavoriteService) {
 	utils.NewLogger().Info("Favorite handler initialized")
 }
 
-// ListFavorites returns a list of favorite songs
+// ListFavorites returns a page of favorites, optionally filtered by type or minimum rating
 func ListFavorites(c *gin.Context) {
 	userID, exists := middleware.GetCurrentUserID(c)
 	if !exists {
@@ -29,30 +30,34 @@ func ListFavorites(c *gin.Context) {
 		return
 	}
 
-	favorites, err := favoriteService.ListFavorites(userID)
-	if err != nil {
-		errorHandler.HandleInternalServerError(c, "获取收藏列表失败", err)
+	itemType := c.Query("type")
+	if itemType != "" && !isFavoriteType(itemType) {
+		errorHandler.HandleBadRequest(c, "无效的收藏类型", nil)
 		return
 	}
-
-	// 转换为前端需要的格式
-	result := make([]map[string]interface{}, len(favorites))
-	for i, fav := range favorites {
-		result[i] = map[string]interface{}{
-			"id":       fav.Song.ID,
-			"title":    fav.Song.Title,
-			"artist":   fav.Song.Artist,
-			"album":    fav.Song.Album,
-			"duration": fav.Song.Duration,
-		}
+	minRating, _ := strconv.Atoi(c.Query("min_rating"))
+
+	page, limit, offset := parsePagination(c, 50, 500)
+	favorites, total, err := favoriteService.ListFavorites(userID, services.FavoriteListOptions{
+		Type:      itemType,
+		MinRating: minRating,
+		Sort:      c.Query("sort"),
+		Order:     c.Query("order"),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "获取收藏列表失败: "+err.Error(), err)
+		return
 	}
 
 	errorHandler.HandleOK(c, gin.H{
-		"favorites": result,
+		"favorites":  favorites,
+		"pagination": paginationInfo(page, limit, total),
 	})
 }
 
-// AddFavorite adds a song to favorites
+// AddFavorite adds a song, album, artist or playlist to favorites
 func AddFavorite(c *gin.Context) {
 	userID, exists := middleware.GetCurrentUserID(c)
 	if !exists {
@@ -65,10 +70,18 @@ func AddFavorite(c *gin.Context) {
 		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
 		return
 	}
+	itemType, itemID := req.Type, req.ID
+	if itemType == "" {
+		itemType, itemID = model.FavoriteSong, req.SongID
+	}
+	if itemID <= 0 {
+		errorHandler.HandleBadRequest(c, "参数错误: 缺少收藏对象ID", nil)
+		return
+	}
 
-	err := favoriteService.AddFavorite(userID, req.SongID)
+	err := favoriteService.SetLoved(userID, itemType, itemID, true)
 	if err != nil {
-		errorHandler.HandleInternalServerError(c, "添加收藏失败", err)
+		handleFavoriteError(c, "添加收藏失败", err)
 		return
 	}
 
@@ -101,3 +114,91 @@ func RemoveFavorite(c *gin.Context) {
 		"message": "取消收藏成功",
 	})
 }
+
+// RemoveFavoriteItem removes a song, album, artist or playlist from favorites, keeping its rating
+func RemoveFavoriteItem(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	itemType, itemID, ok := favoriteItemParams(c)
+	if !ok {
+		return
+	}
+
+	err := favoriteService.SetLoved(userID, itemType, itemID, false)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "取消收藏失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message": "取消收藏成功",
+	})
+}
+
+// SetFavoriteRating sets a 1-5 star rating on an item, 0 clears it
+func SetFavoriteRating(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	itemType, itemID, ok := favoriteItemParams(c)
+	if !ok {
+		return
+	}
+
+	var req model.SetRatingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	err := favoriteService.SetRating(userID, itemType, itemID, req.Rating)
+	if err != nil {
+		handleFavoriteError(c, "设置评分失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message": "评分成功",
+		"rating":  req.Rating,
+	})
+}
+
+// favoriteItemParams 解析路径中的收藏类型和对象ID，无效时返回错误响应
+func favoriteItemParams(c *gin.Context) (string, int, bool) {
+	itemType := c.Param("type")
+	if !isFavoriteType(itemType) {
+		errorHandler.HandleBadRequest(c, "无效的收藏类型", nil)
+		return "", 0, false
+	}
+	itemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的ID", err)
+		return "", 0, false
+	}
+	return itemType, itemID, true
+}
+
+// isFavoriteType 是否为可以收藏的类型
+func isFavoriteType(itemType string) bool {
+	switch itemType {
+	case model.FavoriteSong, model.FavoriteAlbum, model.FavoriteArtist, model.FavoritePlaylist:
+		return true
+	}
+	return false
+}
+
+// handleFavoriteError 收藏对象不存在时返回404，其他错误返回500
+func handleFavoriteError(c *gin.Context, message string, err error) {
+	if errors.Is(err, services.ErrFavoriteItemNotFound) {
+		errorHandler.HandleNotFound(c, err.Error())
+		return
+	}
+	errorHandler.HandleInternalServerError(c, message, err)
+}
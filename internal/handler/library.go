@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var libraryService *services.LibraryService
+
+// InitLibraryHandler 初始化曲库浏览处理器
+func InitLibraryHandler(service *services.LibraryService) {
+	libraryService = service
+	utils.NewLogger().Info("Library handler initialized")
+}
+
+// parsePagination 解析分页参数 page 和 limit
+func parsePagination(c *gin.Context, defaultLimit, maxLimit int) (page, limit, offset int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+
+	return page, limit, (page - 1) * limit
+}
+
+// paginationInfo 生成分页信息
+func paginationInfo(page, limit, total int) gin.H {
+	return gin.H{
+		"current_page":   page,
+		"total_pages":    (total + limit - 1) / limit,
+		"total_items":    total,
+		"items_per_page": limit,
+	}
+}
+
+// ListArtists 获取艺术家列表（支持分页和按名称过滤）
+func ListArtists(c *gin.Context) {
+	page, limit, offset := parsePagination(c, 50, 500)
+
+	artists, total, err := libraryService.ListArtists(c.Query("q"), limit, offset)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取艺术家列表失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"artists":    artists,
+		"pagination": paginationInfo(page, limit, total),
+	})
+}
+
+// GetArtist 获取艺术家详情
+func GetArtist(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "艺术家ID格式错误", err)
+		return
+	}
+
+	artist, err := libraryService.GetArtist(id)
+	if err != nil {
+		errorHandler.HandleNotFound(c, err.Error())
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"artist": artist,
+	})
+}
+
+// ListAlbums 获取专辑列表（支持分页、按名称过滤、按艺术家过滤和排序）
+func ListAlbums(c *gin.Context) {
+	page, limit, offset := parsePagination(c, 50, 500)
+
+	artistID := 0
+	if artistIDStr := c.Query("artist_id"); artistIDStr != "" {
+		id, err := strconv.Atoi(artistIDStr)
+		if err != nil {
+			errorHandler.HandleBadRequest(c, "艺术家ID格式错误", err)
+			return
+		}
+		artistID = id
+	}
+
+	sort := c.DefaultQuery("sort", "name")
+	if sort != "name" && sort != "year" && sort != "recent" {
+		errorHandler.HandleBadRequest(c, "排序方式只能是 name、year 或 recent", nil)
+		return
+	}
+
+	albums, total, err := libraryService.ListAlbums(c.Query("q"), artistID, sort, limit, offset)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取专辑列表失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"albums":     albums,
+		"pagination": paginationInfo(page, limit, total),
+	})
+}
+
+// GetAlbum 获取专辑详情及曲目列表
+func GetAlbum(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "专辑ID格式错误", err)
+		return
+	}
+
+	album, err := libraryService.GetAlbum(id)
+	if err != nil {
+		errorHandler.HandleNotFound(c, err.Error())
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"album": album,
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"melogo/internal/services"
 	"melogo/internal/utils"
 	"os"
-	"path/filepath"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -63,25 +62,8 @@ func StreamSong(c *gin.Context) {
 		return
 	}
 
-	// 构建完整的文件路径
-	filePath := filepath.Join(services.GlobalMusicScanner.Cfg.Music.Directory, song.FilePath)
-
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		errorHandler.HandleNotFound(c, "Audio file not found")
-		return
-	}
-
-	// 设置响应头
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Type", "audio/mpeg")
-	c.Header("Content-Disposition", "inline; filename="+filepath.Base(song.FilePath))
-	c.Header("Expires", "0")
-	c.Header("Cache-Control", "must-revalidate")
-	c.Header("Pragma", "public")
-
-	// 流式传输文件
-	c.File(filePath)
+	maxBitRate, _ := strconv.Atoi(c.Query("maxBitRate"))
+	streamSong(c, song, c.Query("format"), maxBitRate, c.Query("estimateContentLength") == "true")
 }
 
 // GetLyrics returns lyrics for a specific song
@@ -110,7 +92,14 @@ func GetLyrics(c *gin.Context) {
 	}
 
 	// 构建完整的歌词文件路径
-	lyricsPath := filepath.Join(services.GlobalMusicScanner.Cfg.Music.Directory, *song.LyricsPath)
+	lyricsPath, err := services.ResolveMusicPath(*song.LyricsPath)
+	if err != nil {
+		errorHandler.HandleOK(c, gin.H{
+			"song_id": id,
+			"lyrics":  "",
+		})
+		return
+	}
 
 	// 读取歌词文件
 	lyricsBytes, err := os.ReadFile(lyricsPath)
@@ -151,7 +140,11 @@ func GetCover(c *gin.Context) {
 	}
 
 	// 构建完整的封面文件路径
-	coverPath := filepath.Join(services.GlobalMusicScanner.Cfg.Music.Directory, *song.CoverImage)
+	coverPath, err := services.ResolveMusicPath(*song.CoverImage)
+	if err != nil {
+		errorHandler.HandleNotFound(c, "Cover image file not found")
+		return
+	}
 
 	// 检查文件是否存在
 	if _, err := os.Stat(coverPath); os.IsNotExist(err) {
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var playHistoryService *services.PlayHistoryService
+
+// InitPlayHistoryHandler 初始化播放记录处理器
+func InitPlayHistoryHandler(service *services.PlayHistoryService) {
+	playHistoryService = service
+	utils.NewLogger().Info("Play history handler initialized")
+}
+
+// ScrobbleSong reports playback of a song
+// submission=false marks the song as now playing; otherwise the play is recorded and counted
+// when at least half of the song or four minutes were played
+func ScrobbleSong(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	songID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的歌曲ID", err)
+		return
+	}
+
+	var req model.ScrobbleRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+			return
+		}
+	}
+
+	if req.Submission != nil && !*req.Submission {
+		if err := playHistoryService.SetNowPlaying(userID, songID, req.Client); err != nil {
+			errorHandler.HandleNotFound(c, err.Error())
+			return
+		}
+		errorHandler.HandleOK(c, gin.H{
+			"now_playing": playHistoryService.NowPlaying(userID),
+		})
+		return
+	}
+
+	var startedAt time.Time
+	if req.StartedAt != nil {
+		startedAt = *req.StartedAt
+	}
+	event, err := playHistoryService.Scrobble(userID, songID, startedAt, req.PlayedMs, req.Client)
+	if err != nil {
+		errorHandler.HandleNotFound(c, err.Error())
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"event": event,
+	})
+}
+
+// GetRecentlyPlayed returns the songs the current user played most recently, one entry per song
+func GetRecentlyPlayed(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	page, limit, offset := parsePagination(c, 20, 100)
+	songs, total, err := playHistoryService.ListRecent(userID, limit, offset)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取最近播放失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"songs":       songs,
+		"now_playing": playHistoryService.NowPlaying(userID),
+		"pagination":  paginationInfo(page, limit, total),
+	})
+}
+
+// GetPlayHistory returns the current user's play events, newest first
+func GetPlayHistory(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	page, limit, offset := parsePagination(c, 50, 200)
+	events, total, err := playHistoryService.ListHistory(userID, limit, offset)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取播放记录失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"history":    events,
+		"pagination": paginationInfo(page, limit, total),
+	})
+}
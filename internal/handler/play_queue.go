@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"errors"
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var playQueueService *services.PlayQueueService
+
+// InitPlayQueueHandler 初始化播放队列处理器
+func InitPlayQueueHandler(service *services.PlayQueueService) {
+	playQueueService = service
+	utils.NewLogger().Info("Play queue handler initialized")
+}
+
+// GetPlayQueue returns the current user's play queue
+func GetPlayQueue(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	queue, err := playQueueService.GetQueue(userID)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取播放队列失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"queue": queue,
+	})
+}
+
+// UpdatePlayQueue saves the play queue; fields omitted from the request are left unchanged
+func UpdatePlayQueue(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	var req model.UpdatePlayQueueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	queue, err := playQueueService.ReplaceQueue(userID, req)
+	respondPlayQueue(c, userID, queue, err)
+}
+
+// EnqueueSongs appends songs to the end of the play queue
+func EnqueueSongs(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	var req model.QueueSongsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	queue, err := playQueueService.EnqueueSongs(userID, req.Version, req.SongIDs, req.Device)
+	respondPlayQueue(c, userID, queue, err)
+}
+
+// PlayNextSongs inserts songs right after the current song
+func PlayNextSongs(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	var req model.QueueSongsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	queue, err := playQueueService.PlayNext(userID, req.Version, req.SongIDs, req.Device)
+	respondPlayQueue(c, userID, queue, err)
+}
+
+// MoveQueueItem moves a song within the play queue
+func MoveQueueItem(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	var req model.MoveQueueItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	queue, err := playQueueService.MoveSong(userID, req.Version, *req.From, *req.To, req.Device)
+	respondPlayQueue(c, userID, queue, err)
+}
+
+// ClearPlayQueue removes all songs from the play queue
+func ClearPlayQueue(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	var req model.ClearQueueRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+			return
+		}
+	}
+
+	queue, err := playQueueService.ClearQueue(userID, req.Version, req.Device)
+	respondPlayQueue(c, userID, queue, err)
+}
+
+// respondPlayQueue 返回修改后的播放队列
+// 版本冲突时返回 409 和服务端当前的队列，客户端据此合并后重试
+func respondPlayQueue(c *gin.Context, userID int, queue *model.PlayQueue, err error) {
+	if errors.Is(err, services.ErrQueueVersionConflict) {
+		current, _ := playQueueService.GetQueue(userID)
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "播放队列已被其他设备修改",
+			"queue": current,
+		})
+		return
+	}
+	if err != nil {
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"queue": queue,
+	})
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
+	"io"
 	"melogo/internal/middleware"
 	"melogo/internal/model"
 	"melogo/internal/services"
 	"melogo/internal/utils"
+	"mime"
+	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -88,7 +92,7 @@ func UpdatePlaylist(c *gin.Context) {
 
 	err = playlistService.UpdatePlaylist(playlistID, userID, req.Name, req.IsPublic)
 	if err != nil {
-		errorHandler.HandleForbidden(c, err.Error())
+		handlePlaylistError(c, err)
 		return
 	}
 
@@ -111,7 +115,7 @@ func DeletePlaylist(c *gin.Context) {
 
 	err = playlistService.DeletePlaylist(playlistID, userID)
 	if err != nil {
-		errorHandler.HandleForbidden(c, err.Error())
+		handlePlaylistError(c, err)
 		return
 	}
 
@@ -120,6 +124,12 @@ func DeletePlaylist(c *gin.Context) {
 
 // AddSongToPlaylist 添加歌曲到播放列表
 func AddSongToPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
 	playlistID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
@@ -132,9 +142,9 @@ func AddSongToPlaylist(c *gin.Context) {
 		return
 	}
 
-	err = playlistService.AddSongToPlaylist(playlistID, req.SongID)
+	err = playlistService.AddSongToPlaylist(playlistID, userID, req.SongID)
 	if err != nil {
-		errorHandler.HandleBadRequest(c, err.Error(), err)
+		handlePlaylistError(c, err)
 		return
 	}
 
@@ -143,6 +153,12 @@ func AddSongToPlaylist(c *gin.Context) {
 
 // RemoveSongFromPlaylist 从播放列表移除歌曲
 func RemoveSongFromPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
 	playlistID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
@@ -155,26 +171,111 @@ func RemoveSongFromPlaylist(c *gin.Context) {
 		return
 	}
 
-	err = playlistService.RemoveSongFromPlaylist(playlistID, songID)
+	err = playlistService.RemoveSongFromPlaylist(playlistID, userID, songID)
 	if err != nil {
-		errorHandler.HandleBadRequest(c, err.Error(), err)
+		handlePlaylistError(c, err)
 		return
 	}
 
 	errorHandler.HandleOK(c, model.SuccessResponse{Message: "移除成功"})
 }
 
+// EditPlaylistSongs 移动、插入、批量添加或批量移除播放列表中的歌曲
+func EditPlaylistSongs(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	var req model.EditPlaylistSongsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	changed := 0
+	switch req.Action {
+	case model.PlaylistSongsMove:
+		if req.From == nil || req.To == nil {
+			errorHandler.HandleBadRequest(c, "参数错误: from 和 to 不能为空", nil)
+			return
+		}
+		err = playlistService.MovePlaylistSong(playlistID, userID, *req.From, *req.To)
+		changed = 1
+	case model.PlaylistSongsInsert, model.PlaylistSongsAdd:
+		if len(req.SongIDs) == 0 {
+			errorHandler.HandleBadRequest(c, "参数错误: song_ids 不能为空", nil)
+			return
+		}
+		index := -1
+		if req.Action == model.PlaylistSongsInsert {
+			if req.Index == nil || *req.Index < 0 {
+				errorHandler.HandleBadRequest(c, "参数错误: index 无效", nil)
+				return
+			}
+			index = *req.Index
+		}
+		changed, err = playlistService.AddSongsToPlaylist(playlistID, userID, index, req.SongIDs, req.AllowDuplicates)
+	case model.PlaylistSongsRemove:
+		if len(req.EntryIDs) == 0 && len(req.SongIDs) == 0 {
+			errorHandler.HandleBadRequest(c, "参数错误: entry_ids 或 song_ids 不能为空", nil)
+			return
+		}
+		changed, err = playlistService.RemovePlaylistSongs(playlistID, userID, req.EntryIDs, req.SongIDs)
+	}
+	if err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	songs, err := playlistService.GetPlaylistSongs(playlistID)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取播放列表歌曲失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"changed": changed,
+		"songs":   songs,
+	})
+}
+
+// handlePlaylistError 根据服务层返回的错误选择响应状态码
+func handlePlaylistError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPlaylistNotFound):
+		errorHandler.HandleNotFound(c, err.Error())
+	case errors.Is(err, services.ErrPlaylistForbidden):
+		errorHandler.HandleForbidden(c, err.Error())
+	default:
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+	}
+}
+
 // GetPlaylistDetail 获取播放列表详情（包含歌曲）
 func GetPlaylistDetail(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
 	playlistID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
 		return
 	}
 
-	playlist, err := playlistService.GetPlaylistByID(playlistID)
+	playlist, err := playlistService.GetPlaylistForUser(playlistID, userID)
 	if err != nil {
-		errorHandler.HandleNotFound(c, err.Error())
+		handlePlaylistError(c, err)
 		return
 	}
 
@@ -189,3 +290,271 @@ func GetPlaylistDetail(c *gin.Context) {
 		"songs":    songs,
 	})
 }
+
+// ListPublicPlaylists 浏览其他用户的公开播放列表（可选 q 按名称或用户名过滤）
+func ListPublicPlaylists(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	page, limit, offset := parsePagination(c, 20, 100)
+	playlists, total, err := playlistService.GetPublicPlaylists(userID, c.Query("q"), limit, offset)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取公开播放列表失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"playlists":  playlists,
+		"pagination": paginationInfo(page, limit, total),
+	})
+}
+
+// ListPlaylistCollaborators 获取播放列表的协作者
+func ListPlaylistCollaborators(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	collaborators, err := playlistService.GetCollaborators(playlistID, userID)
+	if err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"collaborators": collaborators,
+	})
+}
+
+// AddPlaylistCollaborator 授予其他用户修改播放列表歌曲的权限
+func AddPlaylistCollaborator(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	var req model.AddCollaboratorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	collaborator, err := userService.GetUserByUsername(req.Username)
+	if err != nil {
+		errorHandler.HandleNotFound(c, "用户不存在")
+		return
+	}
+
+	if err := playlistService.AddCollaborator(playlistID, userID, collaborator.ID); err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "添加成功"})
+}
+
+// RemovePlaylistCollaborator 移除协作者，协作者也可以移除自己以退出协作
+func RemovePlaylistCollaborator(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	collaboratorID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的用户ID", err)
+		return
+	}
+
+	if err := playlistService.RemoveCollaborator(playlistID, userID, collaboratorID); err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "移除成功"})
+}
+
+// FollowPlaylist 关注其他用户的公开播放列表
+func FollowPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	if err := playlistService.FollowPlaylist(playlistID, userID); err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "关注成功"})
+}
+
+// UnfollowPlaylist 取消关注播放列表
+func UnfollowPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	if err := playlistService.UnfollowPlaylist(playlistID, userID); err != nil {
+		errorHandler.HandleInternalServerError(c, "取消关注失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "已取消关注"})
+}
+
+// CopyPlaylist 将播放列表复制为当前用户的私有播放列表
+func CopyPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	var req model.CopyPlaylistRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+			return
+		}
+	}
+
+	playlist, err := playlistService.CopyPlaylist(playlistID, userID, req.Name)
+	if err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message":  "复制成功",
+		"playlist": playlist,
+	})
+}
+
+// maxPlaylistFileSize 导入的播放列表文件大小上限
+const maxPlaylistFileSize = 5 << 20
+
+// playlistContentTypes 导出格式对应的 Content-Type
+var playlistContentTypes = map[string]string{
+	services.PlaylistFormatM3U8: "audio/x-mpegurl; charset=utf-8",
+	services.PlaylistFormatPLS:  "audio/x-scpls; charset=utf-8",
+	services.PlaylistFormatXSPF: "application/xspf+xml; charset=utf-8",
+}
+
+// ExportPlaylist 将播放列表导出为 m3u8（默认）、pls 或 xspf 文件
+func ExportPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	format := c.DefaultQuery("format", services.PlaylistFormatM3U8)
+	contentType, ok := playlistContentTypes[format]
+	if !ok {
+		errorHandler.HandleBadRequest(c, "不支持的导出格式", nil)
+		return
+	}
+
+	playlist, data, err := playlistService.ExportPlaylist(playlistID, userID, format)
+	if err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": playlist.Name + "." + format}))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportPlaylist 上传 M3U/M3U8、PLS 或 XSPF 文件（表单字段 file，可选 name）创建播放列表
+// 返回创建的播放列表以及已匹配、有歧义和未找到的条目
+func ImportPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "请上传播放列表文件", err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxPlaylistFileSize+1))
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "读取文件失败", err)
+		return
+	}
+	if len(data) > maxPlaylistFileSize {
+		errorHandler.HandleBadRequest(c, "播放列表文件过大", nil)
+		return
+	}
+
+	playlist, report, err := playlistService.ImportPlaylist(userID, header.Filename, data, c.PostForm("name"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message":   "导入成功",
+		"playlist":  playlist,
+		"matched":   report.Matched,
+		"ambiguous": report.Ambiguous,
+		"missing":   report.Missing,
+	})
+}
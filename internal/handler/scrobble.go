@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var scrobbleService *services.ScrobbleService
+
+// InitScrobbleHandler 初始化外部播放记录服务处理器
+func InitScrobbleHandler(service *services.ScrobbleService) {
+	scrobbleService = service
+	utils.NewLogger().Info("Scrobble handler initialized")
+}
+
+// ListScrobbleAccounts returns the scrobbling services linked by the current user
+func ListScrobbleAccounts(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	accounts, err := scrobbleService.ListAccounts(userID)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取播放记录服务账号失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"accounts": accounts,
+	})
+}
+
+// LinkScrobbleAccount links or updates a scrobbling service account (listenbrainz or lastfm)
+func LinkScrobbleAccount(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	var req model.LinkScrobbleAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	account, err := scrobbleService.LinkAccount(userID, c.Param("provider"), req)
+	if err != nil {
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"account": account,
+	})
+}
+
+// UnlinkScrobbleAccount unlinks a scrobbling service account and discards its pending submissions
+func UnlinkScrobbleAccount(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	if err := scrobbleService.UnlinkAccount(userID, c.Param("provider")); err != nil {
+		errorHandler.HandleNotFound(c, err.Error())
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message": "已取消关联",
+	})
+}
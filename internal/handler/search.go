@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"melogo/internal/middleware"
 	"melogo/internal/services"
+	"melogo/internal/utils"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,33 +12,152 @@ import (
 // 使用music.go中定义的errorHandler，避免重复声明
 // var errorHandler = utils.NewErrorHandler()
 
+var searchService *services.SearchService
+
+// InitSearchHandler 初始化搜索处理器
+func InitSearchHandler(service *services.SearchService) {
+	searchService = service
+	utils.NewLogger().Info("Search handler initialized")
+}
+
 // Search searches for songs, artists, or albums
+// 三类结果分别按相关度排序，并使用相同的 limit 和 offset 分页
 func Search(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
 	query := c.Query("q")
 	if query == "" {
 		errorHandler.HandleOK(c, gin.H{
-			"songs": []interface{}{},
+			"songs":   []interface{}{},
+			"artists": []interface{}{},
+			"albums":  []interface{}{},
+			"total":   gin.H{"songs": 0, "artists": 0, "albums": 0},
+			"limit":   limit,
+			"offset":  offset,
 		})
 		return
 	}
 
-	songs, err := services.SearchSongs(query)
+	result, err := searchService.Search(query, limit, offset)
 	if err != nil {
 		errorHandler.HandleInternalServerError(c, "Failed to search songs", err)
 		return
 	}
 
+	// 只记录第一页的查询，翻页不重复记录
+	if userID, exists := middleware.GetCurrentUserID(c); exists && offset == 0 {
+		if err := searchService.RecordSearch(userID, query); err != nil {
+			utils.NewLogger().Errorf("Failed to record search history: %v", err)
+		}
+	}
+
 	errorHandler.HandleOK(c, gin.H{
-		"songs": songs,
+		"songs":   result.Songs,
+		"artists": result.Artists,
+		"albums":  result.Albums,
+		"total": gin.H{
+			"songs":   result.SongTotal,
+			"artists": result.ArtistTotal,
+			"albums":  result.AlbumTotal,
+		},
+		"limit":  limit,
+		"offset": offset,
 	})
 }
 
 // GetSearchHistory returns the user's search history
 func GetSearchHistory(c *gin.Context) {
-	// TODO: Implement get search history logic
-	history := []string{"song1", "artist1", "album1"}
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 50 {
+		limit = 20
+	}
+
+	history, err := searchService.GetSearchHistory(userID, limit)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取搜索记录失败", err)
+		return
+	}
 
 	errorHandler.HandleOK(c, gin.H{
 		"history": history,
 	})
 }
+
+// DeleteSearchHistory deletes one entry from the user's search history
+func DeleteSearchHistory(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的搜索记录ID", err)
+		return
+	}
+
+	if err := searchService.DeleteSearchHistory(userID, id); err != nil {
+		errorHandler.HandleNotFound(c, err.Error())
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message": "搜索记录已删除",
+	})
+}
+
+// ClearSearchHistory clears the user's search history
+func ClearSearchHistory(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	if err := searchService.ClearSearchHistory(userID); err != nil {
+		errorHandler.HandleInternalServerError(c, "清空搜索记录失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message": "搜索记录已清空",
+	})
+}
+
+// SearchSuggest returns search suggestions mixing the user's recent queries with popular library terms
+func SearchSuggest(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	suggestions, err := searchService.Suggest(userID, c.Query("q"), limit)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取搜索建议失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"suggestions": suggestions,
+	})
+}
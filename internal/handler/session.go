@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var sessionService *services.SessionService
+
+// InitSessionHandler 初始化登录会话处理器
+func InitSessionHandler(service *services.SessionService) {
+	sessionService = service
+	utils.NewLogger().Info("Session handler initialized")
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func RefreshToken(c *gin.Context) {
+	var req model.RefreshTokenRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorHandler.HandleBadRequest(c, "请求参数错误: "+err.Error(), err)
+			return
+		}
+	}
+
+	// 未在请求体中提供时使用Cookie中的刷新令牌
+	fromCookie := req.RefreshToken == ""
+	if fromCookie {
+		req.RefreshToken, _ = c.Cookie(middleware.RefreshCookieName)
+	}
+
+	tokens, err := sessionService.Refresh(req.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			if fromCookie {
+				middleware.ClearAuthCookies(c)
+			}
+			errorHandler.HandleUnauthorized(c, err.Error())
+			return
+		}
+		errorHandler.HandleInternalServerError(c, "刷新令牌失败", err)
+		return
+	}
+
+	if fromCookie {
+		middleware.SetAuthCookies(c, tokens)
+	}
+	errorHandler.HandleOK(c, tokens)
+}
+
+// ListSessions 获取当前用户已登录的设备
+func ListSessions(c *gin.Context) {
+	claims, exists := middleware.GetTokenClaims(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	sessions, err := sessionService.ListSessions(claims.UserID, claims.SessionID)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取登录会话失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"sessions": sessions,
+	})
+}
+
+// RevokeSession 退出指定设备上的登录
+func RevokeSession(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的会话ID", err)
+		return
+	}
+
+	if err := sessionService.RevokeSession(userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			errorHandler.HandleNotFound(c, err.Error())
+			return
+		}
+		errorHandler.HandleInternalServerError(c, "退出登录失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "已退出该设备"})
+}
+
+// RevokeAllSessions 退出所有设备上的登录（包括当前设备）
+func RevokeAllSessions(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	if err := sessionService.RevokeUserSessions(userID); err != nil {
+		errorHandler.HandleInternalServerError(c, "退出登录失败", err)
+		return
+	}
+
+	middleware.ClearAuthCookies(c)
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "已退出所有设备"})
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var smartPlaylistService *services.SmartPlaylistService
+
+// InitSmartPlaylistHandler 初始化智能播放列表处理器
+func InitSmartPlaylistHandler(service *services.SmartPlaylistService) {
+	smartPlaylistService = service
+	utils.NewLogger().Info("Smart playlist handler initialized")
+}
+
+// ListSmartPlaylists 获取当前用户的智能播放列表
+func ListSmartPlaylists(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlists, err := smartPlaylistService.GetUserSmartPlaylists(userID)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取智能播放列表失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"playlists": playlists,
+	})
+}
+
+// CreateSmartPlaylist 创建智能播放列表
+func CreateSmartPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	var req model.SmartPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	playlist, err := smartPlaylistService.CreateSmartPlaylist(userID, &req)
+	if err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message":  "创建成功",
+		"playlist": playlist,
+	})
+}
+
+// GetSmartPlaylist 获取智能播放列表定义
+func GetSmartPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	playlist, err := smartPlaylistService.GetSmartPlaylistForUser(playlistID, userID)
+	if err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"playlist": playlist,
+	})
+}
+
+// GetSmartPlaylistDetail 获取智能播放列表详情（包含按规则生成的歌曲）
+func GetSmartPlaylistDetail(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	playlist, err := smartPlaylistService.GetSmartPlaylistForUser(playlistID, userID)
+	if err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	songs, err := smartPlaylistService.GetSmartPlaylistSongs(playlist)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取智能播放列表歌曲失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"playlist": playlist,
+		"songs":    songs,
+	})
+}
+
+// UpdateSmartPlaylist 更新智能播放列表
+func UpdateSmartPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	var req model.SmartPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "参数错误: "+err.Error(), err)
+		return
+	}
+
+	playlist, err := smartPlaylistService.UpdateSmartPlaylist(playlistID, userID, &req)
+	if err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	errorHandler.HandleOK(c, gin.H{
+		"message":  "更新成功",
+		"playlist": playlist,
+	})
+}
+
+// DeleteSmartPlaylist 删除智能播放列表
+func DeleteSmartPlaylist(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的播放列表ID", err)
+		return
+	}
+
+	err = smartPlaylistService.DeleteSmartPlaylist(playlistID, userID)
+	if err != nil {
+		handlePlaylistError(c, err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "删除成功"})
+}
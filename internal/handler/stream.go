@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var songTranscoder *services.Transcoder
+
+// InitStreamHandler 初始化音频流处理器
+func InitStreamHandler(t *services.Transcoder) {
+	songTranscoder = t
+	utils.NewLogger().Info("Stream handler initialized")
+}
+
+// streamSong 根据请求的格式和码率输出歌曲，必要时进行转码
+// formatName 为空表示由服务器决定，"raw" 表示始终输出原始文件；maxBitRate 为0表示客户端不限制；
+// estimateLength 为 true 时未缓存的转码输出按估算大小设置Content-Length
+func streamSong(c *gin.Context, song *model.Song, formatName string, maxBitRate int, estimateLength bool) {
+	filePath, err := services.ResolveMusicPath(song.FilePath)
+	if err != nil {
+		errorHandler.HandleForbidden(c, "Invalid audio file path")
+		return
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		errorHandler.HandleNotFound(c, "Audio file not found")
+		return
+	}
+
+	userID, _ := middleware.GetCurrentUserID(c)
+	format, bitRate, err := resolveTranscode(userID, song, info.Size(), formatName, maxBitRate)
+	if err != nil {
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+		return
+	}
+	if format == nil {
+		serveSongFile(c, song)
+		return
+	}
+
+	serveTranscodedSong(c, song, filePath, info, *format, bitRate, estimateLength)
+}
+
+// resolveTranscode 计算实际的输出格式和码率，返回nil表示无需转码
+// 码率上限取客户端请求值与用户默认值中较小的一个
+func resolveTranscode(userID int, song *model.Song, fileSize int64, formatName string, maxBitRate int) (*services.TranscodeFormat, int, error) {
+	formatName = strings.ToLower(formatName)
+	if formatName == "raw" || songTranscoder == nil {
+		return nil, 0, nil
+	}
+
+	bitRateCap := maxBitRate
+	if user, err := userService.GetUserByID(userID); err == nil && user.MaxBitRate > 0 {
+		if bitRateCap == 0 || user.MaxBitRate < bitRateCap {
+			bitRateCap = user.MaxBitRate
+		}
+	}
+
+	// 源文件码率（kbps），扫描时未读到码率则按文件大小估算
+	sourceBitRate := song.BitRate
+	if sourceBitRate == 0 && song.Duration > 0 {
+		sourceBitRate = int(fileSize * 8 / int64(song.Duration) / 1000)
+	}
+
+	if formatName == "" {
+		// 未指定格式时，仅在源文件超出码率上限时转码
+		if bitRateCap == 0 || sourceBitRate <= bitRateCap {
+			return nil, 0, nil
+		}
+		formatName = songTranscoder.DefaultFormat()
+	}
+
+	format, ok := services.GetTranscodeFormat(formatName)
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported transcode format: %s", formatName)
+	}
+	if !songTranscoder.CanTranscode(format.Name) {
+		utils.NewLogger().Warningf("No transcode command configured for %s, serving original file", format.Name)
+		return nil, 0, nil
+	}
+
+	bitRate := format.DefaultBitRate
+	if bitRateCap > 0 {
+		bitRate = bitRateCap
+	}
+	if bitRate < 32 {
+		bitRate = 32
+	}
+
+	// 源文件已经是目标格式且码率不超过目标码率，无需转码
+	if strings.EqualFold(filepath.Ext(song.FilePath), format.Extension) && sourceBitRate > 0 && sourceBitRate <= bitRate {
+		return nil, 0, nil
+	}
+
+	return &format, bitRate, nil
+}
+
+// serveTranscodedSong 输出转码后的音频
+// 缓存命中时与原始文件一样支持Range请求；未命中时边转码边以分块传输输出，
+// 客户端要求估算长度时按码率和时长设置Content-Length
+func serveTranscodedSong(c *gin.Context, song *model.Song, filePath string, info os.FileInfo, format services.TranscodeFormat, bitRate int, estimateLength bool) {
+	key := songTranscoder.CacheKey(song.ID, format, bitRate, info.ModTime())
+	name := strings.TrimSuffix(filepath.Base(song.FilePath), filepath.Ext(song.FilePath)) + format.Extension
+
+	if cachedPath, ok := songTranscoder.Lookup(key); ok {
+		if file, err := os.Open(cachedPath); err == nil {
+			defer file.Close()
+			if cachedInfo, err := file.Stat(); err == nil {
+				serveAudioContent(c, file, name, format.ContentType, cachedInfo.Size(), info.ModTime())
+				return
+			}
+		}
+	}
+
+	stream, err := songTranscoder.Transcode(c.Request.Context(), filePath, format, bitRate, key)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "Failed to transcode audio", err)
+		return
+	}
+
+	c.Header("Content-Type", format.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	c.Header("Accept-Ranges", "none")
+	c.Header("Cache-Control", "private, no-store")
+
+	estimated := int64(0)
+	if estimateLength && song.Duration > 0 {
+		estimated = services.EstimateTranscodedSize(song.Duration, bitRate)
+		c.Header("Content-Length", strconv.FormatInt(estimated, 10))
+	}
+	c.Status(http.StatusOK)
+
+	if c.Request.Method == http.MethodHead {
+		stream.Abort()
+		stream.Close()
+		return
+	}
+
+	if estimated == 0 {
+		if _, err := io.Copy(c.Writer, stream); err != nil {
+			stream.Abort()
+		}
+	} else {
+		// 实际输出超出估算大小时截断，不足时补零，保证与Content-Length一致；
+		// 截断的部分仍会读完并写入缓存，之后的请求使用准确的大小
+		written, err := io.CopyN(c.Writer, stream, estimated)
+		if err != nil && err != io.EOF {
+			stream.Abort()
+		} else if written < estimated {
+			if err := writeZeros(c.Writer, estimated-written); err != nil {
+				stream.Abort()
+			}
+		}
+	}
+
+	if err := stream.Close(); err != nil {
+		utils.NewLogger().Errorf("Transcoding song %d failed: %v", song.ID, err)
+	}
+}
+
+// writeZeros 写入n个零字节
+func writeZeros(w io.Writer, n int64) error {
+	buf := make([]byte, 32*1024)
+	for n > 0 {
+		chunk := int64(len(buf))
+		if n < chunk {
+			chunk = n
+		}
+		if _, err := w.Write(buf[:chunk]); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// serveSongFile 输出歌曲音频文件，支持Range分段请求和条件请求
+func serveSongFile(c *gin.Context, song *model.Song) {
+	// 构建完整的文件路径（拒绝跳出音乐目录的路径）
+	filePath, err := services.ResolveMusicPath(song.FilePath)
+	if err != nil {
+		errorHandler.HandleForbidden(c, "Invalid audio file path")
+		return
+	}
+
+	// 只允许输出配置中允许的音频格式
+	contentType, ok := streamContentType(filePath)
+	if !ok {
+		errorHandler.HandleNotFound(c, "Unsupported audio format")
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		errorHandler.HandleNotFound(c, "Audio file not found")
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		errorHandler.HandleNotFound(c, "Audio file not found")
+		return
+	}
+
+	serveAudioContent(c, file, filepath.Base(song.FilePath), contentType, info.Size(), info.ModTime())
+}
+
+// serveAudioContent 输出音频内容
+// http.ServeContent 负责处理 Range/If-Range/If-None-Match/If-Modified-Since，
+// 并返回 200、206、304 或 416
+func serveAudioContent(c *gin.Context, content io.ReadSeeker, name, contentType string, size int64, modTime time.Time) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	c.Header("ETag", audioETag(size, modTime))
+	c.Header("Cache-Control", "private, max-age=86400")
+
+	http.ServeContent(c.Writer, c.Request, name, modTime, content)
+}
+
+// audioETag 根据文件大小和修改时间生成强ETag
+func audioETag(size int64, modTime time.Time) string {
+	return fmt.Sprintf(`"%x-%x"`, size, modTime.UnixNano())
+}
+
+// streamContentType 返回允许格式对应的Content-Type，不在MusicConfig.AllowedFormats中的格式返回false
+func streamContentType(filePath string) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for _, format := range appConfig.Music.AllowedFormats {
+		if strings.ToLower(format) == ext {
+			return utils.AudioContentType(filePath), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,1154 @@
+package handler
+
+import (
+	"errors"
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// subsonicIgnoredArticles 建立索引时忽略的冠词
+const subsonicIgnoredArticles = "The El La Los Las Le Les"
+
+// SubsonicPing 检查服务器是否可用
+func SubsonicPing(c *gin.Context) {
+	utils.SendSubsonic(c, utils.NewSubsonicResponse())
+}
+
+// SubsonicGetLicense 返回授权信息（始终有效）
+func SubsonicGetLicense(c *gin.Context) {
+	resp := utils.NewSubsonicResponse()
+	resp.License = &model.SubsonicLicense{Valid: true}
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetOpenSubsonicExtensions 返回支持的OpenSubsonic扩展
+func SubsonicGetOpenSubsonicExtensions(c *gin.Context) {
+	resp := utils.NewSubsonicResponse()
+	resp.OpenSubsonicExtensions = []model.SubsonicExtension{
+		{Name: "songLyrics", Versions: []int{1}},
+		{Name: "formPost", Versions: []int{1}},
+		{Name: "apiKeyAuthentication", Versions: []int{1}},
+	}
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetMusicFolders 返回音乐目录（仅一个）
+func SubsonicGetMusicFolders(c *gin.Context) {
+	resp := utils.NewSubsonicResponse()
+	resp.MusicFolders = &model.SubsonicMusicFolders{
+		Folders: []model.SubsonicMusicFolder{{ID: 1, Name: "Music"}},
+	}
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetIndexes 按首字母返回艺术家索引（基于目录结构的浏览方式）
+func SubsonicGetIndexes(c *gin.Context) {
+	indexes, err := subsonicArtistIndexes()
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get artists")
+		return
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.Indexes = &model.SubsonicIndexes{
+		LastModified:    time.Now().UnixMilli(),
+		IgnoredArticles: subsonicIgnoredArticles,
+		Index:           indexes,
+	}
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetArtists 按首字母返回艺术家索引（基于ID3标签的浏览方式）
+func SubsonicGetArtists(c *gin.Context) {
+	indexes, err := subsonicArtistIndexes()
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get artists")
+		return
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.Artists = &model.SubsonicArtists{
+		IgnoredArticles: subsonicIgnoredArticles,
+		Index:           indexes,
+	}
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetArtist 返回艺术家及其专辑
+func SubsonicGetArtist(c *gin.Context) {
+	artist, ok := subsonicFindArtist(c, utils.SubsonicParam(c, "id"))
+	if !ok {
+		return
+	}
+
+	starredAlbums := subsonicStarredItems(c, model.FavoriteAlbum)
+	result := &model.SubsonicArtistWithAlbums{SubsonicArtist: subsonicArtist(artist.Artist)}
+	if starredAt, ok := subsonicStarredItems(c, model.FavoriteArtist)[artist.ID]; ok {
+		result.Starred = subsonicStarredTime(starredAt)
+	}
+	for _, album := range artist.Albums {
+		entry := subsonicAlbum(album)
+		if starredAt, ok := starredAlbums[album.ID]; ok {
+			entry.Starred = subsonicStarredTime(starredAt)
+		}
+		result.Albums = append(result.Albums, entry)
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.Artist = result
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetAlbum 返回专辑及其歌曲
+func SubsonicGetAlbum(c *gin.Context) {
+	album, ok := subsonicFindAlbum(c, utils.SubsonicParam(c, "id"))
+	if !ok {
+		return
+	}
+
+	starred := subsonicStarredSongs(c)
+	result := &model.SubsonicAlbumWithSongs{SubsonicAlbum: subsonicAlbum(album.Album)}
+	if starredAt, ok := subsonicStarredItems(c, model.FavoriteAlbum)[album.ID]; ok {
+		result.Starred = subsonicStarredTime(starredAt)
+	}
+	for i := range album.Songs {
+		result.Songs = append(result.Songs, subsonicSong(&album.Songs[i], starred))
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.Album = result
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetMusicDirectory 返回目录内容：艺术家目录包含专辑，专辑目录包含歌曲
+func SubsonicGetMusicDirectory(c *gin.Context) {
+	id := utils.SubsonicParam(c, "id")
+	resp := utils.NewSubsonicResponse()
+
+	switch {
+	case strings.HasPrefix(id, "ar-"):
+		artist, ok := subsonicFindArtist(c, id)
+		if !ok {
+			return
+		}
+
+		directory := &model.SubsonicDirectory{ID: id, Name: artist.Name}
+		for _, album := range artist.Albums {
+			child := model.SubsonicChild{
+				ID:     subsonicAlbumID(album.ID),
+				Parent: id,
+				IsDir:  true,
+				Title:  album.Name,
+				Album:  album.Name,
+				Artist: album.Artist,
+			}
+			if album.CoverSongID != nil {
+				child.CoverArt = child.ID
+			}
+			directory.Children = append(directory.Children, child)
+		}
+		resp.Directory = directory
+
+	case strings.HasPrefix(id, "al-"):
+		album, ok := subsonicFindAlbum(c, id)
+		if !ok {
+			return
+		}
+
+		starred := subsonicStarredSongs(c)
+		directory := &model.SubsonicDirectory{ID: id, Parent: subsonicArtistID(album.ArtistID), Name: album.Name}
+		for i := range album.Songs {
+			directory.Children = append(directory.Children, subsonicSong(&album.Songs[i], starred))
+		}
+		resp.Directory = directory
+
+	default:
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Directory not found")
+		return
+	}
+
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetSong 返回单首歌曲信息
+func SubsonicGetSong(c *gin.Context) {
+	song, ok := subsonicFindSong(c, utils.SubsonicParam(c, "id"))
+	if !ok {
+		return
+	}
+
+	child := subsonicSong(song, subsonicStarredSongs(c))
+	resp := utils.NewSubsonicResponse()
+	resp.Song = &child
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicStream 输出歌曲音频，支持 format、maxBitRate 和 estimateContentLength 转码参数
+func SubsonicStream(c *gin.Context) {
+	song, ok := subsonicFindSong(c, utils.SubsonicParam(c, "id"))
+	if !ok {
+		return
+	}
+
+	streamSong(c, song, utils.SubsonicParam(c, "format"), subsonicIntParam(c, "maxBitRate", 0),
+		utils.SubsonicParam(c, "estimateContentLength") == "true")
+}
+
+// SubsonicDownload 输出原始音频文件
+func SubsonicDownload(c *gin.Context) {
+	song, ok := subsonicFindSong(c, utils.SubsonicParam(c, "id"))
+	if !ok {
+		return
+	}
+
+	serveSongFile(c, song)
+}
+
+// SubsonicGetCoverArt 输出歌曲或专辑封面
+func SubsonicGetCoverArt(c *gin.Context) {
+	id := utils.SubsonicParam(c, "id")
+
+	var coverImage *string
+	if strings.HasPrefix(id, "al-") {
+		album, ok := subsonicFindAlbum(c, id)
+		if !ok {
+			return
+		}
+		if album.CoverSongID != nil {
+			if song, err := services.GetSongByID(*album.CoverSongID); err == nil {
+				coverImage = song.CoverImage
+			}
+		}
+	} else {
+		song, ok := subsonicFindSong(c, id)
+		if !ok {
+			return
+		}
+		coverImage = song.CoverImage
+	}
+
+	if coverImage == nil || *coverImage == "" {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Cover art not found")
+		return
+	}
+
+	coverPath, err := services.ResolveMusicPath(*coverImage)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Cover art not found")
+		return
+	}
+	if _, err := os.Stat(coverPath); os.IsNotExist(err) {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Cover art not found")
+		return
+	}
+
+	c.File(coverPath)
+}
+
+// SubsonicGetLyrics 根据艺术家和标题返回歌词
+func SubsonicGetLyrics(c *gin.Context) {
+	artist := utils.SubsonicParam(c, "artist")
+	title := utils.SubsonicParam(c, "title")
+
+	resp := utils.NewSubsonicResponse()
+	resp.Lyrics = &model.SubsonicLyrics{Artist: artist, Title: title}
+
+	if title != "" {
+		songs, err := services.GlobalMusicScanner.SearchSongsPaged(title, 50, 0)
+		if err == nil {
+			for i := range songs {
+				if !strings.EqualFold(songs[i].Title, title) {
+					continue
+				}
+				if artist != "" && !strings.EqualFold(songs[i].Artist, artist) {
+					continue
+				}
+				resp.Lyrics.Artist = songs[i].Artist
+				resp.Lyrics.Title = songs[i].Title
+				resp.Lyrics.Value = subsonicStripLRC(readSongLyrics(&songs[i]))
+				break
+			}
+		}
+	}
+
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetLyricsBySongID 返回结构化（可能带时间轴）的歌词
+func SubsonicGetLyricsBySongID(c *gin.Context) {
+	song, ok := subsonicFindSong(c, utils.SubsonicParam(c, "id"))
+	if !ok {
+		return
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.LyricsList = &model.SubsonicLyricsList{}
+
+	if lyrics := readSongLyrics(song); lyrics != "" {
+		lines, synced := subsonicParseLRC(lyrics)
+		resp.LyricsList.StructuredLyrics = []model.SubsonicStructuredLyrics{{
+			DisplayArtist: song.Artist,
+			DisplayTitle:  song.Title,
+			Lang:          "xxx",
+			Synced:        synced,
+			Lines:         lines,
+		}}
+	}
+
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicSearch3 搜索艺术家、专辑和歌曲，空查询返回全部（用于客户端同步曲库）
+func SubsonicSearch3(c *gin.Context) {
+	query := strings.Trim(utils.SubsonicParam(c, "query"), `"`)
+	query = strings.TrimSuffix(query, "*")
+
+	artistCount := subsonicIntParam(c, "artistCount", 20)
+	artistOffset := subsonicIntParam(c, "artistOffset", 0)
+	albumCount := subsonicIntParam(c, "albumCount", 20)
+	albumOffset := subsonicIntParam(c, "albumOffset", 0)
+	songCount := subsonicIntParam(c, "songCount", 20)
+	songOffset := subsonicIntParam(c, "songOffset", 0)
+
+	result := &model.SubsonicSearchResult3{}
+
+	if artistCount > 0 {
+		artists, _, err := libraryService.ListArtists(query, artistCount, artistOffset)
+		if err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to search artists")
+			return
+		}
+		for _, artist := range artists {
+			result.Artists = append(result.Artists, subsonicArtist(artist))
+		}
+	}
+
+	if albumCount > 0 {
+		albums, _, err := libraryService.ListAlbums(query, 0, "name", albumCount, albumOffset)
+		if err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to search albums")
+			return
+		}
+		for _, album := range albums {
+			result.Albums = append(result.Albums, subsonicAlbum(album))
+		}
+	}
+
+	if songCount > 0 {
+		songs, err := services.GlobalMusicScanner.SearchSongsPaged(query, songCount, songOffset)
+		if err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to search songs")
+			return
+		}
+		starred := subsonicStarredSongs(c)
+		for i := range songs {
+			result.Songs = append(result.Songs, subsonicSong(&songs[i], starred))
+		}
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.SearchResult3 = result
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetPlaylists 返回当前用户的播放列表
+func SubsonicGetPlaylists(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	playlists, err := playlistService.GetUserPlaylists(userID)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get playlists")
+		return
+	}
+
+	result := &model.SubsonicPlaylists{}
+	for _, playlist := range playlists {
+		songs, err := playlistService.GetPlaylistSongs(playlist.ID)
+		if err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get playlist songs")
+			return
+		}
+		result.Playlists = append(result.Playlists, subsonicPlaylist(playlist, songs))
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.Playlists = result
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicGetPlaylist 返回播放列表及其歌曲
+func SubsonicGetPlaylist(c *gin.Context) {
+	playlistID, err := strconv.Atoi(utils.SubsonicParam(c, "id"))
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrMissingParameter, "Required parameter is missing: id")
+		return
+	}
+
+	sendSubsonicPlaylist(c, playlistID)
+}
+
+// SubsonicCreatePlaylist 创建播放列表；传入playlistId时替换已有播放列表的歌曲
+func SubsonicCreatePlaylist(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+	songIDs := subsonicIntParams(c, "songId")
+
+	if idStr := utils.SubsonicParam(c, "playlistId"); idStr != "" {
+		playlistID, err := strconv.Atoi(idStr)
+		if err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Playlist not found")
+			return
+		}
+		if _, ok := subsonicEditablePlaylist(c, playlistID, userID); !ok {
+			return
+		}
+
+		if err := playlistService.ReplacePlaylistSongs(playlistID, userID, songIDs); err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, err.Error())
+			return
+		}
+		sendSubsonicPlaylist(c, playlistID)
+		return
+	}
+
+	name := utils.SubsonicParam(c, "name")
+	if name == "" {
+		utils.SendSubsonicError(c, model.SubsonicErrMissingParameter, "Required parameter is missing: name")
+		return
+	}
+	playlist, err := playlistService.CreatePlaylist(userID, name, false)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, err.Error())
+		return
+	}
+
+	// Subsonic 允许播放列表包含重复的歌曲
+	if len(songIDs) > 0 {
+		if _, err := playlistService.AddSongsToPlaylist(playlist.ID, userID, -1, songIDs, true); err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, err.Error())
+			return
+		}
+	}
+
+	sendSubsonicPlaylist(c, playlist.ID)
+}
+
+// SubsonicUpdatePlaylist 更新播放列表名称、公开状态及歌曲
+func SubsonicUpdatePlaylist(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	playlistID, err := strconv.Atoi(utils.SubsonicParam(c, "playlistId"))
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrMissingParameter, "Required parameter is missing: playlistId")
+		return
+	}
+
+	playlist, ok := subsonicEditablePlaylist(c, playlistID, userID)
+	if !ok {
+		return
+	}
+
+	name := playlist.Name
+	if value := utils.SubsonicParam(c, "name"); value != "" {
+		name = value
+	}
+	isPublic := playlist.IsPublic
+	if value := utils.SubsonicParam(c, "public"); value != "" {
+		isPublic = value == "true"
+	}
+	if name != playlist.Name || isPublic != playlist.IsPublic {
+		if err := playlistService.UpdatePlaylist(playlistID, userID, name, isPublic); err != nil {
+			// 协作者只能修改歌曲
+			if errors.Is(err, services.ErrPlaylistForbidden) {
+				utils.SendSubsonicError(c, model.SubsonicErrNotAuthorized, "Permission denied for playlist")
+				return
+			}
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, err.Error())
+			return
+		}
+	}
+
+	// 先按索引移除，再追加新歌曲
+	if indexes := subsonicIntParams(c, "songIndexToRemove"); len(indexes) > 0 {
+		entries, err := playlistService.GetPlaylistSongs(playlistID)
+		if err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get playlist songs")
+			return
+		}
+		var entryIDs []int
+		for _, index := range indexes {
+			if index >= 0 && index < len(entries) {
+				entryIDs = append(entryIDs, entries[index].ID)
+			}
+		}
+		if _, err := playlistService.RemovePlaylistSongs(playlistID, userID, entryIDs, nil); err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, err.Error())
+			return
+		}
+	}
+
+	if songIDs := subsonicIntParams(c, "songIdToAdd"); len(songIDs) > 0 {
+		if _, err := playlistService.AddSongsToPlaylist(playlistID, userID, -1, songIDs, true); err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, err.Error())
+			return
+		}
+	}
+
+	utils.SendSubsonic(c, utils.NewSubsonicResponse())
+}
+
+// SubsonicDeletePlaylist 删除播放列表
+func SubsonicDeletePlaylist(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	playlistID, err := strconv.Atoi(utils.SubsonicParam(c, "id"))
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrMissingParameter, "Required parameter is missing: id")
+		return
+	}
+
+	if err := playlistService.DeletePlaylist(playlistID, userID); err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrNotAuthorized, err.Error())
+		return
+	}
+
+	utils.SendSubsonic(c, utils.NewSubsonicResponse())
+}
+
+// SubsonicStar 收藏歌曲、专辑（albumId）或艺术家（artistId）
+func SubsonicStar(c *gin.Context) {
+	subsonicSetStarred(c, true)
+}
+
+// SubsonicUnstar 取消收藏歌曲、专辑或艺术家
+func SubsonicUnstar(c *gin.Context) {
+	subsonicSetStarred(c, false)
+}
+
+// subsonicSetStarred 收藏或取消收藏请求中的全部对象
+// id 通常为歌曲ID，按目录浏览的客户端也会传入 al-/ar- 前缀的专辑或艺术家ID
+func subsonicSetStarred(c *gin.Context, loved bool) {
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	type starItem struct {
+		itemType string
+		itemID   int
+	}
+	var items []starItem
+	for _, param := range []struct{ key, itemType string }{
+		{"id", model.FavoriteSong},
+		{"albumId", model.FavoriteAlbum},
+		{"artistId", model.FavoriteArtist},
+	} {
+		for _, value := range subsonicParams(c, param.key) {
+			itemType, itemID, ok := subsonicStarTarget(value, param.itemType)
+			if !ok {
+				utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Item not found: "+value)
+				return
+			}
+			items = append(items, starItem{itemType: itemType, itemID: itemID})
+		}
+	}
+
+	for _, item := range items {
+		if err := favoriteService.SetLoved(userID, item.itemType, item.itemID, loved); err != nil {
+			if errors.Is(err, services.ErrFavoriteItemNotFound) {
+				utils.SendSubsonicError(c, model.SubsonicErrNotFound, err.Error())
+				return
+			}
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, err.Error())
+			return
+		}
+	}
+
+	utils.SendSubsonic(c, utils.NewSubsonicResponse())
+}
+
+// subsonicStarTarget 将收藏请求中的ID解析为收藏类型和对象ID，带 al-/ar- 前缀时按前缀判断类型
+func subsonicStarTarget(value, defaultType string) (string, int, bool) {
+	if id, ok := subsonicEntityID(value, "al-"); ok {
+		return model.FavoriteAlbum, id, true
+	}
+	if id, ok := subsonicEntityID(value, "ar-"); ok {
+		return model.FavoriteArtist, id, true
+	}
+	// albumId 和 artistId 也接受不带前缀的实体ID
+	id, err := strconv.Atoi(value)
+	return defaultType, id, err == nil && id > 0
+}
+
+// SubsonicGetStarred2 返回收藏的艺术家、专辑和歌曲
+func SubsonicGetStarred2(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+	result := &model.SubsonicStarred2{}
+
+	artists, _, err := favoriteService.ListFavorites(userID, services.FavoriteListOptions{Type: model.FavoriteArtist, Limit: -1})
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get favorites")
+		return
+	}
+	for _, fav := range artists {
+		if fav.Artist == nil || fav.Artist.SongCount == 0 {
+			continue
+		}
+		artist := subsonicArtist(*fav.Artist)
+		artist.Starred = subsonicStarredTime(*fav.LovedAt)
+		result.Artists = append(result.Artists, artist)
+	}
+
+	albums, _, err := favoriteService.ListFavorites(userID, services.FavoriteListOptions{Type: model.FavoriteAlbum, Limit: -1})
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get favorites")
+		return
+	}
+	for _, fav := range albums {
+		if fav.Album == nil {
+			continue
+		}
+		album := subsonicAlbum(*fav.Album)
+		album.Starred = subsonicStarredTime(*fav.LovedAt)
+		result.Albums = append(result.Albums, album)
+	}
+
+	favorites, err := favoriteService.GetLovedItems(userID, model.FavoriteSong)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get favorites")
+		return
+	}
+	starred := subsonicStarredSongs(c)
+	for _, fav := range favorites {
+		song, err := services.GetSongByID(fav.ItemID)
+		if err != nil || song.IsDeleted == 1 || song.IsMissing == 1 {
+			continue
+		}
+		result.Songs = append(result.Songs, subsonicSong(song, starred))
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.Starred2 = result
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicScrobble 记录播放，submission=false 表示正在播放的通知
+// 提交的播放视为完整播放；time 为播放开始时间（毫秒时间戳），与 id 按顺序对应
+func SubsonicScrobble(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+	client := utils.SubsonicParam(c, "c")
+	times := append(c.QueryArray("time"), c.PostFormArray("time")...)
+
+	for i, songID := range subsonicIntParams(c, "id") {
+		var err error
+		if utils.SubsonicParam(c, "submission") == "false" {
+			err = playHistoryService.SetNowPlaying(userID, songID, client)
+		} else {
+			var startedAt time.Time
+			if i < len(times) {
+				if ms, err := strconv.ParseInt(times[i], 10, 64); err == nil && ms > 0 {
+					startedAt = time.UnixMilli(ms)
+				}
+			}
+			_, err = playHistoryService.Scrobble(userID, songID, startedAt, nil, client)
+		}
+		if err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to scrobble")
+			return
+		}
+	}
+
+	utils.SendSubsonic(c, utils.NewSubsonicResponse())
+}
+
+// SubsonicGetPlayQueue 获取保存的播放队列
+func SubsonicGetPlayQueue(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+	username, _ := middleware.GetCurrentUsername(c)
+
+	queue, err := playQueueService.GetQueue(userID)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get play queue")
+		return
+	}
+
+	result := &model.SubsonicPlayQueue{
+		Position:  queue.PositionMs,
+		Username:  username,
+		Changed:   queue.UpdatedAt,
+		ChangedBy: queue.Device,
+	}
+	if queue.CurrentIndex >= 0 {
+		result.Current = strconv.Itoa(queue.SongIDs[queue.CurrentIndex])
+	}
+	starred := subsonicStarredSongs(c)
+	for i := range queue.Songs {
+		result.Entries = append(result.Entries, subsonicSongInfo(&queue.Songs[i], starred))
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.PlayQueue = result
+	utils.SendSubsonic(c, resp)
+}
+
+// SubsonicSavePlayQueue 保存播放队列；current为当前歌曲ID，position为毫秒
+// Subsonic客户端不携带版本号，以最后一次保存为准
+func SubsonicSavePlayQueue(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+	songIDs := subsonicIntParams(c, "id")
+
+	currentIndex := 0
+	if current, err := strconv.Atoi(utils.SubsonicParam(c, "current")); err == nil {
+		for i, songID := range songIDs {
+			if songID == current {
+				currentIndex = i
+				break
+			}
+		}
+	}
+	position := 0
+	if ms, err := strconv.Atoi(utils.SubsonicParam(c, "position")); err == nil && ms > 0 {
+		position = ms
+	}
+
+	req := model.UpdatePlayQueueRequest{
+		SongIDs:      songIDs,
+		CurrentIndex: &currentIndex,
+		PositionMs:   &position,
+		Device:       utils.SubsonicParam(c, "c"),
+	}
+	if _, err := playQueueService.ReplaceQueue(userID, req); err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, err.Error())
+		return
+	}
+
+	utils.SendSubsonic(c, utils.NewSubsonicResponse())
+}
+
+// sendSubsonicPlaylist 输出播放列表详情
+func sendSubsonicPlaylist(c *gin.Context, playlistID int) {
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	playlist, err := playlistService.GetPlaylistForUser(playlistID, userID)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Playlist not found")
+		return
+	}
+
+	entries, err := playlistService.GetPlaylistSongs(playlistID)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to get playlist songs")
+		return
+	}
+
+	starred := subsonicStarredSongs(c)
+	result := &model.SubsonicPlaylistWithEntries{SubsonicPlaylist: subsonicPlaylist(playlist, entries)}
+	for _, entry := range entries {
+		song, err := services.GetSongByID(entry.SongID)
+		if err != nil {
+			continue
+		}
+		result.Entries = append(result.Entries, subsonicSong(song, starred))
+	}
+
+	resp := utils.NewSubsonicResponse()
+	resp.Playlist = result
+	utils.SendSubsonic(c, resp)
+}
+
+// subsonicEditablePlaylist 获取当前用户可以修改的播放列表（所有者或协作者），失败时已输出错误响应
+func subsonicEditablePlaylist(c *gin.Context, playlistID, userID int) (*services.Playlist, bool) {
+	playlist, err := playlistService.GetPlaylistForUser(playlistID, userID)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Playlist not found")
+		return nil, false
+	}
+	if !playlist.CanEdit() {
+		utils.SendSubsonicError(c, model.SubsonicErrNotAuthorized, "Permission denied for playlist")
+		return nil, false
+	}
+	return playlist, true
+}
+
+// subsonicPlaylist 将播放列表转换为Subsonic格式
+func subsonicPlaylist(playlist *services.Playlist, entries []*services.PlaylistSong) model.SubsonicPlaylist {
+	duration := 0
+	for _, entry := range entries {
+		duration += entry.Duration
+	}
+	return model.SubsonicPlaylist{
+		ID:        strconv.Itoa(playlist.ID),
+		Name:      playlist.Name,
+		Owner:     playlist.OwnerName,
+		Public:    playlist.IsPublic,
+		SongCount: len(entries),
+		Duration:  duration,
+		Created:   playlist.CreatedAt,
+		Changed:   playlist.UpdatedAt,
+	}
+}
+
+// subsonicArtistIndexes 获取所有艺术家并按首字母分组
+func subsonicArtistIndexes() ([]model.SubsonicIndex, error) {
+	artists, _, err := libraryService.ListArtists("", -1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]model.SubsonicArtist)
+	var names []string
+	for _, artist := range artists {
+		key := subsonicIndexKey(artist.Name)
+		if _, ok := groups[key]; !ok {
+			names = append(names, key)
+		}
+		groups[key] = append(groups[key], subsonicArtist(artist))
+	}
+	sort.Strings(names)
+
+	indexes := make([]model.SubsonicIndex, 0, len(names))
+	for _, name := range names {
+		indexes = append(indexes, model.SubsonicIndex{Name: name, Artists: groups[name]})
+	}
+	return indexes, nil
+}
+
+// subsonicIndexKey 返回艺术家所属的索引字母，忽略常见冠词
+func subsonicIndexKey(name string) string {
+	trimmed := name
+	for _, article := range strings.Fields(subsonicIgnoredArticles) {
+		if strings.HasPrefix(strings.ToLower(trimmed), strings.ToLower(article)+" ") {
+			trimmed = trimmed[len(article)+1:]
+			break
+		}
+	}
+
+	for _, r := range trimmed {
+		if unicode.IsLetter(r) && r < unicode.MaxASCII {
+			return strings.ToUpper(string(r))
+		}
+		break
+	}
+	return "#"
+}
+
+// subsonicFindArtist 根据 ar- 前缀的ID查找艺术家及其专辑，失败时已输出错误响应
+func subsonicFindArtist(c *gin.Context, id string) (*model.ArtistDetail, bool) {
+	if id == "" {
+		utils.SendSubsonicError(c, model.SubsonicErrMissingParameter, "Required parameter is missing: id")
+		return nil, false
+	}
+
+	artistID, ok := subsonicEntityID(id, "ar-")
+	if !ok {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Artist not found")
+		return nil, false
+	}
+	artist, err := libraryService.GetArtist(artistID)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Artist not found")
+		return nil, false
+	}
+	return artist, true
+}
+
+// subsonicFindAlbum 根据 al- 前缀的ID查找专辑及其歌曲，失败时已输出错误响应
+func subsonicFindAlbum(c *gin.Context, id string) (*model.AlbumDetail, bool) {
+	if id == "" {
+		utils.SendSubsonicError(c, model.SubsonicErrMissingParameter, "Required parameter is missing: id")
+		return nil, false
+	}
+
+	albumID, ok := subsonicEntityID(id, "al-")
+	if !ok {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Album not found")
+		return nil, false
+	}
+	album, err := libraryService.GetAlbum(albumID)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Album not found")
+		return nil, false
+	}
+	return album, true
+}
+
+// subsonicFindSong 根据ID查找歌曲，失败时已输出错误响应
+func subsonicFindSong(c *gin.Context, id string) (*model.Song, bool) {
+	if id == "" {
+		utils.SendSubsonicError(c, model.SubsonicErrMissingParameter, "Required parameter is missing: id")
+		return nil, false
+	}
+
+	songID, err := strconv.Atoi(id)
+	if err != nil {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Song not found")
+		return nil, false
+	}
+
+	song, err := services.GetSongByID(songID)
+	if err != nil || song.IsDeleted == 1 {
+		utils.SendSubsonicError(c, model.SubsonicErrNotFound, "Song not found")
+		return nil, false
+	}
+	return song, true
+}
+
+// subsonicStarredSongs 获取当前用户收藏的歌曲及收藏时间
+func subsonicStarredSongs(c *gin.Context) map[int]time.Time {
+	return subsonicStarredItems(c, model.FavoriteSong)
+}
+
+// subsonicStarredItems 获取当前用户收藏的某类对象及收藏时间
+func subsonicStarredItems(c *gin.Context, itemType string) map[int]time.Time {
+	starred := make(map[int]time.Time)
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		return starred
+	}
+
+	favorites, err := favoriteService.GetLovedItems(userID, itemType)
+	if err != nil {
+		return starred
+	}
+	for _, fav := range favorites {
+		starred[fav.ItemID] = *fav.LovedAt
+	}
+	return starred
+}
+
+// subsonicArtist 将艺术家转换为Subsonic格式
+func subsonicArtist(artist model.Artist) model.SubsonicArtist {
+	return model.SubsonicArtist{
+		ID:         subsonicArtistID(artist.ID),
+		Name:       artist.Name,
+		AlbumCount: artist.AlbumCount,
+	}
+}
+
+// subsonicAlbum 将专辑转换为Subsonic格式
+func subsonicAlbum(album model.Album) model.SubsonicAlbum {
+	result := model.SubsonicAlbum{
+		ID:        subsonicAlbumID(album.ID),
+		Name:      album.Name,
+		Artist:    album.Artist,
+		ArtistID:  subsonicArtistID(album.ArtistID),
+		SongCount: album.SongCount,
+		Duration:  album.Duration,
+		Created:   album.CreatedAt,
+	}
+	if album.CoverSongID != nil {
+		result.CoverArt = result.ID
+	}
+	return result
+}
+
+// subsonicSong 将歌曲转换为Subsonic格式
+func subsonicSong(song *model.Song, starred map[int]time.Time) model.SubsonicChild {
+	child := model.SubsonicChild{
+		ID:          strconv.Itoa(song.ID),
+		Title:       song.Title,
+		Album:       song.Album,
+		Artist:      song.Artist,
+		ContentType: utils.AudioContentType(song.FilePath),
+		Size:        song.FileSize,
+		Suffix:      strings.TrimPrefix(strings.ToLower(filepath.Ext(song.FilePath)), "."),
+		Duration:    song.Duration,
+		BitRate:     song.BitRate,
+		Track:       song.TrackNumber,
+		DiscNumber:  song.DiscNumber,
+		Year:        song.Year,
+		Genre:       song.Genre,
+		Path:        filepath.ToSlash(song.FilePath),
+		PlayCount:   song.PlayCount,
+		Type:        "music",
+		MediaType:   "song",
+
+		BPM:           song.BPM,
+		SamplingRate:  song.SampleRate,
+		ChannelCount:  song.Channels,
+		MusicBrainzID: song.MusicBrainzRecordingID,
+	}
+
+	if !song.CreatedAt.IsZero() {
+		created := song.CreatedAt
+		child.Created = &created
+	}
+	if song.AlbumID != nil {
+		child.AlbumID = subsonicAlbumID(*song.AlbumID)
+		child.Parent = child.AlbumID
+	}
+	if song.ArtistID != nil {
+		child.ArtistID = subsonicArtistID(*song.ArtistID)
+	}
+	if song.CoverImage != nil && *song.CoverImage != "" {
+		child.CoverArt = child.ID
+	}
+	if starredAt, ok := starred[song.ID]; ok {
+		child.Starred = subsonicStarredTime(starredAt)
+	}
+
+	return child
+}
+
+// subsonicSongInfo 将歌曲列表项转换为Subsonic格式，列表项不包含播放次数和添加时间
+func subsonicSongInfo(song *model.SongInfo, starred map[int]time.Time) model.SubsonicChild {
+	return subsonicSong(&model.Song{
+		ID:         song.ID,
+		Title:      song.Title,
+		Artist:     song.Artist,
+		Album:      song.Album,
+		ArtistID:   song.ArtistID,
+		AlbumID:    song.AlbumID,
+		Duration:   song.Duration,
+		FilePath:   song.FilePath,
+		FileSize:   song.FileSize,
+		CoverImage: song.CoverImage,
+		IsDeleted:  song.IsDeleted,
+		UpdatedAt:  song.UpdatedAt,
+		SongTags:   song.SongTags,
+	}, starred)
+}
+
+// subsonicStarredTime 格式化收藏时间
+func subsonicStarredTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// subsonicArtistID 根据艺术家实体ID生成Subsonic ID
+func subsonicArtistID(id int) string {
+	return "ar-" + strconv.Itoa(id)
+}
+
+// subsonicAlbumID 根据专辑实体ID生成Subsonic ID
+func subsonicAlbumID(id int) string {
+	return "al-" + strconv.Itoa(id)
+}
+
+// subsonicEntityID 解析带前缀的Subsonic ID，返回实体ID
+func subsonicEntityID(id, prefix string) (int, bool) {
+	if !strings.HasPrefix(id, prefix) {
+		return 0, false
+	}
+	entityID, err := strconv.Atoi(strings.TrimPrefix(id, prefix))
+	if err != nil || entityID <= 0 {
+		return 0, false
+	}
+	return entityID, true
+}
+
+// readSongLyrics 读取歌曲的歌词文件，不存在时返回空字符串
+func readSongLyrics(song *model.Song) string {
+	if song.LyricsPath == nil || *song.LyricsPath == "" {
+		return ""
+	}
+
+	lyricsPath, err := services.ResolveMusicPath(*song.LyricsPath)
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(lyricsPath)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// lrcTimestampPattern 匹配LRC时间标签，如 [01:23.45]
+var lrcTimestampPattern = regexp.MustCompile(`\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+
+// lrcMetadataPattern 匹配LRC元信息标签，如 [ar:Artist]
+var lrcMetadataPattern = regexp.MustCompile(`^\[[a-zA-Z]+:.*\]$`)
+
+// subsonicParseLRC 解析LRC歌词，返回按时间排序的歌词行及是否带时间轴
+func subsonicParseLRC(text string) ([]model.SubsonicLyricsLine, bool) {
+	var lines []model.SubsonicLyricsLine
+	synced := false
+
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || lrcMetadataPattern.MatchString(raw) {
+			continue
+		}
+
+		matches := lrcTimestampPattern.FindAllStringSubmatch(raw, -1)
+		content := strings.TrimSpace(lrcTimestampPattern.ReplaceAllString(raw, ""))
+		if len(matches) == 0 {
+			lines = append(lines, model.SubsonicLyricsLine{Value: content})
+			continue
+		}
+
+		synced = true
+		for _, match := range matches {
+			minutes, _ := strconv.ParseInt(match[1], 10, 64)
+			seconds, _ := strconv.ParseInt(match[2], 10, 64)
+			var millis int64
+			if match[3] != "" {
+				fraction := match[3]
+				for len(fraction) < 3 {
+					fraction += "0"
+				}
+				millis, _ = strconv.ParseInt(fraction, 10, 64)
+			}
+			start := minutes*60000 + seconds*1000 + millis
+			lines = append(lines, model.SubsonicLyricsLine{Start: &start, Value: content})
+		}
+	}
+
+	if synced {
+		// 未带时间标签的行在带时间轴的歌词中没有意义
+		filtered := lines[:0]
+		for _, line := range lines {
+			if line.Start != nil {
+				filtered = append(filtered, line)
+			}
+		}
+		lines = filtered
+		sort.SliceStable(lines, func(i, j int) bool { return *lines[i].Start < *lines[j].Start })
+	}
+
+	return lines, synced
+}
+
+// subsonicStripLRC 去掉LRC时间标签，返回纯文本歌词
+func subsonicStripLRC(text string) string {
+	lines, _ := subsonicParseLRC(text)
+	values := make([]string, 0, len(lines))
+	for _, line := range lines {
+		values = append(values, line.Value)
+	}
+	return strings.Join(values, "\n")
+}
+
+// subsonicIntParam 读取整数参数，缺失或非法时返回默认值
+func subsonicIntParam(c *gin.Context, key string, defaultValue int) int {
+	value, err := strconv.Atoi(utils.SubsonicParam(c, key))
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// subsonicParams 读取可重复出现的参数（如 id=1&id=2）
+func subsonicParams(c *gin.Context, key string) []string {
+	return append(c.QueryArray(key), c.PostFormArray(key)...)
+}
+
+// subsonicIntParams 读取可重复出现的整数参数（如 id=1&id=2）
+func subsonicIntParams(c *gin.Context, key string) []int {
+	values := subsonicParams(c, key)
+	result := make([]int, 0, len(values))
+	for _, value := range values {
+		if id, err := strconv.Atoi(value); err == nil {
+			result = append(result, id)
+		}
+	}
+	return result
+}
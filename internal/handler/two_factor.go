@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"errors"
+	"melogo/internal/middleware"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var twoFactorService *services.TwoFactorService
+
+// InitTwoFactorHandler 初始化两步验证处理器
+func InitTwoFactorHandler(service *services.TwoFactorService) {
+	twoFactorService = service
+	utils.NewLogger().Info("Two-factor handler initialized")
+}
+
+// LoginTwoFactor 登录第二步：使用预认证令牌和验证码（或恢复码）完成登录；
+// 管理员被要求设置两步验证时，该验证码同时确认新密钥并返回恢复码
+func LoginTwoFactor(c *gin.Context) {
+	var req model.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "请求参数错误: "+err.Error(), err)
+		return
+	}
+
+	userID, setup, err := twoFactorService.Challenge(req.PreAuthToken)
+	if err != nil {
+		handleTwoFactorError(c, "登录失败", err)
+		return
+	}
+	user, err := userService.GetUserByID(userID)
+	if err != nil {
+		handleTwoFactorError(c, "登录失败", services.ErrInvalidPreAuthToken)
+		return
+	}
+
+	if loginThrottled(c, user.Username) {
+		return
+	}
+
+	var recoveryCodes []string
+	if setup {
+		recoveryCodes, err = twoFactorService.Enable(userID, req.Code)
+	} else {
+		err = twoFactorService.Verify(userID, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			twoFactorService.ChallengeFailed(req.PreAuthToken)
+			recordLoginFailure(c, user.Username)
+		}
+		handleTwoFactorError(c, "登录失败", err)
+		return
+	}
+
+	// 预认证令牌只能使用一次
+	if err := twoFactorService.CompleteChallenge(req.PreAuthToken); err != nil {
+		handleTwoFactorError(c, "登录失败", err)
+		return
+	}
+
+	completeLogin(c, user, recoveryCodes)
+}
+
+// LoginTwoFactorSetup 管理员被要求设置两步验证时，使用预认证令牌生成密钥和二维码
+func LoginTwoFactorSetup(c *gin.Context) {
+	var req model.PreAuthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "请求参数错误: "+err.Error(), err)
+		return
+	}
+
+	userID, setup, err := twoFactorService.Challenge(req.PreAuthToken)
+	if err != nil {
+		handleTwoFactorError(c, "生成两步验证密钥失败", err)
+		return
+	}
+	if !setup {
+		handleTwoFactorError(c, "生成两步验证密钥失败", services.ErrTwoFactorAlreadyEnabled)
+		return
+	}
+
+	setupInfo, err := twoFactorService.BeginSetup(userID)
+	if err != nil {
+		handleTwoFactorError(c, "生成两步验证密钥失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, setupInfo)
+}
+
+// GetTwoFactorStatus 获取当前用户的两步验证状态
+func GetTwoFactorStatus(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	status, err := twoFactorService.Status(userID)
+	if err != nil {
+		handleTwoFactorError(c, "获取两步验证状态失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, status)
+}
+
+// BeginTwoFactorSetup 生成新的 TOTP 密钥、otpauth URI 和二维码
+func BeginTwoFactorSetup(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	setupInfo, err := twoFactorService.BeginSetup(userID)
+	if err != nil {
+		handleTwoFactorError(c, "生成两步验证密钥失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, setupInfo)
+}
+
+// EnableTwoFactor 使用验证码确认密钥并启用两步验证，返回只显示一次的恢复码
+func EnableTwoFactor(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+
+	var req model.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "请求参数错误: "+err.Error(), err)
+		return
+	}
+
+	codes, err := twoFactorService.Enable(userID, req.Code)
+	if err != nil {
+		handleTwoFactorError(c, "启用两步验证失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, model.RecoveryCodesResponse{
+		Message:       "两步验证已启用，请妥善保存恢复码，之后将无法再次查看",
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableTwoFactor 验证当前密码和验证码后关闭两步验证
+func DisableTwoFactor(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+	username, _ := middleware.GetCurrentUsername(c)
+
+	var req model.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "请求参数错误: "+err.Error(), err)
+		return
+	}
+
+	if loginThrottled(c, username) {
+		return
+	}
+
+	if err := twoFactorService.Disable(userID, req.Password, req.Code); err != nil {
+		if errors.Is(err, services.ErrWrongPassword) || errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			recordLoginFailure(c, username)
+		}
+		handleTwoFactorError(c, "关闭两步验证失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodes 验证验证码后重新生成恢复码，旧的恢复码全部失效
+func RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未登录")
+		return
+	}
+	username, _ := middleware.GetCurrentUsername(c)
+
+	var req model.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "请求参数错误: "+err.Error(), err)
+		return
+	}
+
+	if loginThrottled(c, username) {
+		return
+	}
+
+	codes, err := twoFactorService.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			recordLoginFailure(c, username)
+		}
+		handleTwoFactorError(c, "生成恢复码失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, model.RecoveryCodesResponse{
+		Message:       "已生成新的恢复码，旧的恢复码已失效",
+		RecoveryCodes: codes,
+	})
+}
+
+// AdminResetUserTwoFactor 管理员为丢失验证器的用户关闭两步验证
+func AdminResetUserTwoFactor(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errorHandler.HandleBadRequest(c, "无效的用户ID", err)
+		return
+	}
+
+	if err := twoFactorService.Reset(userID); err != nil {
+		handleAdminUserError(c, "重置两步验证失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "已关闭该用户的两步验证"})
+}
+
+// handleTwoFactorError 验证码或预认证令牌错误返回401，状态冲突返回409，其他请求错误返回400
+func handleTwoFactorError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrInvalidPreAuthToken):
+		errorHandler.HandleUnauthorized(c, err.Error())
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled), errors.Is(err, services.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorSetupNotStarted), errors.Is(err, services.ErrWrongPassword):
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		errorHandler.HandleForbidden(c, err.Error())
+	case errors.Is(err, services.ErrUserNotFound):
+		errorHandler.HandleNotFound(c, err.Error())
+	default:
+		errorHandler.HandleInternalServerError(c, message, err)
+	}
+}
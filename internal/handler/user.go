@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"melogo/internal/config"
 	"melogo/internal/i18n"
@@ -17,6 +18,7 @@ import (
 )
 
 var userService *services.UserService
+var loginThrottle *services.LoginThrottleService
 var appConfig *config.Config
 
 // 使用music.go中定义的errorHandler，避免重复声明
@@ -25,6 +27,7 @@ var appConfig *config.Config
 // InitUserHandler 初始化用户handler
 func InitUserHandler(cfg *config.Config) {
 	userService = services.NewUserService(services.DB)
+	loginThrottle = services.NewLoginThrottleService(cfg, services.DB)
 	appConfig = cfg
 }
 
@@ -73,27 +76,52 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// 同一用户名或IP连续登录失败过多时需要等待
+	if loginThrottled(c, req.Username) {
+		return
+	}
+
 	// 调用服务层验证用户
-	user, token, err := userService.Login(req.Username, req.Password)
+	user, err := userService.Login(req.Username, req.Password)
 	if err != nil {
+		if !errors.Is(err, services.ErrUserDisabled) {
+			recordLoginFailure(c, req.Username)
+		}
 		errorHandler.HandleUnauthorized(c, err.Error())
 		return
 	}
 
+	// 已启用两步验证，或管理员被要求启用两步验证时，先签发预认证令牌；
+	// 完成第二步之前不清零失败次数，避免借正确的密码无限次猜测验证码
+	if user.TwoFactorEnabled == 1 || twoFactorService.IsRequired(user) {
+		challenge, err := twoFactorService.CreateChallenge(user.ID, user.TwoFactorEnabled == 0)
+		if err != nil {
+			errorHandler.HandleInternalServerError(c, "登录失败", err)
+			return
+		}
+		errorHandler.HandleOK(c, challenge)
+		return
+	}
+
+	completeLogin(c, user, nil)
+}
+
+// completeLogin 创建登录会话，签发访问令牌和刷新令牌并返回用户信息
+func completeLogin(c *gin.Context, user *model.User, recoveryCodes []string) {
+	loginThrottle.RecordSuccess(user.Username)
+
+	tokens, err := sessionService.CreateSession(user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "登录失败", err)
+		return
+	}
+
 	// 设置Cookie
-	c.SetCookie(
-		"token", // name
-		token,   // value
-		3600*24, // maxAge (24小时)
-		"/",     // path
-		"",      // domain
-		false,   // secure
-		true,    // httpOnly
-	)
+	middleware.SetAuthCookies(c, tokens)
 
 	// 返回token和用户信息
 	errorHandler.HandleOK(c, model.LoginResponse{
-		Token: token,
+		TokenPair: *tokens,
 		User: &model.UserProfile{
 			ID:       user.ID,
 			Username: user.Username,
@@ -101,21 +129,140 @@ func Login(c *gin.Context) {
 			Avatar:   user.Avatar,
 			IsAdmin:  user.IsAdmin,
 		},
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// loginThrottled 用户名或IP处于退避或锁定期时返回429和 Retry-After
+func loginThrottled(c *gin.Context, username string) bool {
+	wait, err := loginThrottle.Check(username, c.ClientIP())
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "登录失败", err)
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	seconds := int(wait / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": fmt.Sprintf("登录失败次数过多，请在 %d 秒后重试", seconds),
+	})
+	return true
+}
+
+// recordLoginFailure 记录一次失败的登录
+func recordLoginFailure(c *gin.Context, username string) {
+	if err := loginThrottle.RecordFailure(username, c.ClientIP()); err != nil {
+		utils.NewLogger().Warningf("Failed to record login failure: %v", err)
+	}
+}
+
+// ChangePassword 验证当前密码后修改密码，并退出其他设备上的登录
+func ChangePassword(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未授权访问")
+		return
+	}
+	username, _ := middleware.GetCurrentUsername(c)
+
+	var req model.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorHandler.HandleBadRequest(c, "请求参数错误: "+err.Error(), err)
+		return
+	}
+
+	// 当前密码错误同样计入登录失败，避免借已登录的会话猜测密码
+	if loginThrottled(c, username) {
+		return
+	}
+
+	sessionID := 0
+	if claims, ok := middleware.GetTokenClaims(c); ok {
+		sessionID = claims.SessionID
+	}
+	err := userService.ChangePassword(userID, req.CurrentPassword, req.NewPassword, sessionID)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrWrongPassword):
+		recordLoginFailure(c, username)
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+		return
+	case errors.Is(err, utils.ErrWeakPassword):
+		errorHandler.HandleBadRequest(c, err.Error(), err)
+		return
+	default:
+		errorHandler.HandleInternalServerError(c, "修改密码失败", err)
+		return
+	}
+
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "密码已修改，其他设备已退出登录"})
+}
+
+// GetSubsonicPasswordStatus 获取当前用户是否已经生成 Subsonic 密码
+func GetSubsonicPasswordStatus(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未授权访问")
+		return
+	}
+
+	enabled, err := userService.HasSubsonicPassword(userID)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "获取Subsonic密码状态失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, model.SubsonicPasswordStatus{Enabled: enabled})
+}
+
+// GenerateSubsonicPassword 生成新的 Subsonic 密码，替换旧密码
+func GenerateSubsonicPassword(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未授权访问")
+		return
+	}
+
+	password, err := userService.GenerateSubsonicPassword(userID)
+	if err != nil {
+		errorHandler.HandleInternalServerError(c, "生成Subsonic密码失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, model.SubsonicPasswordResponse{
+		Message:  "已生成新的Subsonic密码，请妥善保存，之后将无法再次查看",
+		Password: password,
 	})
 }
 
+// DeleteSubsonicPassword 删除 Subsonic 密码，Subsonic 客户端之后只能使用API密钥
+func DeleteSubsonicPassword(c *gin.Context) {
+	userID, exists := middleware.GetCurrentUserID(c)
+	if !exists {
+		errorHandler.HandleUnauthorized(c, "未授权访问")
+		return
+	}
+
+	if err := userService.DeleteSubsonicPassword(userID); err != nil {
+		errorHandler.HandleInternalServerError(c, "删除Subsonic密码失败", err)
+		return
+	}
+	errorHandler.HandleOK(c, model.SuccessResponse{Message: "Subsonic密码已删除"})
+}
+
 // Logout handles user logout
 func Logout(c *gin.Context) {
+	// 吊销当前访问令牌和会话，之后刷新令牌也不能再使用
+	if claims, exists := middleware.GetTokenClaims(c); exists {
+		if err := sessionService.Logout(claims); err != nil {
+			errorHandler.HandleInternalServerError(c, "登出失败", err)
+			return
+		}
+	}
+
 	// 清除Cookie中的token
-	c.SetCookie(
-		"token", // name
-		"",      // value
-		-1,      // maxAge (立即过期)
-		"/",     // path
-		"",      // domain
-		false,   // secure
-		true,    // httpOnly
-	)
+	middleware.ClearAuthCookies(c)
 
 	errorHandler.HandleOK(c, model.SuccessResponse{
 		Message: "登出成功",
@@ -139,11 +286,12 @@ func GetUserProfile(c *gin.Context) {
 	}
 
 	errorHandler.HandleOK(c, model.UserProfile{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Avatar:   user.Avatar,
-		IsAdmin:  user.IsAdmin,
+		ID:         user.ID,
+		Username:   user.Username,
+		Email:      user.Email,
+		Avatar:     user.Avatar,
+		MaxBitRate: user.MaxBitRate,
+		IsAdmin:    user.IsAdmin,
 	})
 }
 
@@ -165,6 +313,19 @@ func UpdateUserProfile(c *gin.Context) {
 
 	email := c.PostForm("email")
 
+	// 更新默认的最大播放码率
+	if maxBitRateStr, ok := c.GetPostForm("max_bitrate"); ok {
+		maxBitRate, err := strconv.Atoi(maxBitRateStr)
+		if err != nil {
+			errorHandler.HandleBadRequest(c, "无效的码率", err)
+			return
+		}
+		if err := userService.UpdateMaxBitRate(userID, maxBitRate); err != nil {
+			errorHandler.HandleBadRequest(c, err.Error(), err)
+			return
+		}
+	}
+
 	// 处理头像上传
 	var avatarUpdated bool
 	file, _, err := c.Request.FormFile("avatar_file")
@@ -261,15 +422,17 @@ func LoginPage(c *gin.Context) {
 // RegisterPage 注册页面
 func RegisterPage(c *gin.Context) {
 	i18n.HTML(c, http.StatusOK, "register.html", gin.H{
-		"title":              "用户注册",
-		"allow_registration": appConfig.Auth.AllowRegistration,
+		"title":               "用户注册",
+		"allow_registration":  appConfig.Auth.AllowRegistration,
+		"password_min_length": utils.PasswordMinLength(),
 	})
 }
 
 // ProfilePage 用户信息页面
 func ProfilePage(c *gin.Context) {
 	i18n.HTML(c, http.StatusOK, "profile.html", gin.H{
-		"title": "个人信息",
-		"time":  time.Now().Format("2006-01-02 15:04:05"),
+		"title":               "个人信息",
+		"time":                time.Now().Format("2006-01-02 15:04:05"),
+		"password_min_length": utils.PasswordMinLength(),
 	})
 }
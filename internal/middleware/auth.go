@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"melogo/internal/model"
+	"melogo/internal/services"
 	"melogo/internal/utils"
 	"net/http"
 	"strings"
@@ -8,25 +10,52 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware JWT认证中间件
-func AuthMiddleware() gin.HandlerFunc {
+// Cookie names used by the web interface
+const (
+	TokenCookieName   = "token"
+	RefreshCookieName = "refresh_token"
+)
+
+// API key header and query parameter names
+const (
+	APIKeyHeader     = "X-API-Key"
+	APIKeyQueryParam = "api_key"
+)
+
+// AuthMiddleware JWT认证中间件，同时接受具有任一指定权限的API密钥
+// 未指定权限的路由只能通过登录会话访问
+func AuthMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := getAPIKeyFromRequest(c); key != "" {
+			authenticateAPIKey(c, key, scopes)
+			return
+		}
+
 		// 从请求头或Cookie中获取token
 		tokenString := getTokenFromRequest(c)
 
-		if tokenString == "" {
+		// 解析token
+		claims, err := utils.ParseToken(tokenString)
+		if err != nil && c.GetHeader("Authorization") == "" {
+			// 浏览器请求的访问令牌过期后使用刷新令牌Cookie自动续期
+			claims, err = refreshFromCookie(c)
+		}
+		if err != nil {
+			message := "Token无效或已过期"
+			if tokenString == "" {
+				message = "未授权访问，请先登录"
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "未授权访问，请先登录",
+				"error": message,
 			})
 			c.Abort()
 			return
 		}
 
-		// 解析token
-		claims, err := utils.ParseToken(tokenString)
-		if err != nil {
+		// 已退出登录、被吊销的会话以及被删除或禁用的用户即使持有未过期的token也不能访问
+		if err := services.GetSessionService().ValidateAccess(claims, c.ClientIP()); err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Token无效或已过期",
+				"error": services.ErrSessionRevoked.Error(),
 			})
 			c.Abort()
 			return
@@ -35,11 +64,75 @@ func AuthMiddleware() gin.HandlerFunc {
 		// 将用户信息存入上下文
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("token_claims", claims)
 
 		c.Next()
 	}
 }
 
+// authenticateAPIKey 使用API密钥认证，并检查密钥是否具有路由组要求的权限
+func authenticateAPIKey(c *gin.Context, key string, scopes []string) {
+	apiKey, username, err := services.GetAPIKeyService().Authenticate(key)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": services.ErrInvalidAPIKey.Error(),
+		})
+		c.Abort()
+		return
+	}
+	if !apiKey.HasScope(scopes...) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "API密钥没有访问该接口的权限",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", apiKey.UserID)
+	c.Set("username", username)
+	c.Set("api_key", apiKey)
+
+	c.Next()
+}
+
+// getAPIKeyFromRequest 从 X-API-Key 请求头或 api_key 查询参数中获取API密钥
+func getAPIKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	return c.Query(APIKeyQueryParam)
+}
+
+// refreshFromCookie 使用刷新令牌Cookie换取新的访问令牌并写回Cookie
+func refreshFromCookie(c *gin.Context) (*utils.Claims, error) {
+	refreshToken, err := c.Cookie(RefreshCookieName)
+	if err != nil || refreshToken == "" {
+		return nil, services.ErrInvalidRefreshToken
+	}
+
+	tokens, err := services.GetSessionService().Refresh(refreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		ClearAuthCookies(c)
+		return nil, err
+	}
+	SetAuthCookies(c, tokens)
+	return utils.ParseToken(tokens.Token)
+}
+
+// SetAuthCookies 将访问令牌和轮换后的刷新令牌写入Cookie
+func SetAuthCookies(c *gin.Context, tokens *model.TokenPair) {
+	c.SetCookie(TokenCookieName, tokens.Token, tokens.ExpiresIn, "/", "", false, true)
+	if tokens.RefreshToken != "" {
+		c.SetCookie(RefreshCookieName, tokens.RefreshToken, tokens.RefreshExpiresIn, "/", "", false, true)
+	}
+}
+
+// ClearAuthCookies 清除Cookie中的访问令牌和刷新令牌
+func ClearAuthCookies(c *gin.Context) {
+	c.SetCookie(TokenCookieName, "", -1, "/", "", false, true)
+	c.SetCookie(RefreshCookieName, "", -1, "/", "", false, true)
+}
+
 // getTokenFromRequest 从请求中提取token
 func getTokenFromRequest(c *gin.Context) string {
 	// 优先从Authorization header获取
@@ -52,14 +145,9 @@ func getTokenFromRequest(c *gin.Context) string {
 		}
 	}
 
-	// 从Cookie获取
-	token, err := c.Cookie("token")
-	if err == nil {
-		return token
-	}
-
-	// 从查询参数获取（可选）
-	return c.Query("token")
+	// 从Cookie获取；不再接受查询参数中的token，避免写入访问日志，脚本请使用API密钥
+	token, _ := c.Cookie(TokenCookieName)
+	return token
 }
 
 // GetCurrentUserID 从上下文中获取当前用户ID
@@ -79,3 +167,12 @@ func GetCurrentUsername(c *gin.Context) (string, bool) {
 	}
 	return username.(string), true
 }
+
+// GetTokenClaims 从上下文中获取当前访问令牌的claims
+func GetTokenClaims(c *gin.Context) (*utils.Claims, bool) {
+	claims, exists := c.Get("token_claims")
+	if !exists {
+		return nil, false
+	}
+	return claims.(*utils.Claims), true
+}
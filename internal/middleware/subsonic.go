@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"melogo/internal/model"
+	"melogo/internal/services"
+	"melogo/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubsonicAuthMiddleware Subsonic API认证中间件
+// 支持明文/hex编码的 Subsonic 密码（p=）、token+salt（t=&s=）以及 OpenSubsonic 的 apiKey 认证；
+// Subsonic 密码由用户在个人资料页面单独生成，不是账号密码；p= 也可以是该用户的API密钥（应用密码）。API密钥需要具有任一指定权限，未指定权限时不接受API密钥
+func SubsonicAuthMiddleware(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := utils.SubsonicParam(c, "u")
+		password := utils.SubsonicParam(c, "p")
+		token := utils.SubsonicParam(c, "t")
+		salt := utils.SubsonicParam(c, "s")
+
+		if key := utils.SubsonicParam(c, "apiKey"); key != "" {
+			if username != "" {
+				utils.SendSubsonicError(c, model.SubsonicErrConflictingAuth, "Multiple conflicting authentication mechanisms provided")
+				c.Abort()
+				return
+			}
+			apiKey, keyUsername, err := services.GetAPIKeyService().Authenticate(key)
+			if err != nil {
+				utils.SendSubsonicError(c, model.SubsonicErrInvalidAPIKey, "Invalid API key")
+				c.Abort()
+				return
+			}
+			setSubsonicAPIKeyUser(c, apiKey, keyUsername, scopes)
+			return
+		}
+
+		if username == "" || (password == "" && (token == "" || salt == "")) {
+			utils.SendSubsonicError(c, model.SubsonicErrMissingParameter, "Required parameter is missing")
+			c.Abort()
+			return
+		}
+
+		// 与网页登录共用失败计数，处于退避或锁定期时直接拒绝
+		wait, err := services.GetLoginThrottleService().Check(username, c.ClientIP())
+		if err != nil {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to check login attempts")
+			c.Abort()
+			return
+		}
+		if wait > 0 {
+			utils.SendSubsonicError(c, model.SubsonicErrGeneric, fmt.Sprintf("Too many failed login attempts, try again in %d seconds", int(wait/time.Second)))
+			c.Abort()
+			return
+		}
+
+		userService := services.NewUserService(services.DB)
+		user, err := userService.GetUserByUsername(username)
+		if err != nil {
+			subsonicLoginFailed(c, username)
+			return
+		}
+
+		if password != "" {
+			// 明文密码，或以 enc: 开头的hex编码密码
+			if strings.HasPrefix(password, "enc:") {
+				decoded, err := hex.DecodeString(strings.TrimPrefix(password, "enc:"))
+				if err != nil {
+					subsonicLoginFailed(c, username)
+					return
+				}
+				password = string(decoded)
+			}
+			plain, err := userService.GetSubsonicPassword(user.ID)
+			if err != nil && !errors.Is(err, services.ErrNoSubsonicPassword) {
+				utils.SendSubsonicError(c, model.SubsonicErrGeneric, "Failed to check password")
+				c.Abort()
+				return
+			}
+			if err != nil || subtle.ConstantTimeCompare([]byte(plain), []byte(password)) != 1 {
+				// 不是 Subsonic 密码时尝试作为该用户的API密钥
+				apiKey, keyUsername, keyErr := services.GetAPIKeyService().Authenticate(password)
+				if keyErr != nil || apiKey.UserID != user.ID {
+					subsonicLoginFailed(c, username)
+					return
+				}
+				setSubsonicAPIKeyUser(c, apiKey, keyUsername, scopes)
+				return
+			}
+		} else {
+			// token = md5(password + salt)
+			plain, err := userService.GetSubsonicPassword(user.ID)
+			if err != nil {
+				// 用户还没有生成 Subsonic 密码，无法校验 token，不计入失败次数
+				utils.SendSubsonicError(c, model.SubsonicErrWrongCredentials, "Wrong username or password")
+				c.Abort()
+				return
+			}
+			sum := md5.Sum([]byte(plain + salt))
+			expected := hex.EncodeToString(sum[:])
+			if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(token))) != 1 {
+				subsonicLoginFailed(c, username)
+				return
+			}
+		}
+
+		if user.IsDisabled == 1 {
+			utils.SendSubsonicError(c, model.SubsonicErrNotAuthorized, "User is disabled")
+			c.Abort()
+			return
+		}
+
+		// Subsonic 密码无法携带第二步验证码，启用两步验证的账号只能使用 API 密钥
+		if user.TwoFactorEnabled == 1 || services.GetTwoFactorService().IsRequired(user) {
+			utils.SendSubsonicError(c, model.SubsonicErrNotAuthorized, "Two-factor authentication is enabled, use an API key instead")
+			c.Abort()
+			return
+		}
+
+		// 将用户信息存入上下文，与JWT认证保持一致
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+
+		c.Next()
+	}
+}
+
+// subsonicLoginFailed 记录失败的登录并返回用户名或密码错误
+func subsonicLoginFailed(c *gin.Context, username string) {
+	if err := services.GetLoginThrottleService().RecordFailure(username, c.ClientIP()); err != nil {
+		utils.NewLogger().Warningf("Failed to record login failure: %v", err)
+	}
+	utils.SendSubsonicError(c, model.SubsonicErrWrongCredentials, "Wrong username or password")
+	c.Abort()
+}
+
+// setSubsonicAPIKeyUser 检查API密钥权限并将所属用户存入上下文
+func setSubsonicAPIKeyUser(c *gin.Context, apiKey *model.APIKey, username string, scopes []string) {
+	if !apiKey.HasScope(scopes...) {
+		utils.SendSubsonicError(c, model.SubsonicErrNotAuthorized, "API key is not authorized for this request")
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", apiKey.UserID)
+	c.Set("username", username)
+	c.Set("api_key", apiKey)
+
+	c.Next()
+}
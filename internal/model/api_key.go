@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+)
+
+// Scopes that can be granted to API keys
+const (
+	APIKeyScopeRead          = "read"
+	APIKeyScopeStream        = "stream"
+	APIKeyScopeLibraryWrite  = "library-write"
+	APIKeyScopePlaylistWrite = "playlist-write"
+	APIKeyScopeAdmin         = "admin"
+)
+
+// APIKeyScopes lists every API key scope
+var APIKeyScopes = []string{
+	APIKeyScopeRead, APIKeyScopeStream, APIKeyScopeLibraryWrite, APIKeyScopePlaylistWrite, APIKeyScopeAdmin,
+}
+
+// APIKey represents a named key a user creates for scripts and headless clients
+// Only a hash of the key is stored; Prefix identifies the key in listings
+type APIKey struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"-" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"key_prefix"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+}
+
+// HasScope reports whether the key grants any of the given scopes
+func (k *APIKey) HasScope(scopes ...string) bool {
+	for _, granted := range k.Scopes {
+		for _, scope := range scopes {
+			if granted == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest 创建API密钥请求
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=read stream library-write playlist-write admin"`
+}
@@ -4,21 +4,34 @@ import (
 	"time"
 )
 
-// Favorite represents a user's favorite song
+// Types of items that can be favorited or rated
+const (
+	FavoriteSong     = "song"
+	FavoriteAlbum    = "album"
+	FavoriteArtist   = "artist"
+	FavoritePlaylist = "playlist"
+)
+
+// Favorite represents a user's favorite or rating of a song, album, artist or playlist
+// LovedAt is nil when the item is only rated; Rating is 0 when the item is not rated
 type Favorite struct {
-	ID        int       `json:"id" db:"id"`
-	UserID    int       `json:"user_id" db:"user_id"`
-	SongID    int       `json:"song_id" db:"song_id"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"user_id" db:"user_id"`
+	ItemType  string     `json:"type" db:"item_type"`
+	ItemID    int        `json:"item_id" db:"item_id"`
+	Rating    int        `json:"rating" db:"rating"`
+	LovedAt   *time.Time `json:"loved_at,omitempty" db:"loved_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 }
 
-// FavoriteWithSong represents a favorite with song information
-type FavoriteWithSong struct {
-	Favorite
-	Song SongInfo `json:"song"`
+// AddFavoriteRequest 添加收藏请求，type 为空时收藏歌曲 song_id
+type AddFavoriteRequest struct {
+	Type   string `json:"type" binding:"omitempty,oneof=song album artist playlist"`
+	ID     int    `json:"id"`
+	SongID int    `json:"song_id"`
 }
 
-// AddFavoriteRequest 添加收藏请求
-type AddFavoriteRequest struct {
-	SongID int `json:"song_id" binding:"required"`
+// SetRatingRequest 设置评分请求，rating 为 0 表示清除评分
+type SetRatingRequest struct {
+	Rating int `json:"rating" binding:"min=0,max=5"`
 }
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+)
+
+// Artist represents an artist entity built from song and album artist tags
+type Artist struct {
+	ID         int    `json:"id" db:"id"`
+	Name       string `json:"name" db:"name"`
+	AlbumCount int    `json:"album_count"`
+	SongCount  int    `json:"song_count"`
+}
+
+// ArtistCredit represents one artist credited on a song
+type ArtistCredit struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"` // artist or album_artist
+}
+
+// Album represents an album entity, grouped by album name and album artist
+type Album struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	ArtistID    int       `json:"artist_id" db:"artist_id"`
+	Artist      string    `json:"artist"`
+	Year        int       `json:"year"`
+	SongCount   int       `json:"song_count"`
+	Duration    int       `json:"duration"` // Total duration in seconds
+	CoverSongID *int      `json:"cover_song_id,omitempty"`
+	CoverURL    string    `json:"cover_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ArtistDetail represents an artist with their albums and songs
+type ArtistDetail struct {
+	Artist
+	Albums []Album `json:"albums"`
+	Songs  []Song  `json:"songs"`
+}
+
+// AlbumDetail represents an album with its track list
+type AlbumDetail struct {
+	Album
+	Songs []Song `json:"songs"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+)
+
+// PlayEvent represents one playback of a song by a user
+// Completed is true when the play met the counting rule and was added to the play counts
+type PlayEvent struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	SongID    int       `json:"song_id" db:"song_id"`
+	StartedAt time.Time `json:"started_at" db:"started_at"`
+	PlayedMs  int       `json:"played_ms" db:"played_ms"`
+	Completed bool      `json:"completed" db:"completed"`
+	Client    string    `json:"client" db:"client"`
+	Song      *SongInfo `json:"song,omitempty"`
+}
+
+// RecentSong represents a song the user has played, with the user's own play count
+type RecentSong struct {
+	Song         SongInfo  `json:"song"`
+	PlayCount    int       `json:"play_count"`
+	LastPlayedAt time.Time `json:"last_played_at"`
+}
+
+// NowPlaying represents the song a user is currently playing
+type NowPlaying struct {
+	SongID    int       `json:"song_id"`
+	Client    string    `json:"client"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// ScrobbleRequest 播放上报请求
+// Submission 为 false 时表示开始播放（正在播放通知），默认为 true 表示提交一次播放；
+// PlayedMs 为实际播放的毫秒数，提交时省略表示完整播放
+type ScrobbleRequest struct {
+	Submission *bool      `json:"submission"`
+	StartedAt  *time.Time `json:"started_at"`
+	PlayedMs   *int       `json:"played_ms"`
+	Client     string     `json:"client"`
+}
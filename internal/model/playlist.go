@@ -45,3 +45,34 @@ type UpdatePlaylistRequest struct {
 type AddSongToPlaylistRequest struct {
 	SongID int `json:"song_id" binding:"required"`
 }
+
+// Playlist song edit actions
+const (
+	PlaylistSongsMove   = "move"
+	PlaylistSongsInsert = "insert"
+	PlaylistSongsAdd    = "add"
+	PlaylistSongsRemove = "remove"
+)
+
+// EditPlaylistSongsRequest 修改播放列表歌曲请求
+// move 使用 from/to；insert 在 index 位置插入 song_ids；add 将 song_ids 加到末尾；
+// remove 移除 entry_ids 指定的条目以及 song_ids 中歌曲的所有出现。位置均从 0 开始
+type EditPlaylistSongsRequest struct {
+	Action          string `json:"action" binding:"required,oneof=move insert add remove"`
+	From            *int   `json:"from"`
+	To              *int   `json:"to"`
+	Index           *int   `json:"index"`
+	SongIDs         []int  `json:"song_ids"`
+	EntryIDs        []int  `json:"entry_ids"`
+	AllowDuplicates bool   `json:"allow_duplicates"`
+}
+
+// AddCollaboratorRequest 添加播放列表协作者请求
+type AddCollaboratorRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// CopyPlaylistRequest 复制播放列表请求，Name 为空时沿用原名称
+type CopyPlaylistRequest struct {
+	Name string `json:"name"`
+}
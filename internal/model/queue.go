@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+)
+
+// Play queue repeat modes
+const (
+	RepeatModeOff = "off"
+	RepeatModeAll = "all"
+	RepeatModeOne = "one"
+)
+
+// PlayQueue represents a user's play queue shared between devices
+// Version increases on every change and must be sent back when modifying the queue
+type PlayQueue struct {
+	SongIDs      []int      `json:"song_ids"`
+	Songs        []SongInfo `json:"songs"`
+	CurrentIndex int        `json:"current_index"`
+	PositionMs   int        `json:"position_ms"`
+	Shuffle      bool       `json:"shuffle"`
+	RepeatMode   string     `json:"repeat_mode"`
+	Device       string     `json:"device"`
+	Version      int        `json:"version"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// UpdatePlayQueueRequest 保存播放队列请求，省略的字段保持不变
+type UpdatePlayQueueRequest struct {
+	Version      *int    `json:"version" binding:"required"`
+	SongIDs      []int   `json:"song_ids"`
+	CurrentIndex *int    `json:"current_index"`
+	PositionMs   *int    `json:"position_ms"`
+	Shuffle      *bool   `json:"shuffle"`
+	RepeatMode   *string `json:"repeat_mode"`
+	Device       string  `json:"device"`
+}
+
+// QueueSongsRequest 向播放队列添加歌曲请求（加入末尾或下一首播放）
+// Version 可省略，提供时需与当前版本一致
+type QueueSongsRequest struct {
+	Version *int   `json:"version"`
+	SongIDs []int  `json:"song_ids" binding:"required,min=1"`
+	Device  string `json:"device"`
+}
+
+// MoveQueueItemRequest 移动播放队列中歌曲的请求
+type MoveQueueItemRequest struct {
+	Version *int   `json:"version" binding:"required"`
+	From    *int   `json:"from" binding:"required"`
+	To      *int   `json:"to" binding:"required"`
+	Device  string `json:"device"`
+}
+
+// ClearQueueRequest 清空播放队列请求，Version 可省略
+type ClearQueueRequest struct {
+	Version *int   `json:"version"`
+	Device  string `json:"device"`
+}
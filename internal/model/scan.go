@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+)
+
+// ScanStatus represents the progress of the current or most recent library scan
+type ScanStatus struct {
+	Running        bool            `json:"running"`
+	Phase          string          `json:"phase"`   // idle, scanning, scraping
+	Trigger        string          `json:"trigger"` // schedule, watch, admin
+	Full           bool            `json:"full"`
+	Path           string          `json:"path,omitempty"`
+	StartedAt      *time.Time      `json:"started_at,omitempty"`
+	FinishedAt     *time.Time      `json:"finished_at,omitempty"`
+	ElapsedSeconds float64         `json:"elapsed_seconds"`
+	FilesSeen      int             `json:"files_seen"`
+	Added          int             `json:"added"`
+	Updated        int             `json:"updated"`
+	Moved          int             `json:"moved"`
+	Skipped        int             `json:"skipped"`
+	Missing        int             `json:"missing"`
+	Failed         int             `json:"failed"`
+	ScrapeTotal    int             `json:"scrape_total"`
+	ScrapeDone     int             `json:"scrape_done"`
+	Errors         []ScanFileError `json:"errors"`
+}
+
+// ScanFileError represents a file that could not be processed during a scan
+type ScanFileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// StartScanRequest 管理员触发扫描请求
+type StartScanRequest struct {
+	Mode string `json:"mode"` // incremental (default) or full
+	Path string `json:"path"` // optional subdirectory relative to the music directory
+}
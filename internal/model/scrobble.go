@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+)
+
+// Scrobble account providers
+const (
+	ScrobbleProviderListenBrainz = "listenbrainz"
+	ScrobbleProviderLastFM       = "lastfm"
+)
+
+// ScrobbleAccount represents an external scrobbling service linked by a user
+// The API token is stored encrypted and never returned
+type ScrobbleAccount struct {
+	ID              int        `json:"id" db:"id"`
+	Provider        string     `json:"provider" db:"provider"`
+	APIURL          string     `json:"api_url" db:"api_url"`
+	Username        string     `json:"username" db:"username"`
+	Enabled         bool       `json:"enabled" db:"enabled"`
+	LastError       string     `json:"last_error" db:"last_error"`
+	LastSubmittedAt *time.Time `json:"last_submitted_at" db:"last_submitted_at"`
+	PendingCount    int        `json:"pending_count"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// LinkScrobbleAccountRequest 关联外部播放记录服务账号请求
+// Token 为 ListenBrainz 的用户令牌或 Last.fm 的 session key，更新已关联的账号时可以省略；
+// APIURL 为空字符串时使用服务器配置的默认地址，省略时保持不变
+type LinkScrobbleAccountRequest struct {
+	Token   string  `json:"token"`
+	APIURL  *string `json:"api_url"`
+	Enabled *bool   `json:"enabled"`
+}
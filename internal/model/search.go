@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+)
+
+// SearchResult represents ranked search results grouped into songs, artists and albums
+type SearchResult struct {
+	Songs       []SongInfo `json:"songs"`
+	Artists     []Artist   `json:"artists"`
+	Albums      []Album    `json:"albums"`
+	SongTotal   int        `json:"-"`
+	ArtistTotal int        `json:"-"`
+	AlbumTotal  int        `json:"-"`
+}
+
+// SearchHistoryEntry represents a query in a user's search history
+type SearchHistoryEntry struct {
+	ID         int       `json:"id" db:"id"`
+	Keyword    string    `json:"keyword" db:"keyword"`
+	SearchedAt time.Time `json:"searched_at" db:"searched_at"`
+}
+
+// SearchSuggestion represents a search suggestion
+// Type is history (the user's recent query), artist, album or song (popular library terms)
+type SearchSuggestion struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
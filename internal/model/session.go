@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+)
+
+// Session represents a logged-in device holding a refresh token
+type Session struct {
+	ID         int       `json:"id" db:"id"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	IP         string    `json:"ip" db:"ip"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// TokenPair is a short-lived access token and the refresh token used to renew it
+// RefreshToken is empty when the refresh token was not rotated
+type TokenPair struct {
+	Token            string `json:"token"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	ExpiresIn        int    `json:"expires_in"`                   // access token lifetime in seconds
+	RefreshExpiresIn int    `json:"refresh_expires_in,omitempty"` // refresh token lifetime in seconds
+}
+
+// RefreshTokenRequest 刷新令牌请求，未提供时从 Cookie 读取
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
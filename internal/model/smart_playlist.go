@@ -0,0 +1,44 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+// Smart playlist rule group matching
+const (
+	SmartMatchAll = "all"
+	SmartMatchAny = "any"
+)
+
+// SmartRule is either a condition (Field, Op, Value) or a group of rules (Match, Rules)
+//
+// Fields and operators:
+//   - title, artist, album, album_artist: contains, not_contains, is, is_not
+//   - genre: in, not_in (a list of genre names)
+//   - year, duration (seconds), play_count (the owner's plays): eq, ne, gt, gte, lt, lte, between ([min, max])
+//   - added, last_played: in_last, not_in_last (days)
+//   - never_played, favorite (favorited by the owner): is (true or false)
+type SmartRule struct {
+	Field string          `json:"field,omitempty"`
+	Op    string          `json:"op,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Match string          `json:"match,omitempty"`
+	Rules []SmartRule     `json:"rules,omitempty"`
+}
+
+// IsGroup reports whether the rule is a group of rules
+func (r SmartRule) IsGroup() bool {
+	return r.Field == ""
+}
+
+// SmartPlaylistRequest 创建或更新智能播放列表请求
+// Sort 可选 title、artist、album、year、duration、play_count、added、last_played、random，默认 artist；
+// Limit 为 0 表示不限制数量
+type SmartPlaylistRequest struct {
+	Name     string    `json:"name" binding:"required"`
+	IsPublic bool      `json:"is_public"`
+	Rules    SmartRule `json:"rules"`
+	Sort     string    `json:"sort"`
+	Order    string    `json:"order" binding:"omitempty,oneof=asc desc"`
+	Limit    int       `json:"limit" binding:"min=0"`
+}
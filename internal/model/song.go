@@ -10,15 +10,45 @@ type Song struct {
 	Title      string    `json:"title" db:"title"`
 	Artist     string    `json:"artist" db:"artist"`
 	Album      string    `json:"album" db:"album"`
+	ArtistID   *int      `json:"artist_id,omitempty" db:"artist_id"`
+	AlbumID    *int      `json:"album_id,omitempty" db:"album_id"`
 	Duration   int       `json:"duration" db:"duration"` // Duration in seconds
 	FilePath   string    `json:"file_path" db:"file_path"`
+	FileSize   int64     `json:"file_size" db:"file_size"` // Size in bytes recorded by the last scan
 	CoverImage *string   `json:"cover_image,omitempty" db:"cover_image"`
 	LyricsPath *string   `json:"lyrics_path,omitempty" db:"lyrics_path"`
 	PlayCount  int       `json:"play_count" db:"play_count"`
 	IsCollect  int       `json:"is_collect" db:"is_collect"`
 	IsDeleted  int       `json:"is_deleted" db:"is_deleted"`
+	IsMissing  int       `json:"is_missing" db:"is_missing"`
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	SongTags
+	// Artists and Genres are the individual entries split from the raw Artist and Genre strings
+	Artists []ArtistCredit `json:"artists,omitempty"`
+	Genres  []string       `json:"genres,omitempty"`
+}
+
+// SongTags represents the extended tags and audio properties read from a song file
+type SongTags struct {
+	AlbumArtist            string   `json:"album_artist" db:"album_artist"`
+	TrackNumber            int      `json:"track_number" db:"track_number"`
+	DiscNumber             int      `json:"disc_number" db:"disc_number"`
+	Year                   int      `json:"year" db:"year"`
+	Genre                  string   `json:"genre" db:"genre"` // Multiple genres are joined with "; "
+	Composer               string   `json:"composer" db:"composer"`
+	BPM                    int      `json:"bpm" db:"bpm"`
+	MusicBrainzRecordingID string   `json:"musicbrainz_recording_id,omitempty" db:"mb_recording_id"`
+	MusicBrainzReleaseID   string   `json:"musicbrainz_release_id,omitempty" db:"mb_release_id"`
+	MusicBrainzArtistID    string   `json:"musicbrainz_artist_id,omitempty" db:"mb_artist_id"`
+	ReplayGainTrackGain    *float64 `json:"replaygain_track_gain,omitempty" db:"replaygain_track_gain"` // dB
+	ReplayGainTrackPeak    *float64 `json:"replaygain_track_peak,omitempty" db:"replaygain_track_peak"`
+	ReplayGainAlbumGain    *float64 `json:"replaygain_album_gain,omitempty" db:"replaygain_album_gain"` // dB
+	ReplayGainAlbumPeak    *float64 `json:"replaygain_album_peak,omitempty" db:"replaygain_album_peak"`
+	BitRate                int      `json:"bit_rate" db:"bit_rate"`       // kbps
+	SampleRate             int      `json:"sample_rate" db:"sample_rate"` // Hz
+	Channels               int      `json:"channels" db:"channels"`
+	Codec                  string   `json:"codec" db:"codec"`
 }
 
 // SongInfo represents basic song information for listing
@@ -31,4 +61,10 @@ type SongInfo struct {
 	CoverImage *string   `json:"cover_image,omitempty"`
 	IsDeleted  int       `json:"is_deleted"`
 	UpdatedAt  time.Time `json:"updated_at"`
+	SongTags
+	// FilePath, FileSize, ArtistID and AlbumID are only used by the Subsonic API
+	FilePath string `json:"-"`
+	FileSize int64  `json:"-"`
+	ArtistID *int   `json:"-"`
+	AlbumID  *int   `json:"-"`
 }
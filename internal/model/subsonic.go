@@ -0,0 +1,245 @@
+package model
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Subsonic API 版本及错误码
+const (
+	SubsonicAPIVersion = "1.16.1"
+	SubsonicServerType = "melogo"
+
+	SubsonicErrGeneric          = 0
+	SubsonicErrMissingParameter = 10
+	SubsonicErrWrongCredentials = 40
+	SubsonicErrConflictingAuth  = 43
+	SubsonicErrInvalidAPIKey    = 44
+	SubsonicErrNotAuthorized    = 50
+	SubsonicErrNotFound         = 70
+)
+
+// SubsonicResponse is the root element of every Subsonic API response
+type SubsonicResponse struct {
+	XMLName       xml.Name `xml:"subsonic-response" json:"-"`
+	Xmlns         string   `xml:"xmlns,attr" json:"-"`
+	Status        string   `xml:"status,attr" json:"status"`
+	Version       string   `xml:"version,attr" json:"version"`
+	Type          string   `xml:"type,attr" json:"type"`
+	ServerVersion string   `xml:"serverVersion,attr" json:"serverVersion"`
+	OpenSubsonic  bool     `xml:"openSubsonic,attr" json:"openSubsonic"`
+
+	Error                  *SubsonicError               `xml:"error,omitempty" json:"error,omitempty"`
+	License                *SubsonicLicense             `xml:"license,omitempty" json:"license,omitempty"`
+	OpenSubsonicExtensions []SubsonicExtension          `xml:"openSubsonicExtensions,omitempty" json:"openSubsonicExtensions,omitempty"`
+	MusicFolders           *SubsonicMusicFolders        `xml:"musicFolders,omitempty" json:"musicFolders,omitempty"`
+	Indexes                *SubsonicIndexes             `xml:"indexes,omitempty" json:"indexes,omitempty"`
+	Directory              *SubsonicDirectory           `xml:"directory,omitempty" json:"directory,omitempty"`
+	Artists                *SubsonicArtists             `xml:"artists,omitempty" json:"artists,omitempty"`
+	Artist                 *SubsonicArtistWithAlbums    `xml:"artist,omitempty" json:"artist,omitempty"`
+	Album                  *SubsonicAlbumWithSongs      `xml:"album,omitempty" json:"album,omitempty"`
+	Song                   *SubsonicChild               `xml:"song,omitempty" json:"song,omitempty"`
+	Lyrics                 *SubsonicLyrics              `xml:"lyrics,omitempty" json:"lyrics,omitempty"`
+	LyricsList             *SubsonicLyricsList          `xml:"lyricsList,omitempty" json:"lyricsList,omitempty"`
+	SearchResult3          *SubsonicSearchResult3       `xml:"searchResult3,omitempty" json:"searchResult3,omitempty"`
+	Playlists              *SubsonicPlaylists           `xml:"playlists,omitempty" json:"playlists,omitempty"`
+	Playlist               *SubsonicPlaylistWithEntries `xml:"playlist,omitempty" json:"playlist,omitempty"`
+	Starred2               *SubsonicStarred2            `xml:"starred2,omitempty" json:"starred2,omitempty"`
+	PlayQueue              *SubsonicPlayQueue           `xml:"playQueue,omitempty" json:"playQueue,omitempty"`
+}
+
+// SubsonicError describes a failed request
+type SubsonicError struct {
+	Code    int    `xml:"code,attr" json:"code"`
+	Message string `xml:"message,attr" json:"message"`
+}
+
+// SubsonicLicense is returned by getLicense
+type SubsonicLicense struct {
+	Valid bool `xml:"valid,attr" json:"valid"`
+}
+
+// SubsonicExtension describes a supported OpenSubsonic extension
+type SubsonicExtension struct {
+	Name     string `xml:"name,attr" json:"name"`
+	Versions []int  `xml:"versions" json:"versions"`
+}
+
+// SubsonicMusicFolders is returned by getMusicFolders
+type SubsonicMusicFolders struct {
+	Folders []SubsonicMusicFolder `xml:"musicFolder" json:"musicFolder,omitempty"`
+}
+
+// SubsonicMusicFolder is a top level music folder
+type SubsonicMusicFolder struct {
+	ID   int    `xml:"id,attr" json:"id"`
+	Name string `xml:"name,attr" json:"name"`
+}
+
+// SubsonicIndexes is returned by getIndexes
+type SubsonicIndexes struct {
+	LastModified    int64           `xml:"lastModified,attr" json:"lastModified"`
+	IgnoredArticles string          `xml:"ignoredArticles,attr" json:"ignoredArticles"`
+	Index           []SubsonicIndex `xml:"index" json:"index,omitempty"`
+}
+
+// SubsonicIndex groups artists by their first letter
+type SubsonicIndex struct {
+	Name    string           `xml:"name,attr" json:"name"`
+	Artists []SubsonicArtist `xml:"artist" json:"artist,omitempty"`
+}
+
+// SubsonicArtists is returned by getArtists
+type SubsonicArtists struct {
+	IgnoredArticles string          `xml:"ignoredArticles,attr" json:"ignoredArticles"`
+	Index           []SubsonicIndex `xml:"index" json:"index,omitempty"`
+}
+
+// SubsonicArtist is an ID3 artist
+type SubsonicArtist struct {
+	ID         string `xml:"id,attr" json:"id"`
+	Name       string `xml:"name,attr" json:"name"`
+	CoverArt   string `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	AlbumCount int    `xml:"albumCount,attr" json:"albumCount"`
+	Starred    string `xml:"starred,attr,omitempty" json:"starred,omitempty"`
+}
+
+// SubsonicArtistWithAlbums is returned by getArtist
+type SubsonicArtistWithAlbums struct {
+	SubsonicArtist
+	Albums []SubsonicAlbum `xml:"album" json:"album,omitempty"`
+}
+
+// SubsonicAlbum is an ID3 album
+type SubsonicAlbum struct {
+	ID        string    `xml:"id,attr" json:"id"`
+	Name      string    `xml:"name,attr" json:"name"`
+	Artist    string    `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	ArtistID  string    `xml:"artistId,attr,omitempty" json:"artistId,omitempty"`
+	CoverArt  string    `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	SongCount int       `xml:"songCount,attr" json:"songCount"`
+	Duration  int       `xml:"duration,attr" json:"duration"`
+	Created   time.Time `xml:"created,attr" json:"created"`
+	Starred   string    `xml:"starred,attr,omitempty" json:"starred,omitempty"`
+}
+
+// SubsonicAlbumWithSongs is returned by getAlbum
+type SubsonicAlbumWithSongs struct {
+	SubsonicAlbum
+	Songs []SubsonicChild `xml:"song" json:"song,omitempty"`
+}
+
+// SubsonicDirectory is returned by getMusicDirectory
+type SubsonicDirectory struct {
+	ID       string          `xml:"id,attr" json:"id"`
+	Parent   string          `xml:"parent,attr,omitempty" json:"parent,omitempty"`
+	Name     string          `xml:"name,attr" json:"name"`
+	Children []SubsonicChild `xml:"child" json:"child,omitempty"`
+}
+
+// SubsonicChild is a song or a directory entry
+type SubsonicChild struct {
+	ID          string     `xml:"id,attr" json:"id"`
+	Parent      string     `xml:"parent,attr,omitempty" json:"parent,omitempty"`
+	IsDir       bool       `xml:"isDir,attr" json:"isDir"`
+	Title       string     `xml:"title,attr" json:"title"`
+	Album       string     `xml:"album,attr,omitempty" json:"album,omitempty"`
+	Artist      string     `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	CoverArt    string     `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	Size        int64      `xml:"size,attr,omitempty" json:"size,omitempty"`
+	ContentType string     `xml:"contentType,attr,omitempty" json:"contentType,omitempty"`
+	Suffix      string     `xml:"suffix,attr,omitempty" json:"suffix,omitempty"`
+	Duration    int        `xml:"duration,attr,omitempty" json:"duration,omitempty"`
+	BitRate     int        `xml:"bitRate,attr,omitempty" json:"bitRate,omitempty"`
+	Track       int        `xml:"track,attr,omitempty" json:"track,omitempty"`
+	DiscNumber  int        `xml:"discNumber,attr,omitempty" json:"discNumber,omitempty"`
+	Year        int        `xml:"year,attr,omitempty" json:"year,omitempty"`
+	Genre       string     `xml:"genre,attr,omitempty" json:"genre,omitempty"`
+	Path        string     `xml:"path,attr,omitempty" json:"path,omitempty"`
+	PlayCount   int        `xml:"playCount,attr,omitempty" json:"playCount,omitempty"`
+	Created     *time.Time `xml:"created,attr,omitempty" json:"created,omitempty"`
+	Starred     string     `xml:"starred,attr,omitempty" json:"starred,omitempty"`
+	AlbumID     string     `xml:"albumId,attr,omitempty" json:"albumId,omitempty"`
+	ArtistID    string     `xml:"artistId,attr,omitempty" json:"artistId,omitempty"`
+	Type        string     `xml:"type,attr,omitempty" json:"type,omitempty"`
+	MediaType   string     `xml:"mediaType,attr,omitempty" json:"mediaType,omitempty"`
+	// OpenSubsonic extensions
+	BPM           int    `xml:"bpm,attr,omitempty" json:"bpm,omitempty"`
+	SamplingRate  int    `xml:"samplingRate,attr,omitempty" json:"samplingRate,omitempty"`
+	ChannelCount  int    `xml:"channelCount,attr,omitempty" json:"channelCount,omitempty"`
+	MusicBrainzID string `xml:"musicBrainzId,attr,omitempty" json:"musicBrainzId,omitempty"`
+}
+
+// SubsonicLyrics is returned by getLyrics
+type SubsonicLyrics struct {
+	Artist string `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	Title  string `xml:"title,attr,omitempty" json:"title,omitempty"`
+	Value  string `xml:",chardata" json:"value"`
+}
+
+// SubsonicLyricsList is returned by the OpenSubsonic getLyricsBySongId
+type SubsonicLyricsList struct {
+	StructuredLyrics []SubsonicStructuredLyrics `xml:"structuredLyrics" json:"structuredLyrics,omitempty"`
+}
+
+// SubsonicStructuredLyrics is one set of (optionally synced) lyrics
+type SubsonicStructuredLyrics struct {
+	DisplayArtist string               `xml:"displayArtist,attr,omitempty" json:"displayArtist,omitempty"`
+	DisplayTitle  string               `xml:"displayTitle,attr,omitempty" json:"displayTitle,omitempty"`
+	Lang          string               `xml:"lang,attr" json:"lang"`
+	Synced        bool                 `xml:"synced,attr" json:"synced"`
+	Lines         []SubsonicLyricsLine `xml:"line" json:"line,omitempty"`
+}
+
+// SubsonicLyricsLine is one lyrics line, Start is in milliseconds
+type SubsonicLyricsLine struct {
+	Start *int64 `xml:"start,attr,omitempty" json:"start,omitempty"`
+	Value string `xml:",chardata" json:"value"`
+}
+
+// SubsonicSearchResult3 is returned by search3
+type SubsonicSearchResult3 struct {
+	Artists []SubsonicArtist `xml:"artist" json:"artist,omitempty"`
+	Albums  []SubsonicAlbum  `xml:"album" json:"album,omitempty"`
+	Songs   []SubsonicChild  `xml:"song" json:"song,omitempty"`
+}
+
+// SubsonicPlaylists is returned by getPlaylists
+type SubsonicPlaylists struct {
+	Playlists []SubsonicPlaylist `xml:"playlist" json:"playlist,omitempty"`
+}
+
+// SubsonicPlaylist describes a playlist
+type SubsonicPlaylist struct {
+	ID        string    `xml:"id,attr" json:"id"`
+	Name      string    `xml:"name,attr" json:"name"`
+	Owner     string    `xml:"owner,attr,omitempty" json:"owner,omitempty"`
+	Public    bool      `xml:"public,attr" json:"public"`
+	SongCount int       `xml:"songCount,attr" json:"songCount"`
+	Duration  int       `xml:"duration,attr" json:"duration"`
+	Created   time.Time `xml:"created,attr" json:"created"`
+	Changed   time.Time `xml:"changed,attr" json:"changed"`
+}
+
+// SubsonicPlaylistWithEntries is returned by getPlaylist and createPlaylist
+type SubsonicPlaylistWithEntries struct {
+	SubsonicPlaylist
+	Entries []SubsonicChild `xml:"entry" json:"entry,omitempty"`
+}
+
+// SubsonicStarred2 is returned by getStarred2
+type SubsonicStarred2 struct {
+	Artists []SubsonicArtist `xml:"artist" json:"artist,omitempty"`
+	Albums  []SubsonicAlbum  `xml:"album" json:"album,omitempty"`
+	Songs   []SubsonicChild  `xml:"song" json:"song,omitempty"`
+}
+
+// SubsonicPlayQueue is returned by getPlayQueue; Current is the ID of the current song
+type SubsonicPlayQueue struct {
+	Current   string          `xml:"current,attr,omitempty" json:"current,omitempty"`
+	Position  int             `xml:"position,attr" json:"position"`
+	Username  string          `xml:"username,attr" json:"username"`
+	Changed   time.Time       `xml:"changed,attr" json:"changed"`
+	ChangedBy string          `xml:"changedBy,attr" json:"changedBy"`
+	Entries   []SubsonicChild `xml:"entry" json:"entry,omitempty"`
+}
@@ -0,0 +1,53 @@
+package model
+
+// TwoFactorStatus 当前用户的两步验证状态
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+	// Required 管理员账号被要求启用两步验证，不能关闭
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorSetup 新生成的 TOTP 密钥，使用验证码确认后才会启用
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+	// QRCode otpauth URI 的二维码，PNG 格式的 data URI
+	QRCode string `json:"qr_code"`
+}
+
+// TwoFactorChallenge 密码验证通过但还需要两步验证时的登录响应
+type TwoFactorChallenge struct {
+	TwoFactorRequired      bool   `json:"two_factor_required,omitempty"`
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required,omitempty"`
+	PreAuthToken           string `json:"pre_auth_token"`
+	ExpiresIn              int    `json:"expires_in"` // seconds
+}
+
+// PreAuthRequest 使用预认证令牌的请求
+type PreAuthRequest struct {
+	PreAuthToken string `json:"pre_auth_token" binding:"required"`
+}
+
+// TwoFactorLoginRequest 登录第二步：提交验证器中的验证码或恢复码
+type TwoFactorLoginRequest struct {
+	PreAuthToken string `json:"pre_auth_token" binding:"required"`
+	Code         string `json:"code" binding:"required"`
+}
+
+// TwoFactorCodeRequest 需要验证码的两步验证操作
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest 关闭两步验证请求，需要当前密码和验证码
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse 新生成的恢复码，只显示这一次
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
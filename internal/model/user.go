@@ -6,30 +6,34 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID        int       `json:"id" db:"id"`
-	Username  string    `json:"username" db:"username"`
-	Email     string    `json:"email" db:"email"`
-	Password  string    `json:"-" db:"password_hash"`
-	Avatar    string    `json:"avatar" db:"avatar"`
-	IsAdmin   int       `json:"is_admin" db:"is_admin"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID               int       `json:"id" db:"id"`
+	Username         string    `json:"username" db:"username"`
+	Email            string    `json:"email" db:"email"`
+	Password         string    `json:"-" db:"password_hash"`
+	Avatar           string    `json:"avatar" db:"avatar"`
+	MaxBitRate       int       `json:"max_bitrate" db:"max_bitrate"` // kbps, 0 means unlimited
+	IsAdmin          int       `json:"is_admin" db:"is_admin"`
+	IsDisabled       int       `json:"is_disabled" db:"is_disabled"`
+	TwoFactorEnabled int       `json:"two_factor_enabled" db:"totp_enabled"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // UserProfile represents user profile information
 type UserProfile struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Avatar   string `json:"avatar"`
-	IsAdmin  int    `json:"is_admin"`
+	ID         int    `json:"id"`
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	Avatar     string `json:"avatar"`
+	MaxBitRate int    `json:"max_bitrate"`
+	IsAdmin    int    `json:"is_admin"`
 }
 
 // RegisterRequest 用户注册请求
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"omitempty,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 }
 
 // LoginRequest 用户登录请求
@@ -38,10 +42,48 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// SubsonicPasswordStatus 用户是否已经生成 Subsonic 密码
+type SubsonicPasswordStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SubsonicPasswordResponse 新生成的 Subsonic 密码，只显示这一次
+type SubsonicPasswordResponse struct {
+	Message  string `json:"message"`
+	Password string `json:"password"`
+}
+
 // LoginResponse 登录响应
 type LoginResponse struct {
-	Token string       `json:"token"`
-	User  *UserProfile `json:"user"`
+	TokenPair
+	User *UserProfile `json:"user"`
+	// RecoveryCodes 登录时完成两步验证设置后返回的恢复码，只显示这一次
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// AdminCreateUserRequest 管理员创建用户请求
+type AdminCreateUserRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Email    string `json:"email" binding:"omitempty,email"`
+	Password string `json:"password" binding:"required"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// AdminUpdateUserRequest 管理员修改用户状态请求，未提供的字段保持不变
+type AdminUpdateUserRequest struct {
+	IsAdmin    *bool `json:"is_admin"`
+	IsDisabled *bool `json:"is_disabled"`
+}
+
+// AdminResetPasswordRequest 管理员重置用户密码请求
+type AdminResetPasswordRequest struct {
+	Password string `json:"password" binding:"required"`
 }
 
 // ErrorResponse 错误响应
@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"melogo/internal/handler"
 	"melogo/internal/middleware"
+	"melogo/internal/model"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -39,46 +40,149 @@ func RegisterRoutes(r *gin.Engine, assetsFS fs.FS) {
 		// Public routes - no authentication required
 		api.POST("/register", handler.Register)
 		api.POST("/login", handler.Login)
+		api.POST("/login/2fa", handler.LoginTwoFactor)
+		api.POST("/login/2fa/setup", handler.LoginTwoFactorSetup)
+		api.POST("/refresh", handler.RefreshToken)
 
 		// Protected routes - authentication required
-		authenticated := api.Group("")
-		authenticated.Use(middleware.AuthMiddleware())
+		// API keys are accepted only by the route groups that name a scope, and need that scope
+
+		// Library routes - read scope
+		library := api.Group("")
+		library.Use(middleware.AuthMiddleware(model.APIKeyScopeRead))
 		{
 			// User routes
-			authenticated.POST("/logout", handler.Logout)
-			authenticated.GET("/user/profile", handler.GetUserProfile)
-			authenticated.PUT("/user/profile", handler.UpdateUserProfile)
-			authenticated.GET("/user/:id/avatar", handler.GetUserAvatar)
+			library.GET("/user/profile", handler.GetUserProfile)
+			library.GET("/user/:id/avatar", handler.GetUserAvatar)
 
 			// Song routes
-			authenticated.GET("/songs", handler.ListSongs)
-			authenticated.GET("/songs/:id", handler.GetSong)
-			authenticated.GET("/songs/:id/stream", handler.StreamSong)
-			authenticated.GET("/songs/:id/lyrics", handler.GetLyrics)
-			authenticated.GET("/songs/:id/cover", handler.GetCover)
+			library.GET("/songs", handler.ListSongs)
+			library.GET("/songs/:id", handler.GetSong)
+			library.GET("/songs/:id/lyrics", handler.GetLyrics)
+			library.GET("/songs/:id/cover", handler.GetCover)
+
+			// Play history and play queue routes
+			library.GET("/me/recent", handler.GetRecentlyPlayed)
+			library.GET("/me/history", handler.GetPlayHistory)
+			library.GET("/me/queue", handler.GetPlayQueue)
+
+			// Artist and album routes
+			library.GET("/artists", handler.ListArtists)
+			library.GET("/artists/:id", handler.GetArtist)
+			library.GET("/albums", handler.ListAlbums)
+			library.GET("/albums/:id", handler.GetAlbum)
 
 			// Playlist routes // 播放列表相关路由
-			authenticated.GET("/playlists", handler.ListPlaylists)
-			authenticated.POST("/playlists", handler.CreatePlaylist)
-			authenticated.GET("/playlists/:id/detail", handler.GetPlaylistDetail)
-			authenticated.PUT("/playlists/:id", handler.UpdatePlaylist)
-			authenticated.DELETE("/playlists/:id", handler.DeletePlaylist)
-			authenticated.POST("/playlists/:id/songs", handler.AddSongToPlaylist)
-			authenticated.DELETE("/playlists/:id/songs/:song_id", handler.RemoveSongFromPlaylist)
+			library.GET("/playlists", handler.ListPlaylists)
+			library.GET("/playlists/public", handler.ListPublicPlaylists)
+			library.GET("/playlists/:id/detail", handler.GetPlaylistDetail)
+			library.GET("/playlists/:id/collaborators", handler.ListPlaylistCollaborators)
+			library.GET("/playlists/:id/export", handler.ExportPlaylist)
+
+			// Smart playlist routes
+			library.GET("/smart-playlists", handler.ListSmartPlaylists)
+			library.GET("/smart-playlists/:id", handler.GetSmartPlaylist)
+			library.GET("/smart-playlists/:id/detail", handler.GetSmartPlaylistDetail)
 
 			// Favorite routes
-			authenticated.GET("/favorites", handler.ListFavorites)
-			authenticated.POST("/favorites", handler.AddFavorite)
-			authenticated.DELETE("/favorites/:song_id", handler.RemoveFavorite)
+			library.GET("/favorites", handler.ListFavorites)
 
 			// Search routes
-			authenticated.GET("/search", handler.Search)
-			authenticated.GET("/search/history", handler.GetSearchHistory)
+			library.GET("/search", handler.Search)
+			library.GET("/search/history", handler.GetSearchHistory)
+			library.GET("/search/suggest", handler.SearchSuggest)
+		}
+
+		// Streaming routes - stream scope
+		streaming := api.Group("")
+		streaming.Use(middleware.AuthMiddleware(model.APIKeyScopeStream))
+		{
+			streaming.GET("/songs/:id/stream", handler.StreamSong)
+			streaming.POST("/songs/:id/scrobble", handler.ScrobbleSong)
+		}
+
+		// Favorite and play queue editing routes - library-write scope
+		libraryWrite := api.Group("")
+		libraryWrite.Use(middleware.AuthMiddleware(model.APIKeyScopeLibraryWrite))
+		{
+			// Play queue routes
+			libraryWrite.PUT("/me/queue", handler.UpdatePlayQueue)
+			libraryWrite.DELETE("/me/queue", handler.ClearPlayQueue)
+			libraryWrite.POST("/me/queue/enqueue", handler.EnqueueSongs)
+			libraryWrite.POST("/me/queue/next", handler.PlayNextSongs)
+			libraryWrite.POST("/me/queue/move", handler.MoveQueueItem)
+
+			// Favorite routes
+			libraryWrite.POST("/favorites", handler.AddFavorite)
+			libraryWrite.DELETE("/favorites/:song_id", handler.RemoveFavorite)
+			libraryWrite.DELETE("/favorites/items/:type/:id", handler.RemoveFavoriteItem)
+			libraryWrite.PUT("/favorites/items/:type/:id/rating", handler.SetFavoriteRating)
+		}
+
+		// Playlist editing routes - playlist-write scope
+		playlists := api.Group("")
+		playlists.Use(middleware.AuthMiddleware(model.APIKeyScopePlaylistWrite))
+		{
+			playlists.POST("/playlists/import", handler.ImportPlaylist)
+			playlists.POST("/playlists", handler.CreatePlaylist)
+			playlists.PUT("/playlists/:id", handler.UpdatePlaylist)
+			playlists.DELETE("/playlists/:id", handler.DeletePlaylist)
+			playlists.POST("/playlists/:id/songs", handler.AddSongToPlaylist)
+			playlists.PATCH("/playlists/:id/songs", handler.EditPlaylistSongs)
+			playlists.POST("/playlists/:id/collaborators", handler.AddPlaylistCollaborator)
+			playlists.DELETE("/playlists/:id/collaborators/:user_id", handler.RemovePlaylistCollaborator)
+			playlists.POST("/playlists/:id/follow", handler.FollowPlaylist)
+			playlists.DELETE("/playlists/:id/follow", handler.UnfollowPlaylist)
+			playlists.POST("/playlists/:id/copy", handler.CopyPlaylist)
+			playlists.DELETE("/playlists/:id/songs/:song_id", handler.RemoveSongFromPlaylist)
+
+			playlists.POST("/smart-playlists", handler.CreateSmartPlaylist)
+			playlists.PUT("/smart-playlists/:id", handler.UpdateSmartPlaylist)
+			playlists.DELETE("/smart-playlists/:id", handler.DeleteSmartPlaylist)
+		}
+
+		// Account routes - login session only
+		authenticated := api.Group("")
+		authenticated.Use(middleware.AuthMiddleware())
+		{
+			// User routes
+			authenticated.POST("/logout", handler.Logout)
+			authenticated.PUT("/user/profile", handler.UpdateUserProfile)
+			authenticated.PUT("/me/password", handler.ChangePassword)
+			authenticated.GET("/me/subsonic-password", handler.GetSubsonicPasswordStatus)
+			authenticated.POST("/me/subsonic-password", handler.GenerateSubsonicPassword)
+			authenticated.DELETE("/me/subsonic-password", handler.DeleteSubsonicPassword)
+
+			// Login session routes
+			authenticated.GET("/me/sessions", handler.ListSessions)
+			authenticated.DELETE("/me/sessions", handler.RevokeAllSessions)
+			authenticated.DELETE("/me/sessions/:id", handler.RevokeSession)
+
+			// Two-factor authentication routes
+			authenticated.GET("/me/2fa", handler.GetTwoFactorStatus)
+			authenticated.POST("/me/2fa/setup", handler.BeginTwoFactorSetup)
+			authenticated.POST("/me/2fa/enable", handler.EnableTwoFactor)
+			authenticated.DELETE("/me/2fa", handler.DisableTwoFactor)
+			authenticated.POST("/me/2fa/recovery-codes", handler.RegenerateRecoveryCodes)
+
+			// API key routes
+			authenticated.GET("/me/api-keys", handler.ListAPIKeys)
+			authenticated.POST("/me/api-keys", handler.CreateAPIKey)
+			authenticated.DELETE("/me/api-keys/:id", handler.RevokeAPIKey)
+
+			// Scrobble account routes
+			authenticated.GET("/me/scrobble-accounts", handler.ListScrobbleAccounts)
+			authenticated.PUT("/me/scrobble-accounts/:provider", handler.LinkScrobbleAccount)
+			authenticated.DELETE("/me/scrobble-accounts/:provider", handler.UnlinkScrobbleAccount)
+
+			// Search history routes
+			authenticated.DELETE("/search/history", handler.ClearSearchHistory)
+			authenticated.DELETE("/search/history/:id", handler.DeleteSearchHistory)
 		}
 
-		// Admin routes - admin authentication required
+		// Admin routes - admin authentication required, admin scope for API keys
 		admin := api.Group("/admin")
-		admin.Use(middleware.AuthMiddleware())
+		admin.Use(middleware.AuthMiddleware(model.APIKeyScopeAdmin))
 		admin.Use(middleware.AdminMiddleware())
 		{
 			// Admin song management routes
@@ -86,9 +190,74 @@ func RegisterRoutes(r *gin.Engine, assetsFS fs.FS) {
 			admin.PUT("/songs/:id", handler.AdminUpdateSong)
 			admin.DELETE("/songs", handler.AdminDeleteSongs)
 			admin.GET("/songs/search", handler.AdminSearchSongs)
+
+			// Admin user management routes
+			admin.GET("/users", handler.AdminListUsers)
+			admin.POST("/users", handler.AdminCreateUser)
+			admin.PATCH("/users/:id", handler.AdminUpdateUser)
+			admin.DELETE("/users/:id", handler.AdminDeleteUser)
+			admin.PUT("/users/:id/password", handler.AdminResetUserPassword)
+			admin.DELETE("/users/:id/2fa", handler.AdminResetUserTwoFactor)
+
+			// Admin library scan routes
+			admin.POST("/scan", handler.AdminStartScan)
+			admin.GET("/scan/status", handler.AdminGetScanStatus)
+			admin.GET("/scan/events", handler.AdminScanEvents)
 		}
 	}
 
+	// Subsonic/OpenSubsonic compatible API - token+salt, password or API key authentication
+	// API keys need the scope of the route group, like the REST API above
+	rest := r.Group("/rest")
+	{
+		// System routes - any API key
+		system := rest.Group("")
+		system.Use(middleware.SubsonicAuthMiddleware(model.APIKeyScopes...))
+		subsonicRoute(system, "ping", handler.SubsonicPing)
+		subsonicRoute(system, "getLicense", handler.SubsonicGetLicense)
+		subsonicRoute(system, "getOpenSubsonicExtensions", handler.SubsonicGetOpenSubsonicExtensions)
+
+		// Library routes - read scope
+		library := rest.Group("")
+		library.Use(middleware.SubsonicAuthMiddleware(model.APIKeyScopeRead))
+		subsonicRoute(library, "getMusicFolders", handler.SubsonicGetMusicFolders)
+		subsonicRoute(library, "getIndexes", handler.SubsonicGetIndexes)
+		subsonicRoute(library, "getMusicDirectory", handler.SubsonicGetMusicDirectory)
+		subsonicRoute(library, "getArtists", handler.SubsonicGetArtists)
+		subsonicRoute(library, "getArtist", handler.SubsonicGetArtist)
+		subsonicRoute(library, "getAlbum", handler.SubsonicGetAlbum)
+		subsonicRoute(library, "getSong", handler.SubsonicGetSong)
+		subsonicRoute(library, "getCoverArt", handler.SubsonicGetCoverArt)
+		subsonicRoute(library, "getLyrics", handler.SubsonicGetLyrics)
+		subsonicRoute(library, "getLyricsBySongId", handler.SubsonicGetLyricsBySongID)
+		subsonicRoute(library, "search3", handler.SubsonicSearch3)
+		subsonicRoute(library, "getPlaylists", handler.SubsonicGetPlaylists)
+		subsonicRoute(library, "getPlaylist", handler.SubsonicGetPlaylist)
+		subsonicRoute(library, "getStarred2", handler.SubsonicGetStarred2)
+		subsonicRoute(library, "getPlayQueue", handler.SubsonicGetPlayQueue)
+
+		// Streaming routes - stream scope
+		streaming := rest.Group("")
+		streaming.Use(middleware.SubsonicAuthMiddleware(model.APIKeyScopeStream))
+		subsonicRoute(streaming, "stream", handler.SubsonicStream)
+		subsonicRoute(streaming, "download", handler.SubsonicDownload)
+		subsonicRoute(streaming, "scrobble", handler.SubsonicScrobble)
+
+		// Playlist editing routes - playlist-write scope
+		playlists := rest.Group("")
+		playlists.Use(middleware.SubsonicAuthMiddleware(model.APIKeyScopePlaylistWrite))
+		subsonicRoute(playlists, "createPlaylist", handler.SubsonicCreatePlaylist)
+		subsonicRoute(playlists, "updatePlaylist", handler.SubsonicUpdatePlaylist)
+		subsonicRoute(playlists, "deletePlaylist", handler.SubsonicDeletePlaylist)
+
+		// Favorite and play queue editing routes - library-write scope
+		libraryWrite := rest.Group("")
+		libraryWrite.Use(middleware.SubsonicAuthMiddleware(model.APIKeyScopeLibraryWrite))
+		subsonicRoute(libraryWrite, "star", handler.SubsonicStar)
+		subsonicRoute(libraryWrite, "unstar", handler.SubsonicUnstar)
+		subsonicRoute(libraryWrite, "savePlayQueue", handler.SubsonicSavePlayQueue)
+	}
+
 	// Web routes - public pages
 	r.GET("/", handler.Index)
 	r.GET("/login", handler.LoginPage)
@@ -108,6 +277,14 @@ func RegisterRoutes(r *gin.Engine, assetsFS fs.FS) {
 		adminWebAuth.Use(middleware.AdminMiddleware())
 		{
 			adminWebAuth.GET("/admin/songs", handler.AdminSongsPage)
+			adminWebAuth.GET("/admin/users", handler.AdminUsersPage)
 		}
 	}
 }
+
+// subsonicRoute registers a Subsonic endpoint with and without the legacy ".view" suffix
+func subsonicRoute(group *gin.RouterGroup, name string, h gin.HandlerFunc) {
+	methods := []string{http.MethodGet, http.MethodPost}
+	group.Match(methods, "/"+name, h)
+	group.Match(methods, "/"+name+".view", h)
+}
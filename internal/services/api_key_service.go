@@ -0,0 +1,195 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"melogo/internal/model"
+	"melogo/internal/utils"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrAPIKeyNotFound API密钥不存在或不属于当前用户
+	ErrAPIKeyNotFound = errors.New("API密钥不存在")
+	// ErrInvalidAPIKey API密钥无效、已吊销或所属用户已被禁用
+	ErrInvalidAPIKey = errors.New("API密钥无效")
+	// ErrAdminScopeForbidden 非管理员不能创建带 admin 权限的密钥
+	ErrAdminScopeForbidden = errors.New("只有管理员可以创建带 admin 权限的API密钥")
+)
+
+const (
+	// apiKeyPrefix 密钥的固定前缀，便于在日志和代码中识别
+	apiKeyPrefix = "mgk_"
+	// apiKeyDisplayLength 列表中展示的密钥前缀长度
+	apiKeyDisplayLength = 12
+	// apiKeyTouchInterval 最后使用时间的最小更新间隔
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyService 用户 API 密钥服务
+type APIKeyService struct {
+	db     *sql.DB
+	logger *utils.Logger
+}
+
+var apiKeyService *APIKeyService
+
+// NewAPIKeyService 创建 API 密钥服务实例
+func NewAPIKeyService(db *sql.DB) *APIKeyService {
+	service := &APIKeyService{db: db, logger: utils.NewLogger()}
+	apiKeyService = service
+	return service
+}
+
+// GetAPIKeyService 获取全局 API 密钥服务实例
+func GetAPIKeyService() *APIKeyService {
+	return apiKeyService
+}
+
+// CreateAPIKey 创建 API 密钥，返回的明文密钥只在创建时提供一次
+func (ks *APIKeyService) CreateAPIKey(userID int, name string, scopes []string) (*model.APIKey, string, error) {
+	scopes = normalizeScopes(scopes)
+	for _, scope := range scopes {
+		if scope != model.APIKeyScopeAdmin {
+			continue
+		}
+		var isAdmin int
+		if err := ks.db.QueryRow("SELECT is_admin FROM users WHERE id = ?", userID).Scan(&isAdmin); err != nil {
+			return nil, "", fmt.Errorf("查询用户失败: %v", err)
+		}
+		if isAdmin == 0 {
+			return nil, "", ErrAdminScopeForbidden
+		}
+	}
+
+	random, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("生成API密钥失败: %v", err)
+	}
+	key := apiKeyPrefix + random
+
+	now := time.Now()
+	result, err := ks.db.Exec(`
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, strings.TrimSpace(name), key[:apiKeyDisplayLength], utils.HashToken(key), strings.Join(scopes, ","), dbTime(now))
+	if err != nil {
+		return nil, "", fmt.Errorf("创建API密钥失败: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, "", fmt.Errorf("获取API密钥ID失败: %v", err)
+	}
+
+	return &model.APIKey{
+		ID:        int(id),
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    key[:apiKeyDisplayLength],
+		Scopes:    scopes,
+		CreatedAt: now.UTC().Truncate(time.Second),
+	}, key, nil
+}
+
+// normalizeScopes 去除重复的权限并按固定顺序排列
+func normalizeScopes(scopes []string) []string {
+	normalized := []string{}
+	for _, scope := range model.APIKeyScopes {
+		for _, requested := range scopes {
+			if requested == scope {
+				normalized = append(normalized, scope)
+				break
+			}
+		}
+	}
+	return normalized
+}
+
+// ListAPIKeys 获取用户的 API 密钥
+func (ks *APIKeyService) ListAPIKeys(userID int) ([]model.APIKey, error) {
+	rows, err := ks.db.Query(`
+		SELECT id, user_id, name, key_prefix, scopes, created_at, last_used_at
+		FROM api_keys
+		WHERE user_id = ?
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询API密钥失败: %v", err)
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// scanAPIKey 读取一行 API 密钥
+func scanAPIKey(row rowScanner, extra ...interface{}) (*model.APIKey, error) {
+	var key model.APIKey
+	var scopes string
+	var createdAt, lastUsedAt sql.NullString
+	dest := append([]interface{}{&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &createdAt, &lastUsedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	key.CreatedAt = parseDBTime(createdAt)
+	if lastUsedAt.Valid {
+		lastUsed := parseDBTime(lastUsedAt)
+		key.LastUsedAt = &lastUsed
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey 吊销（删除）用户的 API 密钥
+func (ks *APIKeyService) RevokeAPIKey(userID, id int) error {
+	result, err := ks.db.Exec("DELETE FROM api_keys WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("吊销API密钥失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate 校验 API 密钥，返回密钥信息和所属用户名，并更新最后使用时间
+func (ks *APIKeyService) Authenticate(key string) (*model.APIKey, string, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, "", ErrInvalidAPIKey
+	}
+
+	var username string
+	apiKey, err := scanAPIKey(ks.db.QueryRow(`
+		SELECT k.id, k.user_id, k.name, k.key_prefix, k.scopes, k.created_at, k.last_used_at, u.username
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = ? AND u.is_disabled = 0
+	`, utils.HashToken(key)), &username)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("查询API密钥失败: %v", err)
+	}
+
+	now := time.Now()
+	_, err = ks.db.Exec(
+		"UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		dbTime(now), apiKey.ID, dbTime(now.Add(-apiKeyTouchInterval)),
+	)
+	if err != nil {
+		ks.logger.Warningf("Failed to update API key last used time: %v", err)
+	}
+	return apiKey, username, nil
+}
@@ -9,13 +9,50 @@ import (
 	"path/filepath"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
 
-// InitDatabase initializes the SQLite database
+// sqliteDriverName is the SQLite driver that enables foreign keys and registers
+// the search functions on every new connection
+const sqliteDriverName = "sqlite3_melogo"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// Foreign keys are off by default and enabled per connection;
+			// without them ON DELETE CASCADE/SET NULL never run
+			if _, err := conn.Exec("PRAGMA foreign_keys = ON", nil); err != nil {
+				return err
+			}
+			return registerSearchFunctions(conn)
+		},
+	})
+}
+
+// InitDatabase opens the SQLite database and applies pending migrations
 func InitDatabase(cfg *config.Config) error {
+	if err := OpenDatabase(cfg); err != nil {
+		return err
+	}
+
+	// 执行尚未应用的迁移
+	if _, err := MigrateUp(); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	// 创建或重建全文索引
+	if err := EnsureSearchIndex(); err != nil {
+		return fmt.Errorf("failed to initialize search index: %v", err)
+	}
+
+	utils.NewLogger().Info("Database initialized successfully")
+	return nil
+}
+
+// OpenDatabase opens the SQLite database without applying migrations
+func OpenDatabase(cfg *config.Config) error {
 	// Ensure database directory exists
 	dbDir := filepath.Dir(cfg.Database.Path)
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
@@ -24,7 +61,8 @@ func InitDatabase(cfg *config.Config) error {
 
 	// Open database connection
 	var err error
-	DB, err = sql.Open("sqlite3", cfg.Database.Path)
+	searchMusicDirectory = cfg.Music.Directory
+	DB, err = sql.Open(sqliteDriverName, cfg.Database.Path)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %v", err)
 	}
@@ -45,92 +83,5 @@ func InitDatabase(cfg *config.Config) error {
 		return fmt.Errorf("failed to ping database: %v", err)
 	}
 
-	// Create tables if they don't exist
-	if err := createTables(); err != nil {
-		return fmt.Errorf("failed to create tables: %v", err)
-	}
-
-	utils.NewLogger().Info("Database initialized successfully")
-	return nil
-}
-
-// createTables creates the necessary tables if they don't exist
-func createTables() error {
-	// 首先创建表
-	tables := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username VARCHAR(50) UNIQUE NOT NULL,
-			password_hash VARCHAR(255) NOT NULL,
-			email VARCHAR(100) UNIQUE,
-			avatar TEXT,
-			avatar_blob BLOB,
-			is_admin INTEGER DEFAULT 0,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS songs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			title VARCHAR(200) NOT NULL,
-			artist VARCHAR(100),
-			album VARCHAR(100),
-			duration INTEGER,
-			file_path TEXT NOT NULL,
-			cover_image TEXT,
-			lyrics_path TEXT,
-			play_count INTEGER DEFAULT 0,
-			is_collect INTEGER DEFAULT 0,
-			is_deleted INTEGER DEFAULT 0,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS playlists (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name VARCHAR(100) NOT NULL,
-			user_id INTEGER REFERENCES users(id),
-			is_public BOOLEAN DEFAULT FALSE,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS playlist_songs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			playlist_id INTEGER REFERENCES playlists(id) ON DELETE CASCADE,
-			song_id INTEGER REFERENCES songs(id) ON DELETE CASCADE,
-			order_index INTEGER,
-			added_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS favorites (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-			song_id INTEGER REFERENCES songs(id) ON DELETE CASCADE,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS search_history (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-			keyword VARCHAR(200) NOT NULL,
-			searched_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		`CREATE TABLE IF NOT EXISTS configurations (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			key VARCHAR(100) UNIQUE NOT NULL,
-			value TEXT,
-			description TEXT
-		)`,
-	}
-
-	for _, tableSQL := range tables {
-		_, err := DB.Exec(tableSQL)
-		if err != nil {
-			return fmt.Errorf("failed to create table or migrate: %v", err)
-		}
-	}
-
 	return nil
 }
@@ -2,15 +2,43 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"melogo/internal/model"
+	"strings"
 )
 
+// ErrFavoriteItemNotFound 收藏或评分的对象不存在
+var ErrFavoriteItemNotFound = errors.New("收藏的对象不存在")
+
 // FavoriteService 收藏服务
+// 每个用户对每首歌曲、专辑、艺术家或播放列表最多一条记录，同时保存收藏时间和 1-5 星评分；
+// 既未收藏也未评分的记录会被删除
 type FavoriteService struct {
 	db *sql.DB
 }
 
+// FavoriteItem 收藏列表中的一项，根据类型填充对应的详细信息
+type FavoriteItem struct {
+	model.Favorite
+	Song     *model.SongInfo `json:"song,omitempty"`
+	Album    *model.Album    `json:"album,omitempty"`
+	Artist   *model.Artist   `json:"artist,omitempty"`
+	Playlist *Playlist       `json:"playlist,omitempty"`
+}
+
+// FavoriteListOptions 收藏列表的筛选、排序和分页
+// Type 为空时返回所有类型；MinRating 大于 0 时返回评分不低于该值的对象（包括未收藏的）；
+// Sort 可选 loved（默认）、rating、name，Order 为空时 loved 和 rating 降序、name 升序
+type FavoriteListOptions struct {
+	Type      string
+	MinRating int
+	Sort      string
+	Order     string
+	Limit     int
+	Offset    int
+}
+
 // NewFavoriteService 创建新的收藏服务实例
 func NewFavoriteService(database *sql.DB) *FavoriteService {
 	return &FavoriteService{
@@ -18,92 +46,351 @@ func NewFavoriteService(database *sql.DB) *FavoriteService {
 	}
 }
 
-// AddFavorite 添加收藏
+// favoriteItemName 收藏对象的名称，对象不存在时为 NULL
+const favoriteItemName = `CASE f.item_type
+		WHEN 'song' THEN (SELECT title FROM songs WHERE id = f.item_id AND is_deleted = 0 AND is_missing = 0)
+		WHEN 'album' THEN (SELECT name FROM albums WHERE id = f.item_id)
+		WHEN 'artist' THEN (SELECT name FROM artists WHERE id = f.item_id)
+		WHEN 'playlist' THEN (SELECT p.name FROM playlists p WHERE p.id = f.item_id AND (
+			p.is_public = 1 OR p.user_id = f.user_id
+			OR EXISTS (SELECT 1 FROM playlist_collaborators pc WHERE pc.playlist_id = p.id AND pc.user_id = f.user_id)))
+	END`
+
+// favoriteSortColumns 收藏列表的排序字段及默认方向
+var favoriteSortColumns = map[string]struct {
+	column    string
+	direction string
+}{
+	"loved":  {"f.loved_at", "DESC"},
+	"rating": {"f.rating", "DESC"},
+	"name":   {"item_name COLLATE NOCASE", "ASC"},
+}
+
+// AddFavorite 收藏歌曲
 func (fs *FavoriteService) AddFavorite(userID, songID int) error {
-	// 检查收藏是否已存在
-	exists, err := fs.IsFavorite(userID, songID)
+	return fs.SetLoved(userID, model.FavoriteSong, songID, true)
+}
+
+// RemoveFavorite 取消收藏歌曲
+func (fs *FavoriteService) RemoveFavorite(userID, songID int) error {
+	return fs.SetLoved(userID, model.FavoriteSong, songID, false)
+}
+
+// IsFavorite 检查是否已收藏歌曲
+func (fs *FavoriteService) IsFavorite(userID, songID int) (bool, error) {
+	var count int
+	err := fs.db.QueryRow(
+		"SELECT COUNT(*) FROM favorites WHERE user_id = ? AND item_type = ? AND item_id = ? AND loved_at IS NOT NULL",
+		userID, model.FavoriteSong, songID,
+	).Scan(&count)
+
 	if err != nil {
-		return fmt.Errorf("检查收藏状态失败: %v", err)
+		return false, fmt.Errorf("查询收藏状态失败: %v", err)
 	}
 
-	// 如果已存在，直接返回
-	if exists {
-		return nil
+	return count > 0, nil
+}
+
+// SetLoved 收藏或取消收藏，重复收藏保留最初的收藏时间
+func (fs *FavoriteService) SetLoved(userID int, itemType string, itemID int, loved bool) error {
+	if !loved {
+		_, err := fs.db.Exec(
+			"UPDATE favorites SET loved_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND item_type = ? AND item_id = ?",
+			userID, itemType, itemID,
+		)
+		if err != nil {
+			return fmt.Errorf("取消收藏失败: %v", err)
+		}
+		return fs.pruneFavorite(userID, itemType, itemID)
 	}
 
-	// 插入新的收藏记录
-	_, err = fs.db.Exec(
-		"INSERT INTO favorites (user_id, song_id, created_at) VALUES (?, ?, datetime('now'))",
-		userID, songID,
-	)
+	if err := fs.checkItem(userID, itemType, itemID); err != nil {
+		return err
+	}
+	_, err := fs.db.Exec(`
+		INSERT INTO favorites (user_id, item_type, item_id, loved_at, created_at, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id, item_type, item_id)
+		DO UPDATE SET loved_at = COALESCE(loved_at, excluded.loved_at), updated_at = CURRENT_TIMESTAMP
+	`, userID, itemType, itemID)
 	if err != nil {
 		return fmt.Errorf("添加收藏失败: %v", err)
 	}
+	return nil
+}
+
+// SetRating 设置 1-5 星评分，rating 为 0 时清除评分
+func (fs *FavoriteService) SetRating(userID int, itemType string, itemID, rating int) error {
+	if rating < 0 || rating > 5 {
+		return errors.New("评分必须在 0 到 5 之间")
+	}
+	if rating == 0 {
+		_, err := fs.db.Exec(
+			"UPDATE favorites SET rating = 0, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND item_type = ? AND item_id = ?",
+			userID, itemType, itemID,
+		)
+		if err != nil {
+			return fmt.Errorf("清除评分失败: %v", err)
+		}
+		return fs.pruneFavorite(userID, itemType, itemID)
+	}
 
+	if err := fs.checkItem(userID, itemType, itemID); err != nil {
+		return err
+	}
+	_, err := fs.db.Exec(`
+		INSERT INTO favorites (user_id, item_type, item_id, rating, created_at, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id, item_type, item_id)
+		DO UPDATE SET rating = excluded.rating, updated_at = CURRENT_TIMESTAMP
+	`, userID, itemType, itemID, rating)
+	if err != nil {
+		return fmt.Errorf("设置评分失败: %v", err)
+	}
 	return nil
 }
 
-// RemoveFavorite 取消收藏
-func (fs *FavoriteService) RemoveFavorite(userID, songID int) error {
+// pruneFavorite 删除既未收藏也未评分的记录
+func (fs *FavoriteService) pruneFavorite(userID int, itemType string, itemID int) error {
 	_, err := fs.db.Exec(
-		"DELETE FROM favorites WHERE user_id = ? AND song_id = ?",
-		userID, songID,
+		"DELETE FROM favorites WHERE user_id = ? AND item_type = ? AND item_id = ? AND loved_at IS NULL AND rating = 0",
+		userID, itemType, itemID,
 	)
 	if err != nil {
-		return fmt.Errorf("取消收藏失败: %v", err)
+		return fmt.Errorf("删除收藏记录失败: %v", err)
 	}
-
 	return nil
 }
 
-// IsFavorite 检查是否已收藏
-func (fs *FavoriteService) IsFavorite(userID, songID int) (bool, error) {
-	var count int
-	err := fs.db.QueryRow(
-		"SELECT COUNT(*) FROM favorites WHERE user_id = ? AND song_id = ?",
-		userID, songID,
-	).Scan(&count)
-
-	if err != nil {
-		return false, fmt.Errorf("查询收藏状态失败: %v", err)
+// checkItem 检查收藏对象是否存在，播放列表还需要当前用户可以查看
+func (fs *FavoriteService) checkItem(userID int, itemType string, itemID int) error {
+	var query string
+	switch itemType {
+	case model.FavoriteSong:
+		query = "SELECT COUNT(*) FROM songs WHERE id = ? AND is_deleted = 0 AND is_missing = 0"
+	case model.FavoriteAlbum:
+		query = "SELECT COUNT(*) FROM albums WHERE id = ?"
+	case model.FavoriteArtist:
+		query = "SELECT COUNT(*) FROM artists WHERE id = ?"
+	case model.FavoritePlaylist:
+		if _, err := GetPlaylistService().GetPlaylistForUser(itemID, userID); err != nil {
+			if errors.Is(err, ErrPlaylistNotFound) {
+				return ErrFavoriteItemNotFound
+			}
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("不支持的收藏类型: %s", itemType)
 	}
 
-	return count > 0, nil
+	var count int
+	if err := fs.db.QueryRow(query, itemID).Scan(&count); err != nil {
+		return fmt.Errorf("查询收藏对象失败: %v", err)
+	}
+	if count == 0 {
+		return ErrFavoriteItemNotFound
+	}
+	return nil
 }
 
-// ListFavorites 获取用户收藏列表
-func (fs *FavoriteService) ListFavorites(userID int) ([]model.FavoriteWithSong, error) {
-	query := `
-		SELECT f.id, f.user_id, f.song_id, f.created_at, 
-		       s.title, s.artist, s.album, s.duration
-		FROM favorites f
-		JOIN songs s ON f.song_id = s.id
-		WHERE f.user_id = ? AND s.is_deleted = 0
-		ORDER BY f.created_at DESC
-	`
-
-	rows, err := fs.db.Query(query, userID)
+// GetLovedItems 获取用户收藏的某类对象，按收藏时间倒序；不检查对象是否仍然存在
+func (fs *FavoriteService) GetLovedItems(userID int, itemType string) ([]model.Favorite, error) {
+	rows, err := fs.db.Query(`
+		SELECT id, user_id, item_type, item_id, rating, loved_at, created_at
+		FROM favorites
+		WHERE user_id = ? AND item_type = ? AND loved_at IS NOT NULL
+		ORDER BY loved_at DESC, id DESC
+	`, userID, itemType)
 	if err != nil {
 		return nil, fmt.Errorf("查询收藏列表失败: %v", err)
 	}
 	defer rows.Close()
 
-	var favorites []model.FavoriteWithSong
+	favorites := []model.Favorite{}
 	for rows.Next() {
-		var fav model.FavoriteWithSong
-		err := rows.Scan(
-			&fav.ID, &fav.UserID, &fav.SongID, &fav.CreatedAt,
-			&fav.Song.Title, &fav.Song.Artist, &fav.Song.Album, &fav.Song.Duration,
-		)
+		fav, err := scanFavorite(rows)
 		if err != nil {
 			return nil, fmt.Errorf("扫描收藏记录失败: %v", err)
 		}
 		favorites = append(favorites, fav)
 	}
-
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("遍历收藏记录失败: %v", err)
 	}
-
 	return favorites, nil
 }
+
+// scanFavorite 读取一条收藏记录，列顺序为 id, user_id, item_type, item_id, rating, loved_at, created_at
+func scanFavorite(scanner rowScanner) (model.Favorite, error) {
+	var fav model.Favorite
+	var lovedAt, createdAt sql.NullString
+	err := scanner.Scan(&fav.ID, &fav.UserID, &fav.ItemType, &fav.ItemID, &fav.Rating, &lovedAt, &createdAt)
+	if err != nil {
+		return fav, err
+	}
+	if lovedAt.Valid {
+		t := parseDBTime(lovedAt)
+		fav.LovedAt = &t
+	}
+	fav.CreatedAt = parseDBTime(createdAt)
+	return fav, nil
+}
+
+// ListFavorites 分页获取用户的收藏，返回当前页及总数；已删除或无权查看的对象不会返回
+func (fs *FavoriteService) ListFavorites(userID int, opts FavoriteListOptions) ([]*FavoriteItem, int, error) {
+	where := "f.user_id = ?"
+	args := []interface{}{userID}
+	if opts.Type != "" {
+		where += " AND f.item_type = ?"
+		args = append(args, opts.Type)
+	}
+	if opts.MinRating > 0 {
+		where += " AND f.rating >= ?"
+		args = append(args, opts.MinRating)
+	} else {
+		where += " AND f.loved_at IS NOT NULL"
+	}
+
+	if opts.Sort == "" {
+		opts.Sort = "loved"
+	}
+	sortColumn, ok := favoriteSortColumns[opts.Sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("不支持的排序字段: %s", opts.Sort)
+	}
+	direction := sortColumn.direction
+	switch opts.Order {
+	case "":
+	case "asc", "desc":
+		direction = strings.ToUpper(opts.Order)
+	default:
+		return nil, 0, fmt.Errorf("不支持的排序方向: %s", opts.Order)
+	}
+
+	from := `FROM (SELECT f.*, ` + favoriteItemName + ` AS item_name FROM favorites f WHERE ` + where + `) f
+		WHERE f.item_name IS NOT NULL`
+
+	var total int
+	if err := fs.db.QueryRow("SELECT COUNT(*) "+from, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询收藏总数失败: %v", err)
+	}
+
+	rows, err := fs.db.Query(`
+		SELECT f.id, f.user_id, f.item_type, f.item_id, f.rating, f.loved_at, f.created_at
+		`+from+`
+		ORDER BY `+sortColumn.column+` `+direction+`, f.id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, opts.Limit, opts.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询收藏列表失败: %v", err)
+	}
+	defer rows.Close()
+
+	items := []*FavoriteItem{}
+	for rows.Next() {
+		fav, err := scanFavorite(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("扫描收藏记录失败: %v", err)
+		}
+		items = append(items, &FavoriteItem{Favorite: fav})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("遍历收藏记录失败: %v", err)
+	}
+	rows.Close()
+
+	if err := fs.loadFavoriteDetails(userID, items); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// loadFavoriteDetails 按类型批量查询收藏对象的详细信息
+func (fs *FavoriteService) loadFavoriteDetails(userID int, items []*FavoriteItem) error {
+	byType := make(map[string]map[int]*FavoriteItem)
+	for _, item := range items {
+		if byType[item.ItemType] == nil {
+			byType[item.ItemType] = make(map[int]*FavoriteItem)
+		}
+		byType[item.ItemType][item.ItemID] = item
+	}
+
+	for itemType, byID := range byType {
+		ids := make([]interface{}, 0, len(byID))
+		for id := range byID {
+			ids = append(ids, id)
+		}
+		placeholders := "?" + strings.Repeat(", ?", len(ids)-1)
+
+		switch itemType {
+		case model.FavoriteSong:
+			rows, err := fs.db.Query("SELECT "+songInfoColumns+" FROM songs WHERE id IN ("+placeholders+")", ids...)
+			if err != nil {
+				return fmt.Errorf("查询收藏歌曲失败: %v", err)
+			}
+			songs, err := scanSongInfoRows(rows)
+			rows.Close()
+			if err != nil {
+				return err
+			}
+			for i := range songs {
+				byID[songs[i].ID].Song = &songs[i]
+			}
+		case model.FavoriteAlbum:
+			rows, err := fs.db.Query(`
+				SELECT `+albumColumns+albumFromClause+`
+				WHERE al.id IN (`+placeholders+`)
+				GROUP BY al.id
+			`, ids...)
+			if err != nil {
+				return fmt.Errorf("查询收藏专辑失败: %v", err)
+			}
+			albums, err := scanAlbumRows(rows)
+			rows.Close()
+			if err != nil {
+				return err
+			}
+			for i := range albums {
+				byID[albums[i].ID].Album = &albums[i]
+			}
+		case model.FavoriteArtist:
+			if err := fs.loadFavoriteArtists(byID, ids, placeholders); err != nil {
+				return err
+			}
+		case model.FavoritePlaylist:
+			for id, item := range byID {
+				playlist, err := GetPlaylistService().GetPlaylistForUser(id, userID)
+				if err != nil && !errors.Is(err, ErrPlaylistNotFound) {
+					return err
+				}
+				item.Playlist = playlist
+			}
+		}
+	}
+	return nil
+}
+
+// loadFavoriteArtists 查询收藏的艺术家及其专辑数和歌曲数
+func (fs *FavoriteService) loadFavoriteArtists(byID map[int]*FavoriteItem, ids []interface{}, placeholders string) error {
+	rows, err := fs.db.Query(artistSongsCTE+`
+		SELECT a.id, a.name, COUNT(DISTINCT x.album_id), COUNT(DISTINCT x.song_id)
+		FROM artists a
+		LEFT JOIN artist_songs x ON x.artist_id = a.id
+		WHERE a.id IN (`+placeholders+`)
+		GROUP BY a.id
+	`, ids...)
+	if err != nil {
+		return fmt.Errorf("查询收藏艺术家失败: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var artist model.Artist
+		if err := rows.Scan(&artist.ID, &artist.Name, &artist.AlbumCount, &artist.SongCount); err != nil {
+			return fmt.Errorf("读取艺术家失败: %v", err)
+		}
+		byID[artist.ID].Artist = &artist
+	}
+	return rows.Err()
+}
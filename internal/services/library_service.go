@@ -0,0 +1,537 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"melogo/internal/config"
+	"melogo/internal/model"
+	"melogo/internal/utils"
+	"strings"
+)
+
+// LibraryService 艺术家和专辑浏览服务
+type LibraryService struct {
+	db *sql.DB
+}
+
+// NewLibraryService 创建新的曲库浏览服务实例
+func NewLibraryService(database *sql.DB) *LibraryService {
+	return &LibraryService{
+		db: database,
+	}
+}
+
+// visibleSongCondition 对用户可见的歌曲条件
+const visibleSongCondition = "s.is_deleted = 0 AND s.is_missing = 0"
+
+// artistSongsCTE 艺术家与歌曲的对应关系：歌曲的全部艺术家（包括合作艺术家）以及专辑艺术家
+const artistSongsCTE = `
+	WITH artist_songs AS (
+		SELECT sa.artist_id AS artist_id, s.id AS song_id, s.album_id AS album_id
+		FROM song_artists sa
+		JOIN songs s ON s.id = sa.song_id
+		WHERE ` + visibleSongCondition + `
+		UNION
+		SELECT s.artist_id, s.id, s.album_id
+		FROM songs s
+		WHERE ` + visibleSongCondition + ` AND s.artist_id IS NOT NULL
+		UNION
+		SELECT al.artist_id, s.id, s.album_id
+		FROM songs s
+		JOIN albums al ON al.id = s.album_id
+		WHERE ` + visibleSongCondition + `
+	)
+`
+
+// albumColumns 专辑列表查询使用的列，需配合 albumFromClause 使用
+const albumColumns = `
+	al.id, al.name, al.artist_id, ar.name,
+	COALESCE(MIN(NULLIF(s.year, 0)), 0), COUNT(s.id), COALESCE(SUM(s.duration), 0),
+	(SELECT cs.id FROM songs cs
+		WHERE cs.album_id = al.id AND cs.is_deleted = 0 AND cs.is_missing = 0
+			AND cs.cover_image IS NOT NULL AND cs.cover_image != ''
+		ORDER BY cs.disc_number, cs.track_number, cs.id LIMIT 1),
+	MIN(s.created_at)
+`
+
+// albumFromClause 专辑查询的表连接，只统计可见的歌曲
+const albumFromClause = `
+	FROM albums al
+	JOIN artists ar ON ar.id = al.artist_id
+	JOIN songs s ON s.album_id = al.id AND ` + visibleSongCondition + `
+`
+
+// albumSongOrder 专辑内歌曲的排序
+const albumSongOrder = "disc_number, track_number, title COLLATE NOCASE, id"
+
+// 歌曲与艺术家关联的角色
+const (
+	songArtistRoleArtist      = "artist"
+	songArtistRoleAlbumArtist = "album_artist"
+)
+
+// songCredits 歌曲拆分后的艺术家、专辑艺术家、专辑和流派
+type songCredits struct {
+	Artists      []string
+	AlbumArtists []string
+	Album        string
+	Genres       []string
+}
+
+// newSongCredits 按配置的分隔符拆分艺术家和流派标签
+// artistValues 为艺术家标签的全部取值；artistNames 不为空时直接作为艺术家列表，不再拆分
+// albumArtist 为空时使用歌曲艺术家
+func newSongCredits(cfg *config.MusicConfig, artistValues, artistNames []string, albumArtist, album, genre string) songCredits {
+	credits := songCredits{
+		Artists: utils.SplitTagValues(artistValues, cfg.ArtistSeparators),
+		Album:   album,
+		Genres:  utils.SplitTagValues([]string{genre}, cfg.GenreSeparators),
+	}
+	if len(artistNames) > 0 {
+		credits.Artists = utils.SplitTagValues(artistNames, nil)
+	}
+	if len(credits.Artists) == 0 {
+		credits.Artists = []string{"Unknown Artist"}
+	}
+	if albumArtist == "" {
+		credits.AlbumArtists = credits.Artists
+	} else {
+		credits.AlbumArtists = utils.SplitTagValues([]string{albumArtist}, cfg.ArtistSeparators)
+	}
+	if len(credits.AlbumArtists) == 0 {
+		credits.AlbumArtists = credits.Artists
+	}
+	return credits
+}
+
+// dbExecutor 兼容 *sql.DB 和 *sql.Tx
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// linkSongCredits 获取或创建歌曲的艺术家、专辑和流派，并重建歌曲的关联记录
+// 第一位艺术家作为歌曲的主艺术家，第一位专辑艺术家作为专辑的所属艺术家
+func linkSongCredits(db *sql.DB, songID int, credits songCredits) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM song_artists WHERE song_id = ?", songID); err != nil {
+		return fmt.Errorf("清除歌曲艺术家关联失败: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM song_genres WHERE song_id = ?", songID); err != nil {
+		return fmt.Errorf("清除歌曲流派关联失败: %v", err)
+	}
+
+	roles := []struct {
+		role  string
+		names []string
+	}{
+		{songArtistRoleArtist, credits.Artists},
+		{songArtistRoleAlbumArtist, credits.AlbumArtists},
+	}
+	firstIDs := make(map[string]int)
+	for _, r := range roles {
+		for i, name := range r.names {
+			artistID, err := ensureArtist(tx, name)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				firstIDs[r.role] = artistID
+			}
+			_, err = tx.Exec(
+				"INSERT OR IGNORE INTO song_artists (song_id, artist_id, role, position) VALUES (?, ?, ?, ?)",
+				songID, artistID, r.role, i,
+			)
+			if err != nil {
+				return fmt.Errorf("关联歌曲艺术家失败: %v", err)
+			}
+		}
+	}
+
+	for i, name := range credits.Genres {
+		genreID, err := ensureGenre(tx, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT OR IGNORE INTO song_genres (song_id, genre_id, position) VALUES (?, ?, ?)", songID, genreID, i)
+		if err != nil {
+			return fmt.Errorf("关联歌曲流派失败: %v", err)
+		}
+	}
+
+	albumID, err := ensureAlbum(tx, credits.Album, firstIDs[songArtistRoleAlbumArtist])
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE songs SET artist_id = ?, album_id = ? WHERE id = ?", firstIDs[songArtistRoleArtist], albumID, songID)
+	if err != nil {
+		return fmt.Errorf("更新歌曲关联失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// ensureArtist 获取或创建艺术家
+func ensureArtist(db dbExecutor, name string) (int, error) {
+	if _, err := db.Exec("INSERT OR IGNORE INTO artists (name) VALUES (?)", name); err != nil {
+		return 0, fmt.Errorf("创建艺术家失败: %v", err)
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM artists WHERE name = ?", name).Scan(&id); err != nil {
+		return 0, fmt.Errorf("查询艺术家失败: %v", err)
+	}
+	return id, nil
+}
+
+// ensureAlbum 获取或创建专辑，同名专辑按专辑艺术家区分
+func ensureAlbum(db dbExecutor, name string, artistID int) (int, error) {
+	if _, err := db.Exec("INSERT OR IGNORE INTO albums (name, artist_id) VALUES (?, ?)", name, artistID); err != nil {
+		return 0, fmt.Errorf("创建专辑失败: %v", err)
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM albums WHERE name = ? AND artist_id = ?", name, artistID).Scan(&id); err != nil {
+		return 0, fmt.Errorf("查询专辑失败: %v", err)
+	}
+	return id, nil
+}
+
+// ensureGenre 获取或创建流派
+func ensureGenre(db dbExecutor, name string) (int, error) {
+	if _, err := db.Exec("INSERT OR IGNORE INTO genres (name) VALUES (?)", name); err != nil {
+		return 0, fmt.Errorf("创建流派失败: %v", err)
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM genres WHERE name = ?", name).Scan(&id); err != nil {
+		return 0, fmt.Errorf("查询流派失败: %v", err)
+	}
+	return id, nil
+}
+
+// LinkSongEntities 根据歌曲当前的艺术家、专辑和流派文本重新关联，用于手动修改歌曲信息后
+func (ms *MusicScanner) LinkSongEntities(songID int) error {
+	var artist, album, albumArtist, genre string
+	err := ms.Db.QueryRow(`
+		SELECT COALESCE(artist, ''), COALESCE(album, ''), COALESCE(album_artist, ''), COALESCE(genre, '')
+		FROM songs WHERE id = ?
+	`, songID).Scan(&artist, &album, &albumArtist, &genre)
+	if err != nil {
+		return fmt.Errorf("查询歌曲失败: %v", err)
+	}
+
+	credits := newSongCredits(&ms.Cfg.Music, []string{artist}, nil, albumArtist, album, genre)
+	if err := linkSongCredits(ms.Db, songID, credits); err != nil {
+		return err
+	}
+	return PruneLibraryEntities(ms.Db)
+}
+
+// PruneLibraryEntities 删除已没有歌曲引用的关联记录、专辑、艺术家和流派
+func PruneLibraryEntities(db *sql.DB) error {
+	statements := []struct {
+		query string
+		name  string
+	}{
+		{"DELETE FROM song_artists WHERE NOT EXISTS (SELECT 1 FROM songs WHERE songs.id = song_artists.song_id)", "歌曲艺术家关联"},
+		{"DELETE FROM song_genres WHERE NOT EXISTS (SELECT 1 FROM songs WHERE songs.id = song_genres.song_id)", "歌曲流派关联"},
+		{"DELETE FROM albums WHERE NOT EXISTS (SELECT 1 FROM songs WHERE songs.album_id = albums.id)", "专辑"},
+		{`DELETE FROM artists
+			WHERE NOT EXISTS (SELECT 1 FROM songs WHERE songs.artist_id = artists.id)
+				AND NOT EXISTS (SELECT 1 FROM albums WHERE albums.artist_id = artists.id)
+				AND NOT EXISTS (SELECT 1 FROM song_artists WHERE song_artists.artist_id = artists.id)`, "艺术家"},
+		{"DELETE FROM genres WHERE NOT EXISTS (SELECT 1 FROM song_genres WHERE song_genres.genre_id = genres.id)", "流派"},
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt.query); err != nil {
+			return fmt.Errorf("清理%s失败: %v", stmt.name, err)
+		}
+	}
+	return nil
+}
+
+// ListArtists 分页获取艺术家列表，query不为空时按名称过滤
+func (ls *LibraryService) ListArtists(query string, limit, offset int) ([]model.Artist, int, error) {
+	var total int
+	err := ls.db.QueryRow(artistSongsCTE+`
+		SELECT COUNT(DISTINCT a.id)
+		FROM artists a
+		JOIN artist_songs x ON x.artist_id = a.id
+		WHERE a.name LIKE ?
+	`, "%"+query+"%").Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询艺术家总数失败: %v", err)
+	}
+
+	rows, err := ls.db.Query(artistSongsCTE+`
+		SELECT a.id, a.name, COUNT(DISTINCT x.album_id), COUNT(DISTINCT x.song_id)
+		FROM artists a
+		JOIN artist_songs x ON x.artist_id = a.id
+		WHERE a.name LIKE ?
+		GROUP BY a.id
+		ORDER BY a.name COLLATE NOCASE
+		LIMIT ? OFFSET ?
+	`, "%"+query+"%", limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询艺术家列表失败: %v", err)
+	}
+	defer rows.Close()
+
+	artists := []model.Artist{}
+	for rows.Next() {
+		var artist model.Artist
+		if err := rows.Scan(&artist.ID, &artist.Name, &artist.AlbumCount, &artist.SongCount); err != nil {
+			return nil, 0, fmt.Errorf("读取艺术家失败: %v", err)
+		}
+		artists = append(artists, artist)
+	}
+	return artists, total, rows.Err()
+}
+
+// GetArtist 获取艺术家详情，包括其参与的专辑和所有歌曲
+func (ls *LibraryService) GetArtist(id int) (*model.ArtistDetail, error) {
+	var detail model.ArtistDetail
+	err := ls.db.QueryRow(artistSongsCTE+`
+		SELECT a.id, a.name, COUNT(DISTINCT x.album_id), COUNT(DISTINCT x.song_id)
+		FROM artists a
+		JOIN artist_songs x ON x.artist_id = a.id
+		WHERE a.id = ?
+		GROUP BY a.id
+	`, id).Scan(&detail.ID, &detail.Name, &detail.AlbumCount, &detail.SongCount)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("艺术家不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询艺术家失败: %v", err)
+	}
+
+	rows, err := ls.db.Query(artistSongsCTE+`
+		SELECT `+albumColumns+albumFromClause+`
+		WHERE al.id IN (SELECT album_id FROM artist_songs WHERE artist_id = ?)
+		GROUP BY al.id
+		ORDER BY COALESCE(MIN(NULLIF(s.year, 0)), 9999), al.name COLLATE NOCASE
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("查询艺术家专辑失败: %v", err)
+	}
+	detail.Albums, err = scanAlbumRows(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = ls.db.Query(fmt.Sprintf(artistSongsCTE+`
+		SELECT %s
+		FROM songs
+		WHERE id IN (SELECT song_id FROM artist_songs WHERE artist_id = ?)
+		ORDER BY album COLLATE NOCASE, %s
+	`, songColumns, albumSongOrder), id)
+	if err != nil {
+		return nil, fmt.Errorf("查询艺术家歌曲失败: %v", err)
+	}
+	defer rows.Close()
+	if detail.Songs, err = scanSongRows(rows); err != nil {
+		return nil, fmt.Errorf("读取艺术家歌曲失败: %v", err)
+	}
+	if detail.Songs == nil {
+		detail.Songs = []model.Song{}
+	}
+	if err := loadSongCredits(ls.db, detail.Songs); err != nil {
+		return nil, err
+	}
+
+	return &detail, nil
+}
+
+// ListAlbums 分页获取专辑列表
+// artistID 不为0时只返回该艺术家的专辑；sort 可选 name（默认）、year、recent
+func (ls *LibraryService) ListAlbums(query string, artistID int, sort string, limit, offset int) ([]model.Album, int, error) {
+	var total int
+	err := ls.db.QueryRow(`
+		SELECT COUNT(DISTINCT al.id)
+		`+albumFromClause+`
+		WHERE al.name LIKE ? AND (? = 0 OR al.artist_id = ?)
+	`, "%"+query+"%", artistID, artistID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询专辑总数失败: %v", err)
+	}
+
+	orderBy := "al.name COLLATE NOCASE"
+	switch sort {
+	case "year":
+		orderBy = "COALESCE(MIN(NULLIF(s.year, 0)), 9999), al.name COLLATE NOCASE"
+	case "recent":
+		orderBy = "MIN(s.created_at) DESC, al.id DESC"
+	}
+
+	rows, err := ls.db.Query(`
+		SELECT `+albumColumns+albumFromClause+`
+		WHERE al.name LIKE ? AND (? = 0 OR al.artist_id = ?)
+		GROUP BY al.id
+		ORDER BY `+orderBy+`
+		LIMIT ? OFFSET ?
+	`, "%"+query+"%", artistID, artistID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询专辑列表失败: %v", err)
+	}
+	defer rows.Close()
+
+	albums, err := scanAlbumRows(rows)
+	return albums, total, err
+}
+
+// GetAlbum 获取专辑详情及按碟号、曲目号排序的歌曲列表
+func (ls *LibraryService) GetAlbum(id int) (*model.AlbumDetail, error) {
+	rows, err := ls.db.Query(`
+		SELECT `+albumColumns+albumFromClause+`
+		WHERE al.id = ?
+		GROUP BY al.id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("查询专辑失败: %v", err)
+	}
+	albums, err := scanAlbumRows(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(albums) == 0 {
+		return nil, errors.New("专辑不存在")
+	}
+
+	detail := model.AlbumDetail{Album: albums[0]}
+	songRows, err := ls.db.Query(fmt.Sprintf(`
+		SELECT %s
+		FROM songs
+		WHERE album_id = ? AND is_deleted = 0 AND is_missing = 0
+		ORDER BY %s
+	`, songColumns, albumSongOrder), id)
+	if err != nil {
+		return nil, fmt.Errorf("查询专辑歌曲失败: %v", err)
+	}
+	defer songRows.Close()
+	if detail.Songs, err = scanSongRows(songRows); err != nil {
+		return nil, fmt.Errorf("读取专辑歌曲失败: %v", err)
+	}
+	if detail.Songs == nil {
+		detail.Songs = []model.Song{}
+	}
+	if err := loadSongCredits(ls.db, detail.Songs); err != nil {
+		return nil, err
+	}
+
+	return &detail, nil
+}
+
+// scanAlbumRows 扫描专辑查询结果，查询列需与albumColumns一致
+func scanAlbumRows(rows *sql.Rows) ([]model.Album, error) {
+	albums := []model.Album{}
+	for rows.Next() {
+		var album model.Album
+		var coverSongID sql.NullInt64
+		var createdAt sql.NullString
+		err := rows.Scan(
+			&album.ID, &album.Name, &album.ArtistID, &album.Artist,
+			&album.Year, &album.SongCount, &album.Duration, &coverSongID, &createdAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("读取专辑失败: %v", err)
+		}
+		if coverSongID.Valid {
+			id := int(coverSongID.Int64)
+			album.CoverSongID = &id
+			album.CoverURL = fmt.Sprintf("/api/v1/songs/%d/cover", id)
+		}
+		album.CreatedAt = parseDBTime(createdAt)
+		albums = append(albums, album)
+	}
+	return albums, rows.Err()
+}
+
+// loadSongCredits 为歌曲填充拆分后的艺术家和流派列表
+func loadSongCredits(db *sql.DB, songs []model.Song) error {
+	// 分批查询，避免超出 SQLite 的参数数量限制
+	const batchSize = 500
+	for start := 0; start < len(songs); start += batchSize {
+		end := start + batchSize
+		if end > len(songs) {
+			end = len(songs)
+		}
+		if err := loadSongCreditsBatch(db, songs[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSongCreditsBatch 为一批歌曲填充艺术家和流派列表
+func loadSongCreditsBatch(db *sql.DB, songs []model.Song) error {
+	index := make(map[int]*model.Song, len(songs))
+	placeholders := make([]string, len(songs))
+	args := make([]interface{}, len(songs))
+	for i := range songs {
+		index[songs[i].ID] = &songs[i]
+		placeholders[i] = "?"
+		args[i] = songs[i].ID
+	}
+	inClause := strings.Join(placeholders, ", ")
+
+	rows, err := db.Query(`
+		SELECT sa.song_id, a.id, a.name, sa.role
+		FROM song_artists sa
+		JOIN artists a ON a.id = sa.artist_id
+		WHERE sa.song_id IN (`+inClause+`)
+		ORDER BY sa.song_id, CASE sa.role WHEN 'artist' THEN 0 ELSE 1 END, sa.position
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("查询歌曲艺术家失败: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var songID int
+		var credit model.ArtistCredit
+		if err := rows.Scan(&songID, &credit.ID, &credit.Name, &credit.Role); err != nil {
+			return fmt.Errorf("读取歌曲艺术家失败: %v", err)
+		}
+		if song, ok := index[songID]; ok {
+			song.Artists = append(song.Artists, credit)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取歌曲艺术家失败: %v", err)
+	}
+
+	genreRows, err := db.Query(`
+		SELECT sg.song_id, g.name
+		FROM song_genres sg
+		JOIN genres g ON g.id = sg.genre_id
+		WHERE sg.song_id IN (`+inClause+`)
+		ORDER BY sg.song_id, sg.position
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("查询歌曲流派失败: %v", err)
+	}
+	defer genreRows.Close()
+	for genreRows.Next() {
+		var songID int
+		var genre string
+		if err := genreRows.Scan(&songID, &genre); err != nil {
+			return fmt.Errorf("读取歌曲流派失败: %v", err)
+		}
+		if song, ok := index[songID]; ok {
+			song.Genres = append(song.Genres, genre)
+		}
+	}
+	return genreRows.Err()
+}
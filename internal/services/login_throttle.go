@@ -0,0 +1,150 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"melogo/internal/config"
+	"melogo/internal/utils"
+	"time"
+)
+
+const (
+	// loginFailureWindow 超过该时间没有再失败时清零失败次数
+	loginFailureWindow = 24 * time.Hour
+	// loginBackoffBase 指数退避的初始等待时间，之后每次失败翻倍
+	loginBackoffBase = time.Second
+)
+
+// LoginThrottleService 登录限流服务：按用户名和客户端IP记录连续失败次数，
+// 失败次数过半后每次失败都要等待翻倍的时间，达到上限后临时锁定
+type LoginThrottleService struct {
+	db            *sql.DB
+	maxFailures   int
+	maxIPFailures int
+	lockout       time.Duration
+	logger        *utils.Logger
+}
+
+var loginThrottleService *LoginThrottleService
+
+// NewLoginThrottleService 创建登录限流服务实例
+func NewLoginThrottleService(cfg *config.Config, db *sql.DB) *LoginThrottleService {
+	service := &LoginThrottleService{
+		db:            db,
+		maxFailures:   cfg.Auth.LoginMaxFailures,
+		maxIPFailures: cfg.Auth.LoginMaxFailuresPerIP,
+		lockout:       time.Duration(cfg.Auth.LoginLockout) * time.Minute,
+		logger:        utils.NewLogger(),
+	}
+	loginThrottleService = service
+	return service
+}
+
+// GetLoginThrottleService 获取全局登录限流服务实例
+func GetLoginThrottleService() *LoginThrottleService {
+	return loginThrottleService
+}
+
+// Check 返回用户名或IP还需要等待多久才能再次尝试登录，0 表示可以立即尝试
+func (ts *LoginThrottleService) Check(username, ip string) (time.Duration, error) {
+	var lockedUntil sql.NullString
+	err := ts.db.QueryRow(`
+		SELECT MAX(locked_until)
+		FROM login_attempts
+		WHERE (kind = 'user' AND subject = ?) OR (kind = 'ip' AND subject = ?)
+	`, username, ip).Scan(&lockedUntil)
+	if err != nil {
+		return 0, fmt.Errorf("查询登录失败记录失败: %v", err)
+	}
+	if !lockedUntil.Valid {
+		return 0, nil
+	}
+
+	wait := time.Until(parseDBTime(lockedUntil))
+	if wait <= 0 {
+		return 0, nil
+	}
+	// 向上取整到秒，避免客户端按 Retry-After 重试时仍被拒绝
+	return wait.Truncate(time.Second) + time.Second, nil
+}
+
+// RecordFailure 记录一次失败的登录，用户名不存在时同样计数，避免借此探测用户名
+func (ts *LoginThrottleService) RecordFailure(username, ip string) error {
+	if err := ts.recordFailure("user", username, ts.maxFailures); err != nil {
+		return err
+	}
+	return ts.recordFailure("ip", ip, ts.maxIPFailures)
+}
+
+// recordFailure 增加失败次数并按次数计算锁定截止时间
+func (ts *LoginThrottleService) recordFailure(kind, subject string, maxFailures int) error {
+	if subject == "" || maxFailures <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var failures int
+	err := ts.db.QueryRow(`
+		INSERT INTO login_attempts (kind, subject, failures, last_failure_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT(kind, subject) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures
+	`, kind, subject, dbTime(now), dbTime(now.Add(-loginFailureWindow))).Scan(&failures)
+	if err != nil {
+		return fmt.Errorf("记录登录失败失败: %v", err)
+	}
+
+	var lockedUntil interface{}
+	if delay := ts.backoff(failures, maxFailures); delay > 0 {
+		lockedUntil = dbTime(now.Add(delay))
+		if failures == maxFailures {
+			ts.logger.Warningf("Login locked for %s %s after %d failed attempts", kind, subject, failures)
+		}
+	}
+	if _, err := ts.db.Exec(
+		"UPDATE login_attempts SET locked_until = ? WHERE kind = ? AND subject = ?",
+		lockedUntil, kind, subject,
+	); err != nil {
+		return fmt.Errorf("记录登录失败失败: %v", err)
+	}
+	return nil
+}
+
+// backoff 前一半的失败不等待，之后从 1 秒开始每次翻倍，达到上限后锁定；
+// 锁定结束后失败次数不清零，再次失败会立即重新锁定
+func (ts *LoginThrottleService) backoff(failures, maxFailures int) time.Duration {
+	if failures >= maxFailures {
+		return ts.lockout
+	}
+	exponent := failures - maxFailures/2
+	if exponent < 0 {
+		return 0
+	}
+	if exponent > 30 {
+		return ts.lockout
+	}
+	delay := loginBackoffBase << uint(exponent)
+	if delay > ts.lockout {
+		return ts.lockout
+	}
+	return delay
+}
+
+// RecordSuccess 登录成功后清零该用户名的失败次数，并清理过期的失败记录；
+// IP的失败次数不清零，避免用自己的账号登录来重置对其他账号的尝试次数
+func (ts *LoginThrottleService) RecordSuccess(username string) {
+	if _, err := ts.db.Exec("DELETE FROM login_attempts WHERE kind = 'user' AND subject = ?", username); err != nil {
+		ts.logger.Warningf("Failed to reset login failures: %v", err)
+	}
+
+	now := time.Now()
+	_, err := ts.db.Exec(
+		"DELETE FROM login_attempts WHERE last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)",
+		dbTime(now.Add(-loginFailureWindow)), dbTime(now),
+	)
+	if err != nil {
+		ts.logger.Warningf("Failed to clean up login failures: %v", err)
+	}
+}
@@ -0,0 +1,1013 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"melogo/internal/utils"
+	"time"
+)
+
+// Migration 一次数据库结构变更，Up 和 Down 在同一个事务中执行
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error // 为 nil 表示不可回滚
+}
+
+// MigrationState 迁移的应用状态
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// ErrNoMigrationToRollback 没有可回滚的迁移
+var ErrNoMigrationToRollback = errors.New("no applied migration to roll back")
+
+// migrations 按版本号递增排列的迁移列表，新的结构变更只能追加到末尾
+var migrations = []Migration{
+	{Version: 1, Name: "initial schema", Up: migrateInitialSchema},
+	{Version: 2, Name: "add indexes and unique constraints", Up: migrateAddIndexes, Down: rollbackAddIndexes},
+	{Version: 3, Name: "add play events", Up: migratePlayEvents, Down: rollbackPlayEvents},
+	{Version: 4, Name: "add scrobble accounts and queue", Up: migrateScrobbleQueue, Down: rollbackScrobbleQueue},
+	{Version: 5, Name: "add play queues", Up: migratePlayQueues, Down: rollbackPlayQueues},
+	{Version: 6, Name: "allow duplicate playlist songs", Up: migratePlaylistDuplicates, Down: rollbackPlaylistDuplicates},
+	{Version: 7, Name: "add playlist collaborators and followers", Up: migratePlaylistSharing, Down: rollbackPlaylistSharing},
+	{Version: 8, Name: "add server playlists", Up: migrateServerPlaylists, Down: rollbackServerPlaylists},
+	{Version: 9, Name: "add smart playlists", Up: migrateSmartPlaylists, Down: rollbackSmartPlaylists},
+	{Version: 10, Name: "generalise favorites and add ratings", Up: migrateFavoriteItems, Down: rollbackFavoriteItems},
+	{Version: 11, Name: "add disabled users", Up: migrateDisabledUsers, Down: rollbackDisabledUsers},
+	{Version: 12, Name: "add sessions and revoked tokens", Up: migrateSessions, Down: rollbackSessions},
+	{Version: 13, Name: "add api keys", Up: migrateAPIKeys, Down: rollbackAPIKeys},
+	{Version: 14, Name: "add login attempts", Up: migrateLoginAttempts, Down: rollbackLoginAttempts},
+	{Version: 15, Name: "add two-factor authentication", Up: migrateTwoFactor, Down: rollbackTwoFactor},
+	{Version: 16, Name: "store empty emails as null", Up: migrateNullEmails, Down: rollbackDataOnly},
+	{Version: 17, Name: "drop stored account passwords", Up: migrateDropStoredPasswords, Down: rollbackDataOnly},
+}
+
+// ensureMigrationsTable 创建记录已应用迁移的 schema_migrations 表
+func ensureMigrationsTable() error {
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+// appliedMigrations 查询已应用的迁移版本及应用时间
+func appliedMigrations() (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus 返回所有迁移及其应用状态
+func MigrationStatus() ([]MigrationState, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// MigrateUp 按顺序应用所有尚未应用的迁移，返回本次应用的数量
+func MigrateUp() (int, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := runMigration(m.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		utils.NewLogger().Infof("Applied migration %d: %s", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown 回滚最近应用的一个迁移，返回被回滚的迁移
+func MigrateDown() (*Migration, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return nil, fmt.Errorf("migration %d (%s) cannot be rolled back", m.Version, m.Name)
+		}
+		err := runMigration(m.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rollback of migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		utils.NewLogger().Infof("Rolled back migration %d: %s", m.Version, m.Name)
+		return &m, nil
+	}
+	return nil, ErrNoMigrationToRollback
+}
+
+// runMigration 在一个事务中执行迁移并更新 schema_migrations
+func runMigration(migrate, record func(tx *sql.Tx) error) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := migrate(tx); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateAddIndexes 为常用查询添加索引，并为不应重复的数据添加唯一约束（添加前先清理已有的重复数据）
+func migrateAddIndexes(tx *sql.Tx) error {
+	statements := []string{
+		// 同一文件只保留最早的歌曲记录
+		`DELETE FROM songs WHERE id NOT IN (SELECT MIN(id) FROM songs GROUP BY file_path)`,
+		`DROP INDEX IF EXISTS idx_songs_file_path`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_songs_file_path ON songs(file_path)`,
+		`CREATE INDEX IF NOT EXISTS idx_songs_visible ON songs(is_deleted, is_missing)`,
+
+		`DELETE FROM favorites WHERE id NOT IN (SELECT MIN(id) FROM favorites GROUP BY user_id, song_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_favorites_user_song ON favorites(user_id, song_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_favorites_song_id ON favorites(song_id)`,
+
+		`DELETE FROM playlist_songs WHERE id NOT IN (SELECT MIN(id) FROM playlist_songs GROUP BY playlist_id, song_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_playlist_songs_playlist_song ON playlist_songs(playlist_id, song_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_playlist_songs_playlist_order ON playlist_songs(playlist_id, order_index)`,
+		`CREATE INDEX IF NOT EXISTS idx_playlist_songs_song_id ON playlist_songs(song_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_playlists_user_id ON playlists(user_id)`,
+
+		`CREATE INDEX IF NOT EXISTS idx_search_history_user ON search_history(user_id, searched_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackAddIndexes 删除 migrateAddIndexes 添加的索引，已清理的重复数据不会恢复
+func rollbackAddIndexes(tx *sql.Tx) error {
+	statements := []string{
+		`DROP INDEX IF EXISTS idx_songs_file_path`,
+		`CREATE INDEX IF NOT EXISTS idx_songs_file_path ON songs(file_path)`,
+		`DROP INDEX IF EXISTS idx_songs_visible`,
+		`DROP INDEX IF EXISTS idx_favorites_user_song`,
+		`DROP INDEX IF EXISTS idx_favorites_song_id`,
+		`DROP INDEX IF EXISTS idx_playlist_songs_playlist_song`,
+		`DROP INDEX IF EXISTS idx_playlist_songs_playlist_order`,
+		`DROP INDEX IF EXISTS idx_playlist_songs_song_id`,
+		`DROP INDEX IF EXISTS idx_playlists_user_id`,
+		`DROP INDEX IF EXISTS idx_search_history_user`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePlayEvents 添加播放记录表和按用户统计的播放次数表
+func migratePlayEvents(tx *sql.Tx) error {
+	statements := []string{
+		// completed 表示该次播放满足计数规则，已计入播放次数
+		`CREATE TABLE IF NOT EXISTS play_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			started_at DATETIME NOT NULL,
+			played_ms INTEGER NOT NULL DEFAULT 0,
+			completed BOOLEAN NOT NULL DEFAULT 0,
+			client VARCHAR(100) NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// 同一次播放重复提交时只记录一次
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_play_events_user_song_started ON play_events(user_id, song_id, started_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_play_events_user_started ON play_events(user_id, started_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_play_events_song_id ON play_events(song_id)`,
+
+		`CREATE TABLE IF NOT EXISTS user_song_stats (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			play_count INTEGER NOT NULL DEFAULT 0,
+			last_played_at DATETIME,
+			PRIMARY KEY (user_id, song_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_song_stats_last_played ON user_song_stats(user_id, last_played_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackPlayEvents 删除播放记录表和按用户统计的播放次数表
+func rollbackPlayEvents(tx *sql.Tx) error {
+	statements := []string{
+		`DROP TABLE IF EXISTS user_song_stats`,
+		`DROP TABLE IF EXISTS play_events`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateScrobbleQueue 添加外部播放记录服务账号表和待提交队列表
+func migrateScrobbleQueue(tx *sql.Tx) error {
+	statements := []string{
+		// token 为加密保存的 API 令牌，api_url 为空时使用配置中的默认地址
+		`CREATE TABLE IF NOT EXISTS scrobble_accounts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			provider VARCHAR(20) NOT NULL,
+			token TEXT NOT NULL,
+			api_url VARCHAR(255) NOT NULL DEFAULT '',
+			username VARCHAR(100) NOT NULL DEFAULT '',
+			enabled BOOLEAN NOT NULL DEFAULT 1,
+			last_error TEXT NOT NULL DEFAULT '',
+			last_submitted_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, provider)
+		)`,
+
+		// payload 为提交时使用的歌曲信息（JSON），歌曲删除后仍可提交
+		`CREATE TABLE IF NOT EXISTS scrobble_queue (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			account_id INTEGER NOT NULL REFERENCES scrobble_accounts(id) ON DELETE CASCADE,
+			play_event_id INTEGER REFERENCES play_events(id) ON DELETE SET NULL,
+			payload TEXT NOT NULL,
+			listened_at DATETIME NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_scrobble_queue_next_attempt ON scrobble_queue(next_attempt_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_scrobble_queue_account ON scrobble_queue(account_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackScrobbleQueue 删除外部播放记录服务账号表和待提交队列表
+func rollbackScrobbleQueue(tx *sql.Tx) error {
+	statements := []string{
+		`DROP TABLE IF EXISTS scrobble_queue`,
+		`DROP TABLE IF EXISTS scrobble_accounts`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePlayQueues 添加按用户保存的播放队列表
+func migratePlayQueues(tx *sql.Tx) error {
+	statements := []string{
+		// version 每次修改递增，用于检测多个设备的并发修改
+		`CREATE TABLE IF NOT EXISTS play_queues (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			current_index INTEGER NOT NULL DEFAULT -1,
+			position_ms INTEGER NOT NULL DEFAULT 0,
+			shuffle BOOLEAN NOT NULL DEFAULT 0,
+			repeat_mode VARCHAR(10) NOT NULL DEFAULT 'off',
+			device VARCHAR(100) NOT NULL DEFAULT '',
+			version INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS play_queue_items (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			PRIMARY KEY (user_id, position)
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackPlayQueues 删除播放队列表
+func rollbackPlayQueues(tx *sql.Tx) error {
+	statements := []string{
+		`DROP TABLE IF EXISTS play_queue_items`,
+		`DROP TABLE IF EXISTS play_queues`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePlaylistDuplicates 允许同一首歌在播放列表中出现多次，并按当前顺序将 order_index 重新编号为从 0 开始的连续序号
+func migratePlaylistDuplicates(tx *sql.Tx) error {
+	statements := []string{
+		`DROP INDEX IF EXISTS idx_playlist_songs_playlist_song`,
+		`CREATE INDEX IF NOT EXISTS idx_playlist_songs_playlist_song ON playlist_songs(playlist_id, song_id)`,
+		`UPDATE playlist_songs SET order_index = (
+			SELECT COUNT(*) FROM playlist_songs other
+			WHERE other.playlist_id = playlist_songs.playlist_id
+			  AND (COALESCE(other.order_index, 0) < COALESCE(playlist_songs.order_index, 0)
+			    OR (COALESCE(other.order_index, 0) = COALESCE(playlist_songs.order_index, 0) AND other.id < playlist_songs.id))
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackPlaylistDuplicates 恢复唯一约束，重复的歌曲只保留最早添加的一条
+func rollbackPlaylistDuplicates(tx *sql.Tx) error {
+	statements := []string{
+		`DELETE FROM playlist_songs WHERE id NOT IN (SELECT MIN(id) FROM playlist_songs GROUP BY playlist_id, song_id)`,
+		`DROP INDEX IF EXISTS idx_playlist_songs_playlist_song`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_playlist_songs_playlist_song ON playlist_songs(playlist_id, song_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePlaylistSharing 添加播放列表协作者和关注者表
+func migratePlaylistSharing(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS playlist_collaborators (
+			playlist_id INTEGER NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (playlist_id, user_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_playlist_collaborators_user ON playlist_collaborators(user_id)`,
+		`CREATE TABLE IF NOT EXISTS playlist_followers (
+			playlist_id INTEGER NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			followed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (playlist_id, user_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_playlist_followers_user ON playlist_followers(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_playlists_public ON playlists(is_public)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackPlaylistSharing 删除播放列表协作者和关注者表
+func rollbackPlaylistSharing(tx *sql.Tx) error {
+	statements := []string{
+		`DROP INDEX IF EXISTS idx_playlists_public`,
+		`DROP TABLE IF EXISTS playlist_followers`,
+		`DROP TABLE IF EXISTS playlist_collaborators`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateServerPlaylists 为播放列表添加 source_path，记录从音乐目录中的播放列表文件导入的只读服务器播放列表
+func migrateServerPlaylists(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE playlists ADD COLUMN source_path TEXT`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_playlists_source_path ON playlists(source_path) WHERE source_path IS NOT NULL`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackServerPlaylists 删除服务器播放列表及 source_path 列
+func rollbackServerPlaylists(tx *sql.Tx) error {
+	statements := []string{
+		`DELETE FROM playlist_songs WHERE playlist_id IN (SELECT id FROM playlists WHERE source_path IS NOT NULL)`,
+		`DELETE FROM playlist_followers WHERE playlist_id IN (SELECT id FROM playlists WHERE source_path IS NOT NULL)`,
+		`DELETE FROM playlists WHERE source_path IS NOT NULL`,
+		`DROP INDEX IF EXISTS idx_playlists_source_path`,
+		`ALTER TABLE playlists DROP COLUMN source_path`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateSmartPlaylists 添加智能播放列表表，rules 为 JSON 格式的规则定义
+func migrateSmartPlaylists(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS smart_playlists (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			is_public BOOLEAN DEFAULT 0,
+			rules TEXT NOT NULL,
+			sort TEXT NOT NULL DEFAULT 'artist',
+			sort_order TEXT NOT NULL DEFAULT 'asc',
+			limit_count INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_smart_playlists_user ON smart_playlists(user_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackSmartPlaylists 删除智能播放列表表
+func rollbackSmartPlaylists(tx *sql.Tx) error {
+	statements := []string{
+		`DROP INDEX IF EXISTS idx_smart_playlists_user`,
+		`DROP TABLE IF EXISTS smart_playlists`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateFavoriteItems 将收藏扩展到歌曲、专辑、艺术家和播放列表，并增加评分
+// loved_at 为空表示只评分未收藏；原有的歌曲收藏以收藏时间作为 loved_at 迁移
+func migrateFavoriteItems(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE favorite_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			item_type TEXT NOT NULL,
+			item_id INTEGER NOT NULL,
+			rating INTEGER NOT NULL DEFAULT 0,
+			loved_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, item_type, item_id)
+		)`,
+		`INSERT OR IGNORE INTO favorite_items (user_id, item_type, item_id, loved_at, created_at, updated_at)
+			SELECT user_id, 'song', song_id, COALESCE(created_at, CURRENT_TIMESTAMP), COALESCE(created_at, CURRENT_TIMESTAMP), COALESCE(created_at, CURRENT_TIMESTAMP)
+			FROM favorites
+			WHERE user_id IS NOT NULL AND song_id IS NOT NULL
+			ORDER BY id`,
+		`DROP TABLE favorites`,
+		`ALTER TABLE favorite_items RENAME TO favorites`,
+		`CREATE INDEX IF NOT EXISTS idx_favorites_item ON favorites(item_type, item_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_favorites_user_loved ON favorites(user_id, loved_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackFavoriteItems 恢复只包含歌曲收藏的 favorites 表，其他类型的收藏和评分会丢失
+func rollbackFavoriteItems(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE favorite_songs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			song_id INTEGER REFERENCES songs(id) ON DELETE CASCADE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`INSERT INTO favorite_songs (user_id, song_id, created_at)
+			SELECT user_id, item_id, loved_at FROM favorites
+			WHERE item_type = 'song' AND loved_at IS NOT NULL
+			ORDER BY id`,
+		`DROP TABLE favorites`,
+		`ALTER TABLE favorite_songs RENAME TO favorites`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_favorites_user_song ON favorites(user_id, song_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_favorites_song_id ON favorites(song_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateDisabledUsers 添加 is_disabled 列，被禁用的用户不能登录
+func migrateDisabledUsers(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE users ADD COLUMN is_disabled INTEGER NOT NULL DEFAULT 0`)
+	return err
+}
+
+// rollbackDisabledUsers 删除 is_disabled 列
+func rollbackDisabledUsers(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE users DROP COLUMN is_disabled`)
+	return err
+}
+
+// migrateSessions 登录会话（保存刷新令牌摘要）和已吊销访问令牌的 jti
+// previous_token_hash 保存轮换前的刷新令牌摘要，用于发现被盗用的刷新令牌
+func migrateSessions(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			refresh_token_hash TEXT NOT NULL UNIQUE,
+			previous_token_hash TEXT,
+			user_agent TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			rotated_at DATETIME,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_previous_token ON sessions(previous_token_hash)`,
+		`CREATE TABLE IF NOT EXISTS revoked_tokens (
+			jti TEXT PRIMARY KEY,
+			expires_at DATETIME NOT NULL
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackSessions 删除会话表和吊销列表
+func rollbackSessions(tx *sql.Tx) error {
+	statements := []string{
+		`DROP TABLE IF EXISTS revoked_tokens`,
+		`DROP INDEX IF EXISTS idx_sessions_previous_token`,
+		`DROP INDEX IF EXISTS idx_sessions_user`,
+		`DROP TABLE IF EXISTS sessions`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAPIKeys 用户的 API 密钥，只保存密钥摘要；scopes 为逗号分隔的权限列表
+func migrateAPIKeys(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			key_prefix TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			scopes TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackAPIKeys 删除 API 密钥表
+func rollbackAPIKeys(tx *sql.Tx) error {
+	statements := []string{
+		`DROP INDEX IF EXISTS idx_api_keys_user`,
+		`DROP TABLE IF EXISTS api_keys`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLoginAttempts 按用户名和客户端IP记录连续登录失败次数及锁定截止时间；kind 为 user 或 ip
+func migrateLoginAttempts(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS login_attempts (
+		kind TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		failures INTEGER NOT NULL DEFAULT 0,
+		last_failure_at DATETIME NOT NULL,
+		locked_until DATETIME,
+		PRIMARY KEY (kind, subject)
+	)`)
+	return err
+}
+
+// rollbackLoginAttempts 删除登录失败记录表
+func rollbackLoginAttempts(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE IF EXISTS login_attempts`)
+	return err
+}
+
+// migrateTwoFactor 两步验证：users 保存加密的 TOTP 密钥、是否已启用以及最后使用的时间步（防止验证码重放），
+// recovery_codes 保存一次性恢复码的摘要，login_challenges 保存密码验证通过后等待两步验证的预认证令牌摘要
+func migrateTwoFactor(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE users ADD COLUMN totp_secret TEXT`,
+		`ALTER TABLE users ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0`,
+		`CREATE TABLE IF NOT EXISTS recovery_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash TEXT NOT NULL,
+			used_at DATETIME
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id)`,
+		`CREATE TABLE IF NOT EXISTS login_challenges (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash TEXT NOT NULL UNIQUE,
+			purpose TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			expires_at DATETIME NOT NULL
+		)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackTwoFactor 删除两步验证相关的表和列
+func rollbackTwoFactor(tx *sql.Tx) error {
+	statements := []string{
+		`DROP TABLE IF EXISTS login_challenges`,
+		`DROP INDEX IF EXISTS idx_recovery_codes_user`,
+		`DROP TABLE IF EXISTS recovery_codes`,
+		`ALTER TABLE users DROP COLUMN totp_last_step`,
+		`ALTER TABLE users DROP COLUMN totp_enabled`,
+		`ALTER TABLE users DROP COLUMN totp_secret`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateNullEmails 旧版本把未填写的邮箱保存为空字符串，多个这样的用户会违反 email 的唯一约束；
+// 表结构不变，NULL 对旧版本同样有效，回滚时保持数据不变
+func migrateNullEmails(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE users SET email = NULL WHERE email = ''`)
+	return err
+}
+
+// rollbackDataOnly 只修改数据、不改变表结构的迁移回滚时无需操作，
+// 使更早的迁移仍然可以继续回滚
+func rollbackDataOnly(tx *sql.Tx) error {
+	return nil
+}
+
+// migrateDropStoredPasswords 旧版本在 subsonic_password 中保存了可解密的账号密码，全部删除；
+// 用户需要在个人资料页面重新生成单独的 Subsonic 密码；删除的密码无法恢复，
+// 回滚时只撤销迁移记录，表结构不变
+func migrateDropStoredPasswords(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE users SET subsonic_password = NULL`)
+	return err
+}
+
+// migrateInitialSchema 初始表结构，同时为迁移框架引入之前创建的旧数据库补充缺失的列
+func migrateInitialSchema(tx *sql.Tx) error {
+	// 首先创建表
+	tables := []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username VARCHAR(50) UNIQUE NOT NULL,
+			password_hash VARCHAR(255) NOT NULL,
+			email VARCHAR(100) UNIQUE,
+			avatar TEXT,
+			avatar_blob BLOB,
+			subsonic_password TEXT,
+			max_bitrate INTEGER DEFAULT 0,
+			is_admin INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS songs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title VARCHAR(200) NOT NULL,
+			artist VARCHAR(100),
+			album VARCHAR(100),
+			duration INTEGER,
+			file_path TEXT NOT NULL,
+			cover_image TEXT,
+			lyrics_path TEXT,
+			play_count INTEGER DEFAULT 0,
+			is_collect INTEGER DEFAULT 0,
+			is_deleted INTEGER DEFAULT 0,
+			file_size INTEGER DEFAULT 0,
+			file_mtime INTEGER DEFAULT 0,
+			content_hash TEXT,
+			is_missing INTEGER DEFAULT 0,
+			album_artist TEXT DEFAULT '',
+			track_number INTEGER DEFAULT 0,
+			disc_number INTEGER DEFAULT 0,
+			year INTEGER DEFAULT 0,
+			genre TEXT DEFAULT '',
+			composer TEXT DEFAULT '',
+			bpm INTEGER DEFAULT 0,
+			mb_recording_id TEXT DEFAULT '',
+			mb_release_id TEXT DEFAULT '',
+			mb_artist_id TEXT DEFAULT '',
+			replaygain_track_gain REAL,
+			replaygain_track_peak REAL,
+			replaygain_album_gain REAL,
+			replaygain_album_peak REAL,
+			bit_rate INTEGER DEFAULT 0,
+			sample_rate INTEGER DEFAULT 0,
+			channels INTEGER DEFAULT 0,
+			codec TEXT DEFAULT '',
+			artist_id INTEGER REFERENCES artists(id) ON DELETE SET NULL,
+			album_id INTEGER REFERENCES albums(id) ON DELETE SET NULL,
+			metadata_version INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS artists (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS albums (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL COLLATE NOCASE,
+			artist_id INTEGER NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(name, artist_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS song_artists (
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			artist_id INTEGER NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+			role TEXT NOT NULL DEFAULT 'artist',
+			position INTEGER DEFAULT 0,
+			PRIMARY KEY (song_id, artist_id, role)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS genres (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS song_genres (
+			song_id INTEGER NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+			genre_id INTEGER NOT NULL REFERENCES genres(id) ON DELETE CASCADE,
+			position INTEGER DEFAULT 0,
+			PRIMARY KEY (song_id, genre_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS playlists (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name VARCHAR(100) NOT NULL,
+			user_id INTEGER REFERENCES users(id),
+			is_public BOOLEAN DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS playlist_songs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			playlist_id INTEGER REFERENCES playlists(id) ON DELETE CASCADE,
+			song_id INTEGER REFERENCES songs(id) ON DELETE CASCADE,
+			order_index INTEGER,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS favorites (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			song_id INTEGER REFERENCES songs(id) ON DELETE CASCADE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS search_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			keyword VARCHAR(200) NOT NULL,
+			searched_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS configurations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			key VARCHAR(100) UNIQUE NOT NULL,
+			value TEXT,
+			description TEXT
+		)`,
+	}
+
+	for _, tableSQL := range tables {
+		_, err := tx.Exec(tableSQL)
+		if err != nil {
+			return fmt.Errorf("failed to create table: %v", err)
+		}
+	}
+
+	// 为旧版本数据库补充新增的列
+	if err := addMissingColumns(tx); err != nil {
+		return fmt.Errorf("failed to add missing columns: %v", err)
+	}
+
+	// 创建索引（依赖补充的列，需在其后执行）
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_songs_file_path ON songs(file_path)`,
+		`CREATE INDEX IF NOT EXISTS idx_songs_content_hash ON songs(content_hash)`,
+		`CREATE INDEX IF NOT EXISTS idx_songs_artist_id ON songs(artist_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_songs_album_id ON songs(album_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_song_artists_artist_id ON song_artists(artist_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_song_genres_genre_id ON song_genres(genre_id)`,
+	}
+	for _, indexSQL := range indexes {
+		if _, err := tx.Exec(indexSQL); err != nil {
+			return fmt.Errorf("failed to create index: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// columnDefinition 描述一个需要保证存在的列
+type columnDefinition struct {
+	Table      string
+	Column     string
+	Definition string
+}
+
+// addMissingColumns 检查已有表结构，为缺失的列执行 ALTER TABLE
+func addMissingColumns(tx *sql.Tx) error {
+	columns := []columnDefinition{
+		{Table: "users", Column: "subsonic_password", Definition: "TEXT"},
+		{Table: "users", Column: "max_bitrate", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "file_size", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "file_mtime", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "content_hash", Definition: "TEXT"},
+		{Table: "songs", Column: "is_missing", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "album_artist", Definition: "TEXT DEFAULT ''"},
+		{Table: "songs", Column: "track_number", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "disc_number", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "year", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "genre", Definition: "TEXT DEFAULT ''"},
+		{Table: "songs", Column: "composer", Definition: "TEXT DEFAULT ''"},
+		{Table: "songs", Column: "bpm", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "mb_recording_id", Definition: "TEXT DEFAULT ''"},
+		{Table: "songs", Column: "mb_release_id", Definition: "TEXT DEFAULT ''"},
+		{Table: "songs", Column: "mb_artist_id", Definition: "TEXT DEFAULT ''"},
+		{Table: "songs", Column: "replaygain_track_gain", Definition: "REAL"},
+		{Table: "songs", Column: "replaygain_track_peak", Definition: "REAL"},
+		{Table: "songs", Column: "replaygain_album_gain", Definition: "REAL"},
+		{Table: "songs", Column: "replaygain_album_peak", Definition: "REAL"},
+		{Table: "songs", Column: "bit_rate", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "sample_rate", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "channels", Definition: "INTEGER DEFAULT 0"},
+		{Table: "songs", Column: "codec", Definition: "TEXT DEFAULT ''"},
+		{Table: "songs", Column: "artist_id", Definition: "INTEGER REFERENCES artists(id) ON DELETE SET NULL"},
+		{Table: "songs", Column: "album_id", Definition: "INTEGER REFERENCES albums(id) ON DELETE SET NULL"},
+		{Table: "songs", Column: "metadata_version", Definition: "INTEGER DEFAULT 0"},
+	}
+
+	for _, col := range columns {
+		exists, err := columnExists(tx, col.Table, col.Column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.Table, col.Column, col.Definition)
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %v", col.Table, col.Column, err)
+		}
+	}
+
+	return nil
+}
+
+// columnExists 检查表中是否存在指定列
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"melogo/internal/model"
+	"melogo/internal/utils"
+	"time"
+)
+
+// songTagColumns 扩展标签和音频属性列，顺序需与 songTagFields 一致
+const songTagColumns = `album_artist, track_number, disc_number, year, genre, composer, bpm,
+	mb_recording_id, mb_release_id, mb_artist_id,
+	replaygain_track_gain, replaygain_track_peak, replaygain_album_gain, replaygain_album_peak,
+	bit_rate, sample_rate, channels, codec`
+
+// songTagFields 返回扩展标签各字段的指针，顺序与 songTagColumns 一致，可用于扫描和写入
+func songTagFields(tags *model.SongTags) []interface{} {
+	return []interface{}{
+		&tags.AlbumArtist, &tags.TrackNumber, &tags.DiscNumber, &tags.Year, &tags.Genre, &tags.Composer, &tags.BPM,
+		&tags.MusicBrainzRecordingID, &tags.MusicBrainzReleaseID, &tags.MusicBrainzArtistID,
+		&tags.ReplayGainTrackGain, &tags.ReplayGainTrackPeak, &tags.ReplayGainAlbumGain, &tags.ReplayGainAlbumPeak,
+		&tags.BitRate, &tags.SampleRate, &tags.Channels, &tags.Codec,
+	}
+}
+
+// songColumns 查询完整歌曲信息时使用的列
+const songColumns = `id, title, artist, album, artist_id, album_id,
+	duration, file_path, file_size, cover_image, lyrics_path, play_count, is_collect, is_deleted, is_missing, created_at, updated_at,
+	` + songTagColumns
+
+// songArtistMatch 匹配歌曲任一艺术家名称的条件，需要一个 LIKE 参数，查询需以 songs 为表名
+const songArtistMatch = `EXISTS (
+	SELECT 1 FROM song_artists sa
+	JOIN artists a ON a.id = sa.artist_id
+	WHERE sa.song_id = songs.id AND a.name LIKE ?
+)`
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSong 扫描一行歌曲数据，查询列需与songColumns一致
+func scanSong(row rowScanner) (*model.Song, error) {
+	var song model.Song
+	dest := []interface{}{
+		&song.ID, &song.Title, &song.Artist, &song.Album, &song.ArtistID, &song.AlbumID,
+		&song.Duration, &song.FilePath, &song.FileSize, &song.CoverImage, &song.LyricsPath,
+		&song.PlayCount, &song.IsCollect, &song.IsDeleted, &song.IsMissing, &song.CreatedAt, &song.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, songTagFields(&song.SongTags)...)...); err != nil {
+		return nil, err
+	}
+	return &song, nil
+}
+
+// scanSongRows 将查询结果扫描为歌曲列表，查询列需与songColumns一致
+func scanSongRows(rows *sql.Rows) ([]model.Song, error) {
+	var songs []model.Song
+	for rows.Next() {
+		song, err := scanSong(rows)
+		if err != nil {
+			return nil, err
+		}
+		songs = append(songs, *song)
+	}
+	return songs, rows.Err()
+}
+
+// parseDBTime 解析聚合查询返回的时间字符串（聚合结果不携带列类型，驱动不会自动转换）
+func parseDBTime(value sql.NullString) time.Time {
+	if !value.Valid {
+		return time.Time{}
+	}
+	layouts := []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05Z",
+		"2006-01-02",
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value.String); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// SearchSongsPaged 分页搜索歌曲，query为空时返回全部
+func (ms *MusicScanner) SearchSongsPaged(query string, limit, offset int) ([]model.Song, error) {
+	searchQuery := "%" + query + "%"
+	sqlQuery := fmt.Sprintf(`
+		SELECT %s
+		FROM songs
+		WHERE (title LIKE ? OR artist LIKE ? OR album LIKE ? OR %s) AND is_deleted = 0 AND is_missing = 0
+		ORDER BY id
+		LIMIT ? OFFSET ?
+	`, songColumns, songArtistMatch)
+	rows, err := ms.Db.Query(sqlQuery, searchQuery, searchQuery, searchQuery, searchQuery, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSongRows(rows)
+}
+
+// ResolvePath 将数据库中保存的相对路径解析为音乐目录下的绝对路径
+func (ms *MusicScanner) ResolvePath(relPath string) (string, error) {
+	return utils.SafeJoin(ms.Cfg.Music.Directory, relPath)
+}
+
+// ResolveMusicPath 解析音乐目录下相对路径的便捷函数
+func ResolveMusicPath(relPath string) (string, error) {
+	if GlobalMusicScanner == nil {
+		return "", fmt.Errorf("music scanner not initialized")
+	}
+	return GlobalMusicScanner.ResolvePath(relPath)
+}
@@ -2,14 +2,19 @@ package services
 
 import (
 	"context"
+	"crypto/sha1"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"melogo/internal/config"
 	"melogo/internal/model"
 	"melogo/internal/utils"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mattn/go-sqlite3"
@@ -19,7 +24,6 @@ import (
 var (
 	// GlobalMusicScanner 全局音乐扫描器实例
 	GlobalMusicScanner *MusicScanner
-	Collecting         bool = false
 )
 
 // MusicScanner 音乐扫描器
@@ -29,6 +33,13 @@ type MusicScanner struct {
 	Logger        *utils.Logger
 	LyricsScraper *utils.LyricsScraper
 	cancel        context.CancelFunc
+	// processMu 保证完整扫描与文件监听不会同时写入歌曲记录
+	processMu sync.Mutex
+
+	// stateMu 保护扫描状态及其订阅者
+	stateMu  sync.Mutex
+	status   model.ScanStatus
+	watchers map[chan struct{}]struct{}
 }
 
 // NewMusicScanner 创建新的音乐扫描器
@@ -50,8 +61,15 @@ func (ms *MusicScanner) Start() {
 	ctx, cancel := context.WithCancel(context.Background())
 	ms.cancel = cancel
 
-	// 立即执行一次扫描
-	// go ms.scanMusicDirectory()
+	// 监听模式：先开始监听，再补扫一次停机期间的变化
+	if ms.Cfg.Music.Watch {
+		if err := ms.startWatcher(ctx); err != nil {
+			ms.Logger.Warningf("Filesystem watch unavailable, falling back to periodic scanning: %v", err)
+		}
+		if err := ms.StartScan(ScanOptions{Trigger: ScanTriggerWatch}); err != nil {
+			ms.Logger.Warningf("Failed to start initial scan: %v", err)
+		}
+	}
 
 	// 启动定时任务，根据配置的时间间隔扫描
 	scanInterval := time.Duration(ms.Cfg.Music.ScanInterval) * time.Minute
@@ -80,17 +98,22 @@ func (ms *MusicScanner) Stop() {
 	}
 }
 
-// scanMusicDirectory 扫描音乐目录
+// scanMusicDirectory 定时触发的增量扫描，已有扫描进行中时跳过
 func (ms *MusicScanner) scanMusicDirectory() {
-	if Collecting {
-		ms.Logger.Info("Collector is already running")
-		return
+	if err := ms.StartScan(ScanOptions{Trigger: ScanTriggerSchedule}); err != nil {
+		ms.Logger.Infof("Skipping scheduled scan: %v", err)
 	}
-	ms.Logger.Info("Starting music directory scan...")
+}
+
+// runScan 扫描音乐目录，root 为实际遍历的目录（整个音乐目录或其子目录）
+func (ms *MusicScanner) runScan(opts ScanOptions, root string) {
+	defer ms.finishScan()
+	ms.Logger.Infof("Starting music directory scan (%s, full=%t): %s", opts.Trigger, opts.Full, root)
 
 	// 检查音乐目录是否存在
 	if _, err := os.Stat(ms.Cfg.Music.Directory); os.IsNotExist(err) {
 		ms.Logger.Warningf("Music directory does not exist: %s", ms.Cfg.Music.Directory)
+		ms.recordScanError(ms.Cfg.Music.Directory, err)
 		return
 	}
 
@@ -100,13 +123,28 @@ func (ms *MusicScanner) scanMusicDirectory() {
 		supportedFormats[format] = true
 	}
 
+	ms.processMu.Lock()
+
+	// 记录扫描前数据库中的歌曲路径，扫描后仍未出现的即为丢失的文件
+	knownSongs, err := ms.loadKnownSongPaths(opts.Path)
+	if err != nil {
+		ms.processMu.Unlock()
+		ms.Logger.Errorf("Error loading known songs: %v", err)
+		ms.recordScanError(root, err)
+		return
+	}
+	var unreadableDirs []string
+	var playlistFiles []string
+
 	// 收集meta信息
 	var metas []*songMetadata
 
 	// 遍历音乐目录
-	err := filepath.Walk(ms.Cfg.Music.Directory, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			ms.Logger.Errorf("Error accessing path %s: %v", path, err)
+			unreadableDirs = append(unreadableDirs, path)
+			ms.recordScanError(path, err)
 			return nil
 		}
 
@@ -115,16 +153,43 @@ func (ms *MusicScanner) scanMusicDirectory() {
 			return nil
 		}
 
-		// 检查文件扩展名
+		// 检查文件扩展名，播放列表文件在歌曲扫描完成后处理
 		ext := strings.ToLower(filepath.Ext(path))
+		if playlistFileExtensions[ext] {
+			if relPath, err := filepath.Rel(ms.Cfg.Music.Directory, path); err == nil {
+				playlistFiles = append(playlistFiles, relPath)
+			}
+			return nil
+		}
 		if !supportedFormats[ext] {
 			return nil
 		}
 
+		if relPath, err := filepath.Rel(ms.Cfg.Music.Directory, path); err == nil {
+			delete(knownSongs, relPath)
+		}
+		ms.updateScanStatus(func(status *model.ScanStatus) { status.FilesSeen++ })
+
 		// 处理音频文件
-		if meta, err := ms.processAudioFile(path, info); err != nil {
+		meta, result, err := ms.processAudioFile(path, info, opts.Full)
+		if err != nil {
 			ms.Logger.Errorf("Error processing file %s: %v", path, err)
-		} else if meta != nil {
+			ms.recordScanError(path, err)
+			return nil
+		}
+		ms.updateScanStatus(func(status *model.ScanStatus) {
+			switch result {
+			case scanResultAdded:
+				status.Added++
+			case scanResultUpdated:
+				status.Updated++
+			case scanResultMoved:
+				status.Moved++
+			default:
+				status.Skipped++
+			}
+		})
+		if meta != nil {
 			metas = append(metas, meta)
 		}
 
@@ -133,14 +198,133 @@ func (ms *MusicScanner) scanMusicDirectory() {
 
 	if err != nil {
 		ms.Logger.Errorf("Error walking music directory: %v", err)
+		ms.recordScanError(root, err)
+	} else {
+		missing := ms.markMissingSongs(knownSongs, unreadableDirs)
+		ms.updateScanStatus(func(status *model.ScanStatus) { status.Missing = missing })
+	}
+	ms.syncServerPlaylists(playlistFiles, opts.Path, err == nil && len(unreadableDirs) == 0)
+	if err := PruneLibraryEntities(ms.Db); err != nil {
+		ms.Logger.Errorf("Error pruning artists and albums: %v", err)
 	}
+	ms.processMu.Unlock()
 
-	ms.Logger.Info("Music directory scan completed")
+	status := ms.GetScanStatus()
+	ms.Logger.Infof("Music directory scan completed: %d added, %d updated, %d moved, %d unchanged, %d missing, %d failed",
+		status.Added, status.Updated, status.Moved, status.Skipped, status.Missing, status.Failed)
 
 	// 刮削歌曲缺失的歌词或者封面
-	ms.scrapeMissingMetadata(metas)
+	ms.updateScanStatus(func(status *model.ScanStatus) { status.Phase = "scraping" })
+	ms.scrapeMissingMetadata(metas, true)
 }
 
+// syncServerPlaylists 将扫描到的播放列表文件同步为服务器播放列表
+// complete 为 true 表示目录已完整遍历，此时删除文件已不存在的服务器播放列表
+func (ms *MusicScanner) syncServerPlaylists(relPaths []string, subDir string, complete bool) {
+	found := make(map[string]bool, len(relPaths))
+	for _, relPath := range relPaths {
+		found[relPath] = true
+		if err := syncServerPlaylist(ms.Db, ms.Cfg.Music.Directory, relPath); err != nil {
+			ms.Logger.Errorf("Error importing playlist %s: %v", relPath, err)
+			ms.recordScanError(filepath.Join(ms.Cfg.Music.Directory, relPath), err)
+		}
+	}
+	if !complete {
+		return
+	}
+	if removed, err := removeServerPlaylists(ms.Db, subDir, found); err != nil {
+		ms.Logger.Errorf("Error removing server playlists: %v", err)
+	} else if removed > 0 {
+		ms.Logger.Infof("Removed %d server playlists whose files no longer exist", removed)
+	}
+}
+
+// scanResult 单个文件的扫描结果
+type scanResult int
+
+const (
+	scanResultUnchanged scanResult = iota // 文件未变化或已被删除，未重新解析
+	scanResultAdded                       // 新增歌曲
+	scanResultUpdated                     // 文件变化，重新解析标签
+	scanResultMoved                       // 通过指纹识别为移动或重命名的歌曲
+	scanResultMissing                     // 文件已不存在
+)
+
+// loadKnownSongPaths 加载数据库中未标记丢失的歌曲路径，subDir 不为空时只加载该目录下的歌曲
+func (ms *MusicScanner) loadKnownSongPaths(subDir string) (map[string]int, error) {
+	rows, err := ms.Db.Query("SELECT id, file_path FROM songs WHERE is_missing = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			return nil, err
+		}
+		if subDir != "" && !strings.HasPrefix(path, subDir+string(filepath.Separator)) {
+			continue
+		}
+		known[path] = id
+	}
+	return known, rows.Err()
+}
+
+// markMissingSongs 将扫描中未出现的歌曲标记为丢失，保留记录以便文件恢复后继续使用
+// 位于无法访问目录下的歌曲不做处理
+func (ms *MusicScanner) markMissingSongs(missing map[string]int, unreadableDirs []string) int {
+	if len(missing) == 0 {
+		return 0
+	}
+
+	tx, err := ms.Db.Begin()
+	if err != nil {
+		ms.Logger.Errorf("Failed to mark missing songs: %v", err)
+		return 0
+	}
+	defer tx.Rollback()
+
+	marked := 0
+	for relPath, id := range missing {
+		absPath := filepath.Join(ms.Cfg.Music.Directory, relPath)
+		if isUnderAnyDir(absPath, unreadableDirs) {
+			continue
+		}
+		// 带上file_path条件，本次扫描中已被识别为移动的歌曲路径已更新，不会被误标记
+		result, err := tx.Exec("UPDATE songs SET is_missing = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND file_path = ?", id, relPath)
+		if err != nil {
+			ms.Logger.Errorf("Failed to mark song %d as missing: %v", id, err)
+			continue
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			marked++
+			ms.Logger.Infof("Song file missing: %s", relPath)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ms.Logger.Errorf("Failed to mark missing songs: %v", err)
+		return 0
+	}
+	return marked
+}
+
+// isUnderAnyDir 检查路径是否位于任一目录之下
+func isUnderAnyDir(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// songMetadataVersion 标签解析逻辑的版本，解析内容变化时递增，旧版本解析的歌曲会在下次扫描时重新解析
+const songMetadataVersion = 3
+
 // songMetadata 内部结构，用于在处理过程中传递歌曲元数据
 type songMetadata struct {
 	Title        string
@@ -151,42 +335,219 @@ type songMetadata struct {
 	CoverPath    string
 	FilePath     string // 绝对路径
 	RelativePath string // 相对数据库音乐目录的路径
+	FileSize     int64
+	ModTime      int64    // 文件修改时间（Unix纳秒）
+	ContentHash  string   // 文件指纹，未启用时为空
+	ArtistValues []string // ARTIST 标签的全部取值，按分隔符拆分出多位艺术家
+	ArtistNames  []string // ARTISTS 标签的取值，每个值即一位艺术家
+	model.SongTags
 }
 
 // processAudioFile 处理音频文件
-func (ms *MusicScanner) processAudioFile(filePath string, fileInfo os.FileInfo) (*songMetadata, error) {
+// 文件大小和修改时间与数据库记录一致时跳过标签解析，force 为 true 时总是重新解析
+func (ms *MusicScanner) processAudioFile(filePath string, fileInfo os.FileInfo, force bool) (*songMetadata, scanResult, error) {
 	// 获取相对路径
 	relPath, err := filepath.Rel(ms.Cfg.Music.Directory, filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get relative path: %v", err)
+		return nil, scanResultUnchanged, fmt.Errorf("failed to get relative path: %v", err)
 	}
 
-	// 查询历史数据到song信息中，同时检查记录是否存在和is_collect状态
-	var isCollect, isDeleted int
-	err = ms.Db.QueryRow("SELECT is_collect, is_deleted FROM songs WHERE file_path = ?", relPath).Scan(&isCollect, &isDeleted)
+	// 查询历史数据，检查记录是否存在以及文件是否变化
+	var (
+		id, isCollect, isDeleted, isMissing, metadataVersion int
+		fileSize, fileMtime                                  int64
+	)
+	err = ms.Db.QueryRow(
+		"SELECT id, is_collect, is_deleted, is_missing, file_size, file_mtime, metadata_version FROM songs WHERE file_path = ?", relPath,
+	).Scan(&id, &isCollect, &isDeleted, &isMissing, &fileSize, &fileMtime, &metadataVersion)
 	if err != nil && err != sql.ErrNoRows {
-		// 如果查询出错但不是因为记录不存在，记录错误但继续处理
-		ms.Logger.Warningf("Error querying is_collect for %s: %v", relPath, err)
-	} else if err == nil && isDeleted == 1 {
+		return nil, scanResultUnchanged, fmt.Errorf("failed to query song: %v", err)
+	}
+	exists := err == nil
+
+	if exists && isDeleted == 1 {
 		ms.Logger.Debugf("Song already deleted, skipping: %s", relPath)
-		return nil, nil
-	} else if err == nil && isCollect == 1 {
-		// 如果记录存在且is_collect为1，跳过后续处理
-		ms.Logger.Debugf("Song already processed (is_collect=1), skipping: %s", relPath)
-		return nil, nil
+		return nil, scanResultUnchanged, nil
+	}
+
+	size := fileInfo.Size()
+	modTime := fileInfo.ModTime().UnixNano()
+
+	if exists && !force && fileSize == size && fileMtime == modTime && metadataVersion >= songMetadataVersion {
+		if isMissing == 1 {
+			// 文件重新出现
+			if _, err := ms.Db.Exec("UPDATE songs SET is_missing = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+				return nil, scanResultUnchanged, fmt.Errorf("failed to restore missing song: %v", err)
+			}
+			ms.Logger.Infof("Song file restored: %s", relPath)
+		}
+		if isCollect == 1 {
+			ms.Logger.Debugf("Song unchanged, skipping: %s", relPath)
+			return nil, scanResultUnchanged, nil
+		}
+		// 文件未变化但仍缺少歌词或封面，仅刷新旁路文件并交给刮削流程
+		meta, err := ms.refreshSidecarFiles(id, filePath, relPath)
+		return meta, scanResultUnchanged, err
 	}
 
-	// 确定记录是否存在（用于决定是插入还是更新）
-	exists := err != sql.ErrNoRows
+	var contentHash string
+	if ms.Cfg.Music.ScanHash {
+		if contentHash, err = quickFileHash(filePath, size); err != nil {
+			ms.Logger.Warningf("Failed to fingerprint %s: %v", relPath, err)
+		}
+	}
+
+	result := scanResultUpdated
+	if !exists {
+		result = scanResultAdded
+		// 新路径但指纹与丢失的歌曲一致，视为移动或重命名，沿用原有记录
+		if contentHash != "" {
+			if movedFrom, ok := ms.relinkMovedSong(contentHash, size, relPath); ok {
+				ms.Logger.Infof("Song moved: %s -> %s", movedFrom, relPath)
+				exists = true
+				result = scanResultMoved
+			}
+		}
+	}
 
 	// 1. 解析及提取元数据（包括处理歌词和封面文件）
 	meta, err := ms.resolveSongMetadata(filePath, relPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve metadata for %s: %v", filePath, err)
+		return nil, scanResultUnchanged, fmt.Errorf("failed to resolve metadata for %s: %v", filePath, err)
 	}
+	meta.FileSize = size
+	meta.ModTime = modTime
+	meta.ContentHash = contentHash
 
 	// 2. 保存到数据库 (Insert 或 Update)
-	return meta, ms.saveSongToDB(meta, exists)
+	if err := ms.saveSongToDB(meta, exists); err != nil {
+		return nil, scanResultUnchanged, err
+	}
+	return meta, result, nil
+}
+
+// relinkMovedSong 查找指纹相同且原文件已不存在的歌曲，将其路径更新为新路径
+// 歌曲ID保持不变，播放次数、收藏和歌单中的记录随之保留
+func (ms *MusicScanner) relinkMovedSong(contentHash string, size int64, relPath string) (string, bool) {
+	rows, err := ms.Db.Query(
+		"SELECT id, file_path, is_missing FROM songs WHERE content_hash = ? AND file_size = ? AND is_deleted = 0", contentHash, size,
+	)
+	if err != nil {
+		ms.Logger.Warningf("Failed to look up moved song: %v", err)
+		return "", false
+	}
+
+	var (
+		movedID   int
+		movedFrom string
+	)
+	for rows.Next() {
+		var id, isMissing int
+		var oldPath string
+		if err := rows.Scan(&id, &oldPath, &isMissing); err != nil {
+			continue
+		}
+		// 原文件仍然存在说明是重复文件而不是移动
+		if isMissing == 0 {
+			if _, err := os.Stat(filepath.Join(ms.Cfg.Music.Directory, oldPath)); err == nil {
+				continue
+			}
+		}
+		movedID, movedFrom = id, oldPath
+		break
+	}
+	rows.Close()
+
+	if movedID == 0 {
+		return "", false
+	}
+
+	// 旧位置的歌词和封面已不适用，由后续的元数据解析重新确定
+	_, err = ms.Db.Exec(
+		"UPDATE songs SET file_path = ?, lyrics_path = NULL, cover_image = NULL, is_missing = 0 WHERE id = ?", relPath, movedID,
+	)
+	if err != nil {
+		ms.Logger.Errorf("Failed to relink moved song %d: %v", movedID, err)
+		return "", false
+	}
+	return movedFrom, true
+}
+
+// refreshSidecarFiles 从数据库读取未变化歌曲的元数据，并重新检查同名的歌词和封面文件
+func (ms *MusicScanner) refreshSidecarFiles(id int, filePath, relPath string) (*songMetadata, error) {
+	meta := &songMetadata{FilePath: filePath, RelativePath: relPath}
+	var lyricsPath, coverPath sql.NullString
+	err := ms.Db.QueryRow(
+		"SELECT title, artist, album, duration, lyrics_path, cover_image FROM songs WHERE id = ?", id,
+	).Scan(&meta.Title, &meta.Artist, &meta.Album, &meta.Duration, &lyricsPath, &coverPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load song: %v", err)
+	}
+	meta.LyricsPath = lyricsPath.String
+	meta.CoverPath = coverPath.String
+
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	changed := false
+	if meta.LyricsPath == "" {
+		if _, err := os.Stat(base + ".lrc"); err == nil {
+			meta.LyricsPath = strings.TrimSuffix(relPath, filepath.Ext(relPath)) + ".lrc"
+			changed = true
+		}
+	}
+	if meta.CoverPath == "" {
+		for _, ext := range []string{".jpg", ".png"} {
+			if _, err := os.Stat(base + ext); err == nil {
+				meta.CoverPath = strings.TrimSuffix(relPath, filepath.Ext(relPath)) + ext
+				changed = true
+				break
+			}
+		}
+	}
+
+	if changed {
+		isCollect := 0
+		if meta.LyricsPath != "" && meta.CoverPath != "" {
+			isCollect = 1
+		}
+		_, err := ms.Db.Exec(
+			"UPDATE songs SET lyrics_path = ?, cover_image = ?, is_collect = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			meta.LyricsPath, meta.CoverPath, isCollect, id,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update sidecar files: %v", err)
+		}
+		if isCollect == 1 {
+			return nil, nil
+		}
+	}
+	return meta, nil
+}
+
+// quickFileHash 计算文件指纹：文件大小加上首尾各64KB内容的SHA-1
+// 只读取少量数据，适合大型曲库；移动或重命名不会改变指纹
+func quickFileHash(filePath string, size int64) (string, error) {
+	const chunkSize = 64 * 1024
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%d:", size)
+	if _, err := io.CopyN(hash, file, chunkSize); err != nil && err != io.EOF {
+		return "", err
+	}
+	if size > 2*chunkSize {
+		if _, err := file.Seek(size-chunkSize, io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(hash, file, chunkSize); err != nil && err != io.EOF {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 // resolveSongMetadata 解析音频文件，提取元数据，处理歌词和封面保存
@@ -201,24 +562,66 @@ func (ms *MusicScanner) resolveSongMetadata(filePath string, relPath string) (*s
 	}
 
 	// 提取元数据
-	tags, duration, coverMimeType, err := ms.extractAudioMetadata(filePath)
+	tags, props, duration, coverMimeType, err := ms.extractAudioMetadata(filePath)
 	if err != nil {
 		ms.Logger.Errorf("Error extracting metadata from %s: %v", filePath, err)
 		// 出错也继续，使用默认值
 	}
 	meta.Duration = duration
 
+	// 音频属性
+	if props != nil {
+		meta.BitRate = int(props.Bitrate)
+		meta.SampleRate = int(props.SampleRate)
+		meta.Channels = int(props.Channels)
+	}
+	meta.Codec = utils.AudioCodec(filePath, meta.BitRate)
+
 	// 处理标签信息 (Title, Artist, Album)
 	if tags != nil {
 		if val, ok := tags[taglib.Title]; ok && len(val) > 0 && val[0] != "" {
 			meta.Title = val[0]
 		}
-		if val, ok := tags[taglib.Artist]; ok && len(val) > 0 && val[0] != "" {
-			meta.Artist = val[0]
+		if artist := joinTagValues(tags[taglib.Artist]); artist != "" {
+			meta.Artist = artist
+			meta.ArtistValues = tags[taglib.Artist]
+		}
+		// ARTISTS 标签（如 MusicBrainz Picard 写入）逐个列出艺术家，无需再拆分
+		if artists := joinTagValues(tags[taglib.Artists]); artists != "" {
+			meta.ArtistNames = tags[taglib.Artists]
+			if meta.Artist == "Unknown Artist" {
+				meta.Artist = artists
+			}
 		}
 		if val, ok := tags[taglib.Album]; ok && len(val) > 0 && val[0] != "" {
 			meta.Album = val[0]
 		}
+		if val, ok := tags[taglib.AlbumArtist]; ok && len(val) > 0 && val[0] != "" {
+			meta.AlbumArtist = val[0]
+		}
+		if val, ok := tags[taglib.TrackNumber]; ok && len(val) > 0 {
+			meta.TrackNumber = parseTagNumber(val[0])
+		}
+		if val, ok := tags[taglib.DiscNumber]; ok && len(val) > 0 {
+			meta.DiscNumber = parseTagNumber(val[0])
+		}
+		for _, key := range []string{taglib.Date, taglib.OriginalDate} {
+			if val, ok := tags[key]; ok && len(val) > 0 && meta.Year == 0 {
+				meta.Year = parseTagYear(val[0])
+			}
+		}
+		meta.Genre = joinTagValues(tags[taglib.Genre])
+		meta.Composer = joinTagValues(tags[taglib.Composer])
+		if val, ok := tags[taglib.BPM]; ok && len(val) > 0 {
+			meta.BPM = parseTagNumber(val[0])
+		}
+		meta.MusicBrainzRecordingID = firstTagValue(tags[taglib.MusicBrainzTrackID])
+		meta.MusicBrainzReleaseID = firstTagValue(tags[taglib.MusicBrainzAlbumID])
+		meta.MusicBrainzArtistID = joinTagValues(tags[taglib.MusicBrainzArtistID])
+		meta.ReplayGainTrackGain = parseReplayGain(tags[tagReplayGainTrackGain])
+		meta.ReplayGainTrackPeak = parseReplayGain(tags[tagReplayGainTrackPeak])
+		meta.ReplayGainAlbumGain = parseReplayGain(tags[tagReplayGainAlbumGain])
+		meta.ReplayGainAlbumPeak = parseReplayGain(tags[tagReplayGainAlbumPeak])
 
 		// 处理歌词 (Extract & Save)
 		if lyrics, ok := tags[taglib.Lyrics]; ok && len(lyrics) > 0 && lyrics[0] != "" {
@@ -306,37 +709,59 @@ func (ms *MusicScanner) saveSongToDB(meta *songMetadata, exists bool) error {
 		isCollect = 0
 	}
 
+	// 专辑艺术家缺失时使用歌曲艺术家
+	if meta.AlbumArtist == "" {
+		meta.AlbumArtist = meta.Artist
+	}
+	artistValues := meta.ArtistValues
+	if len(artistValues) == 0 {
+		artistValues = []string{meta.Artist}
+	}
+	credits := newSongCredits(&ms.Cfg.Music, artistValues, meta.ArtistNames, meta.AlbumArtist, meta.Album, meta.Genre)
+
+	columns := []string{
+		"title", "artist", "album", "duration",
+		"lyrics_path", "is_collect", "file_size", "file_mtime", "content_hash", "metadata_version",
+	}
+	values := []interface{}{
+		meta.Title, meta.Artist, meta.Album, meta.Duration,
+		meta.LyricsPath, isCollect, meta.FileSize, meta.ModTime, meta.ContentHash, songMetadataVersion,
+	}
+	for _, column := range strings.Split(songTagColumns, ",") {
+		columns = append(columns, strings.TrimSpace(column))
+	}
+	values = append(values, songTagFields(&meta.SongTags)...)
+
+	var songID int
 	if exists {
-		// Update
-		query := `
+		// Update，封面为空时保留原有封面
+		assignments := make([]string, len(columns))
+		for i, column := range columns {
+			assignments[i] = column + " = ?"
+		}
+		query := fmt.Sprintf(`
 			UPDATE songs 
-			SET title = ?, artist = ?, album = ?, duration = ?, lyrics_path = ?, play_count = play_count, is_collect = ?, updated_at = CURRENT_TIMESTAMP
+			SET %s, cover_image = COALESCE(NULLIF(?, ''), cover_image), is_missing = 0, updated_at = CURRENT_TIMESTAMP
 			WHERE file_path = ?
-		`
-		args := []interface{}{meta.Title, meta.Artist, meta.Album, meta.Duration, meta.LyricsPath, isCollect, meta.RelativePath}
+		`, strings.Join(assignments, ", "))
+		args := append(values, meta.CoverPath, meta.RelativePath)
 
-		if meta.CoverPath != "" {
-			query = `
-				UPDATE songs 
-				SET title = ?, artist = ?, album = ?, duration = ?, lyrics_path = ?, cover_image = ?, play_count = play_count, is_collect = ?, updated_at = CURRENT_TIMESTAMP
-				WHERE file_path = ?
-			`
-			args = []interface{}{meta.Title, meta.Artist, meta.Album, meta.Duration, meta.LyricsPath, meta.CoverPath, isCollect, meta.RelativePath}
-		}
-
-		_, err := ms.Db.Exec(query, args...)
-		if err != nil {
+		if _, err := ms.Db.Exec(query, args...); err != nil {
 			return fmt.Errorf("failed to update song: %v", err)
 		}
+		if err := ms.Db.QueryRow("SELECT id FROM songs WHERE file_path = ?", meta.RelativePath).Scan(&songID); err != nil {
+			return fmt.Errorf("failed to query updated song: %v", err)
+		}
 		ms.Logger.Infof("Updated song info: %s - %s", meta.Artist, meta.Title)
 	} else {
 		// Insert
-		query := `
-			INSERT INTO songs (title, artist, album, duration, file_path, lyrics_path, cover_image, is_collect, created_at, updated_at) 
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		`
-		_, err := ms.Db.Exec(query, meta.Title, meta.Artist, meta.Album, meta.Duration, meta.RelativePath, meta.LyricsPath, meta.CoverPath, isCollect)
+		query := fmt.Sprintf(`
+			INSERT INTO songs (%s, file_path, cover_image, created_at, updated_at) 
+			VALUES (%s?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`, strings.Join(columns, ", "), strings.Repeat("?, ", len(columns)))
+		args := append(values, meta.RelativePath, meta.CoverPath)
 
+		result, err := ms.Db.Exec(query, args...)
 		if err != nil {
 			// 唯一性约束检查
 			if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
@@ -345,18 +770,93 @@ func (ms *MusicScanner) saveSongToDB(meta *songMetadata, exists bool) error {
 			}
 			return fmt.Errorf("failed to insert song: %v", err)
 		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get inserted song ID: %v", err)
+		}
+		songID = int(id)
 		ms.Logger.Infof("Added new song: %s - %s", meta.Artist, meta.Title)
 	}
 
-	return nil
+	// 关联艺术家、专辑和流派
+	return linkSongCredits(ms.Db, songID, credits)
+}
+
+// parseTagNumber 解析曲目号或碟号，支持 "3" 和 "3/12" 两种格式
+func parseTagNumber(value string) int {
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, "/"); i >= 0 {
+		value = value[:i]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseTagYear 从日期标签中解析年份，支持 "2001"、"2001-05-01" 等格式
+func parseTagYear(value string) int {
+	value = strings.TrimSpace(value)
+	if len(value) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(value[:4])
+	if err != nil || year <= 0 {
+		return 0
+	}
+	return year
+}
+
+// ReplayGain 标签名称
+const (
+	tagReplayGainTrackGain = "REPLAYGAIN_TRACK_GAIN"
+	tagReplayGainTrackPeak = "REPLAYGAIN_TRACK_PEAK"
+	tagReplayGainAlbumGain = "REPLAYGAIN_ALBUM_GAIN"
+	tagReplayGainAlbumPeak = "REPLAYGAIN_ALBUM_PEAK"
+)
+
+// parseReplayGain 解析 ReplayGain 增益或峰值，支持 "-6.50 dB" 格式，缺失或无法解析时返回 nil
+func parseReplayGain(values []string) *float64 {
+	value := strings.TrimSpace(firstTagValue(values))
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(value, "dB"), "db"))
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+// firstTagValue 返回标签的第一个非空值
+func firstTagValue(values []string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// joinTagValues 合并多值标签，使用 "; " 分隔
+func joinTagValues(values []string) string {
+	var parts []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, "; ")
 }
 
 // GetSongs 获取所有歌曲
 func (ms *MusicScanner) GetSongs() ([]model.SongInfo, error) {
 	query := `
-		SELECT id, title, artist, album, duration, cover_image, is_deleted, updated_at
+		SELECT ` + songInfoColumns + `
 		FROM songs
-		WHERE is_deleted = 0
+		WHERE is_deleted = 0 AND is_missing = 0
 		ORDER BY created_at DESC
 	`
 	rows, err := ms.Db.Query(query)
@@ -365,35 +865,18 @@ func (ms *MusicScanner) GetSongs() ([]model.SongInfo, error) {
 	}
 	defer rows.Close()
 
-	var songs []model.SongInfo
-	for rows.Next() {
-		var song model.SongInfo
-		err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.Album, &song.Duration, &song.CoverImage, &song.IsDeleted, &song.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		songs = append(songs, song)
-	}
-
-	return songs, rows.Err()
+	return scanSongInfoRows(rows)
 }
 
 // GetSongByID 根据ID获取歌曲详情
 func (ms *MusicScanner) GetSongByID(id int) (*model.Song, error) {
 	ms.Logger.Infof("Getting song by ID: %d", id)
-	query := `
-		SELECT id, title, artist, album, duration, file_path, cover_image, lyrics_path, play_count, is_deleted, created_at, updated_at
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM songs
 		WHERE id = ?
-	`
-	row := ms.Db.QueryRow(query, id)
-
-	var song model.Song
-	err := row.Scan(
-		&song.ID, &song.Title, &song.Artist, &song.Album,
-		&song.Duration, &song.FilePath, &song.CoverImage, &song.LyricsPath,
-		&song.PlayCount, &song.IsDeleted, &song.CreatedAt, &song.UpdatedAt,
-	)
+	`, songColumns)
+	song, err := scanSong(ms.Db.QueryRow(query, id))
 	if err != nil {
 		ms.Logger.Errorf("Error getting song by ID %d: %v", id, err)
 		if err == sql.ErrNoRows {
@@ -402,8 +885,14 @@ func (ms *MusicScanner) GetSongByID(id int) (*model.Song, error) {
 		return nil, err
 	}
 
+	songs := []model.Song{*song}
+	if err := loadSongCredits(ms.Db, songs); err != nil {
+		return nil, err
+	}
+	song = &songs[0]
+
 	ms.Logger.Debugf("Found song: %+v", song)
-	return &song, nil
+	return song, nil
 }
 
 // GetSongs 获取所有歌曲的便捷函数
@@ -422,8 +911,8 @@ func GetSongByID(id int) (*model.Song, error) {
 	return GlobalMusicScanner.GetSongByID(id)
 }
 
-// extractAudioMetadata 从音频文件中提取元数据和时长
-func (ms *MusicScanner) extractAudioMetadata(filePath string) (map[string][]string, int, string, error) {
+// extractAudioMetadata 从音频文件中提取元数据、音频属性和时长，无法读取音频属性时返回的属性为 nil
+func (ms *MusicScanner) extractAudioMetadata(filePath string) (map[string][]string, *taglib.Properties, int, string, error) {
 	// 使用go-taglib库读取元数据
 	tags, err := taglib.ReadTags(filePath)
 	if err != nil {
@@ -431,7 +920,7 @@ func (ms *MusicScanner) extractAudioMetadata(filePath string) (map[string][]stri
 		// 即使无法读取标签，也尝试读取属性或估算时长
 	}
 
-	// 尝试读取音频属性获取时长
+	// 尝试读取音频属性获取时长、码率、采样率和声道数
 	props, propErr := taglib.ReadProperties(filePath)
 	var coverMimeType string
 	if propErr == nil {
@@ -440,7 +929,7 @@ func (ms *MusicScanner) extractAudioMetadata(filePath string) (map[string][]stri
 			if len(props.Images) > 0 {
 				coverMimeType = props.Images[0].MIMEType
 			}
-			return tags, int(props.Length.Seconds()), coverMimeType, nil
+			return tags, &props, int(props.Length.Seconds()), coverMimeType, nil
 		}
 	}
 
@@ -451,13 +940,13 @@ func (ms *MusicScanner) extractAudioMetadata(filePath string) (map[string][]stri
 	if estErr != nil {
 		// 如果连估算都失败了，且之前读tags也失败了，那就真的失败了
 		if err != nil {
-			return nil, 0, "", fmt.Errorf("failed to read metadata and estimate duration: %v, %v", err, estErr)
+			return nil, nil, 0, "", fmt.Errorf("failed to read metadata and estimate duration: %v, %v", err, estErr)
 		}
 		// 如果tags读取成功但时长失败，返回tags和0时长
-		return tags, 0, "", nil
+		return tags, nil, 0, "", nil
 	}
 
-	return tags, int(duration), "", nil
+	return tags, nil, int(duration), "", nil
 }
 
 // estimateBitrateForFormat 估算特定格式的比特率
@@ -496,43 +985,21 @@ func (ms *MusicScanner) estimateDurationFromSize(filePath string) (float64, erro
 	return approxDuration, nil
 }
 
-// SearchSongs 搜索歌曲
-func (ms *MusicScanner) SearchSongs(query string) ([]model.SongInfo, error) {
-	searchQuery := "%" + query + "%"
-	sqlQuery := `
-		SELECT id, title, artist, album, duration, cover_image, is_deleted, updated_at
-		FROM songs
-		WHERE (title LIKE ? OR artist LIKE ? OR album LIKE ?) AND is_deleted = 0
-		ORDER BY created_at DESC
-	`
-	rows, err := ms.Db.Query(sqlQuery, searchQuery, searchQuery, searchQuery)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var songs []model.SongInfo
-	for rows.Next() {
-		var song model.SongInfo
-		err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.Album, &song.Duration, &song.CoverImage, &song.IsDeleted, &song.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		songs = append(songs, song)
-	}
-
-	return songs, rows.Err()
-}
-
-// scrapeMissingMetadata 刮削缺失的歌词或封面
-func (ms *MusicScanner) scrapeMissingMetadata(metas []*songMetadata) {
+// scrapeMissingMetadata 刮削缺失的歌词或封面，trackProgress 为 true 时更新扫描状态中的刮削进度
+func (ms *MusicScanner) scrapeMissingMetadata(metas []*songMetadata, trackProgress bool) {
 	if len(metas) == 0 {
 		return
 	}
 	ms.Logger.Info("开始刮削缺失的歌词和封面")
-	Collecting = true
+	if trackProgress {
+		ms.updateScanStatus(func(status *model.ScanStatus) { status.ScrapeTotal = len(metas) })
+	}
 
 	for _, meta := range metas {
+		if trackProgress {
+			ms.updateScanStatus(func(status *model.ScanStatus) { status.ScrapeDone++ })
+		}
+
 		// 检查是否缺少歌词或封面
 		missingLyrics := meta.LyricsPath == ""
 		missingCover := meta.CoverPath == ""
@@ -594,14 +1061,5 @@ func (ms *MusicScanner) scrapeMissingMetadata(metas []*songMetadata) {
 		}
 	}
 
-	Collecting = false
 	ms.Logger.Info("歌词和封面刮削完成")
 }
-
-// SearchSongs 搜索歌曲的便捷函数
-func SearchSongs(query string) ([]model.SongInfo, error) {
-	if GlobalMusicScanner == nil {
-		return nil, fmt.Errorf("music scanner not initialized")
-	}
-	return GlobalMusicScanner.SearchSongs(query)
-}
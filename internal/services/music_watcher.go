@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// sidecarExtensions 与音频文件同名的歌词和封面文件
+var sidecarExtensions = map[string]bool{
+	".lrc": true,
+	".jpg": true,
+	".png": true,
+}
+
+// musicWatcher 监听音乐目录的文件变化，合并短时间内的事件后增量处理
+type musicWatcher struct {
+	ms       *MusicScanner
+	watcher  *fsnotify.Watcher
+	debounce time.Duration
+
+	mu          sync.Mutex
+	pending     map[string]struct{}
+	pendingDirs map[string]struct{}
+	timer       *time.Timer
+}
+
+// errWatchLimit 监听数量达到系统上限
+var errWatchLimit = errors.New("filesystem watch limit reached")
+
+// startWatcher 为音乐目录及其所有子目录创建监听
+// 监听数量不足时返回错误，由定时扫描兜底
+func (ms *MusicScanner) startWatcher(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	mw := &musicWatcher{
+		ms:          ms,
+		watcher:     watcher,
+		debounce:    time.Duration(ms.Cfg.Music.WatchDebounce) * time.Millisecond,
+		pending:     make(map[string]struct{}),
+		pendingDirs: make(map[string]struct{}),
+	}
+
+	if err := mw.addTree(ms.Cfg.Music.Directory); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go mw.run(ctx)
+	ms.Logger.Infof("Watching music directory for changes: %s", ms.Cfg.Music.Directory)
+	return nil
+}
+
+// addTree 递归监听目录，fsnotify 不支持递归监听
+func (mw *musicWatcher) addTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if err := mw.watcher.Add(path); err != nil {
+			if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE) {
+				return errWatchLimit
+			}
+			mw.ms.Logger.Warningf("Failed to watch %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// run 处理监听事件，直到上下文取消或监听失效
+func (mw *musicWatcher) run(ctx context.Context) {
+	defer mw.watcher.Close()
+
+	for {
+		select {
+		case event, ok := <-mw.watcher.Events:
+			if !ok {
+				return
+			}
+			if !mw.handleEvent(event) {
+				return
+			}
+		case err, ok := <-mw.watcher.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// 事件队列溢出，无法确定哪些文件发生了变化
+				mw.ms.Logger.Warning("Filesystem event queue overflowed, running a full scan")
+				if err := mw.ms.StartScan(ScanOptions{Trigger: ScanTriggerWatch}); err != nil {
+					mw.ms.Logger.Infof("Skipping watch-triggered scan: %v", err)
+				}
+				continue
+			}
+			mw.ms.Logger.Errorf("Filesystem watch error: %v", err)
+		case <-ctx.Done():
+			mw.mu.Lock()
+			if mw.timer != nil {
+				mw.timer.Stop()
+			}
+			mw.mu.Unlock()
+			return
+		}
+	}
+}
+
+// handleEvent 记录变化的路径，返回false表示监听已失效
+func (mw *musicWatcher) handleEvent(event fsnotify.Event) bool {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) {
+		return true
+	}
+
+	// 新建的目录需要加入监听，目录中已有的文件在加入监听前可能已经写入
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := mw.addTree(event.Name); errors.Is(err, errWatchLimit) {
+				mw.ms.Logger.Warningf("Filesystem watch limit reached, falling back to periodic scanning every %d minutes", mw.ms.Cfg.Music.ScanInterval)
+				if err := mw.ms.StartScan(ScanOptions{Trigger: ScanTriggerWatch}); err != nil {
+					mw.ms.Logger.Infof("Skipping watch-triggered scan: %v", err)
+				}
+				return false
+			}
+			mw.mu.Lock()
+			mw.pendingDirs[event.Name] = struct{}{}
+			mw.mu.Unlock()
+			filepath.Walk(event.Name, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					mw.enqueue(path)
+				}
+				return nil
+			})
+			return true
+		}
+	}
+
+	mw.enqueue(event.Name)
+	return true
+}
+
+// enqueue 加入待处理路径并重置防抖计时器
+func (mw *musicWatcher) enqueue(path string) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	mw.pending[path] = struct{}{}
+	if mw.timer != nil {
+		mw.timer.Stop()
+	}
+	mw.timer = time.AfterFunc(mw.debounce, mw.flush)
+}
+
+// flush 处理防抖期间累积的路径
+func (mw *musicWatcher) flush() {
+	mw.mu.Lock()
+	paths := make([]string, 0, len(mw.pending))
+	for path := range mw.pending {
+		paths = append(paths, path)
+	}
+	dirs := mw.pendingDirs
+	mw.pending = make(map[string]struct{})
+	mw.pendingDirs = make(map[string]struct{})
+	mw.mu.Unlock()
+
+	// 目录被移动时，旧路径的监听会在移动事件处理完后才被移除，
+	// 事件平静后再次为新目录添加监听，避免移入的目录失去监听
+	for dir := range dirs {
+		if err := mw.addTree(dir); err != nil {
+			mw.ms.Logger.Warningf("Failed to watch %s: %v", dir, err)
+		}
+	}
+
+	sort.Strings(paths)
+	mw.ms.processChangedPaths(paths)
+}
+
+// processChangedPaths 增量处理发生变化的路径
+// 先处理仍然存在的文件，再处理已消失的路径，这样移动操作会被识别为移动而不是丢失
+func (ms *MusicScanner) processChangedPaths(paths []string) {
+	var existing, vanished []string
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			existing = append(existing, path)
+		} else {
+			vanished = append(vanished, path)
+		}
+	}
+
+	ms.processMu.Lock()
+	var metas []*songMetadata
+	var playlistFiles []string
+	sidecarSongs := make(map[string]bool)
+	for _, path := range existing {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		switch {
+		case ms.isSupportedFormat(path):
+			meta, _, err := ms.processAudioFile(path, info, false)
+			if err != nil {
+				ms.Logger.Errorf("Error processing file %s: %v", path, err)
+			} else if meta != nil {
+				metas = append(metas, meta)
+			}
+		case sidecarExtensions[ext]:
+			sidecarSongs[strings.TrimSuffix(path, filepath.Ext(path))] = true
+		case playlistFileExtensions[ext]:
+			playlistFiles = append(playlistFiles, path)
+		}
+	}
+
+	for _, path := range vanished {
+		ext := strings.ToLower(filepath.Ext(path))
+		switch {
+		case ms.isSupportedFormat(path):
+			ms.markPathMissing(path, false)
+		case sidecarExtensions[ext]:
+			sidecarSongs[strings.TrimSuffix(path, filepath.Ext(path))] = true
+		case playlistFileExtensions[ext]:
+			ms.removeServerPlaylistsAt(path)
+		default:
+			// 可能是被删除或移走的目录
+			ms.markPathMissing(path, true)
+			ms.removeServerPlaylistsAt(path)
+		}
+	}
+
+	for base := range sidecarSongs {
+		ms.updateSidecarPaths(base)
+	}
+
+	// 歌曲处理完成后再同步播放列表，新加入的歌曲才能被匹配
+	for _, path := range playlistFiles {
+		if relPath, err := filepath.Rel(ms.Cfg.Music.Directory, path); err == nil {
+			if err := syncServerPlaylist(ms.Db, ms.Cfg.Music.Directory, relPath); err != nil {
+				ms.Logger.Errorf("Error importing playlist %s: %v", relPath, err)
+			}
+		}
+	}
+	ms.processMu.Unlock()
+
+	ms.scrapeMissingMetadata(metas, false)
+}
+
+// removeServerPlaylistsAt 删除来自已消失的播放列表文件（或目录下的播放列表文件）的服务器播放列表
+func (ms *MusicScanner) removeServerPlaylistsAt(absPath string) {
+	relPath, err := filepath.Rel(ms.Cfg.Music.Directory, absPath)
+	if err != nil {
+		return
+	}
+	if err := removeServerPlaylistsUnder(ms.Db, relPath); err != nil {
+		ms.Logger.Errorf("Failed to remove server playlists under %s: %v", relPath, err)
+	}
+}
+
+// isSupportedFormat 检查文件是否为允许的音频格式
+func (ms *MusicScanner) isSupportedFormat(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, format := range ms.Cfg.Music.AllowedFormats {
+		if format == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// markPathMissing 将已消失的文件（或目录下的所有文件）对应的歌曲标记为丢失
+func (ms *MusicScanner) markPathMissing(absPath string, isDir bool) {
+	relPath, err := filepath.Rel(ms.Cfg.Music.Directory, absPath)
+	if err != nil {
+		return
+	}
+
+	query := "UPDATE songs SET is_missing = 1, updated_at = CURRENT_TIMESTAMP WHERE is_missing = 0 AND file_path = ?"
+	args := []interface{}{relPath}
+	if isDir {
+		prefix := relPath + string(filepath.Separator)
+		query = "UPDATE songs SET is_missing = 1, updated_at = CURRENT_TIMESTAMP WHERE is_missing = 0 AND substr(file_path, 1, length(?)) = ?"
+		args = []interface{}{prefix, prefix}
+	}
+
+	result, err := ms.Db.Exec(query, args...)
+	if err != nil {
+		ms.Logger.Errorf("Failed to mark %s as missing: %v", relPath, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		ms.Logger.Infof("Song files missing under %s: %d", relPath, affected)
+	}
+}
+
+// updateSidecarPaths 同名歌词或封面文件变化后，重新确定对应歌曲的歌词和封面路径
+func (ms *MusicScanner) updateSidecarPaths(absBase string) {
+	relBase, err := filepath.Rel(ms.Cfg.Music.Directory, absBase)
+	if err != nil {
+		return
+	}
+
+	// 查找去掉扩展名后与旁路文件同名的歌曲
+	rows, err := ms.Db.Query("SELECT id, file_path FROM songs WHERE substr(file_path, 1, length(?)) = ?", relBase+".", relBase+".")
+	if err != nil {
+		ms.Logger.Errorf("Failed to find songs for %s: %v", relBase, err)
+		return
+	}
+	var songIDs []int
+	for rows.Next() {
+		var id int
+		var filePath string
+		if err := rows.Scan(&id, &filePath); err == nil && strings.TrimSuffix(filePath, filepath.Ext(filePath)) == relBase {
+			songIDs = append(songIDs, id)
+		}
+	}
+	rows.Close()
+	if len(songIDs) == 0 {
+		return
+	}
+
+	var lyricsPath, coverPath string
+	if _, err := os.Stat(absBase + ".lrc"); err == nil {
+		lyricsPath = relBase + ".lrc"
+	}
+	for _, ext := range []string{".jpg", ".png"} {
+		if _, err := os.Stat(absBase + ext); err == nil {
+			coverPath = relBase + ext
+			break
+		}
+	}
+	isCollect := 0
+	if lyricsPath != "" && coverPath != "" {
+		isCollect = 1
+	}
+
+	for _, id := range songIDs {
+		_, err := ms.Db.Exec(
+			"UPDATE songs SET lyrics_path = ?, cover_image = ?, is_collect = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			lyricsPath, coverPath, isCollect, id,
+		)
+		if err != nil {
+			ms.Logger.Errorf("Failed to update lyrics and cover for %s: %v", relBase, err)
+			continue
+		}
+		ms.Logger.Infof("Updated lyrics and cover for %s", relBase)
+	}
+}
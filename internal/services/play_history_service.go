@@ -0,0 +1,288 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"melogo/internal/model"
+	"sync"
+	"time"
+)
+
+// 播放计数规则：播放时长达到歌曲时长的一半或达到 4 分钟
+const (
+	playCountMinRatio    = 0.5
+	playCountMinDuration = 4 * time.Minute
+)
+
+// PlayListener 接收播放通知，如将播放转发到外部服务
+type PlayListener interface {
+	// NowPlaying 用户开始播放歌曲
+	NowPlaying(userID, songID int)
+	// Played 一次计入播放次数的播放已记录
+	Played(event *model.PlayEvent)
+}
+
+// PlayHistoryService 播放记录服务
+type PlayHistoryService struct {
+	db        *sql.DB
+	listeners []PlayListener
+
+	mu         sync.Mutex
+	nowPlaying map[int]nowPlayingEntry
+}
+
+// nowPlayingEntry 用户正在播放的歌曲，超过 expiresAt 后视为已停止播放
+type nowPlayingEntry struct {
+	model.NowPlaying
+	expiresAt time.Time
+}
+
+// NewPlayHistoryService 创建新的播放记录服务实例
+func NewPlayHistoryService(database *sql.DB) *PlayHistoryService {
+	return &PlayHistoryService{
+		db:         database,
+		nowPlaying: make(map[int]nowPlayingEntry),
+	}
+}
+
+// AddListener 注册播放通知的接收者，需在处理请求前调用
+func (ps *PlayHistoryService) AddListener(listener PlayListener) {
+	ps.listeners = append(ps.listeners, listener)
+}
+
+// songDuration 查询可见歌曲的时长（秒）
+func (ps *PlayHistoryService) songDuration(songID int) (int, error) {
+	var duration int
+	err := ps.db.QueryRow(
+		"SELECT duration FROM songs WHERE id = ? AND is_deleted = 0 AND is_missing = 0", songID,
+	).Scan(&duration)
+	if err == sql.ErrNoRows {
+		return 0, errors.New("歌曲不存在")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("查询歌曲失败: %v", err)
+	}
+	return duration, nil
+}
+
+// SetNowPlaying 记录用户开始播放的歌曲，不计入播放次数
+func (ps *PlayHistoryService) SetNowPlaying(userID, songID int, client string) error {
+	duration, err := ps.songDuration(songID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	ps.mu.Lock()
+	ps.nowPlaying[userID] = nowPlayingEntry{
+		NowPlaying: model.NowPlaying{SongID: songID, Client: client, StartedAt: now},
+		// 留出暂停和缓冲的余量
+		expiresAt: now.Add(time.Duration(duration)*time.Second + 5*time.Minute),
+	}
+	ps.mu.Unlock()
+
+	for _, listener := range ps.listeners {
+		listener.NowPlaying(userID, songID)
+	}
+	return nil
+}
+
+// NowPlaying 获取用户正在播放的歌曲，没有时返回 nil
+func (ps *PlayHistoryService) NowPlaying(userID int) *model.NowPlaying {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	entry, ok := ps.nowPlaying[userID]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(ps.nowPlaying, userID)
+		return nil
+	}
+	return &entry.NowPlaying
+}
+
+// clearNowPlaying 提交播放后清除对应的正在播放记录
+func (ps *PlayHistoryService) clearNowPlaying(userID, songID int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if entry, ok := ps.nowPlaying[userID]; ok && entry.SongID == songID {
+		delete(ps.nowPlaying, userID)
+	}
+}
+
+// IsCountedPlay 判断一次播放是否计入播放次数：播放时长达到歌曲时长的一半，或达到 4 分钟
+func IsCountedPlay(playedMs, durationSeconds int) bool {
+	played := time.Duration(playedMs) * time.Millisecond
+	if played >= playCountMinDuration {
+		return true
+	}
+	return durationSeconds > 0 && played.Seconds() >= float64(durationSeconds)*playCountMinRatio
+}
+
+// Scrobble 提交一次播放记录
+// playedMs 为 nil 表示完整播放；startedAt 为零值时按当前时间减去播放时长推算。
+// 满足计数规则的播放同时增加歌曲的总播放次数和用户的播放次数；同一次播放（用户、歌曲、开始时间相同）重复提交时只记录一次
+func (ps *PlayHistoryService) Scrobble(userID, songID int, startedAt time.Time, playedMs *int, client string) (*model.PlayEvent, error) {
+	duration, err := ps.songDuration(songID)
+	if err != nil {
+		return nil, err
+	}
+
+	event := model.PlayEvent{UserID: userID, SongID: songID, Client: client}
+	if playedMs != nil {
+		event.PlayedMs = *playedMs
+	} else {
+		event.PlayedMs = duration * 1000
+	}
+	if event.PlayedMs < 0 {
+		event.PlayedMs = 0
+	}
+	if startedAt.IsZero() {
+		startedAt = time.Now().Add(-time.Duration(event.PlayedMs) * time.Millisecond)
+	}
+	event.StartedAt = startedAt.UTC().Truncate(time.Second)
+	// 未提供播放时长时由客户端判定为完整播放，歌曲时长未知也计入
+	event.Completed = playedMs == nil || IsCountedPlay(event.PlayedMs, duration)
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	startedAtValue := event.StartedAt.Format("2006-01-02 15:04:05")
+	result, err := tx.Exec(`
+		INSERT OR IGNORE INTO play_events (user_id, song_id, started_at, played_ms, completed, client, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, datetime('now'))
+	`, userID, songID, startedAtValue, event.PlayedMs, event.Completed, client)
+	if err != nil {
+		return nil, fmt.Errorf("保存播放记录失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		// 重复提交，返回已有的记录
+		err := tx.QueryRow(`
+			SELECT id, played_ms, completed, client FROM play_events
+			WHERE user_id = ? AND song_id = ? AND started_at = ?
+		`, userID, songID, startedAtValue).Scan(&event.ID, &event.PlayedMs, &event.Completed, &event.Client)
+		if err != nil {
+			return nil, fmt.Errorf("查询播放记录失败: %v", err)
+		}
+		return &event, nil
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("获取播放记录ID失败: %v", err)
+	}
+	event.ID = int(id)
+
+	if event.Completed {
+		if _, err := tx.Exec("UPDATE songs SET play_count = play_count + 1 WHERE id = ?", songID); err != nil {
+			return nil, fmt.Errorf("更新播放次数失败: %v", err)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO user_song_stats (user_id, song_id, play_count, last_played_at) VALUES (?, ?, 1, ?)
+			ON CONFLICT(user_id, song_id) DO UPDATE SET
+				play_count = play_count + 1,
+				last_played_at = MAX(COALESCE(last_played_at, ''), excluded.last_played_at)
+		`, userID, songID, startedAtValue)
+		if err != nil {
+			return nil, fmt.Errorf("更新用户播放次数失败: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	ps.clearNowPlaying(userID, songID)
+	if event.Completed {
+		for _, listener := range ps.listeners {
+			listener.Played(&event)
+		}
+	}
+	return &event, nil
+}
+
+// ListRecent 分页获取用户最近播放的歌曲（每首歌只出现一次），按最近一次计入的播放时间倒序
+func (ps *PlayHistoryService) ListRecent(userID, limit, offset int) ([]model.RecentSong, int, error) {
+	var total int
+	err := ps.db.QueryRow(`
+		SELECT COUNT(*) FROM user_song_stats us
+		JOIN songs ON songs.id = us.song_id
+		WHERE us.user_id = ? AND songs.is_deleted = 0 AND songs.is_missing = 0
+	`, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询最近播放总数失败: %v", err)
+	}
+
+	rows, err := ps.db.Query(`
+		SELECT us.play_count, us.last_played_at, `+songInfoColumns+`
+		FROM user_song_stats us
+		JOIN songs ON songs.id = us.song_id
+		WHERE us.user_id = ? AND songs.is_deleted = 0 AND songs.is_missing = 0
+		ORDER BY us.last_played_at DESC, us.song_id DESC
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询最近播放失败: %v", err)
+	}
+	defer rows.Close()
+
+	recent := []model.RecentSong{}
+	for rows.Next() {
+		var item model.RecentSong
+		var lastPlayedAt sql.NullString
+		dest := append([]interface{}{&item.PlayCount, &lastPlayedAt}, songInfoFields(&item.Song)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, fmt.Errorf("读取最近播放失败: %v", err)
+		}
+		item.LastPlayedAt = parseDBTime(lastPlayedAt)
+		recent = append(recent, item)
+	}
+	return recent, total, rows.Err()
+}
+
+// ListHistory 分页获取用户的播放记录，包括未计入播放次数的播放，按开始时间倒序
+func (ps *PlayHistoryService) ListHistory(userID, limit, offset int) ([]model.PlayEvent, int, error) {
+	var total int
+	err := ps.db.QueryRow(`
+		SELECT COUNT(*) FROM play_events pe
+		JOIN songs ON songs.id = pe.song_id
+		WHERE pe.user_id = ?
+	`, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询播放记录总数失败: %v", err)
+	}
+
+	rows, err := ps.db.Query(`
+		SELECT pe.id, pe.user_id, pe.song_id, pe.started_at, pe.played_ms, pe.completed, pe.client, s.*
+		FROM play_events pe
+		JOIN (SELECT `+songInfoColumns+` FROM songs) s ON s.id = pe.song_id
+		WHERE pe.user_id = ?
+		ORDER BY pe.started_at DESC, pe.id DESC
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询播放记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	events := []model.PlayEvent{}
+	for rows.Next() {
+		var event model.PlayEvent
+		var startedAt sql.NullString
+		song := &model.SongInfo{}
+		dest := append([]interface{}{
+			&event.ID, &event.UserID, &event.SongID, &startedAt, &event.PlayedMs, &event.Completed, &event.Client,
+		}, songInfoFields(song)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, fmt.Errorf("读取播放记录失败: %v", err)
+		}
+		event.StartedAt = parseDBTime(startedAt)
+		event.Song = song
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"melogo/internal/model"
+	"strings"
+)
+
+// maxQueueLength 播放队列的最大歌曲数量
+const maxQueueLength = 5000
+
+var (
+	// ErrQueueVersionConflict 播放队列已被其他设备修改，提交的版本号不是最新的
+	ErrQueueVersionConflict = errors.New("play queue was modified by another device")
+)
+
+// PlayQueueService 按用户保存的播放队列服务，用于在多个设备间继续播放
+type PlayQueueService struct {
+	db *sql.DB
+}
+
+// NewPlayQueueService 创建新的播放队列服务实例
+func NewPlayQueueService(database *sql.DB) *PlayQueueService {
+	return &PlayQueueService{
+		db: database,
+	}
+}
+
+// GetQueue 获取用户的播放队列，尚未保存过时返回版本号为 0 的空队列
+func (qs *PlayQueueService) GetQueue(userID int) (*model.PlayQueue, error) {
+	return loadPlayQueue(qs.db, userID)
+}
+
+// ReplaceQueue 保存播放队列，请求中省略的字段保持不变
+func (qs *PlayQueueService) ReplaceQueue(userID int, req model.UpdatePlayQueueRequest) (*model.PlayQueue, error) {
+	return qs.updateQueue(userID, req.Version, req.Device, func(queue *model.PlayQueue) error {
+		if req.SongIDs != nil {
+			queue.SongIDs = req.SongIDs
+			if req.CurrentIndex == nil {
+				queue.CurrentIndex = 0
+			}
+			if req.PositionMs == nil {
+				queue.PositionMs = 0
+			}
+		}
+		if req.CurrentIndex != nil {
+			queue.CurrentIndex = *req.CurrentIndex
+		}
+		if req.PositionMs != nil {
+			queue.PositionMs = *req.PositionMs
+		}
+		if req.Shuffle != nil {
+			queue.Shuffle = *req.Shuffle
+		}
+		if req.RepeatMode != nil {
+			queue.RepeatMode = *req.RepeatMode
+		}
+		return nil
+	})
+}
+
+// EnqueueSongs 将歌曲加入播放队列末尾
+func (qs *PlayQueueService) EnqueueSongs(userID int, version *int, songIDs []int, device string) (*model.PlayQueue, error) {
+	return qs.updateQueue(userID, version, device, func(queue *model.PlayQueue) error {
+		queue.SongIDs = append(queue.SongIDs, songIDs...)
+		return nil
+	})
+}
+
+// PlayNext 将歌曲插入到当前播放的歌曲之后
+func (qs *PlayQueueService) PlayNext(userID int, version *int, songIDs []int, device string) (*model.PlayQueue, error) {
+	return qs.updateQueue(userID, version, device, func(queue *model.PlayQueue) error {
+		at := queue.CurrentIndex + 1
+		if at < 0 || at > len(queue.SongIDs) {
+			at = len(queue.SongIDs)
+		}
+		ids := make([]int, 0, len(queue.SongIDs)+len(songIDs))
+		ids = append(ids, queue.SongIDs[:at]...)
+		ids = append(ids, songIDs...)
+		queue.SongIDs = append(ids, queue.SongIDs[at:]...)
+		return nil
+	})
+}
+
+// MoveSong 将队列中 from 位置的歌曲移动到 to 位置，当前播放的歌曲保持不变
+func (qs *PlayQueueService) MoveSong(userID int, version *int, from, to int, device string) (*model.PlayQueue, error) {
+	return qs.updateQueue(userID, version, device, func(queue *model.PlayQueue) error {
+		if from < 0 || from >= len(queue.SongIDs) || to < 0 || to >= len(queue.SongIDs) {
+			return errors.New("队列位置超出范围")
+		}
+
+		songID := queue.SongIDs[from]
+		ids := append(queue.SongIDs[:from:from], queue.SongIDs[from+1:]...)
+		ids = append(ids[:to:to], append([]int{songID}, ids[to:]...)...)
+		queue.SongIDs = ids
+
+		switch current := queue.CurrentIndex; {
+		case current == from:
+			queue.CurrentIndex = to
+		case from < current && to >= current:
+			queue.CurrentIndex--
+		case from > current && to <= current:
+			queue.CurrentIndex++
+		}
+		return nil
+	})
+}
+
+// ClearQueue 清空播放队列，保留随机和循环模式
+func (qs *PlayQueueService) ClearQueue(userID int, version *int, device string) (*model.PlayQueue, error) {
+	return qs.updateQueue(userID, version, device, func(queue *model.PlayQueue) error {
+		queue.SongIDs = nil
+		queue.CurrentIndex = -1
+		queue.PositionMs = 0
+		return nil
+	})
+}
+
+// updateQueue 在事务中读取队列、检查版本号、修改并保存，版本号加一
+// version 为 nil 时不检查版本号
+func (qs *PlayQueueService) updateQueue(userID int, version *int, device string, mutate func(queue *model.PlayQueue) error) (*model.PlayQueue, error) {
+	tx, err := qs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	queue, err := loadPlayQueue(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if version != nil && *version != queue.Version {
+		return nil, ErrQueueVersionConflict
+	}
+
+	// 读取的队列已跳过移除的歌曲，这里取保存的全部歌曲，客户端提交的旧队列仍可通过检查
+	oldIDs, err := storedQueueSongIDs(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := mutate(queue); err != nil {
+		return nil, err
+	}
+	if err := validatePlayQueue(tx, queue, oldIDs); err != nil {
+		return nil, err
+	}
+
+	queue.Version++
+	queue.Device = device
+	_, err = tx.Exec(`
+		INSERT INTO play_queues (user_id, current_index, position_ms, shuffle, repeat_mode, device, version, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'))
+		ON CONFLICT(user_id) DO UPDATE SET
+			current_index = excluded.current_index, position_ms = excluded.position_ms, shuffle = excluded.shuffle,
+			repeat_mode = excluded.repeat_mode, device = excluded.device, version = excluded.version,
+			updated_at = excluded.updated_at
+	`, userID, queue.CurrentIndex, queue.PositionMs, queue.Shuffle, queue.RepeatMode, queue.Device, queue.Version)
+	if err != nil {
+		return nil, fmt.Errorf("保存播放队列失败: %v", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM play_queue_items WHERE user_id = ?", userID); err != nil {
+		return nil, fmt.Errorf("保存播放队列失败: %v", err)
+	}
+	stmt, err := tx.Prepare("INSERT INTO play_queue_items (user_id, position, song_id) VALUES (?, ?, ?)")
+	if err != nil {
+		return nil, fmt.Errorf("保存播放队列失败: %v", err)
+	}
+	defer stmt.Close()
+	for i, songID := range queue.SongIDs {
+		if _, err := stmt.Exec(userID, i, songID); err != nil {
+			return nil, fmt.Errorf("保存播放队列失败: %v", err)
+		}
+	}
+
+	// 重新读取，填充歌曲信息和更新时间
+	saved, err := loadPlayQueue(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return saved, nil
+}
+
+// validatePlayQueue 检查修改后的队列：长度、当前位置、循环模式以及新加入的歌曲是否存在
+func validatePlayQueue(tx *sql.Tx, queue *model.PlayQueue, oldIDs []int) error {
+	if len(queue.SongIDs) > maxQueueLength {
+		return fmt.Errorf("播放队列最多包含 %d 首歌曲", maxQueueLength)
+	}
+	switch {
+	case len(queue.SongIDs) == 0:
+		queue.CurrentIndex = -1
+	case queue.CurrentIndex == -1:
+		// 向空队列添加歌曲时从第一首开始
+		queue.CurrentIndex = 0
+	case queue.CurrentIndex < 0 || queue.CurrentIndex >= len(queue.SongIDs):
+		return errors.New("当前播放位置超出范围")
+	}
+	if queue.PositionMs < 0 {
+		return errors.New("播放进度不能为负数")
+	}
+	switch queue.RepeatMode {
+	case model.RepeatModeOff, model.RepeatModeAll, model.RepeatModeOne:
+	default:
+		return errors.New("循环模式只能是 off、all 或 one")
+	}
+
+	// 只检查新加入的歌曲，已在队列中的歌曲即使已被标记删除也允许保留
+	known := make(map[int]bool, len(oldIDs))
+	for _, id := range oldIDs {
+		known[id] = true
+	}
+	var added []interface{}
+	for _, id := range queue.SongIDs {
+		if !known[id] {
+			known[id] = true
+			added = append(added, id)
+		}
+	}
+	for start := 0; start < len(added); start += 500 {
+		end := start + 500
+		if end > len(added) {
+			end = len(added)
+		}
+		batch := added[start:end]
+		var count int
+		err := tx.QueryRow(
+			"SELECT COUNT(*) FROM songs WHERE is_deleted = 0 AND is_missing = 0 AND id IN (?"+strings.Repeat(", ?", len(batch)-1)+")",
+			batch...,
+		).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("查询歌曲失败: %v", err)
+		}
+		if count != len(batch) {
+			return errors.New("歌曲不存在")
+		}
+	}
+	return nil
+}
+
+// storedQueueSongIDs 读取队列中保存的全部歌曲ID，包括已从曲库中移除的歌曲
+func storedQueueSongIDs(tx *sql.Tx, userID int) ([]int, error) {
+	rows, err := tx.Query("SELECT song_id FROM play_queue_items WHERE user_id = ? ORDER BY position", userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询播放队列歌曲失败: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("读取播放队列歌曲失败: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取播放队列歌曲失败: %v", err)
+	}
+	return ids, nil
+}
+
+// queueQuerier 兼容 *sql.DB 和 *sql.Tx 的查询接口
+type queueQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadPlayQueue 读取用户的播放队列及歌曲信息
+// 已删除或文件丢失的歌曲会被跳过，当前位置随之调整
+func loadPlayQueue(db queueQuerier, userID int) (*model.PlayQueue, error) {
+	queue := &model.PlayQueue{
+		SongIDs:      []int{},
+		Songs:        []model.SongInfo{},
+		CurrentIndex: -1,
+		RepeatMode:   model.RepeatModeOff,
+	}
+
+	var updatedAt sql.NullString
+	err := db.QueryRow(`
+		SELECT current_index, position_ms, shuffle, repeat_mode, device, version, updated_at
+		FROM play_queues WHERE user_id = ?
+	`, userID).Scan(
+		&queue.CurrentIndex, &queue.PositionMs, &queue.Shuffle, &queue.RepeatMode, &queue.Device, &queue.Version, &updatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return queue, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询播放队列失败: %v", err)
+	}
+	queue.UpdatedAt = parseDBTime(updatedAt)
+
+	rows, err := db.Query(`
+		SELECT qi.position, s.*
+		FROM play_queue_items qi
+		JOIN (SELECT `+songInfoColumns+` FROM songs WHERE is_deleted = 0 AND is_missing = 0) s ON s.id = qi.song_id
+		WHERE qi.user_id = ?
+		ORDER BY qi.position
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询播放队列歌曲失败: %v", err)
+	}
+	defer rows.Close()
+
+	currentPosition := queue.CurrentIndex
+	queue.CurrentIndex = -1
+	for rows.Next() {
+		var position int
+		var song model.SongInfo
+		if err := rows.Scan(append([]interface{}{&position}, songInfoFields(&song)...)...); err != nil {
+			return nil, fmt.Errorf("读取播放队列歌曲失败: %v", err)
+		}
+		if position <= currentPosition {
+			queue.CurrentIndex = len(queue.Songs)
+		}
+		queue.SongIDs = append(queue.SongIDs, song.ID)
+		queue.Songs = append(queue.Songs, song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取播放队列歌曲失败: %v", err)
+	}
+	if queue.CurrentIndex == -1 && len(queue.Songs) > 0 {
+		queue.CurrentIndex = 0
+	}
+	return queue, nil
+}
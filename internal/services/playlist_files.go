@@ -0,0 +1,664 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Playlist file formats
+const (
+	PlaylistFormatM3U8 = "m3u8"
+	PlaylistFormatPLS  = "pls"
+	PlaylistFormatXSPF = "xspf"
+)
+
+// playlistFileExtensions 扫描时作为服务器播放列表导入的文件
+var playlistFileExtensions = map[string]bool{
+	".m3u":  true,
+	".m3u8": true,
+}
+
+// ErrUnsupportedPlaylistFormat 无法识别的播放列表文件格式
+var ErrUnsupportedPlaylistFormat = errors.New("不支持的播放列表格式")
+
+// PlaylistFileEntry 播放列表文件中的一项，Artist、Title 和 Duration（秒）来自 #EXTINF 等附加信息
+type PlaylistFileEntry struct {
+	Path     string
+	Artist   string
+	Title    string
+	Duration int
+}
+
+// PlaylistFile 解析后的播放列表文件
+type PlaylistFile struct {
+	Name    string
+	Entries []PlaylistFileEntry
+}
+
+// exportSong 导出播放列表需要的歌曲信息
+type exportSong struct {
+	FilePath string
+	Title    string
+	Artist   string
+	Album    string
+	Duration int
+}
+
+// ParsePlaylistFile 根据文件扩展名解析 M3U/M3U8、PLS 或 XSPF 播放列表，扩展名未知时根据内容判断
+func ParsePlaylistFile(filename string, data []byte) (*PlaylistFile, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var playlist *PlaylistFile
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(filename)); {
+	case ext == ".m3u" || ext == ".m3u8":
+		playlist, err = parseM3U(data)
+	case ext == ".pls":
+		playlist, err = parsePLS(data)
+	case ext == ".xspf":
+		playlist, err = parseXSPF(data)
+	default:
+		trimmed := bytes.TrimSpace(data)
+		switch {
+		case bytes.HasPrefix(trimmed, []byte("<")):
+			playlist, err = parseXSPF(data)
+		case bytes.HasPrefix(bytes.ToLower(trimmed), []byte("[playlist]")):
+			playlist, err = parsePLS(data)
+		case bytes.HasPrefix(trimmed, []byte("#EXTM3U")):
+			playlist, err = parseM3U(data)
+		default:
+			return nil, ErrUnsupportedPlaylistFormat
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if playlist.Name == "" {
+		playlist.Name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	return playlist, nil
+}
+
+// parseM3U 解析 M3U/M3U8，支持 #EXTINF:秒数,艺术家 - 标题 和 #PLAYLIST:名称
+func parseM3U(data []byte) (*PlaylistFile, error) {
+	playlist := &PlaylistFile{}
+	var pending PlaylistFileEntry
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info := strings.TrimPrefix(line, "#EXTINF:")
+			durationPart, display, _ := strings.Cut(info, ",")
+			// 时长后可能带有 tvg-id="..." 等属性
+			durationPart, _, _ = strings.Cut(durationPart, " ")
+			pending = PlaylistFileEntry{}
+			if duration, err := strconv.Atoi(durationPart); err == nil && duration > 0 {
+				pending.Duration = duration
+			}
+			pending.Artist, pending.Title = splitArtistTitle(display)
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			playlist.Name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#"):
+		default:
+			pending.Path = line
+			playlist.Entries = append(playlist.Entries, pending)
+			pending = PlaylistFileEntry{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取播放列表失败: %v", err)
+	}
+	return playlist, nil
+}
+
+// parsePLS 解析 PLS 播放列表（FileN、TitleN、LengthN）
+func parsePLS(data []byte) (*PlaylistFile, error) {
+	entries := make(map[int]*PlaylistFileEntry)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var field string
+		for _, prefix := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if field == "" || err != nil {
+			continue
+		}
+		entry, ok := entries[index]
+		if !ok {
+			entry = &PlaylistFileEntry{}
+			entries[index] = entry
+		}
+		switch field {
+		case "file":
+			entry.Path = value
+		case "title":
+			entry.Artist, entry.Title = splitArtistTitle(value)
+		case "length":
+			if duration, err := strconv.Atoi(value); err == nil && duration > 0 {
+				entry.Duration = duration
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取播放列表失败: %v", err)
+	}
+
+	indexes := make([]int, 0, len(entries))
+	for index := range entries {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	playlist := &PlaylistFile{}
+	for _, index := range indexes {
+		if entries[index].Path != "" {
+			playlist.Entries = append(playlist.Entries, *entries[index])
+		}
+	}
+	return playlist, nil
+}
+
+// xspfPlaylist XSPF 文档结构
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+// xspfTrack XSPF 曲目，duration 单位为毫秒
+type xspfTrack struct {
+	Location string `xml:"location,omitempty"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	Duration int    `xml:"duration,omitempty"`
+}
+
+// parseXSPF 解析 XSPF 播放列表，location 为 URI
+func parseXSPF(data []byte) (*PlaylistFile, error) {
+	var doc struct {
+		Title  string      `xml:"title"`
+		Tracks []xspfTrack `xml:"trackList>track"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析XSPF失败: %v", err)
+	}
+
+	playlist := &PlaylistFile{Name: strings.TrimSpace(doc.Title)}
+	for _, track := range doc.Tracks {
+		location := strings.TrimSpace(track.Location)
+		if u, err := url.Parse(location); err == nil && u.Scheme == "file" {
+			location = u.Path
+		} else if err == nil && u.Scheme == "" {
+			location = u.Path
+		}
+		playlist.Entries = append(playlist.Entries, PlaylistFileEntry{
+			Path:     location,
+			Artist:   strings.TrimSpace(track.Creator),
+			Title:    strings.TrimSpace(track.Title),
+			Duration: track.Duration / 1000,
+		})
+	}
+	return playlist, nil
+}
+
+// splitArtistTitle 拆分 "艺术家 - 标题" 形式的显示名称，无法拆分时整体作为标题
+func splitArtistTitle(display string) (artist, title string) {
+	display = strings.TrimSpace(display)
+	if artist, title, ok := strings.Cut(display, " - "); ok {
+		return strings.TrimSpace(artist), strings.TrimSpace(title)
+	}
+	return "", display
+}
+
+// writePlaylistFile 生成播放列表文件，路径为相对音乐目录的路径
+func writePlaylistFile(format, name string, songs []exportSong) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case PlaylistFormatM3U8:
+		buf.WriteString("#EXTM3U\n")
+		fmt.Fprintf(&buf, "#PLAYLIST:%s\n", name)
+		for _, song := range songs {
+			fmt.Fprintf(&buf, "#EXTINF:%d,%s\n", song.Duration, displayName(song))
+			buf.WriteString(filepath.ToSlash(song.FilePath) + "\n")
+		}
+	case PlaylistFormatPLS:
+		buf.WriteString("[playlist]\n")
+		for i, song := range songs {
+			fmt.Fprintf(&buf, "File%d=%s\n", i+1, filepath.ToSlash(song.FilePath))
+			fmt.Fprintf(&buf, "Title%d=%s\n", i+1, displayName(song))
+			fmt.Fprintf(&buf, "Length%d=%d\n", i+1, song.Duration)
+		}
+		fmt.Fprintf(&buf, "NumberOfEntries=%d\nVersion=2\n", len(songs))
+	case PlaylistFormatXSPF:
+		doc := xspfPlaylist{Version: "1", Title: name}
+		for _, song := range songs {
+			location := (&url.URL{Path: filepath.ToSlash(song.FilePath)}).EscapedPath()
+			doc.Tracks = append(doc.Tracks, xspfTrack{
+				Location: location,
+				Title:    song.Title,
+				Creator:  song.Artist,
+				Album:    song.Album,
+				Duration: song.Duration * 1000,
+			})
+		}
+		buf.WriteString(xml.Header)
+		encoder := xml.NewEncoder(&buf)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(doc); err != nil {
+			return nil, fmt.Errorf("生成XSPF失败: %v", err)
+		}
+		buf.WriteString("\n")
+	default:
+		return nil, ErrUnsupportedPlaylistFormat
+	}
+	return buf.Bytes(), nil
+}
+
+// displayName 返回 "艺术家 - 标题"，没有艺术家时只返回标题
+func displayName(song exportSong) string {
+	if song.Artist == "" {
+		return song.Title
+	}
+	return song.Artist + " - " + song.Title
+}
+
+// Ways a playlist file entry was matched to a song
+const (
+	PlaylistMatchPath     = "path"
+	PlaylistMatchMetadata = "metadata"
+)
+
+// playlistResolver 将播放列表文件中的条目匹配到曲库中的歌曲
+type playlistResolver struct {
+	db       dbQuerier
+	musicDir string
+}
+
+// dbQuerier 兼容 *sql.DB 和 *sql.Tx 的查询接口
+type dbQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// resolve 匹配一个条目：先按 songs.file_path 匹配（相对 baseDir 或音乐目录，或位于音乐目录下的绝对路径），
+// 再按艺术家和标题模糊匹配。返回匹配到的歌曲ID（唯一时）、匹配方式以及全部候选歌曲
+func (pr *playlistResolver) resolve(entry PlaylistFileEntry, baseDir string) (int, string, []int, error) {
+	for _, candidate := range pr.candidatePaths(entry.Path, baseDir) {
+		var songID int
+		err := pr.db.QueryRow(
+			"SELECT id FROM songs WHERE file_path = ? AND is_deleted = 0 AND is_missing = 0",
+			candidate,
+		).Scan(&songID)
+		if err == nil {
+			return songID, PlaylistMatchPath, []int{songID}, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, "", nil, fmt.Errorf("查询歌曲失败: %v", err)
+		}
+	}
+
+	artist, title := entry.Artist, entry.Title
+	if title == "" && entry.Path != "" {
+		// 没有附加信息时从文件名推断，去掉开头的音轨号
+		base := path.Base(filepath.ToSlash(entry.Path))
+		base = strings.TrimSuffix(base, path.Ext(base))
+		artist, title = splitArtistTitle(trackNumberPrefix.ReplaceAllString(base, ""))
+	}
+	if title == "" {
+		return 0, "", nil, nil
+	}
+
+	candidates, err := pr.matchMetadata(artist, title, entry.Duration)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if len(candidates) == 1 {
+		return candidates[0], PlaylistMatchMetadata, candidates, nil
+	}
+	return 0, "", candidates, nil
+}
+
+// trackNumberPrefix 文件名开头的音轨号，如 "01 "、"01. "、"1-02 - "
+var trackNumberPrefix = regexp.MustCompile(`^\d+([-.]\d+)?[\s.\-_]+`)
+
+// candidatePaths 将条目路径转换为可能的 songs.file_path 取值
+func (pr *playlistResolver) candidatePaths(entryPath, baseDir string) []string {
+	entryPath = strings.TrimSpace(entryPath)
+	if entryPath == "" {
+		return nil
+	}
+	if u, err := url.Parse(entryPath); err == nil && len(u.Scheme) > 1 {
+		if u.Scheme != "file" {
+			return nil
+		}
+		entryPath = u.Path
+	}
+	entryPath = filepath.FromSlash(strings.ReplaceAll(entryPath, `\`, "/"))
+
+	var candidates []string
+	add := func(rel string) {
+		rel = filepath.Clean(rel)
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+			return
+		}
+		for _, existing := range candidates {
+			if existing == rel {
+				return
+			}
+		}
+		candidates = append(candidates, rel)
+	}
+
+	if filepath.IsAbs(entryPath) {
+		musicDir, err := filepath.Abs(pr.musicDir)
+		if err != nil {
+			return nil
+		}
+		if rel, err := filepath.Rel(musicDir, entryPath); err == nil {
+			add(rel)
+		}
+		return candidates
+	}
+	if baseDir != "" {
+		add(filepath.Join(baseDir, entryPath))
+	}
+	add(entryPath)
+	return candidates
+}
+
+// matchMetadata 按标题和艺术家查找歌曲，忽略大小写、空白和标点；时长相差超过 3 秒的候选在仍有其他候选时排除
+func (pr *playlistResolver) matchMetadata(artist, title string, duration int) ([]int, error) {
+	normalizedTitle := normalizeMatchText(title)
+	if normalizedTitle == "" {
+		return nil, nil
+	}
+	normalizedArtist := normalizeMatchText(artist)
+
+	// 先用标题中的每个词粗略筛选，再比较去掉标点后的完整标题
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	query := "SELECT id, title, COALESCE(artist, ''), COALESCE(duration, 0) FROM songs WHERE is_deleted = 0 AND is_missing = 0"
+	var args []interface{}
+	for _, word := range words {
+		query += ` AND title LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLike(word)+"%")
+	}
+
+	rows, err := pr.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询歌曲失败: %v", err)
+	}
+	defer rows.Close()
+
+	var matched, closeDuration []int
+	for rows.Next() {
+		var id, songDuration int
+		var songTitle, songArtist string
+		if err := rows.Scan(&id, &songTitle, &songArtist, &songDuration); err != nil {
+			return nil, fmt.Errorf("扫描歌曲数据失败: %v", err)
+		}
+		if normalizeMatchText(songTitle) != normalizedTitle {
+			continue
+		}
+		if normalizedArtist != "" {
+			songArtist = normalizeMatchText(songArtist)
+			if !strings.Contains(songArtist, normalizedArtist) && !strings.Contains(normalizedArtist, songArtist) {
+				continue
+			}
+		}
+		matched = append(matched, id)
+		if duration > 0 && songDuration > 0 && abs(songDuration-duration) <= 3 {
+			closeDuration = append(closeDuration, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("扫描歌曲数据失败: %v", err)
+	}
+
+	if len(matched) > 1 && len(closeDuration) > 0 {
+		return closeDuration, nil
+	}
+	return matched, nil
+}
+
+// normalizeMatchText 转为小写并只保留字母和数字
+func normalizeMatchText(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// abs 整数绝对值
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// syncServerPlaylist 将音乐目录中的播放列表文件同步为只读的服务器播放列表，只添加唯一匹配的歌曲
+// relPath 为相对音乐目录的路径；歌曲列表未变化时不更新
+func syncServerPlaylist(db *sql.DB, musicDir, relPath string) error {
+	data, err := os.ReadFile(filepath.Join(musicDir, relPath))
+	if err != nil {
+		return err
+	}
+	parsed, err := ParsePlaylistFile(relPath, data)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	resolver := &playlistResolver{db: tx, musicDir: musicDir}
+	baseDir := filepath.Dir(relPath)
+	var songIDs []int
+	for _, entry := range parsed.Entries {
+		songID, _, _, err := resolver.resolve(entry, baseDir)
+		if err != nil {
+			return err
+		}
+		if songID != 0 {
+			songIDs = append(songIDs, songID)
+		}
+	}
+
+	var playlistID int
+	var name string
+	err = tx.QueryRow("SELECT id, name FROM playlists WHERE source_path = ?", relPath).Scan(&playlistID, &name)
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := tx.Exec(`
+			INSERT INTO playlists (name, user_id, is_public, source_path, created_at, updated_at)
+			VALUES (?, NULL, 1, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`, parsed.Name, relPath)
+		if err != nil {
+			return fmt.Errorf("创建播放列表失败: %v", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("获取播放列表ID失败: %v", err)
+		}
+		playlistID = int(id)
+	case err != nil:
+		return fmt.Errorf("查询播放列表失败: %v", err)
+	default:
+		existing, err := playlistSongIDs(tx, playlistID)
+		if err != nil {
+			return err
+		}
+		if name == parsed.Name && equalInts(existing, songIDs) {
+			return nil
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM playlist_songs WHERE playlist_id = ?", playlistID); err != nil {
+		return fmt.Errorf("更新播放列表歌曲失败: %v", err)
+	}
+	for i, songID := range songIDs {
+		_, err := tx.Exec(`
+			INSERT INTO playlist_songs (playlist_id, song_id, order_index, added_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		`, playlistID, songID, i)
+		if err != nil {
+			return fmt.Errorf("更新播放列表歌曲失败: %v", err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE playlists SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", parsed.Name, playlistID); err != nil {
+		return fmt.Errorf("更新播放列表失败: %v", err)
+	}
+	return tx.Commit()
+}
+
+// removeServerPlaylists 删除播放列表文件已不存在的服务器播放列表
+// keep 为扫描中找到的文件；subDir 不为空时只处理该目录下的播放列表
+func removeServerPlaylists(db *sql.DB, subDir string, keep map[string]bool) (int, error) {
+	rows, err := db.Query("SELECT id, source_path FROM playlists WHERE source_path IS NOT NULL")
+	if err != nil {
+		return 0, fmt.Errorf("查询播放列表失败: %v", err)
+	}
+	var stale []int
+	for rows.Next() {
+		var id int
+		var sourcePath string
+		if err := rows.Scan(&id, &sourcePath); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("扫描播放列表数据失败: %v", err)
+		}
+		if subDir != "" && !strings.HasPrefix(sourcePath, subDir+string(filepath.Separator)) {
+			continue
+		}
+		if !keep[sourcePath] {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range stale {
+		if err := deletePlaylistRows(db, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+// removeServerPlaylistsUnder 删除来自指定文件或目录下文件的服务器播放列表
+func removeServerPlaylistsUnder(db *sql.DB, relPath string) error {
+	prefix := relPath + string(filepath.Separator)
+	rows, err := db.Query(
+		"SELECT id FROM playlists WHERE source_path = ? OR substr(source_path, 1, length(?)) = ?",
+		relPath, prefix, prefix,
+	)
+	if err != nil {
+		return fmt.Errorf("查询播放列表失败: %v", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := deletePlaylistRows(db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbExecer 兼容 *sql.DB 和 *sql.Tx 的执行接口
+type dbExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// deletePlaylistRows 删除播放列表及其歌曲、协作者、关注者和收藏
+func deletePlaylistRows(db dbExecer, playlistID int) error {
+	statements := []string{
+		"DELETE FROM playlist_songs WHERE playlist_id = ?",
+		"DELETE FROM playlist_collaborators WHERE playlist_id = ?",
+		"DELETE FROM playlist_followers WHERE playlist_id = ?",
+		"DELETE FROM favorites WHERE item_type = 'playlist' AND item_id = ?",
+		"DELETE FROM playlists WHERE id = ?",
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt, playlistID); err != nil {
+			return fmt.Errorf("删除播放列表失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// playlistSongIDs 按顺序返回播放列表中的歌曲ID
+func playlistSongIDs(db dbQuerier, playlistID int) ([]int, error) {
+	rows, err := db.Query("SELECT song_id FROM playlist_songs WHERE playlist_id = ? ORDER BY order_index ASC, id ASC", playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("查询播放列表歌曲失败: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("扫描歌曲数据失败: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// equalInts 比较两个整数切片是否相同
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -4,23 +4,58 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"melogo/internal/config"
+	"strings"
 	"time"
 )
 
+var (
+	// ErrPlaylistNotFound 播放列表不存在，或是其他用户的私有播放列表
+	ErrPlaylistNotFound = errors.New("播放列表不存在")
+	// ErrPlaylistForbidden 无权限修改播放列表
+	ErrPlaylistForbidden = errors.New("无权限修改此播放列表")
+)
+
+// Roles of a user for a playlist
+const (
+	PlaylistRoleOwner        = "owner"
+	PlaylistRoleCollaborator = "collaborator"
+	PlaylistRoleFollower     = "follower"
+)
+
 // PlaylistService 播放列表服务
+// 查看需要是所有者、协作者或公开的播放列表；修改歌曲需要是所有者或协作者；
+// 修改名称、公开状态、协作者以及删除只有所有者可以操作。
+// 从音乐目录中的播放列表文件导入的服务器播放列表没有所有者，对所有用户公开且只读
 type PlaylistService struct {
-	db *sql.DB
+	db       *sql.DB
+	musicDir string
 }
 
 // Playlist 播放列表结构
+// Role 为当前用户与播放列表的关系，不相关的公开播放列表为空
 type Playlist struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	UserID    int       `json:"user_id"`
-	IsPublic  bool      `json:"is_public"`
-	SongCount int       `json:"song_count"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	UserID        int       `json:"user_id"`
+	OwnerName     string    `json:"owner_name"`
+	IsPublic      bool      `json:"is_public"`
+	SongCount     int       `json:"song_count"`
+	FollowerCount int       `json:"follower_count"`
+	Role          string    `json:"role,omitempty"`
+	ReadOnly      bool      `json:"read_only"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// CanEdit 当前用户是否可以修改播放列表中的歌曲
+func (p *Playlist) CanEdit() bool {
+	return !p.ReadOnly && (p.Role == PlaylistRoleOwner || p.Role == PlaylistRoleCollaborator)
+}
+
+// canView 当前用户是否可以查看播放列表
+func (p *Playlist) canView() bool {
+	return p.CanEdit() || p.IsPublic
 }
 
 // PlaylistSong 播放列表歌曲结构
@@ -36,11 +71,18 @@ type PlaylistSong struct {
 	Duration int    `json:"duration,omitempty"`
 }
 
+// PlaylistCollaborator 可以修改播放列表歌曲的其他用户
+type PlaylistCollaborator struct {
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
 var playlistService *PlaylistService
 
 // NewPlaylistService 创建播放列表服务实例
-func NewPlaylistService(db *sql.DB) *PlaylistService {
-	service := &PlaylistService{db: db}
+func NewPlaylistService(cfg *config.Config, db *sql.DB) *PlaylistService {
+	service := &PlaylistService{db: db, musicDir: cfg.Music.Directory}
 	playlistService = service
 	return service
 }
@@ -50,19 +92,47 @@ func GetPlaylistService() *PlaylistService {
 	return playlistService
 }
 
-// GetUserPlaylists 获取用户的所有播放列表
-func (ps *PlaylistService) GetUserPlaylists(userID int) ([]*Playlist, error) {
-	query := `
-		SELECT p.id, p.name, p.user_id, p.is_public, p.created_at, p.updated_at,
-		       COUNT(ps.song_id) as song_count
-		FROM playlists p
-		LEFT JOIN playlist_songs ps ON p.id = ps.playlist_id
-		WHERE p.user_id = ?
-		GROUP BY p.id
-		ORDER BY p.updated_at DESC
-	`
+// playlistSelect 查询播放列表及当前用户角色，需要依次传入三次当前用户ID
+const playlistSelect = `
+	SELECT p.id, p.name, COALESCE(p.user_id, 0), COALESCE(u.username, ''), p.is_public, p.source_path IS NOT NULL,
+	       p.created_at, p.updated_at,
+	       (SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = p.id) AS song_count,
+	       (SELECT COUNT(*) FROM playlist_followers WHERE playlist_id = p.id) AS follower_count,
+	       CASE
+	           WHEN p.user_id = ? THEN 'owner'
+	           WHEN EXISTS (SELECT 1 FROM playlist_collaborators WHERE playlist_id = p.id AND user_id = ?) THEN 'collaborator'
+	           WHEN EXISTS (SELECT 1 FROM playlist_followers WHERE playlist_id = p.id AND user_id = ?) THEN 'follower'
+	           ELSE ''
+	       END AS role
+	FROM playlists p
+	LEFT JOIN users u ON u.id = p.user_id
+`
+
+// scanPlaylist 读取 playlistSelect 查询的一行
+func scanPlaylist(scanner rowScanner) (*Playlist, error) {
+	var p Playlist
+	err := scanner.Scan(
+		&p.ID,
+		&p.Name,
+		&p.UserID,
+		&p.OwnerName,
+		&p.IsPublic,
+		&p.ReadOnly,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.SongCount,
+		&p.FollowerCount,
+		&p.Role,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
 
-	rows, err := ps.db.Query(query, userID)
+// queryPlaylists 查询播放列表列表
+func (ps *PlaylistService) queryPlaylists(query string, args ...interface{}) ([]*Playlist, error) {
+	rows, err := ps.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("查询播放列表失败: %v", err)
 	}
@@ -70,25 +140,56 @@ func (ps *PlaylistService) GetUserPlaylists(userID int) ([]*Playlist, error) {
 
 	playlists := []*Playlist{}
 	for rows.Next() {
-		var p Playlist
-		err := rows.Scan(
-			&p.ID,
-			&p.Name,
-			&p.UserID,
-			&p.IsPublic,
-			&p.CreatedAt,
-			&p.UpdatedAt,
-			&p.SongCount,
-		)
+		p, err := scanPlaylist(rows)
 		if err != nil {
 			return nil, fmt.Errorf("扫描播放列表数据失败: %v", err)
 		}
-		playlists = append(playlists, &p)
+		playlists = append(playlists, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("扫描播放列表数据失败: %v", err)
 	}
 
 	return playlists, nil
 }
 
+// GetUserPlaylists 获取用户拥有、参与协作以及关注的播放列表
+// 关注的播放列表被设为私有后不再返回
+func (ps *PlaylistService) GetUserPlaylists(userID int) ([]*Playlist, error) {
+	query := playlistSelect + `
+		WHERE p.user_id = ?
+		   OR EXISTS (SELECT 1 FROM playlist_collaborators WHERE playlist_id = p.id AND user_id = ?)
+		   OR (p.is_public = 1 AND EXISTS (SELECT 1 FROM playlist_followers WHERE playlist_id = p.id AND user_id = ?))
+		ORDER BY p.updated_at DESC
+	`
+	return ps.queryPlaylists(query, userID, userID, userID, userID, userID, userID)
+}
+
+// GetPublicPlaylists 获取其他用户的公开播放列表及服务器播放列表，按关注人数排序，返回当前页及总数
+func (ps *PlaylistService) GetPublicPlaylists(userID int, keyword string, limit, offset int) ([]*Playlist, int, error) {
+	where := `WHERE p.is_public = 1 AND COALESCE(p.user_id, 0) != ?`
+	args := []interface{}{userID}
+	if keyword = strings.TrimSpace(keyword); keyword != "" {
+		where += ` AND (p.name LIKE ? ESCAPE '\' OR u.username LIKE ? ESCAPE '\')`
+		pattern := "%" + escapeLike(keyword) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	var total int
+	err := ps.db.QueryRow("SELECT COUNT(*) FROM playlists p LEFT JOIN users u ON u.id = p.user_id "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询播放列表失败: %v", err)
+	}
+
+	query := playlistSelect + where + ` ORDER BY follower_count DESC, p.updated_at DESC LIMIT ? OFFSET ?`
+	queryArgs := append([]interface{}{userID, userID, userID}, args...)
+	playlists, err := ps.queryPlaylists(query, append(queryArgs, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return playlists, total, nil
+}
+
 // CreatePlaylist 创建新播放列表
 func (ps *PlaylistService) CreatePlaylist(userID int, name string, isPublic bool) (*Playlist, error) {
 	if name == "" {
@@ -115,59 +216,66 @@ func (ps *PlaylistService) CreatePlaylist(userID int, name string, isPublic bool
 		return nil, fmt.Errorf("获取播放列表ID失败: %v", err)
 	}
 
-	playlist := &Playlist{
-		ID:        int(id),
-		Name:      name,
-		UserID:    userID,
-		IsPublic:  isPublic,
-		SongCount: 0,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	return playlist, nil
+	return ps.GetPlaylistForUser(int(id), userID)
 }
 
-// GetPlaylistByID 根据ID获取播放列表
+// GetPlaylistByID 根据ID获取播放列表，不检查权限
 func (ps *PlaylistService) GetPlaylistByID(playlistID int) (*Playlist, error) {
-	query := `
-		SELECT p.id, p.name, p.user_id, p.is_public, p.created_at, p.updated_at,
-		       COUNT(ps.song_id) as song_count
-		FROM playlists p
-		LEFT JOIN playlist_songs ps ON p.id = ps.playlist_id
-		WHERE p.id = ?
-		GROUP BY p.id
-	`
+	return ps.loadPlaylist(playlistID, 0)
+}
 
-	var p Playlist
-	err := ps.db.QueryRow(query, playlistID).Scan(
-		&p.ID,
-		&p.Name,
-		&p.UserID,
-		&p.IsPublic,
-		&p.CreatedAt,
-		&p.UpdatedAt,
-		&p.SongCount,
-	)
+// GetPlaylistForUser 获取用户可以查看的播放列表，其他用户的私有播放列表视为不存在
+func (ps *PlaylistService) GetPlaylistForUser(playlistID, userID int) (*Playlist, error) {
+	playlist, err := ps.loadPlaylist(playlistID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !playlist.canView() {
+		return nil, ErrPlaylistNotFound
+	}
+	return playlist, nil
+}
+
+// loadPlaylist 查询播放列表及用户角色
+func (ps *PlaylistService) loadPlaylist(playlistID, userID int) (*Playlist, error) {
+	playlist, err := scanPlaylist(ps.db.QueryRow(playlistSelect+" WHERE p.id = ?", userID, userID, userID, playlistID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("播放列表不存在")
+			return nil, ErrPlaylistNotFound
 		}
 		return nil, fmt.Errorf("查询播放列表失败: %v", err)
 	}
+	return playlist, nil
+}
 
-	return &p, nil
+// checkOwner 检查播放列表是否属于该用户
+func (ps *PlaylistService) checkOwner(playlistID, userID int) (*Playlist, error) {
+	playlist, err := ps.GetPlaylistForUser(playlistID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if playlist.Role != PlaylistRoleOwner {
+		return nil, ErrPlaylistForbidden
+	}
+	return playlist, nil
 }
 
-// UpdatePlaylist 更新播放列表
-func (ps *PlaylistService) UpdatePlaylist(playlistID, userID int, name string, isPublic bool) error {
-	// 检查权限
-	playlist, err := ps.GetPlaylistByID(playlistID)
+// checkEditor 检查用户是否可以修改播放列表中的歌曲
+func (ps *PlaylistService) checkEditor(playlistID, userID int) error {
+	playlist, err := ps.GetPlaylistForUser(playlistID, userID)
 	if err != nil {
 		return err
 	}
-	if playlist.UserID != userID {
-		return errors.New("无权限修改此播放列表")
+	if !playlist.CanEdit() {
+		return ErrPlaylistForbidden
+	}
+	return nil
+}
+
+// UpdatePlaylist 更新播放列表
+func (ps *PlaylistService) UpdatePlaylist(playlistID, userID int, name string, isPublic bool) error {
+	if _, err := ps.checkOwner(playlistID, userID); err != nil {
+		return err
 	}
 
 	isPublicInt := 0
@@ -181,7 +289,7 @@ func (ps *PlaylistService) UpdatePlaylist(playlistID, userID int, name string, i
 		WHERE id = ?
 	`
 
-	_, err = ps.db.Exec(query, name, isPublicInt, playlistID)
+	_, err := ps.db.Exec(query, name, isPublicInt, playlistID)
 	if err != nil {
 		return fmt.Errorf("更新播放列表失败: %v", err)
 	}
@@ -191,71 +299,447 @@ func (ps *PlaylistService) UpdatePlaylist(playlistID, userID int, name string, i
 
 // DeletePlaylist 删除播放列表
 func (ps *PlaylistService) DeletePlaylist(playlistID, userID int) error {
-	// 检查权限
-	playlist, err := ps.GetPlaylistByID(playlistID)
+	if _, err := ps.checkOwner(playlistID, userID); err != nil {
+		return err
+	}
+
+	tx, err := ps.db.Begin()
 	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := deletePlaylistRows(tx, playlistID); err != nil {
 		return err
 	}
-	if playlist.UserID != userID {
-		return errors.New("无权限删除此播放列表")
+	return tx.Commit()
+}
+
+// GetCollaborators 获取播放列表的协作者，所有者和协作者可以查看
+func (ps *PlaylistService) GetCollaborators(playlistID, userID int) ([]*PlaylistCollaborator, error) {
+	if err := ps.checkEditor(playlistID, userID); err != nil {
+		return nil, err
 	}
 
-	query := `DELETE FROM playlists WHERE id = ?`
-	_, err = ps.db.Exec(query, playlistID)
+	rows, err := ps.db.Query(`
+		SELECT pc.user_id, u.username, pc.added_at
+		FROM playlist_collaborators pc
+		INNER JOIN users u ON u.id = pc.user_id
+		WHERE pc.playlist_id = ?
+		ORDER BY pc.added_at ASC
+	`, playlistID)
 	if err != nil {
-		return fmt.Errorf("删除播放列表失败: %v", err)
+		return nil, fmt.Errorf("查询协作者失败: %v", err)
+	}
+	defer rows.Close()
+
+	collaborators := []*PlaylistCollaborator{}
+	for rows.Next() {
+		var pc PlaylistCollaborator
+		if err := rows.Scan(&pc.UserID, &pc.Username, &pc.AddedAt); err != nil {
+			return nil, fmt.Errorf("扫描协作者数据失败: %v", err)
+		}
+		collaborators = append(collaborators, &pc)
+	}
+
+	return collaborators, nil
+}
+
+// AddCollaborator 授予其他用户修改播放列表歌曲的权限，只有所有者可以操作
+func (ps *PlaylistService) AddCollaborator(playlistID, ownerID, collaboratorID int) error {
+	if _, err := ps.checkOwner(playlistID, ownerID); err != nil {
+		return err
+	}
+	if collaboratorID == ownerID {
+		return errors.New("不能将自己添加为协作者")
 	}
 
+	_, err := ps.db.Exec(
+		"INSERT OR IGNORE INTO playlist_collaborators (playlist_id, user_id, added_at) VALUES (?, ?, CURRENT_TIMESTAMP)",
+		playlistID, collaboratorID,
+	)
+	if err != nil {
+		return fmt.Errorf("添加协作者失败: %v", err)
+	}
 	return nil
 }
 
-// AddSongToPlaylist 添加歌曲到播放列表
-func (ps *PlaylistService) AddSongToPlaylist(playlistID, songID int) error {
-	// 检查歌曲是否已存在
-	checkQuery := `SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = ? AND song_id = ?`
-	var count int
-	err := ps.db.QueryRow(checkQuery, playlistID, songID).Scan(&count)
+// RemoveCollaborator 移除协作者；所有者可以移除任何协作者，协作者可以退出协作
+func (ps *PlaylistService) RemoveCollaborator(playlistID, userID, collaboratorID int) error {
+	playlist, err := ps.GetPlaylistForUser(playlistID, userID)
 	if err != nil {
-		return fmt.Errorf("检查歌曲是否存在失败: %v", err)
+		return err
 	}
-	if count > 0 {
-		return errors.New("歌曲已在播放列表中")
+	if playlist.Role != PlaylistRoleOwner && userID != collaboratorID {
+		return ErrPlaylistForbidden
+	}
+
+	result, err := ps.db.Exec("DELETE FROM playlist_collaborators WHERE playlist_id = ? AND user_id = ?", playlistID, collaboratorID)
+	if err != nil {
+		return fmt.Errorf("移除协作者失败: %v", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("该用户不是协作者")
 	}
+	return nil
+}
 
-	// 获取当前最大序号
-	maxOrderQuery := `SELECT COALESCE(MAX(order_index), 0) FROM playlist_songs WHERE playlist_id = ?`
-	var maxOrder int
-	err = ps.db.QueryRow(maxOrderQuery, playlistID).Scan(&maxOrder)
+// FollowPlaylist 关注其他用户的公开播放列表
+func (ps *PlaylistService) FollowPlaylist(playlistID, userID int) error {
+	playlist, err := ps.GetPlaylistForUser(playlistID, userID)
 	if err != nil {
-		return fmt.Errorf("获取最大序号失败: %v", err)
+		return err
+	}
+	if playlist.Role == PlaylistRoleOwner {
+		return errors.New("不能关注自己的播放列表")
+	}
+	if !playlist.IsPublic {
+		return errors.New("只能关注公开的播放列表")
 	}
 
-	// 插入歌曲
-	insertQuery := `
-		INSERT INTO playlist_songs (playlist_id, song_id, order_index, added_at)
-		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
-	`
-	_, err = ps.db.Exec(insertQuery, playlistID, songID, maxOrder+1)
+	_, err = ps.db.Exec(
+		"INSERT OR IGNORE INTO playlist_followers (playlist_id, user_id, followed_at) VALUES (?, ?, CURRENT_TIMESTAMP)",
+		playlistID, userID,
+	)
 	if err != nil {
-		return fmt.Errorf("添加歌曲失败: %v", err)
+		return fmt.Errorf("关注播放列表失败: %v", err)
 	}
+	return nil
+}
 
+// UnfollowPlaylist 取消关注播放列表
+func (ps *PlaylistService) UnfollowPlaylist(playlistID, userID int) error {
+	_, err := ps.db.Exec("DELETE FROM playlist_followers WHERE playlist_id = ? AND user_id = ?", playlistID, userID)
+	if err != nil {
+		return fmt.Errorf("取消关注播放列表失败: %v", err)
+	}
 	return nil
 }
 
-// RemoveSongFromPlaylist 从播放列表移除歌曲
-func (ps *PlaylistService) RemoveSongFromPlaylist(playlistID, songID int) error {
-	query := `DELETE FROM playlist_songs WHERE playlist_id = ? AND song_id = ?`
-	result, err := ps.db.Exec(query, playlistID, songID)
+// CopyPlaylist 将可以查看的播放列表复制为当前用户的私有播放列表，name 为空时沿用原名称
+func (ps *PlaylistService) CopyPlaylist(playlistID, userID int, name string) (*Playlist, error) {
+	source, err := ps.GetPlaylistForUser(playlistID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = source.Name
+	}
+
+	tx, err := ps.db.Begin()
 	if err != nil {
-		return fmt.Errorf("移除歌曲失败: %v", err)
+		return nil, fmt.Errorf("开始事务失败: %v", err)
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	result, err := tx.Exec(`
+		INSERT INTO playlists (name, user_id, is_public, created_at, updated_at)
+		VALUES (?, ?, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, name, userID)
+	if err != nil {
+		return nil, fmt.Errorf("创建播放列表失败: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("获取播放列表ID失败: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO playlist_songs (playlist_id, song_id, order_index, added_at)
+		SELECT ?, song_id, order_index, CURRENT_TIMESTAMP
+		FROM playlist_songs WHERE playlist_id = ?
+		ORDER BY order_index ASC, id ASC
+	`, id, playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("复制播放列表歌曲失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return ps.GetPlaylistForUser(int(id), userID)
+}
+
+// AddSongToPlaylist 添加歌曲到播放列表末尾
+func (ps *PlaylistService) AddSongToPlaylist(playlistID, userID, songID int) error {
+	if err := ps.checkEditor(playlistID, userID); err != nil {
+		return err
+	}
+	added, err := ps.insertSongs(playlistID, -1, []int{songID}, false)
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		return errors.New("歌曲已在播放列表中")
+	}
+	return nil
+}
+
+// RemoveSongFromPlaylist 从播放列表移除歌曲，歌曲出现多次时全部移除
+func (ps *PlaylistService) RemoveSongFromPlaylist(playlistID, userID, songID int) error {
+	if err := ps.checkEditor(playlistID, userID); err != nil {
+		return err
+	}
+	removed, err := ps.removeEntries(playlistID, nil, []int{songID})
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
 		return errors.New("歌曲不在播放列表中")
 	}
+	return nil
+}
+
+// MovePlaylistSong 将播放列表中 from 位置的歌曲移动到 to 位置
+// 位置与 GetPlaylistSongs 返回的列表一致，从 0 开始
+func (ps *PlaylistService) MovePlaylistSong(playlistID, userID, from, to int) error {
+	if err := ps.checkEditor(playlistID, userID); err != nil {
+		return err
+	}
+	return ps.editPlaylistSongs(playlistID, func(entries []playlistEntry) ([]playlistEntry, error) {
+		visible := visibleEntryPositions(entries)
+		if from < 0 || from >= len(visible) || to < 0 || to >= len(visible) {
+			return nil, errors.New("歌曲位置超出范围")
+		}
+		entry := entries[visible[from]]
+		entries = append(entries[:visible[from]:visible[from]], entries[visible[from]+1:]...)
+		at := entryInsertPosition(entries, to)
+		return append(entries[:at:at], append([]playlistEntry{entry}, entries[at:]...)...), nil
+	})
+}
+
+// AddSongsToPlaylist 批量添加歌曲，index 为插入位置（从 0 开始），小于 0 表示加到末尾
+// 不允许重复时跳过已在播放列表中的歌曲，返回实际添加的数量
+func (ps *PlaylistService) AddSongsToPlaylist(playlistID, userID, index int, songIDs []int, allowDuplicates bool) (int, error) {
+	if err := ps.checkEditor(playlistID, userID); err != nil {
+		return 0, err
+	}
+	return ps.insertSongs(playlistID, index, songIDs, allowDuplicates)
+}
+
+// RemovePlaylistSongs 批量移除歌曲，entryIDs 为播放列表条目ID，songIDs 中的歌曲会移除所有出现
+// 返回实际移除的数量
+func (ps *PlaylistService) RemovePlaylistSongs(playlistID, userID int, entryIDs, songIDs []int) (int, error) {
+	if err := ps.checkEditor(playlistID, userID); err != nil {
+		return 0, err
+	}
+	return ps.removeEntries(playlistID, entryIDs, songIDs)
+}
+
+// ReplacePlaylistSongs 用给定的歌曲替换播放列表的全部内容，允许重复
+func (ps *PlaylistService) ReplacePlaylistSongs(playlistID, userID int, songIDs []int) error {
+	if err := ps.checkEditor(playlistID, userID); err != nil {
+		return err
+	}
+	return ps.editPlaylistSongs(playlistID, func(entries []playlistEntry) ([]playlistEntry, error) {
+		replaced := make([]playlistEntry, 0, len(songIDs))
+		for _, songID := range songIDs {
+			replaced = append(replaced, playlistEntry{SongID: songID, Visible: true})
+		}
+		return replaced, nil
+	})
+}
+
+// insertSongs 在 index 位置插入歌曲，返回实际添加的数量
+func (ps *PlaylistService) insertSongs(playlistID, index int, songIDs []int, allowDuplicates bool) (int, error) {
+	added := 0
+	err := ps.editPlaylistSongs(playlistID, func(entries []playlistEntry) ([]playlistEntry, error) {
+		existing := make(map[int]bool, len(entries))
+		for _, entry := range entries {
+			existing[entry.SongID] = true
+		}
+
+		var inserted []playlistEntry
+		for _, songID := range songIDs {
+			if existing[songID] && !allowDuplicates {
+				continue
+			}
+			existing[songID] = true
+			inserted = append(inserted, playlistEntry{SongID: songID, Visible: true})
+		}
+		if len(inserted) == 0 {
+			return entries, nil
+		}
+		added = len(inserted)
+
+		at := len(entries)
+		if index >= 0 {
+			at = entryInsertPosition(entries, index)
+		}
+		result := make([]playlistEntry, 0, len(entries)+len(inserted))
+		result = append(result, entries[:at]...)
+		result = append(result, inserted...)
+		return append(result, entries[at:]...), nil
+	})
+	return added, err
+}
+
+// removeEntries 移除指定的条目以及指定歌曲的所有出现，返回实际移除的数量
+func (ps *PlaylistService) removeEntries(playlistID int, entryIDs, songIDs []int) (int, error) {
+	removed := 0
+	err := ps.editPlaylistSongs(playlistID, func(entries []playlistEntry) ([]playlistEntry, error) {
+		removeEntry := make(map[int]bool, len(entryIDs))
+		for _, id := range entryIDs {
+			removeEntry[id] = true
+		}
+		removeSong := make(map[int]bool, len(songIDs))
+		for _, id := range songIDs {
+			removeSong[id] = true
+		}
+
+		kept := entries[:0:0]
+		for _, entry := range entries {
+			if removeEntry[entry.ID] || removeSong[entry.SongID] {
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		removed = len(entries) - len(kept)
+		return kept, nil
+	})
+	return removed, err
+}
+
+// playlistEntry 播放列表中的一个条目，ID 为 0 表示新加入的条目
+// Visible 为 false 表示歌曲已被删除或文件缺失，不会出现在 GetPlaylistSongs 的结果中
+type playlistEntry struct {
+	ID      int
+	SongID  int
+	Visible bool
+}
+
+// visibleEntryPositions 返回可见条目在 entries 中的下标
+func visibleEntryPositions(entries []playlistEntry) []int {
+	positions := []int{}
+	for i, entry := range entries {
+		if entry.Visible {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// entryInsertPosition 将可见列表中的位置转换为 entries 中的插入下标
+// 插入到第 index 首可见歌曲之前，超出范围时插入到末尾
+func entryInsertPosition(entries []playlistEntry, index int) int {
+	visible := visibleEntryPositions(entries)
+	if index < len(visible) {
+		return visible[index]
+	}
+	return len(entries)
+}
+
+// editPlaylistSongs 在事务中读取播放列表的全部条目、修改后保存，并将 order_index 重新编号为从 0 开始的连续序号
+func (ps *PlaylistService) editPlaylistSongs(playlistID int, mutate func(entries []playlistEntry) ([]playlistEntry, error)) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM playlists WHERE id = ?", playlistID).Scan(&exists); err != nil {
+		return fmt.Errorf("查询播放列表失败: %v", err)
+	}
+	if exists == 0 {
+		return ErrPlaylistNotFound
+	}
+
+	rows, err := tx.Query(`
+		SELECT ps.id, ps.song_id, COALESCE(s.is_deleted = 0 AND s.is_missing = 0, 0)
+		FROM playlist_songs ps
+		LEFT JOIN songs s ON ps.song_id = s.id
+		WHERE ps.playlist_id = ?
+		ORDER BY ps.order_index ASC, ps.id ASC
+	`, playlistID)
+	if err != nil {
+		return fmt.Errorf("查询播放列表歌曲失败: %v", err)
+	}
+	var entries []playlistEntry
+	for rows.Next() {
+		var entry playlistEntry
+		if err := rows.Scan(&entry.ID, &entry.SongID, &entry.Visible); err != nil {
+			rows.Close()
+			return fmt.Errorf("扫描歌曲数据失败: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描歌曲数据失败: %v", err)
+	}
 
+	original := make(map[int]bool, len(entries))
+	for _, entry := range entries {
+		original[entry.ID] = true
+	}
+
+	updated, err := mutate(entries)
+	if err != nil {
+		return err
+	}
+
+	// 检查新加入的歌曲是否存在
+	seen := make(map[int]bool)
+	var added []interface{}
+	for _, entry := range updated {
+		if entry.ID == 0 && !seen[entry.SongID] {
+			seen[entry.SongID] = true
+			added = append(added, entry.SongID)
+		}
+	}
+	for start := 0; start < len(added); start += 500 {
+		end := start + 500
+		if end > len(added) {
+			end = len(added)
+		}
+		batch := added[start:end]
+		var count int
+		err := tx.QueryRow(
+			"SELECT COUNT(*) FROM songs WHERE is_deleted = 0 AND is_missing = 0 AND id IN (?"+strings.Repeat(", ?", len(batch)-1)+")",
+			batch...,
+		).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("查询歌曲失败: %v", err)
+		}
+		if count != len(batch) {
+			return errors.New("歌曲不存在")
+		}
+	}
+
+	kept := make(map[int]bool, len(updated))
+	for _, entry := range updated {
+		kept[entry.ID] = true
+	}
+	for id := range original {
+		if !kept[id] {
+			if _, err := tx.Exec("DELETE FROM playlist_songs WHERE id = ?", id); err != nil {
+				return fmt.Errorf("移除歌曲失败: %v", err)
+			}
+		}
+	}
+	for i, entry := range updated {
+		if entry.ID == 0 {
+			_, err = tx.Exec(`
+				INSERT INTO playlist_songs (playlist_id, song_id, order_index, added_at)
+				VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			`, playlistID, entry.SongID, i)
+			if err != nil {
+				return fmt.Errorf("添加歌曲失败: %v", err)
+			}
+			continue
+		}
+		if _, err := tx.Exec("UPDATE playlist_songs SET order_index = ? WHERE id = ?", i, entry.ID); err != nil {
+			return fmt.Errorf("更新歌曲顺序失败: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE playlists SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", playlistID); err != nil {
+		return fmt.Errorf("更新播放列表失败: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
 	return nil
 }
 
@@ -266,7 +750,7 @@ func (ps *PlaylistService) GetPlaylistSongs(playlistID int) ([]*PlaylistSong, er
 		       s.title, s.artist, s.duration
 		FROM playlist_songs ps
 		INNER JOIN songs s ON ps.song_id = s.id
-		WHERE ps.playlist_id = ? AND s.is_deleted = 0
+		WHERE ps.playlist_id = ? AND s.is_deleted = 0 AND s.is_missing = 0
 		ORDER BY ps.order_index ASC
 	`
 
@@ -297,3 +781,137 @@ func (ps *PlaylistService) GetPlaylistSongs(playlistID int) ([]*PlaylistSong, er
 
 	return songs, nil
 }
+
+// PlaylistImportEntry 导入时一个条目的匹配结果，Index 为条目在文件中的序号（从 0 开始）
+type PlaylistImportEntry struct {
+	Index      int    `json:"index"`
+	Path       string `json:"path"`
+	Artist     string `json:"artist,omitempty"`
+	Title      string `json:"title,omitempty"`
+	SongID     int    `json:"song_id,omitempty"`
+	MatchedBy  string `json:"matched_by,omitempty"`
+	Candidates []int  `json:"candidates,omitempty"`
+}
+
+// PlaylistImportReport 导入结果：已匹配、匹配到多首歌曲（未添加）以及未找到的条目
+type PlaylistImportReport struct {
+	Matched   []PlaylistImportEntry `json:"matched"`
+	Ambiguous []PlaylistImportEntry `json:"ambiguous"`
+	Missing   []PlaylistImportEntry `json:"missing"`
+}
+
+// ImportPlaylist 从播放列表文件创建用户的私有播放列表，name 为空时使用文件中的名称或文件名
+// 条目先按路径匹配 songs.file_path，再按艺术家和标题模糊匹配；只有唯一匹配的歌曲会被添加
+func (ps *PlaylistService) ImportPlaylist(userID int, filename string, data []byte, name string) (*Playlist, *PlaylistImportReport, error) {
+	parsed, err := ParsePlaylistFile(filename, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(parsed.Entries) == 0 {
+		return nil, nil, errors.New("播放列表为空")
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = parsed.Name
+	}
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	resolver := &playlistResolver{db: tx, musicDir: ps.musicDir}
+	report := &PlaylistImportReport{
+		Matched:   []PlaylistImportEntry{},
+		Ambiguous: []PlaylistImportEntry{},
+		Missing:   []PlaylistImportEntry{},
+	}
+	var songIDs []int
+	for i, entry := range parsed.Entries {
+		songID, matchedBy, candidates, err := resolver.resolve(entry, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		result := PlaylistImportEntry{Index: i, Path: entry.Path, Artist: entry.Artist, Title: entry.Title}
+		switch {
+		case songID != 0:
+			result.SongID = songID
+			result.MatchedBy = matchedBy
+			report.Matched = append(report.Matched, result)
+			songIDs = append(songIDs, songID)
+		case len(candidates) > 1:
+			result.Candidates = candidates
+			report.Ambiguous = append(report.Ambiguous, result)
+		default:
+			report.Missing = append(report.Missing, result)
+		}
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO playlists (name, user_id, is_public, created_at, updated_at)
+		VALUES (?, ?, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, name, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建播放列表失败: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取播放列表ID失败: %v", err)
+	}
+	for i, songID := range songIDs {
+		_, err := tx.Exec(`
+			INSERT INTO playlist_songs (playlist_id, song_id, order_index, added_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		`, id, songID, i)
+		if err != nil {
+			return nil, nil, fmt.Errorf("添加歌曲失败: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+
+	playlist, err := ps.GetPlaylistForUser(int(id), userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return playlist, report, nil
+}
+
+// ExportPlaylist 将用户可以查看的播放列表导出为 m3u8、pls 或 xspf，路径为相对音乐目录的路径
+func (ps *PlaylistService) ExportPlaylist(playlistID, userID int, format string) (*Playlist, []byte, error) {
+	playlist, err := ps.GetPlaylistForUser(playlistID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := ps.db.Query(`
+		SELECT s.file_path, s.title, COALESCE(s.artist, ''), COALESCE(s.album, ''), COALESCE(s.duration, 0)
+		FROM playlist_songs ps
+		INNER JOIN songs s ON ps.song_id = s.id
+		WHERE ps.playlist_id = ? AND s.is_deleted = 0 AND s.is_missing = 0
+		ORDER BY ps.order_index ASC, ps.id ASC
+	`, playlistID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("查询播放列表歌曲失败: %v", err)
+	}
+	defer rows.Close()
+
+	var songs []exportSong
+	for rows.Next() {
+		var song exportSong
+		if err := rows.Scan(&song.FilePath, &song.Title, &song.Artist, &song.Album, &song.Duration); err != nil {
+			return nil, nil, fmt.Errorf("扫描歌曲数据失败: %v", err)
+		}
+		songs = append(songs, song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("扫描歌曲数据失败: %v", err)
+	}
+
+	data, err := writePlaylistFile(format, playlist.Name, songs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return playlist, data, nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"melogo/internal/model"
+	"melogo/internal/utils"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 扫描触发来源
+const (
+	ScanTriggerSchedule = "schedule"
+	ScanTriggerWatch    = "watch"
+	ScanTriggerAdmin    = "admin"
+)
+
+// maxScanErrors 扫描状态中保留的单文件错误数量上限
+const maxScanErrors = 200
+
+var (
+	// ErrScanInProgress 已有扫描正在进行
+	ErrScanInProgress = errors.New("music scan is already running")
+	// ErrInvalidScanPath 扫描路径不是音乐目录下的有效目录
+	ErrInvalidScanPath = errors.New("invalid scan path")
+)
+
+// ScanOptions 扫描选项
+type ScanOptions struct {
+	Full    bool   // 忽略文件大小和修改时间，重新解析所有文件
+	Path    string // 仅扫描音乐目录下的子目录（相对路径），为空时扫描整个目录
+	Trigger string
+}
+
+// StartScan 在后台启动扫描，已有扫描进行中时返回 ErrScanInProgress
+func (ms *MusicScanner) StartScan(opts ScanOptions) error {
+	root := ms.Cfg.Music.Directory
+	if opts.Path != "" && opts.Path != "." {
+		absPath, err := utils.SafeJoin(ms.Cfg.Music.Directory, opts.Path)
+		if err != nil {
+			return ErrInvalidScanPath
+		}
+		if info, err := os.Stat(absPath); err != nil || !info.IsDir() {
+			return ErrInvalidScanPath
+		}
+		absBase, _ := filepath.Abs(ms.Cfg.Music.Directory)
+		relPath, err := filepath.Rel(absBase, absPath)
+		if err != nil {
+			return ErrInvalidScanPath
+		}
+		if relPath == "." {
+			relPath = ""
+		}
+		opts.Path = relPath
+		root = filepath.Join(ms.Cfg.Music.Directory, relPath)
+	} else {
+		opts.Path = ""
+	}
+
+	ms.stateMu.Lock()
+	if ms.status.Running {
+		ms.stateMu.Unlock()
+		return ErrScanInProgress
+	}
+	now := time.Now()
+	ms.status = model.ScanStatus{
+		Running:   true,
+		Phase:     "scanning",
+		Trigger:   opts.Trigger,
+		Full:      opts.Full,
+		Path:      opts.Path,
+		StartedAt: &now,
+		Errors:    []model.ScanFileError{},
+	}
+	ms.notifyScanWatchersLocked()
+	ms.stateMu.Unlock()
+
+	go ms.runScan(opts, root)
+	return nil
+}
+
+// GetScanStatus 获取当前或最近一次扫描的状态
+func (ms *MusicScanner) GetScanStatus() model.ScanStatus {
+	ms.stateMu.Lock()
+	defer ms.stateMu.Unlock()
+
+	status := ms.status
+	status.Errors = append([]model.ScanFileError{}, ms.status.Errors...)
+	if status.StartedAt != nil {
+		end := time.Now()
+		if status.FinishedAt != nil {
+			end = *status.FinishedAt
+		}
+		status.ElapsedSeconds = end.Sub(*status.StartedAt).Seconds()
+	}
+	if status.Phase == "" {
+		status.Phase = "idle"
+	}
+	return status
+}
+
+// WatchScanStatus 订阅扫描状态变化，返回的通道只作通知，状态需通过 GetScanStatus 获取
+// 不再使用时必须调用返回的取消函数
+func (ms *MusicScanner) WatchScanStatus() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	ms.stateMu.Lock()
+	if ms.watchers == nil {
+		ms.watchers = make(map[chan struct{}]struct{})
+	}
+	ms.watchers[ch] = struct{}{}
+	ms.stateMu.Unlock()
+
+	return ch, func() {
+		ms.stateMu.Lock()
+		delete(ms.watchers, ch)
+		ms.stateMu.Unlock()
+	}
+}
+
+// updateScanStatus 修改扫描状态并通知订阅者
+func (ms *MusicScanner) updateScanStatus(update func(status *model.ScanStatus)) {
+	ms.stateMu.Lock()
+	update(&ms.status)
+	ms.notifyScanWatchersLocked()
+	ms.stateMu.Unlock()
+}
+
+// recordScanError 记录单个文件的处理错误
+func (ms *MusicScanner) recordScanError(path string, err error) {
+	if relPath, relErr := filepath.Rel(ms.Cfg.Music.Directory, path); relErr == nil {
+		path = relPath
+	}
+	ms.updateScanStatus(func(status *model.ScanStatus) {
+		status.Failed++
+		if len(status.Errors) < maxScanErrors {
+			status.Errors = append(status.Errors, model.ScanFileError{Path: path, Error: err.Error()})
+		}
+	})
+}
+
+// finishScan 标记扫描结束
+func (ms *MusicScanner) finishScan() {
+	now := time.Now()
+	ms.updateScanStatus(func(status *model.ScanStatus) {
+		status.Running = false
+		status.Phase = "idle"
+		status.FinishedAt = &now
+	})
+}
+
+// notifyScanWatchersLocked 通知订阅者状态已变化，调用方需持有 stateMu
+// 通道已有未读通知时跳过，连续的变化会被合并
+func (ms *MusicScanner) notifyScanWatchersLocked() {
+	for ch := range ms.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
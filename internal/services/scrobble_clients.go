@@ -0,0 +1,317 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"melogo/internal/model"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scrobbleClientName 提交播放记录时使用的客户端名称
+const scrobbleClientName = "MeloGo"
+
+// scrobbleTrack 提交到外部服务的歌曲信息，以 JSON 保存在待提交队列中
+type scrobbleTrack struct {
+	Title         string   `json:"title"`
+	Artist        string   `json:"artist"`
+	Album         string   `json:"album,omitempty"`
+	AlbumArtist   string   `json:"album_artist,omitempty"`
+	DurationMs    int      `json:"duration_ms,omitempty"`
+	TrackNumber   int      `json:"track_number,omitempty"`
+	RecordingMBID string   `json:"recording_mbid,omitempty"`
+	ReleaseMBID   string   `json:"release_mbid,omitempty"`
+	ArtistMBIDs   []string `json:"artist_mbids,omitempty"`
+}
+
+// scrobbleCredentials 提交时使用的账号信息，Token 为解密后的令牌
+type scrobbleCredentials struct {
+	Provider string
+	Token    string
+	APIURL   string
+}
+
+// scrobbleError 外部服务返回的错误
+// Permanent 为 true 表示重试也不会成功（如请求数据无效），该条记录应丢弃
+type scrobbleError struct {
+	Message   string
+	Permanent bool
+}
+
+func (e *scrobbleError) Error() string {
+	return e.Message
+}
+
+// scrobbleClient 外部播放记录服务的客户端
+type scrobbleClient struct {
+	http            *http.Client
+	lastFMAPIKey    string
+	lastFMAPISecret string
+}
+
+// validate 校验令牌并返回服务端的用户名
+func (sc *scrobbleClient) validate(ctx context.Context, creds scrobbleCredentials) (string, error) {
+	switch creds.Provider {
+	case model.ScrobbleProviderListenBrainz:
+		var result struct {
+			Valid    bool   `json:"valid"`
+			UserName string `json:"user_name"`
+		}
+		status, err := sc.listenBrainzRequest(ctx, creds, http.MethodGet, "/1/validate-token", nil, &result)
+		if status == http.StatusNotFound {
+			// 部分兼容服务未实现令牌校验接口
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !result.Valid {
+			return "", errors.New("令牌无效")
+		}
+		return result.UserName, nil
+	case model.ScrobbleProviderLastFM:
+		var result struct {
+			User struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		}
+		if err := sc.lastFMCall(ctx, creds, map[string]string{"method": "user.getInfo"}, &result); err != nil {
+			return "", err
+		}
+		return result.User.Name, nil
+	}
+	return "", fmt.Errorf("不支持的播放记录服务: %s", creds.Provider)
+}
+
+// submit 提交一次播放，listenedAt 为 nil 时发送正在播放通知
+func (sc *scrobbleClient) submit(ctx context.Context, creds scrobbleCredentials, track scrobbleTrack, listenedAt *time.Time) error {
+	switch creds.Provider {
+	case model.ScrobbleProviderListenBrainz:
+		return sc.submitListenBrainz(ctx, creds, track, listenedAt)
+	case model.ScrobbleProviderLastFM:
+		return sc.submitLastFM(ctx, creds, track, listenedAt)
+	}
+	return &scrobbleError{Message: "不支持的播放记录服务: " + creds.Provider, Permanent: true}
+}
+
+// submitListenBrainz 按 ListenBrainz API 提交（Maloja、Koito 等兼容服务同样适用）
+func (sc *scrobbleClient) submitListenBrainz(ctx context.Context, creds scrobbleCredentials, track scrobbleTrack, listenedAt *time.Time) error {
+	additionalInfo := map[string]interface{}{
+		"media_player":      scrobbleClientName,
+		"submission_client": scrobbleClientName,
+	}
+	if track.DurationMs > 0 {
+		additionalInfo["duration_ms"] = track.DurationMs
+	}
+	if track.TrackNumber > 0 {
+		additionalInfo["tracknumber"] = track.TrackNumber
+	}
+	if track.RecordingMBID != "" {
+		additionalInfo["recording_mbid"] = track.RecordingMBID
+	}
+	if track.ReleaseMBID != "" {
+		additionalInfo["release_mbid"] = track.ReleaseMBID
+	}
+	if len(track.ArtistMBIDs) > 0 {
+		additionalInfo["artist_mbids"] = track.ArtistMBIDs
+	}
+	if track.AlbumArtist != "" {
+		additionalInfo["release_artist_name"] = track.AlbumArtist
+	}
+
+	metadata := map[string]interface{}{
+		"artist_name":     track.Artist,
+		"track_name":      track.Title,
+		"additional_info": additionalInfo,
+	}
+	if track.Album != "" {
+		metadata["release_name"] = track.Album
+	}
+
+	listen := map[string]interface{}{"track_metadata": metadata}
+	listenType := "playing_now"
+	if listenedAt != nil {
+		listenType = "single"
+		listen["listened_at"] = listenedAt.Unix()
+	}
+
+	body := map[string]interface{}{
+		"listen_type": listenType,
+		"payload":     []interface{}{listen},
+	}
+	_, err := sc.listenBrainzRequest(ctx, creds, http.MethodPost, "/1/submit-listens", body, nil)
+	return err
+}
+
+// listenBrainzRequest 发送 ListenBrainz API 请求，返回 HTTP 状态码
+func (sc *scrobbleClient) listenBrainzRequest(ctx context.Context, creds scrobbleCredentials, method, path string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, &scrobbleError{Message: err.Error(), Permanent: true}
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(creds.APIURL, "/")+path, reader)
+	if err != nil {
+		return 0, &scrobbleError{Message: "无效的服务地址", Permanent: true}
+	}
+	req.Header.Set("Authorization", "Token "+creds.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := sc.http.Do(req)
+	if err != nil {
+		return 0, &scrobbleError{Message: "请求失败: " + err.Error()}
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(data, &apiErr)
+		message := fmt.Sprintf("HTTP %d", resp.StatusCode)
+		if apiErr.Error != "" {
+			message += ": " + truncateString(apiErr.Error, 200)
+		}
+		// 请求数据无效时重试也不会成功；认证失败保留记录，等待用户更新令牌
+		return resp.StatusCode, &scrobbleError{Message: message, Permanent: resp.StatusCode == http.StatusBadRequest}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, &scrobbleError{Message: "无法解析服务响应"}
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// submitLastFM 按 Last.fm API 2.0 提交
+func (sc *scrobbleClient) submitLastFM(ctx context.Context, creds scrobbleCredentials, track scrobbleTrack, listenedAt *time.Time) error {
+	params := map[string]string{
+		"method": "track.updateNowPlaying",
+		"artist": track.Artist,
+		"track":  track.Title,
+	}
+	if listenedAt != nil {
+		params["method"] = "track.scrobble"
+		params["timestamp"] = strconv.FormatInt(listenedAt.Unix(), 10)
+	}
+	if track.Album != "" {
+		params["album"] = track.Album
+	}
+	if track.AlbumArtist != "" {
+		params["albumArtist"] = track.AlbumArtist
+	}
+	if track.DurationMs > 0 {
+		params["duration"] = strconv.Itoa(track.DurationMs / 1000)
+	}
+	if track.TrackNumber > 0 {
+		params["trackNumber"] = strconv.Itoa(track.TrackNumber)
+	}
+	if track.RecordingMBID != "" {
+		params["mbid"] = track.RecordingMBID
+	}
+	return sc.lastFMCall(ctx, creds, params, nil)
+}
+
+// lastFMCall 发送签名的 Last.fm API 请求
+func (sc *scrobbleClient) lastFMCall(ctx context.Context, creds scrobbleCredentials, params map[string]string, out interface{}) error {
+	if sc.lastFMAPIKey == "" || sc.lastFMAPISecret == "" {
+		return &scrobbleError{Message: "服务器未配置 Last.fm API 密钥"}
+	}
+
+	params["api_key"] = sc.lastFMAPIKey
+	params["sk"] = creds.Token
+	form := url.Values{}
+	for key, value := range params {
+		form.Set(key, value)
+	}
+	form.Set("api_sig", lastFMSignature(params, sc.lastFMAPISecret))
+	form.Set("format", "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, creds.APIURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return &scrobbleError{Message: "无效的服务地址", Permanent: true}
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := sc.http.Do(req)
+	if err != nil {
+		return &scrobbleError{Message: "请求失败: " + err.Error()}
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	var apiErr struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	json.Unmarshal(data, &apiErr)
+	if apiErr.Error != 0 {
+		message := fmt.Sprintf("Last.fm error %d: %s", apiErr.Error, truncateString(apiErr.Message, 200))
+		return &scrobbleError{Message: message, Permanent: !lastFMRetryableError(apiErr.Error)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &scrobbleError{Message: fmt.Sprintf("HTTP %d", resp.StatusCode), Permanent: resp.StatusCode == http.StatusBadRequest}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return &scrobbleError{Message: "无法解析服务响应"}
+		}
+	}
+	return nil
+}
+
+// lastFMRetryableError 判断 Last.fm 错误码是否值得重试：服务暂不可用、限流以及认证相关的错误
+// （认证错误在用户更新 session key 后可恢复）
+func lastFMRetryableError(code int) bool {
+	switch code {
+	case 4, 9, 10, 11, 14, 16, 26, 29:
+		return true
+	}
+	return false
+}
+
+// lastFMSignature 计算 Last.fm API 签名：参数按名称排序后拼接名称和值，末尾加上密钥，取 MD5
+func lastFMSignature(params map[string]string, secret string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteString(params[key])
+	}
+	b.WriteString(secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncateString 截断过长的字符串
+func truncateString(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= maxRunes {
+		return s
+	}
+	return string(runes[:maxRunes]) + "..."
+}
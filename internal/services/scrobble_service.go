@@ -0,0 +1,588 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"melogo/internal/config"
+	"melogo/internal/model"
+	"melogo/internal/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// scrobblePollInterval 检查待提交队列的间隔
+	scrobblePollInterval = 30 * time.Second
+	// scrobbleBatchSize 每次处理的待提交记录数量
+	scrobbleBatchSize = 50
+	// scrobbleMaxBackoff 重试间隔的上限
+	scrobbleMaxBackoff = 6 * time.Hour
+	// scrobbleNowPlayingTimeout 正在播放通知的超时时间，通知失败不重试
+	scrobbleNowPlayingTimeout = 10 * time.Second
+)
+
+// ScrobbleService 将播放记录转发到 ListenBrainz、Last.fm 等外部服务
+// 播放记录先写入 scrobble_queue 表，由后台任务提交，失败时按指数退避重试，重启后继续提交
+type ScrobbleService struct {
+	db     *sql.DB
+	cfg    *config.ScrobbleConfig
+	client *scrobbleClient
+	logger *utils.Logger
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewScrobbleService 创建新的外部播放记录服务实例
+func NewScrobbleService(cfg *config.Config, database *sql.DB) *ScrobbleService {
+	return &ScrobbleService{
+		db:  database,
+		cfg: &cfg.Scrobble,
+		client: &scrobbleClient{
+			http:            &http.Client{Timeout: 30 * time.Second},
+			lastFMAPIKey:    cfg.Scrobble.LastFMAPIKey,
+			lastFMAPISecret: cfg.Scrobble.LastFMAPISecret,
+		},
+		logger: utils.NewLogger(),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Start 启动后台提交任务
+func (ss *ScrobbleService) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	ss.cancel = cancel
+	ss.done = make(chan struct{})
+
+	go func() {
+		defer close(ss.done)
+		for {
+			ss.processQueue(ctx)
+			timer := time.NewTimer(ss.nextQueueCheck())
+			select {
+			case <-timer.C:
+			case <-ss.wake:
+			case <-ctx.Done():
+			}
+			timer.Stop()
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+}
+
+// nextQueueCheck 距下一条记录到期的时间，最长为 scrobblePollInterval
+func (ss *ScrobbleService) nextQueueCheck() time.Duration {
+	var next sql.NullString
+	err := ss.db.QueryRow(`
+		SELECT MIN(q.next_attempt_at) FROM scrobble_queue q
+		JOIN scrobble_accounts a ON a.id = q.account_id
+		WHERE a.enabled = 1
+	`).Scan(&next)
+	if err != nil || !next.Valid {
+		return scrobblePollInterval
+	}
+	wait := time.Until(parseDBTime(next))
+	if wait < time.Second {
+		wait = time.Second
+	}
+	if wait > scrobblePollInterval {
+		wait = scrobblePollInterval
+	}
+	return wait
+}
+
+// Stop 停止后台提交任务，未提交的记录保留在队列中
+func (ss *ScrobbleService) Stop() {
+	if ss.cancel != nil {
+		ss.cancel()
+		<-ss.done
+	}
+}
+
+// notify 唤醒后台任务立即处理队列
+func (ss *ScrobbleService) notify() {
+	select {
+	case ss.wake <- struct{}{}:
+	default:
+	}
+}
+
+// defaultAPIURL 服务的默认地址
+func (ss *ScrobbleService) defaultAPIURL(provider string) string {
+	if provider == model.ScrobbleProviderLastFM {
+		return ss.cfg.LastFMURL
+	}
+	return ss.cfg.ListenBrainzURL
+}
+
+// ListAccounts 获取用户关联的外部服务账号
+func (ss *ScrobbleService) ListAccounts(userID int) ([]model.ScrobbleAccount, error) {
+	rows, err := ss.db.Query(`
+		SELECT a.id, a.provider, a.api_url, a.username, a.enabled, a.last_error, a.last_submitted_at, a.created_at, a.updated_at,
+			(SELECT COUNT(*) FROM scrobble_queue q WHERE q.account_id = a.id)
+		FROM scrobble_accounts a
+		WHERE a.user_id = ?
+		ORDER BY a.provider
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询播放记录服务账号失败: %v", err)
+	}
+	defer rows.Close()
+
+	accounts := []model.ScrobbleAccount{}
+	for rows.Next() {
+		var account model.ScrobbleAccount
+		var lastSubmittedAt, createdAt, updatedAt sql.NullString
+		err := rows.Scan(
+			&account.ID, &account.Provider, &account.APIURL, &account.Username, &account.Enabled, &account.LastError,
+			&lastSubmittedAt, &createdAt, &updatedAt, &account.PendingCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("读取播放记录服务账号失败: %v", err)
+		}
+		if lastSubmittedAt.Valid {
+			t := parseDBTime(lastSubmittedAt)
+			account.LastSubmittedAt = &t
+		}
+		account.CreatedAt = parseDBTime(createdAt)
+		account.UpdatedAt = parseDBTime(updatedAt)
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// GetAccount 获取用户关联的指定服务账号
+func (ss *ScrobbleService) GetAccount(userID int, provider string) (*model.ScrobbleAccount, error) {
+	accounts, err := ss.ListAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		if accounts[i].Provider == provider {
+			return &accounts[i], nil
+		}
+	}
+	return nil, errors.New("播放记录服务账号不存在")
+}
+
+// LinkAccount 关联或更新外部服务账号，提供令牌时先向服务校验
+// 更新后该账号队列中等待重试的记录会立即重新提交
+func (ss *ScrobbleService) LinkAccount(userID int, provider string, req model.LinkScrobbleAccountRequest) (*model.ScrobbleAccount, error) {
+	if provider != model.ScrobbleProviderListenBrainz && provider != model.ScrobbleProviderLastFM {
+		return nil, fmt.Errorf("不支持的播放记录服务: %s", provider)
+	}
+
+	var encryptedToken, apiURL string
+	enabled := true
+	err := ss.db.QueryRow(
+		"SELECT token, api_url, enabled FROM scrobble_accounts WHERE user_id = ? AND provider = ?", userID, provider,
+	).Scan(&encryptedToken, &apiURL, &enabled)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("查询播放记录服务账号失败: %v", err)
+	}
+
+	urlChanged := req.APIURL != nil && strings.TrimSpace(*req.APIURL) != apiURL
+	if req.APIURL != nil {
+		apiURL = strings.TrimSpace(*req.APIURL)
+	}
+	if apiURL != "" {
+		parsed, err := url.Parse(apiURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, errors.New("无效的服务地址")
+		}
+	}
+
+	token := strings.TrimSpace(req.Token)
+	if token == "" && !exists {
+		return nil, errors.New("缺少令牌")
+	}
+
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	username := ""
+	// 令牌或服务地址变化时重新校验
+	if token != "" || urlChanged {
+		if token == "" {
+			if token, err = utils.DecryptString(encryptedToken); err != nil {
+				return nil, fmt.Errorf("解密令牌失败: %v", err)
+			}
+		}
+		creds := scrobbleCredentials{Provider: provider, Token: token, APIURL: apiURL}
+		if creds.APIURL == "" {
+			creds.APIURL = ss.defaultAPIURL(provider)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), scrobbleNowPlayingTimeout)
+		defer cancel()
+		if username, err = ss.client.validate(ctx, creds); err != nil {
+			return nil, fmt.Errorf("校验令牌失败: %v", err)
+		}
+		if encryptedToken, err = utils.EncryptString(token); err != nil {
+			return nil, fmt.Errorf("加密令牌失败: %v", err)
+		}
+	}
+
+	if exists {
+		_, err = ss.db.Exec(`
+			UPDATE scrobble_accounts
+			SET token = ?, api_url = ?, username = CASE WHEN ? != '' THEN ? ELSE username END,
+				enabled = ?, last_error = '', updated_at = datetime('now')
+			WHERE user_id = ? AND provider = ?
+		`, encryptedToken, apiURL, username, username, enabled, userID, provider)
+	} else {
+		_, err = ss.db.Exec(`
+			INSERT INTO scrobble_accounts (user_id, provider, token, api_url, username, enabled, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))
+		`, userID, provider, encryptedToken, apiURL, username, enabled)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("保存播放记录服务账号失败: %v", err)
+	}
+
+	// 账号更新后立即重试等待中的记录
+	_, err = ss.db.Exec(`
+		UPDATE scrobble_queue SET next_attempt_at = datetime('now')
+		WHERE account_id = (SELECT id FROM scrobble_accounts WHERE user_id = ? AND provider = ?)
+	`, userID, provider)
+	if err != nil {
+		return nil, fmt.Errorf("更新待提交记录失败: %v", err)
+	}
+	ss.notify()
+
+	return ss.GetAccount(userID, provider)
+}
+
+// UnlinkAccount 取消关联外部服务账号，同时删除该账号未提交的记录
+func (ss *ScrobbleService) UnlinkAccount(userID int, provider string) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	var accountID int
+	err = tx.QueryRow("SELECT id FROM scrobble_accounts WHERE user_id = ? AND provider = ?", userID, provider).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		return errors.New("播放记录服务账号不存在")
+	}
+	if err != nil {
+		return fmt.Errorf("查询播放记录服务账号失败: %v", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM scrobble_queue WHERE account_id = ?", accountID); err != nil {
+		return fmt.Errorf("删除待提交记录失败: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM scrobble_accounts WHERE id = ?", accountID); err != nil {
+		return fmt.Errorf("删除播放记录服务账号失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// scrobbleAccountRecord 用于提交的账号记录
+type scrobbleAccountRecord struct {
+	ID int
+	scrobbleCredentials
+}
+
+// enabledAccounts 获取用户已启用的账号，令牌已解密
+func (ss *ScrobbleService) enabledAccounts(userID int) ([]scrobbleAccountRecord, error) {
+	rows, err := ss.db.Query(
+		"SELECT id, provider, token, api_url FROM scrobble_accounts WHERE user_id = ? AND enabled = 1", userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询播放记录服务账号失败: %v", err)
+	}
+	defer rows.Close()
+
+	var accounts []scrobbleAccountRecord
+	for rows.Next() {
+		var account scrobbleAccountRecord
+		if err := rows.Scan(&account.ID, &account.Provider, &account.Token, &account.APIURL); err != nil {
+			return nil, fmt.Errorf("读取播放记录服务账号失败: %v", err)
+		}
+		if err := ss.decryptCredentials(&account.scrobbleCredentials); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// decryptCredentials 解密令牌并补全默认服务地址
+func (ss *ScrobbleService) decryptCredentials(creds *scrobbleCredentials) error {
+	token, err := utils.DecryptString(creds.Token)
+	if err != nil {
+		return fmt.Errorf("解密令牌失败: %v", err)
+	}
+	creds.Token = token
+	if creds.APIURL == "" {
+		creds.APIURL = ss.defaultAPIURL(creds.Provider)
+	}
+	return nil
+}
+
+// loadScrobbleTrack 读取提交所需的歌曲信息
+func (ss *ScrobbleService) loadScrobbleTrack(songID int) (*scrobbleTrack, error) {
+	var track scrobbleTrack
+	var duration int
+	var artistMBIDs string
+	err := ss.db.QueryRow(`
+		SELECT title, COALESCE(artist, ''), COALESCE(album, ''), COALESCE(album_artist, ''), duration,
+			COALESCE(track_number, 0), COALESCE(mb_recording_id, ''), COALESCE(mb_release_id, ''), COALESCE(mb_artist_id, '')
+		FROM songs WHERE id = ?
+	`, songID).Scan(
+		&track.Title, &track.Artist, &track.Album, &track.AlbumArtist, &duration,
+		&track.TrackNumber, &track.RecordingMBID, &track.ReleaseMBID, &artistMBIDs,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("歌曲不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询歌曲失败: %v", err)
+	}
+
+	track.DurationMs = duration * 1000
+	if track.Album == "Unknown Album" {
+		track.Album = ""
+	}
+	if track.AlbumArtist == track.Artist {
+		track.AlbumArtist = ""
+	}
+	for _, id := range strings.Split(artistMBIDs, ";") {
+		if id = strings.TrimSpace(id); id != "" {
+			track.ArtistMBIDs = append(track.ArtistMBIDs, id)
+		}
+	}
+	return &track, nil
+}
+
+// NowPlaying 向用户关联的服务发送正在播放通知，在后台发送且失败不重试
+func (ss *ScrobbleService) NowPlaying(userID, songID int) {
+	accounts, err := ss.enabledAccounts(userID)
+	if err != nil {
+		ss.logger.Errorf("Failed to load scrobble accounts: %v", err)
+		return
+	}
+	if len(accounts) == 0 {
+		return
+	}
+	track, err := ss.loadScrobbleTrack(songID)
+	if err != nil {
+		ss.logger.Errorf("Failed to load song for now playing: %v", err)
+		return
+	}
+
+	for _, account := range accounts {
+		go func(account scrobbleAccountRecord) {
+			ctx, cancel := context.WithTimeout(context.Background(), scrobbleNowPlayingTimeout)
+			defer cancel()
+			if err := ss.client.submit(ctx, account.scrobbleCredentials, *track, nil); err != nil {
+				ss.logger.Warningf("Failed to send now playing to %s: %v", account.Provider, err)
+			}
+		}(account)
+	}
+}
+
+// Played 将计入播放次数的播放加入用户关联服务的待提交队列
+func (ss *ScrobbleService) Played(event *model.PlayEvent) {
+	accounts, err := ss.enabledAccounts(event.UserID)
+	if err != nil {
+		ss.logger.Errorf("Failed to load scrobble accounts: %v", err)
+		return
+	}
+	if len(accounts) == 0 {
+		return
+	}
+	track, err := ss.loadScrobbleTrack(event.SongID)
+	if err != nil {
+		ss.logger.Errorf("Failed to load song for scrobbling: %v", err)
+		return
+	}
+	payload, err := json.Marshal(track)
+	if err != nil {
+		ss.logger.Errorf("Failed to encode scrobble: %v", err)
+		return
+	}
+
+	for _, account := range accounts {
+		_, err := ss.db.Exec(`
+			INSERT INTO scrobble_queue (account_id, play_event_id, payload, listened_at, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))
+		`, account.ID, event.ID, string(payload), event.StartedAt.UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			ss.logger.Errorf("Failed to queue scrobble: %v", err)
+		}
+	}
+	ss.notify()
+}
+
+// scrobbleQueueItem 待提交队列中的一条记录
+type scrobbleQueueItem struct {
+	ID         int
+	AccountID  int
+	Track      scrobbleTrack
+	ListenedAt time.Time
+	Attempts   int
+	Creds      scrobbleCredentials
+}
+
+// dueQueueItems 获取已到提交时间的记录，按加入队列的顺序排列
+func (ss *ScrobbleService) dueQueueItems() ([]scrobbleQueueItem, error) {
+	rows, err := ss.db.Query(`
+		SELECT q.id, q.account_id, q.payload, q.listened_at, q.attempts, a.provider, a.token, a.api_url
+		FROM scrobble_queue q
+		JOIN scrobble_accounts a ON a.id = q.account_id
+		WHERE a.enabled = 1 AND q.next_attempt_at <= datetime('now')
+		ORDER BY q.id
+		LIMIT ?
+	`, scrobbleBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("查询待提交记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var items []scrobbleQueueItem
+	for rows.Next() {
+		var item scrobbleQueueItem
+		var payload string
+		var listenedAt sql.NullString
+		err := rows.Scan(
+			&item.ID, &item.AccountID, &payload, &listenedAt, &item.Attempts,
+			&item.Creds.Provider, &item.Creds.Token, &item.Creds.APIURL,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("读取待提交记录失败: %v", err)
+		}
+		if err := json.Unmarshal([]byte(payload), &item.Track); err != nil {
+			return nil, fmt.Errorf("解析待提交记录失败: %v", err)
+		}
+		item.ListenedAt = parseDBTime(listenedAt)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// processQueue 提交队列中已到时间的记录
+// 同一账号提交失败后，本轮跳过该账号剩余的记录，保持提交顺序
+func (ss *ScrobbleService) processQueue(ctx context.Context) {
+	for ctx.Err() == nil {
+		items, err := ss.dueQueueItems()
+		if err != nil {
+			ss.logger.Errorf("Failed to load scrobble queue: %v", err)
+			return
+		}
+		if len(items) == 0 {
+			return
+		}
+
+		failedAccounts := make(map[int]bool)
+		for _, item := range items {
+			if ctx.Err() != nil {
+				return
+			}
+			if failedAccounts[item.AccountID] {
+				continue
+			}
+
+			err := ss.decryptCredentials(&item.Creds)
+			if err == nil {
+				listenedAt := item.ListenedAt
+				err = ss.client.submit(ctx, item.Creds, item.Track, &listenedAt)
+			}
+			if err == nil {
+				ss.completeQueueItem(item)
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			failedAccounts[item.AccountID] = true
+			ss.failQueueItem(item, err)
+		}
+
+		// 本轮有失败的账号时，剩余记录等待下次退避后再提交
+		if len(failedAccounts) > 0 {
+			return
+		}
+	}
+}
+
+// completeQueueItem 提交成功后删除记录并更新账号状态
+func (ss *ScrobbleService) completeQueueItem(item scrobbleQueueItem) {
+	if _, err := ss.db.Exec("DELETE FROM scrobble_queue WHERE id = ?", item.ID); err != nil {
+		ss.logger.Errorf("Failed to remove submitted scrobble: %v", err)
+	}
+	_, err := ss.db.Exec(
+		"UPDATE scrobble_accounts SET last_error = '', last_submitted_at = datetime('now') WHERE id = ?", item.AccountID,
+	)
+	if err != nil {
+		ss.logger.Errorf("Failed to update scrobble account: %v", err)
+	}
+}
+
+// failQueueItem 记录提交失败：无法重试或重试次数用尽时丢弃，否则按指数退避推迟该账号的记录
+func (ss *ScrobbleService) failQueueItem(item scrobbleQueueItem, err error) {
+	message := err.Error()
+	if _, dbErr := ss.db.Exec("UPDATE scrobble_accounts SET last_error = ? WHERE id = ?", message, item.AccountID); dbErr != nil {
+		ss.logger.Errorf("Failed to update scrobble account: %v", dbErr)
+	}
+
+	var scrobbleErr *scrobbleError
+	permanent := errors.As(err, &scrobbleErr) && scrobbleErr.Permanent
+	attempts := item.Attempts + 1
+	if permanent || (ss.cfg.MaxAttempts > 0 && attempts >= ss.cfg.MaxAttempts) {
+		ss.logger.Warningf("Dropping scrobble of %q for %s after %d attempt(s): %s", item.Track.Title, item.Creds.Provider, attempts, message)
+		if _, dbErr := ss.db.Exec("DELETE FROM scrobble_queue WHERE id = ?", item.ID); dbErr != nil {
+			ss.logger.Errorf("Failed to remove scrobble: %v", dbErr)
+		}
+		return
+	}
+
+	delay := scrobbleBackoff(time.Duration(ss.cfg.RetryInterval)*time.Second, attempts)
+	nextAttempt := time.Now().UTC().Add(delay).Format("2006-01-02 15:04:05")
+	ss.logger.Warningf("Scrobble to %s failed (attempt %d), retrying in %s: %s", item.Creds.Provider, attempts, delay, message)
+
+	_, dbErr := ss.db.Exec(
+		"UPDATE scrobble_queue SET attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		attempts, message, nextAttempt, item.ID,
+	)
+	if dbErr == nil {
+		// 同一账号的其他记录一起推迟，避免服务不可用时逐条重试
+		_, dbErr = ss.db.Exec(
+			"UPDATE scrobble_queue SET next_attempt_at = MAX(next_attempt_at, ?) WHERE account_id = ?",
+			nextAttempt, item.AccountID,
+		)
+	}
+	if dbErr != nil {
+		ss.logger.Errorf("Failed to reschedule scrobble: %v", dbErr)
+	}
+}
+
+// scrobbleBackoff 第 attempts 次失败后的重试间隔：base * 2^(attempts-1)，不超过 scrobbleMaxBackoff
+func scrobbleBackoff(base time.Duration, attempts int) time.Duration {
+	if base <= 0 {
+		base = time.Minute
+	}
+	delay := base
+	for i := 1; i < attempts && delay < scrobbleMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > scrobbleMaxBackoff {
+		delay = scrobbleMaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"melogo/internal/model"
+	"strings"
+)
+
+// searchHistoryLimit 每个用户保留的搜索记录数量
+const searchHistoryLimit = 50
+
+// searchRefineWindow 边输入边搜索时，此时间内的较短查询视为同一次搜索的中间输入，由完整查询替换
+const searchRefineWindow = "-60 seconds"
+
+// 搜索建议的类型
+const (
+	suggestionTypeHistory = "history"
+	suggestionTypeArtist  = "artist"
+	suggestionTypeAlbum   = "album"
+	suggestionTypeSong    = "song"
+)
+
+// RecordSearch 记录用户的搜索查询
+// 相同的查询（不区分大小写）只保留最近一次，每个用户最多保留 searchHistoryLimit 条
+func (ss *SearchService) RecordSearch(userID int, keyword string) error {
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return nil
+	}
+	if len([]rune(keyword)) > 200 {
+		keyword = string([]rune(keyword)[:200])
+	}
+
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	// 删除相同的查询，以及刚刚输入的、作为当前查询前缀的中间查询
+	_, err = tx.Exec(`
+		DELETE FROM search_history
+		WHERE user_id = ? AND (
+			keyword = ? COLLATE NOCASE
+			OR (searched_at >= datetime('now', ?) AND substr(?, 1, length(keyword)) = keyword COLLATE NOCASE)
+		)
+	`, userID, keyword, searchRefineWindow, keyword)
+	if err != nil {
+		return fmt.Errorf("清理重复搜索记录失败: %v", err)
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO search_history (user_id, keyword, searched_at) VALUES (?, ?, datetime('now'))",
+		userID, keyword,
+	)
+	if err != nil {
+		return fmt.Errorf("保存搜索记录失败: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM search_history
+		WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM search_history WHERE user_id = ?
+			ORDER BY searched_at DESC, id DESC
+			LIMIT ?
+		)
+	`, userID, userID, searchHistoryLimit)
+	if err != nil {
+		return fmt.Errorf("清理过期搜索记录失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// GetSearchHistory 获取用户的搜索记录，按时间倒序
+func (ss *SearchService) GetSearchHistory(userID, limit int) ([]model.SearchHistoryEntry, error) {
+	rows, err := ss.db.Query(`
+		SELECT id, keyword, searched_at FROM search_history
+		WHERE user_id = ?
+		ORDER BY searched_at DESC, id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询搜索记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	history := []model.SearchHistoryEntry{}
+	for rows.Next() {
+		var entry model.SearchHistoryEntry
+		var searchedAt sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.Keyword, &searchedAt); err != nil {
+			return nil, fmt.Errorf("读取搜索记录失败: %v", err)
+		}
+		entry.SearchedAt = parseDBTime(searchedAt)
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
+
+// DeleteSearchHistory 删除用户的一条搜索记录
+func (ss *SearchService) DeleteSearchHistory(userID, id int) error {
+	result, err := ss.db.Exec("DELETE FROM search_history WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("删除搜索记录失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("搜索记录不存在")
+	}
+	return nil
+}
+
+// ClearSearchHistory 清空用户的搜索记录
+func (ss *SearchService) ClearSearchHistory(userID int) error {
+	if _, err := ss.db.Exec("DELETE FROM search_history WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("清空搜索记录失败: %v", err)
+	}
+	return nil
+}
+
+// suggestionQuery 一类搜索建议的查询，结果的第一列为建议文本
+type suggestionQuery struct {
+	suggestionType string
+	query          string
+	args           []interface{}
+}
+
+// Suggest 获取搜索建议：先是用户以 prefix 开头的最近查询，再是曲库中以 prefix 开头的热门艺术家、专辑和歌曲
+// 曲库词条按播放次数排序；prefix 为空时返回最近查询和最常播放的艺术家
+func (ss *SearchService) Suggest(userID int, prefix string, limit int) ([]model.SearchSuggestion, error) {
+	prefix = strings.TrimSpace(prefix)
+	// 匹配词条开头或词条中某个词的开头
+	pattern := escapeLike(prefix) + "%"
+	wordPattern := "% " + pattern
+
+	suggestions := []model.SearchSuggestion{}
+	seen := make(map[string]bool)
+	add := func(rows *sql.Rows, suggestionType string) error {
+		defer rows.Close()
+		for rows.Next() && len(suggestions) < limit {
+			var text string
+			if err := rows.Scan(&text); err != nil {
+				return fmt.Errorf("读取搜索建议失败: %v", err)
+			}
+			key := strings.ToLower(text)
+			if text == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			suggestions = append(suggestions, model.SearchSuggestion{Text: text, Type: suggestionType})
+		}
+		return rows.Err()
+	}
+
+	queries := []suggestionQuery{
+		{suggestionTypeHistory, `
+			SELECT keyword FROM search_history
+			WHERE user_id = ? AND (keyword LIKE ? ESCAPE '\' OR keyword LIKE ? ESCAPE '\')
+			ORDER BY searched_at DESC, id DESC
+			LIMIT ?
+		`, []interface{}{userID, pattern, wordPattern, limit}},
+		{suggestionTypeArtist, artistSongsCTE + `
+			SELECT a.name
+			FROM artists a
+			JOIN artist_songs x ON x.artist_id = a.id
+			JOIN songs s ON s.id = x.song_id
+			WHERE a.name LIKE ? ESCAPE '\' OR a.name LIKE ? ESCAPE '\'
+			GROUP BY a.id
+			ORDER BY SUM(s.play_count) DESC, COUNT(s.id) DESC, a.name COLLATE NOCASE
+			LIMIT ?
+		`, []interface{}{pattern, wordPattern, limit}},
+	}
+	if prefix != "" {
+		queries = append(queries,
+			suggestionQuery{suggestionTypeAlbum, `
+				SELECT al.name` + albumFromClause + `
+				WHERE al.name LIKE ? ESCAPE '\' OR al.name LIKE ? ESCAPE '\'
+				GROUP BY al.id
+				ORDER BY SUM(s.play_count) DESC, al.name COLLATE NOCASE
+				LIMIT ?
+			`, []interface{}{pattern, wordPattern, limit}},
+			suggestionQuery{suggestionTypeSong, `
+				SELECT title FROM songs
+				WHERE (title LIKE ? ESCAPE '\' OR title LIKE ? ESCAPE '\') AND is_deleted = 0 AND is_missing = 0
+				ORDER BY play_count DESC, title COLLATE NOCASE
+				LIMIT ?
+			`, []interface{}{pattern, wordPattern, limit}},
+		)
+	}
+
+	for _, q := range queries {
+		if len(suggestions) >= limit {
+			break
+		}
+		rows, err := ss.db.Query(q.query, q.args...)
+		if err != nil {
+			return nil, fmt.Errorf("查询搜索建议失败: %v", err)
+		}
+		if err := add(rows, q.suggestionType); err != nil {
+			return nil, err
+		}
+	}
+	return suggestions, nil
+}
+
+// escapeLike 转义 LIKE 模式中的特殊字符，需配合 ESCAPE '\' 使用
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"melogo/internal/utils"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// searchIndexVersion 全文索引内容的版本，规范化规则变化时递增，启动时会重建索引
+const searchIndexVersion = "1"
+
+var (
+	// searchMusicDirectory 建立歌词索引时读取歌词文件使用的音乐目录
+	searchMusicDirectory string
+	// searchIndexEnabled 全文索引是否可用，SQLite 未编译 FTS5 时为 false
+	searchIndexEnabled bool
+)
+
+// registerSearchFunctions 在新连接上注册全文索引触发器使用的 search_normalize 和 search_lyrics 函数
+func registerSearchFunctions(conn *sqlite3.SQLiteConn) error {
+	if err := conn.RegisterFunc("search_normalize", utils.NormalizeSearchText, true); err != nil {
+		return err
+	}
+	return conn.RegisterFunc("search_lyrics", searchLyricsText, false)
+}
+
+// searchLyricsText 读取歌词文件并生成索引文本，供触发器中的 search_lyrics 函数使用
+func searchLyricsText(lyricsPath string) string {
+	if lyricsPath == "" || searchMusicDirectory == "" {
+		return ""
+	}
+	absPath, err := utils.SafeJoin(searchMusicDirectory, lyricsPath)
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return ""
+	}
+	return utils.LyricsSearchText(string(data))
+}
+
+// 全文索引各表的写入表达式，参数均不能为 NULL
+const (
+	songsFTSValues = `search_normalize(COALESCE(new.title, '')),
+		search_normalize(COALESCE(new.artist, '') || ' ' || COALESCE(new.album_artist, '')),
+		search_normalize(COALESCE(new.album, '')),
+		search_lyrics(COALESCE(new.lyrics_path, ''))`
+	albumsFTSValues = `search_normalize(new.name),
+		search_normalize(COALESCE((SELECT name FROM artists WHERE id = new.artist_id), ''))`
+)
+
+// searchIndexStatements 创建全文索引表和同步触发器
+var searchIndexStatements = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS songs_fts USING fts5(
+		title, artist, album, lyrics, tokenize = 'unicode61 remove_diacritics 2'
+	)`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS artists_fts USING fts5(
+		name, tokenize = 'unicode61 remove_diacritics 2'
+	)`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS albums_fts USING fts5(
+		name, artist, tokenize = 'unicode61 remove_diacritics 2'
+	)`,
+
+	`CREATE TRIGGER IF NOT EXISTS songs_fts_insert AFTER INSERT ON songs BEGIN
+		INSERT INTO songs_fts (rowid, title, artist, album, lyrics) VALUES (new.id, ` + songsFTSValues + `);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS songs_fts_update AFTER UPDATE OF title, artist, album, album_artist, lyrics_path ON songs BEGIN
+		DELETE FROM songs_fts WHERE rowid = old.id;
+		INSERT INTO songs_fts (rowid, title, artist, album, lyrics) VALUES (new.id, ` + songsFTSValues + `);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS songs_fts_delete AFTER DELETE ON songs BEGIN
+		DELETE FROM songs_fts WHERE rowid = old.id;
+	END`,
+
+	`CREATE TRIGGER IF NOT EXISTS artists_fts_insert AFTER INSERT ON artists BEGIN
+		INSERT INTO artists_fts (rowid, name) VALUES (new.id, search_normalize(new.name));
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS artists_fts_update AFTER UPDATE OF name ON artists BEGIN
+		DELETE FROM artists_fts WHERE rowid = old.id;
+		INSERT INTO artists_fts (rowid, name) VALUES (new.id, search_normalize(new.name));
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS artists_fts_delete AFTER DELETE ON artists BEGIN
+		DELETE FROM artists_fts WHERE rowid = old.id;
+	END`,
+
+	`CREATE TRIGGER IF NOT EXISTS albums_fts_insert AFTER INSERT ON albums BEGIN
+		INSERT INTO albums_fts (rowid, name, artist) VALUES (new.id, ` + albumsFTSValues + `);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS albums_fts_update AFTER UPDATE OF name, artist_id ON albums BEGIN
+		DELETE FROM albums_fts WHERE rowid = old.id;
+		INSERT INTO albums_fts (rowid, name, artist) VALUES (new.id, ` + albumsFTSValues + `);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS albums_fts_delete AFTER DELETE ON albums BEGIN
+		DELETE FROM albums_fts WHERE rowid = old.id;
+	END`,
+}
+
+// searchIndexTriggers 全文索引的同步触发器，FTS5 不可用时需要删除，否则写入歌曲会失败
+var searchIndexTriggers = []string{
+	"songs_fts_insert", "songs_fts_update", "songs_fts_delete",
+	"artists_fts_insert", "artists_fts_update", "artists_fts_delete",
+	"albums_fts_insert", "albums_fts_update", "albums_fts_delete",
+}
+
+// searchIndexRebuildStatements 根据现有数据重建全文索引
+var searchIndexRebuildStatements = []string{
+	`DELETE FROM songs_fts`,
+	`INSERT INTO songs_fts (rowid, title, artist, album, lyrics)
+		SELECT id, ` + songsFTSValues + ` FROM songs AS new`,
+	`DELETE FROM artists_fts`,
+	`INSERT INTO artists_fts (rowid, name) SELECT id, search_normalize(name) FROM artists`,
+	`DELETE FROM albums_fts`,
+	`INSERT INTO albums_fts (rowid, name, artist)
+		SELECT id, ` + albumsFTSValues + ` FROM albums AS new`,
+}
+
+// EnsureSearchIndex 创建全文索引并在索引版本变化时重建
+// SQLite 未编译 FTS5（构建时未使用 -tags sqlite_fts5）时删除同步触发器，搜索退回 LIKE 匹配
+func EnsureSearchIndex() error {
+	logger := utils.NewLogger()
+
+	var available int
+	if err := DB.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available); err != nil {
+		return fmt.Errorf("failed to check FTS5 support: %v", err)
+	}
+	if available == 0 {
+		searchIndexEnabled = false
+		for _, trigger := range searchIndexTriggers {
+			if _, err := DB.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+				return fmt.Errorf("failed to drop search trigger %s: %v", trigger, err)
+			}
+		}
+		// 清除索引版本，之后启用 FTS5 时会重建索引
+		if _, err := DB.Exec("DELETE FROM configurations WHERE key = 'search_index_version'"); err != nil {
+			return fmt.Errorf("failed to reset search index version: %v", err)
+		}
+		logger.Warning("SQLite was built without FTS5 (build with -tags sqlite_fts5), full-text search is disabled")
+		return nil
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range searchIndexStatements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create search index: %v", err)
+		}
+	}
+
+	var version string
+	err = tx.QueryRow("SELECT value FROM configurations WHERE key = 'search_index_version'").Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read search index version: %v", err)
+	}
+	if version != searchIndexVersion {
+		logger.Info("Rebuilding full-text search index")
+		for _, stmt := range searchIndexRebuildStatements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to rebuild search index: %v", err)
+			}
+		}
+		_, err = tx.Exec(`
+			INSERT INTO configurations (key, value, description) VALUES ('search_index_version', ?, 'Full-text search index version')
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value
+		`, searchIndexVersion)
+		if err != nil {
+			return fmt.Errorf("failed to save search index version: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	searchIndexEnabled = true
+	return nil
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"melogo/internal/model"
+	"melogo/internal/utils"
+)
+
+// SearchService 歌曲、艺术家和专辑搜索服务
+type SearchService struct {
+	db      *sql.DB
+	library *LibraryService
+}
+
+// NewSearchService 创建新的搜索服务实例
+func NewSearchService(database *sql.DB) *SearchService {
+	return &SearchService{
+		db:      database,
+		library: NewLibraryService(database),
+	}
+}
+
+// songsFTSRank 歌曲匹配的相关度，标题权重最高，其次是艺术家、专辑和歌词
+const songsFTSRank = "bm25(songs_fts, 10.0, 5.0, 3.0, 1.0)"
+
+// songInfoColumns 歌曲列表（model.SongInfo）查询使用的列，需配合 scanSongInfoRows 使用
+const songInfoColumns = "id, title, artist, album, duration, cover_image, is_deleted, updated_at, " + songTagColumns +
+	", file_path, file_size, artist_id, album_id"
+
+// Search 搜索歌曲、艺术家和专辑，三类结果分别按相关度排序并使用相同的 limit 和 offset 分页
+// 全文索引不可用时退回 LIKE 匹配
+func (ss *SearchService) Search(query string, limit, offset int) (*model.SearchResult, error) {
+	if !searchIndexEnabled {
+		return ss.searchLike(query, limit, offset)
+	}
+
+	result := &model.SearchResult{
+		Songs:   []model.SongInfo{},
+		Artists: []model.Artist{},
+		Albums:  []model.Album{},
+	}
+	match := utils.BuildFTSQuery(query)
+	if match == "" {
+		return result, nil
+	}
+
+	var err error
+	if result.Songs, result.SongTotal, err = ss.searchSongs(match, limit, offset); err != nil {
+		return nil, err
+	}
+	if result.Artists, result.ArtistTotal, err = ss.searchArtists(match, limit, offset); err != nil {
+		return nil, err
+	}
+	if result.Albums, result.AlbumTotal, err = ss.searchAlbums(match, limit, offset); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// searchSongs 按全文索引搜索歌曲
+func (ss *SearchService) searchSongs(match string, limit, offset int) ([]model.SongInfo, int, error) {
+	matches := `
+		WITH matches AS MATERIALIZED (
+			SELECT rowid AS match_id, ` + songsFTSRank + ` AS match_rank
+			FROM songs_fts WHERE songs_fts MATCH ?
+		)
+	`
+
+	var total int
+	err := ss.db.QueryRow(matches+`
+		SELECT COUNT(*) FROM songs JOIN matches ON matches.match_id = songs.id
+		WHERE is_deleted = 0 AND is_missing = 0
+	`, match).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("搜索歌曲失败: %v", err)
+	}
+
+	rows, err := ss.db.Query(matches+`
+		SELECT `+songInfoColumns+`
+		FROM songs JOIN matches ON matches.match_id = songs.id
+		WHERE is_deleted = 0 AND is_missing = 0
+		ORDER BY matches.match_rank, title COLLATE NOCASE
+		LIMIT ? OFFSET ?
+	`, match, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("搜索歌曲失败: %v", err)
+	}
+	defer rows.Close()
+
+	songs, err := scanSongInfoRows(rows)
+	return songs, total, err
+}
+
+// searchArtists 按全文索引搜索艺术家
+func (ss *SearchService) searchArtists(match string, limit, offset int) ([]model.Artist, int, error) {
+	query := artistSongsCTE + `,
+		matches AS MATERIALIZED (
+			SELECT rowid AS match_id, bm25(artists_fts) AS match_rank
+			FROM artists_fts WHERE artists_fts MATCH ?
+		)
+	`
+
+	var total int
+	err := ss.db.QueryRow(query+`
+		SELECT COUNT(DISTINCT a.id)
+		FROM artists a
+		JOIN matches m ON m.match_id = a.id
+		JOIN artist_songs x ON x.artist_id = a.id
+	`, match).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("搜索艺术家失败: %v", err)
+	}
+
+	rows, err := ss.db.Query(query+`
+		SELECT a.id, a.name, COUNT(DISTINCT x.album_id), COUNT(DISTINCT x.song_id)
+		FROM artists a
+		JOIN matches m ON m.match_id = a.id
+		JOIN artist_songs x ON x.artist_id = a.id
+		GROUP BY a.id
+		ORDER BY MIN(m.match_rank), a.name COLLATE NOCASE
+		LIMIT ? OFFSET ?
+	`, match, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("搜索艺术家失败: %v", err)
+	}
+	defer rows.Close()
+
+	artists := []model.Artist{}
+	for rows.Next() {
+		var artist model.Artist
+		if err := rows.Scan(&artist.ID, &artist.Name, &artist.AlbumCount, &artist.SongCount); err != nil {
+			return nil, 0, fmt.Errorf("读取艺术家失败: %v", err)
+		}
+		artists = append(artists, artist)
+	}
+	return artists, total, rows.Err()
+}
+
+// searchAlbums 按全文索引搜索专辑（匹配专辑名和专辑艺术家）
+func (ss *SearchService) searchAlbums(match string, limit, offset int) ([]model.Album, int, error) {
+	matches := `
+		WITH matches AS MATERIALIZED (
+			SELECT rowid AS match_id, bm25(albums_fts, 2.0, 1.0) AS match_rank
+			FROM albums_fts WHERE albums_fts MATCH ?
+		)
+	`
+
+	var total int
+	err := ss.db.QueryRow(matches+`
+		SELECT COUNT(DISTINCT al.id)
+		`+albumFromClause+`
+		JOIN matches m ON m.match_id = al.id
+	`, match).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("搜索专辑失败: %v", err)
+	}
+
+	rows, err := ss.db.Query(matches+`
+		SELECT `+albumColumns+albumFromClause+`
+		JOIN matches m ON m.match_id = al.id
+		GROUP BY al.id
+		ORDER BY MIN(m.match_rank), al.name COLLATE NOCASE
+		LIMIT ? OFFSET ?
+	`, match, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("搜索专辑失败: %v", err)
+	}
+	defer rows.Close()
+
+	albums, err := scanAlbumRows(rows)
+	return albums, total, err
+}
+
+// searchLike 未启用全文索引时使用 LIKE 匹配搜索
+func (ss *SearchService) searchLike(query string, limit, offset int) (*model.SearchResult, error) {
+	result := &model.SearchResult{}
+	pattern := "%" + query + "%"
+	condition := `(title LIKE ? OR artist LIKE ? OR album LIKE ? OR ` + songArtistMatch + `)
+		AND is_deleted = 0 AND is_missing = 0`
+
+	err := ss.db.QueryRow("SELECT COUNT(*) FROM songs WHERE "+condition, pattern, pattern, pattern, pattern).Scan(&result.SongTotal)
+	if err != nil {
+		return nil, fmt.Errorf("搜索歌曲失败: %v", err)
+	}
+
+	rows, err := ss.db.Query(`
+		SELECT `+songInfoColumns+`
+		FROM songs
+		WHERE `+condition+`
+		ORDER BY title COLLATE NOCASE
+		LIMIT ? OFFSET ?
+	`, pattern, pattern, pattern, pattern, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("搜索歌曲失败: %v", err)
+	}
+	defer rows.Close()
+	if result.Songs, err = scanSongInfoRows(rows); err != nil {
+		return nil, err
+	}
+
+	if result.Artists, result.ArtistTotal, err = ss.library.ListArtists(query, limit, offset); err != nil {
+		return nil, err
+	}
+	if result.Albums, result.AlbumTotal, err = ss.library.ListAlbums(query, 0, "name", limit, offset); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// scanSongInfoRows 将查询结果扫描为歌曲列表，查询列需与 songInfoColumns 一致
+func scanSongInfoRows(rows *sql.Rows) ([]model.SongInfo, error) {
+	songs := []model.SongInfo{}
+	for rows.Next() {
+		var song model.SongInfo
+		if err := rows.Scan(songInfoFields(&song)...); err != nil {
+			return nil, fmt.Errorf("读取歌曲失败: %v", err)
+		}
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
+
+// songInfoFields 返回与 songInfoColumns 顺序一致的字段指针
+func songInfoFields(song *model.SongInfo) []interface{} {
+	fields := []interface{}{&song.ID, &song.Title, &song.Artist, &song.Album, &song.Duration, &song.CoverImage, &song.IsDeleted, &song.UpdatedAt}
+	fields = append(fields, songTagFields(&song.SongTags)...)
+	return append(fields, &song.FilePath, &song.FileSize, &song.ArtistID, &song.AlbumID)
+}
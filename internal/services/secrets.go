@@ -0,0 +1,66 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"melogo/internal/utils"
+)
+
+// encryptedColumns 保存可逆加密数据的列
+var encryptedColumns = []struct {
+	Table  string
+	Column string
+}{
+	{Table: "users", Column: "subsonic_password"},
+	{Table: "users", Column: "totp_secret"},
+	{Table: "scrobble_accounts", Column: "token"},
+}
+
+// ReencryptSecrets 将旧版本用 JWT 密钥加密的数据改用 ENCRYPTION_KEY 重新加密，
+// 之后更换 JWT 密钥不会再影响这些数据；两个密钥都无法解密的数据保持不变
+func ReencryptSecrets(db *sql.DB) error {
+	logger := utils.NewLogger()
+	for _, col := range encryptedColumns {
+		rows, err := db.Query(fmt.Sprintf(
+			"SELECT rowid, %s FROM %s WHERE %s IS NOT NULL AND %s != ''",
+			col.Column, col.Table, col.Column, col.Column,
+		))
+		if err != nil {
+			return fmt.Errorf("查询加密数据失败: %v", err)
+		}
+
+		updates := map[int64]string{}
+		for rows.Next() {
+			var id int64
+			var ciphertext string
+			if err := rows.Scan(&id, &ciphertext); err != nil {
+				rows.Close()
+				return fmt.Errorf("读取加密数据失败: %v", err)
+			}
+			reencrypted, changed, err := utils.ReencryptString(ciphertext)
+			if err != nil {
+				logger.Warningf("Failed to decrypt %s.%s of row %d: %v", col.Table, col.Column, id, err)
+				continue
+			}
+			if changed {
+				updates[id] = reencrypted
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("读取加密数据失败: %v", err)
+		}
+
+		for id, ciphertext := range updates {
+			if _, err := db.Exec(
+				fmt.Sprintf("UPDATE %s SET %s = ? WHERE rowid = ?", col.Table, col.Column), ciphertext, id,
+			); err != nil {
+				return fmt.Errorf("更新加密数据失败: %v", err)
+			}
+		}
+		if len(updates) > 0 {
+			logger.Infof("Re-encrypted %d value(s) of %s.%s with ENCRYPTION_KEY", len(updates), col.Table, col.Column)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"melogo/internal/config"
+	"melogo/internal/model"
+	"melogo/internal/utils"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新令牌不存在、已过期或会话已被吊销
+	ErrInvalidRefreshToken = errors.New("刷新令牌无效或已过期")
+	// ErrSessionRevoked 访问令牌对应的会话或令牌本身已被吊销
+	ErrSessionRevoked = errors.New("登录已失效，请重新登录")
+	// ErrSessionNotFound 会话不存在或不属于当前用户
+	ErrSessionNotFound = errors.New("会话不存在")
+)
+
+const (
+	// refreshReuseGrace 轮换后旧刷新令牌在此时间内再次使用视为并发刷新，只签发访问令牌；超过后视为令牌被盗用并吊销会话
+	refreshReuseGrace = time.Minute
+	// sessionTouchInterval 会话最后活动时间的最小更新间隔，避免每个请求都写数据库
+	sessionTouchInterval = time.Minute
+	// dbTimeLayout 与 SQLite datetime('now') 相同的 UTC 时间格式，便于直接比较
+	dbTimeLayout = "2006-01-02 15:04:05"
+)
+
+// SessionService 登录会话服务：签发访问令牌、轮换刷新令牌和吊销会话
+type SessionService struct {
+	db         *sql.DB
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	logger     *utils.Logger
+}
+
+var sessionService *SessionService
+
+// NewSessionService 创建会话服务实例
+func NewSessionService(cfg *config.Config, db *sql.DB) *SessionService {
+	service := &SessionService{
+		db:         db,
+		accessTTL:  time.Duration(cfg.Auth.AccessTokenTTL) * time.Minute,
+		refreshTTL: time.Duration(cfg.Auth.RefreshTokenTTL) * 24 * time.Hour,
+		logger:     utils.NewLogger(),
+	}
+	sessionService = service
+	return service
+}
+
+// GetSessionService 获取全局会话服务实例
+func GetSessionService() *SessionService {
+	return sessionService
+}
+
+// dbTime 将时间格式化为数据库中保存的 UTC 字符串
+func dbTime(t time.Time) string {
+	return t.UTC().Format(dbTimeLayout)
+}
+
+// CreateSession 为登录成功的用户创建会话，返回访问令牌和刷新令牌
+func (ss *SessionService) CreateSession(user *model.User, userAgent, ip string) (*model.TokenPair, error) {
+	// 登录时顺带清理过期的会话和吊销记录
+	ss.cleanup()
+
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("生成刷新令牌失败: %v", err)
+	}
+
+	now := time.Now()
+	result, err := ss.db.Exec(`
+		INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, user.ID, utils.HashToken(refreshToken), userAgent, ip, dbTime(now), dbTime(now), dbTime(now.Add(ss.refreshTTL)))
+	if err != nil {
+		return nil, fmt.Errorf("创建会话失败: %v", err)
+	}
+	sessionID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("获取会话ID失败: %v", err)
+	}
+
+	return ss.issueTokens(int(sessionID), user.ID, user.Username, refreshToken)
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌，同时轮换刷新令牌
+// 旧刷新令牌在轮换后不久再次使用时只签发访问令牌；更晚使用说明令牌可能被盗用，整个会话会被吊销
+func (ss *SessionService) Refresh(refreshToken, userAgent, ip string) (*model.TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	hash := utils.HashToken(refreshToken)
+
+	newToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("生成刷新令牌失败: %v", err)
+	}
+
+	// 条件更新保证并发刷新时只有一个请求能完成轮换
+	now := time.Now()
+	result, err := ss.db.Exec(`
+		UPDATE sessions
+		SET refresh_token_hash = ?, previous_token_hash = refresh_token_hash, rotated_at = ?,
+			last_seen_at = ?, expires_at = ?, user_agent = ?, ip = ?
+		WHERE refresh_token_hash = ? AND revoked_at IS NULL AND expires_at > ?
+			AND user_id IN (SELECT id FROM users WHERE is_disabled = 0)
+	`, utils.HashToken(newToken), dbTime(now), dbTime(now), dbTime(now.Add(ss.refreshTTL)), userAgent, ip, hash, dbTime(now))
+	if err != nil {
+		return nil, fmt.Errorf("轮换刷新令牌失败: %v", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		sessionID, userID, username, err := ss.sessionOwner("s.refresh_token_hash = ?", utils.HashToken(newToken))
+		if err != nil {
+			return nil, err
+		}
+		return ss.issueTokens(sessionID, userID, username, newToken)
+	}
+
+	return ss.refreshWithPreviousToken(hash, now)
+}
+
+// refreshWithPreviousToken 处理已被轮换的刷新令牌
+func (ss *SessionService) refreshWithPreviousToken(hash string, now time.Time) (*model.TokenPair, error) {
+	var sessionID int
+	var rotatedAt sql.NullString
+	var active bool
+	err := ss.db.QueryRow(`
+		SELECT s.id, s.rotated_at, s.revoked_at IS NULL AND s.expires_at > ? AND u.is_disabled = 0
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.previous_token_hash = ?
+	`, dbTime(now), hash).Scan(&sessionID, &rotatedAt, &active)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询会话失败: %v", err)
+	}
+	if !active {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if now.Sub(parseDBTime(rotatedAt)) > refreshReuseGrace {
+		ss.logger.Warningf("Refresh token reused for session %d, revoking session", sessionID)
+		if _, err := ss.db.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ?", dbTime(now), sessionID); err != nil {
+			return nil, fmt.Errorf("吊销会话失败: %v", err)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	sessionID, userID, username, err := ss.sessionOwner("s.id = ?", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return ss.issueTokens(sessionID, userID, username, "")
+}
+
+// sessionOwner 查询会话及其所属用户
+func (ss *SessionService) sessionOwner(where string, arg interface{}) (int, int, string, error) {
+	var sessionID, userID int
+	var username string
+	err := ss.db.QueryRow(`
+		SELECT s.id, u.id, u.username
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE `+where, arg).Scan(&sessionID, &userID, &username)
+	if err == sql.ErrNoRows {
+		return 0, 0, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("查询会话失败: %v", err)
+	}
+	return sessionID, userID, username, nil
+}
+
+// issueTokens 签发访问令牌，refreshToken 为空表示刷新令牌未轮换
+func (ss *SessionService) issueTokens(sessionID, userID int, username, refreshToken string) (*model.TokenPair, error) {
+	token, _, err := utils.GenerateToken(userID, username, sessionID, ss.accessTTL)
+	if err != nil {
+		return nil, fmt.Errorf("生成token失败: %v", err)
+	}
+
+	tokens := &model.TokenPair{
+		Token:     token,
+		ExpiresIn: int(ss.accessTTL.Seconds()),
+	}
+	if refreshToken != "" {
+		tokens.RefreshToken = refreshToken
+		tokens.RefreshExpiresIn = int(ss.refreshTTL.Seconds())
+	}
+	return tokens, nil
+}
+
+// ValidateAccess 检查访问令牌的会话仍然有效、令牌未被吊销且用户未被禁用，并更新会话最后活动时间
+func (ss *SessionService) ValidateAccess(claims *utils.Claims, ip string) error {
+	now := time.Now()
+	var revoked bool
+	err := ss.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = ? AND s.user_id = ? AND s.revoked_at IS NULL AND s.expires_at > ? AND u.is_disabled = 0
+	`, claims.ID, claims.SessionID, claims.UserID, dbTime(now)).Scan(&revoked)
+	if err == sql.ErrNoRows || revoked {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return fmt.Errorf("查询会话失败: %v", err)
+	}
+
+	_, err = ss.db.Exec(
+		"UPDATE sessions SET last_seen_at = ?, ip = ? WHERE id = ? AND last_seen_at < ?",
+		dbTime(now), ip, claims.SessionID, dbTime(now.Add(-sessionTouchInterval)),
+	)
+	if err != nil {
+		ss.logger.Warningf("Failed to update session last seen time: %v", err)
+	}
+	return nil
+}
+
+// Logout 吊销当前访问令牌及其所属会话
+func (ss *SessionService) Logout(claims *utils.Claims) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)",
+			claims.ID, dbTime(claims.ExpiresAt.Time),
+		)
+		if err != nil {
+			return fmt.Errorf("吊销token失败: %v", err)
+		}
+	}
+	_, err = tx.Exec(
+		"UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		dbTime(time.Now()), claims.SessionID, claims.UserID,
+	)
+	if err != nil {
+		return fmt.Errorf("吊销会话失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// RevokeSession 吊销用户的指定会话
+func (ss *SessionService) RevokeSession(userID, sessionID int) error {
+	result, err := ss.db.Exec(
+		"UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		dbTime(time.Now()), sessionID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("吊销会话失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions 吊销用户的所有会话（退出所有设备）
+func (ss *SessionService) RevokeUserSessions(userID int) error {
+	_, err := ss.db.Exec(
+		"UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		dbTime(time.Now()), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("吊销会话失败: %v", err)
+	}
+	return nil
+}
+
+// ListSessions 获取用户未过期且未吊销的会话，按最后活动时间倒序
+func (ss *SessionService) ListSessions(userID, currentSessionID int) ([]model.Session, error) {
+	rows, err := ss.db.Query(`
+		SELECT id, user_agent, ip, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_seen_at DESC, id DESC
+	`, userID, dbTime(time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("查询会话失败: %v", err)
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		var session model.Session
+		var createdAt, lastSeenAt, expiresAt sql.NullString
+		if err := rows.Scan(&session.ID, &session.UserAgent, &session.IP, &createdAt, &lastSeenAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("读取会话失败: %v", err)
+		}
+		session.CreatedAt = parseDBTime(createdAt)
+		session.LastSeenAt = parseDBTime(lastSeenAt)
+		session.ExpiresAt = parseDBTime(expiresAt)
+		session.Current = session.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// cleanup 删除已过期或已吊销的会话，以及已过期访问令牌的吊销记录
+func (ss *SessionService) cleanup() {
+	now := dbTime(time.Now())
+	if _, err := ss.db.Exec("DELETE FROM revoked_tokens WHERE expires_at <= ?", now); err != nil {
+		ss.logger.Warningf("Failed to clean up revoked tokens: %v", err)
+	}
+	// 吊销的会话保留到过期，以便识别被盗用的旧刷新令牌
+	if _, err := ss.db.Exec("DELETE FROM sessions WHERE expires_at <= ?", now); err != nil {
+		ss.logger.Warningf("Failed to clean up expired sessions: %v", err)
+	}
+}
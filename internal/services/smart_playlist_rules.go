@@ -0,0 +1,264 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"melogo/internal/model"
+	"strings"
+)
+
+// maxSmartRuleDepth 规则分组允许的最大嵌套层数
+const maxSmartRuleDepth = 5
+
+// smartTextColumns 支持文本条件的字段
+var smartTextColumns = map[string]string{
+	"title":        "s.title",
+	"artist":       "s.artist",
+	"album":        "s.album",
+	"album_artist": "s.album_artist",
+}
+
+// smartNumberColumns 支持数值条件的字段，play_count 为播放列表所有者的播放次数
+var smartNumberColumns = map[string]string{
+	"year":       "s.year",
+	"duration":   "s.duration",
+	"play_count": "COALESCE(us.play_count, 0)",
+}
+
+// smartDateColumns 支持 "最近 N 天" 条件的字段
+var smartDateColumns = map[string]string{
+	"added":       "s.created_at",
+	"last_played": "us.last_played_at",
+}
+
+// smartNumberOps 数值比较运算符
+var smartNumberOps = map[string]string{
+	"eq":  "=",
+	"ne":  "!=",
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+// smartSortColumns 排序字段，第一列使用请求的排序方向
+var smartSortColumns = map[string][]string{
+	"title":       {"s.title COLLATE NOCASE"},
+	"artist":      {"s.artist COLLATE NOCASE", "s.album COLLATE NOCASE", "s.disc_number", "s.track_number"},
+	"album":       {"s.album COLLATE NOCASE", "s.disc_number", "s.track_number"},
+	"year":        {"s.year", "s.album COLLATE NOCASE", "s.disc_number", "s.track_number"},
+	"duration":    {"s.duration"},
+	"play_count":  {"COALESCE(us.play_count, 0)"},
+	"added":       {"s.created_at"},
+	"last_played": {"us.last_played_at"},
+	"random":      {"RANDOM()"},
+}
+
+// smartFavoriteQuery 查询所有者收藏的歌曲
+const smartFavoriteQuery = `SELECT 1 FROM favorites f
+	WHERE f.user_id = ? AND f.item_type = 'song' AND f.item_id = s.id AND f.loved_at IS NOT NULL`
+
+// smartRuleCompiler 将智能播放列表规则编译为参数化的 SQL 条件
+// 查询需要以别名 s 引用 songs，并以别名 us LEFT JOIN 所有者的 user_song_stats
+type smartRuleCompiler struct {
+	userID int
+	args   []interface{}
+}
+
+// compileSmartRules 编译规则，返回 WHERE 条件及参数
+func compileSmartRules(rules model.SmartRule, userID int) (string, []interface{}, error) {
+	compiler := &smartRuleCompiler{userID: userID}
+	where, err := compiler.compile(rules, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	return where, compiler.args, nil
+}
+
+// compileSmartOrder 编译排序方式，sort 为空时按艺术家排序
+func compileSmartOrder(sort, order string) (string, error) {
+	if sort == "" {
+		sort = "artist"
+	}
+	columns, ok := smartSortColumns[sort]
+	if !ok {
+		return "", fmt.Errorf("不支持的排序字段: %s", sort)
+	}
+
+	direction := "ASC"
+	switch order {
+	case "", "asc":
+	case "desc":
+		direction = "DESC"
+	default:
+		return "", fmt.Errorf("不支持的排序方向: %s", order)
+	}
+
+	clauses := make([]string, 0, len(columns)+1)
+	clauses = append(clauses, columns[0]+" "+direction)
+	clauses = append(clauses, columns[1:]...)
+	return strings.Join(append(clauses, "s.id"), ", "), nil
+}
+
+// compile 编译一条规则或一个分组
+func (sc *smartRuleCompiler) compile(rule model.SmartRule, depth int) (string, error) {
+	if rule.IsGroup() {
+		return sc.compileGroup(rule, depth)
+	}
+
+	switch field := rule.Field; {
+	case smartTextColumns[field] != "":
+		return sc.compileText(smartTextColumns[field], rule)
+	case field == "genre":
+		return sc.compileGenre(rule)
+	case smartNumberColumns[field] != "":
+		return sc.compileNumber(smartNumberColumns[field], rule)
+	case smartDateColumns[field] != "":
+		return sc.compileDate(smartDateColumns[field], rule)
+	case field == "never_played":
+		return sc.compileFlag(rule, "COALESCE(us.play_count, 0) = 0", "COALESCE(us.play_count, 0) > 0")
+	case field == "favorite":
+		sc.args = append(sc.args, sc.userID)
+		return sc.compileFlag(rule,
+			"EXISTS ("+smartFavoriteQuery+")",
+			"NOT EXISTS ("+smartFavoriteQuery+")",
+		)
+	default:
+		return "", fmt.Errorf("不支持的规则字段: %s", field)
+	}
+}
+
+// compileGroup 编译分组，all 表示全部满足（AND），any 表示满足任一（OR）；空分组匹配所有歌曲
+func (sc *smartRuleCompiler) compileGroup(group model.SmartRule, depth int) (string, error) {
+	if depth >= maxSmartRuleDepth {
+		return "", fmt.Errorf("规则分组最多嵌套 %d 层", maxSmartRuleDepth)
+	}
+
+	joiner := " AND "
+	switch group.Match {
+	case "", model.SmartMatchAll:
+	case model.SmartMatchAny:
+		joiner = " OR "
+	default:
+		return "", fmt.Errorf("分组的 match 只能是 all 或 any: %s", group.Match)
+	}
+	if len(group.Rules) == 0 {
+		return "1", nil
+	}
+
+	parts := make([]string, 0, len(group.Rules))
+	for _, rule := range group.Rules {
+		part, err := sc.compile(rule, depth+1)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "("+part+")")
+	}
+	return strings.Join(parts, joiner), nil
+}
+
+// compileText 编译文本条件，比较忽略大小写
+func (sc *smartRuleCompiler) compileText(column string, rule model.SmartRule) (string, error) {
+	var value string
+	if err := json.Unmarshal(rule.Value, &value); err != nil || value == "" {
+		return "", fmt.Errorf("规则 %s 需要非空的字符串值", rule.Field)
+	}
+
+	switch rule.Op {
+	case "contains":
+		sc.args = append(sc.args, "%"+escapeLike(value)+"%")
+		return "COALESCE(" + column + ", '') LIKE ? ESCAPE '\\'", nil
+	case "not_contains":
+		sc.args = append(sc.args, "%"+escapeLike(value)+"%")
+		return "COALESCE(" + column + ", '') NOT LIKE ? ESCAPE '\\'", nil
+	case "is":
+		sc.args = append(sc.args, value)
+		return column + " = ? COLLATE NOCASE", nil
+	case "is_not":
+		sc.args = append(sc.args, value)
+		return "COALESCE(" + column + ", '') != ? COLLATE NOCASE", nil
+	default:
+		return "", fmt.Errorf("字段 %s 不支持运算符 %s", rule.Field, rule.Op)
+	}
+}
+
+// compileGenre 编译流派条件，匹配歌曲的任一流派
+func (sc *smartRuleCompiler) compileGenre(rule model.SmartRule) (string, error) {
+	var genres []string
+	if err := json.Unmarshal(rule.Value, &genres); err != nil || len(genres) == 0 {
+		return "", fmt.Errorf("规则 genre 需要非空的字符串数组")
+	}
+
+	exists := "EXISTS"
+	switch rule.Op {
+	case "in":
+	case "not_in":
+		exists = "NOT EXISTS"
+	default:
+		return "", fmt.Errorf("字段 genre 不支持运算符 %s", rule.Op)
+	}
+
+	for _, genre := range genres {
+		sc.args = append(sc.args, genre)
+	}
+	return exists + ` (
+		SELECT 1 FROM song_genres sg INNER JOIN genres g ON g.id = sg.genre_id
+		WHERE sg.song_id = s.id AND g.name IN (?` + strings.Repeat(", ?", len(genres)-1) + `)
+	)`, nil
+}
+
+// compileNumber 编译数值条件，between 的值为 [最小值, 最大值]
+func (sc *smartRuleCompiler) compileNumber(column string, rule model.SmartRule) (string, error) {
+	if rule.Op == "between" {
+		var bounds []int
+		if err := json.Unmarshal(rule.Value, &bounds); err != nil || len(bounds) != 2 || bounds[0] > bounds[1] {
+			return "", fmt.Errorf("规则 %s 的 between 需要 [最小值, 最大值]", rule.Field)
+		}
+		sc.args = append(sc.args, bounds[0], bounds[1])
+		return column + " BETWEEN ? AND ?", nil
+	}
+
+	op, ok := smartNumberOps[rule.Op]
+	if !ok {
+		return "", fmt.Errorf("字段 %s 不支持运算符 %s", rule.Field, rule.Op)
+	}
+	var value int
+	if err := json.Unmarshal(rule.Value, &value); err != nil {
+		return "", fmt.Errorf("规则 %s 需要整数值", rule.Field)
+	}
+	sc.args = append(sc.args, value)
+	return column + " " + op + " ?", nil
+}
+
+// compileDate 编译 "最近 N 天" 条件，从未播放的歌曲不满足 in_last，满足 not_in_last
+func (sc *smartRuleCompiler) compileDate(column string, rule model.SmartRule) (string, error) {
+	var days int
+	if err := json.Unmarshal(rule.Value, &days); err != nil || days <= 0 {
+		return "", fmt.Errorf("规则 %s 需要正整数天数", rule.Field)
+	}
+	sc.args = append(sc.args, fmt.Sprintf("-%d days", days))
+
+	switch rule.Op {
+	case "in_last":
+		return "julianday(" + column + ") >= julianday('now', ?)", nil
+	case "not_in_last":
+		return "(" + column + " IS NULL OR julianday(" + column + ") < julianday('now', ?))", nil
+	default:
+		return "", fmt.Errorf("字段 %s 不支持运算符 %s", rule.Field, rule.Op)
+	}
+}
+
+// compileFlag 编译布尔条件，参数需已由调用方加入
+func (sc *smartRuleCompiler) compileFlag(rule model.SmartRule, whenTrue, whenFalse string) (string, error) {
+	if rule.Op != "is" {
+		return "", fmt.Errorf("字段 %s 不支持运算符 %s", rule.Field, rule.Op)
+	}
+	var value bool
+	if err := json.Unmarshal(rule.Value, &value); err != nil {
+		return "", fmt.Errorf("规则 %s 需要 true 或 false", rule.Field)
+	}
+	if value {
+		return whenTrue, nil
+	}
+	return whenFalse, nil
+}
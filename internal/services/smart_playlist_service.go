@@ -0,0 +1,261 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"melogo/internal/model"
+	"strings"
+	"time"
+)
+
+// maxSmartPlaylistSongs 智能播放列表最多返回的歌曲数，limit 为 0 或超过此值时按此截断
+const maxSmartPlaylistSongs = 5000
+
+// SmartPlaylistService 智能播放列表服务
+// 智能播放列表的歌曲由规则在查询时动态生成，不能手动编辑；规则中的播放次数、
+// 最近播放和收藏均按播放列表所有者计算。查看需要是所有者或公开的智能播放列表，修改和删除只有所有者可以操作
+type SmartPlaylistService struct {
+	db *sql.DB
+}
+
+// SmartPlaylist 智能播放列表结构
+type SmartPlaylist struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	UserID    int             `json:"user_id"`
+	OwnerName string          `json:"owner_name"`
+	IsPublic  bool            `json:"is_public"`
+	Rules     model.SmartRule `json:"rules"`
+	Sort      string          `json:"sort"`
+	Order     string          `json:"order"`
+	Limit     int             `json:"limit"`
+	Role      string          `json:"role,omitempty"`
+	ReadOnly  bool            `json:"read_only"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// NewSmartPlaylistService 创建智能播放列表服务实例
+func NewSmartPlaylistService(db *sql.DB) *SmartPlaylistService {
+	return &SmartPlaylistService{db: db}
+}
+
+// smartPlaylistSelect 查询智能播放列表及所有者名称
+const smartPlaylistSelect = `
+	SELECT sp.id, sp.name, sp.user_id, COALESCE(u.username, ''), sp.is_public, sp.rules,
+	       sp.sort, sp.sort_order, sp.limit_count, sp.created_at, sp.updated_at
+	FROM smart_playlists sp
+	LEFT JOIN users u ON u.id = sp.user_id
+`
+
+// scanSmartPlaylist 读取 smartPlaylistSelect 查询的一行，并设置当前用户的角色
+func scanSmartPlaylist(scanner rowScanner, userID int) (*SmartPlaylist, error) {
+	var p SmartPlaylist
+	var rules string
+	err := scanner.Scan(
+		&p.ID,
+		&p.Name,
+		&p.UserID,
+		&p.OwnerName,
+		&p.IsPublic,
+		&rules,
+		&p.Sort,
+		&p.Order,
+		&p.Limit,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(rules), &p.Rules); err != nil {
+		return nil, fmt.Errorf("解析智能播放列表规则失败: %v", err)
+	}
+	if p.UserID == userID {
+		p.Role = PlaylistRoleOwner
+	}
+	p.ReadOnly = true
+	return &p, nil
+}
+
+// GetUserSmartPlaylists 获取用户的智能播放列表
+func (ss *SmartPlaylistService) GetUserSmartPlaylists(userID int) ([]*SmartPlaylist, error) {
+	rows, err := ss.db.Query(smartPlaylistSelect+" WHERE sp.user_id = ? ORDER BY sp.updated_at DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询智能播放列表失败: %v", err)
+	}
+	defer rows.Close()
+
+	playlists := []*SmartPlaylist{}
+	for rows.Next() {
+		p, err := scanSmartPlaylist(rows, userID)
+		if err != nil {
+			return nil, fmt.Errorf("扫描智能播放列表数据失败: %v", err)
+		}
+		playlists = append(playlists, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("扫描智能播放列表数据失败: %v", err)
+	}
+
+	return playlists, nil
+}
+
+// GetSmartPlaylistForUser 获取用户可以查看的智能播放列表，其他用户的私有智能播放列表视为不存在
+func (ss *SmartPlaylistService) GetSmartPlaylistForUser(playlistID, userID int) (*SmartPlaylist, error) {
+	playlist, err := scanSmartPlaylist(ss.db.QueryRow(smartPlaylistSelect+" WHERE sp.id = ?", playlistID), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPlaylistNotFound
+		}
+		return nil, fmt.Errorf("查询智能播放列表失败: %v", err)
+	}
+	if playlist.Role != PlaylistRoleOwner && !playlist.IsPublic {
+		return nil, ErrPlaylistNotFound
+	}
+	return playlist, nil
+}
+
+// CreateSmartPlaylist 创建智能播放列表，规则和排序方式在保存前校验
+func (ss *SmartPlaylistService) CreateSmartPlaylist(userID int, req *model.SmartPlaylistRequest) (*SmartPlaylist, error) {
+	rules, sort, order, err := validateSmartPlaylist(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ss.db.Exec(`
+		INSERT INTO smart_playlists (user_id, name, is_public, rules, sort, sort_order, limit_count, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, userID, strings.TrimSpace(req.Name), req.IsPublic, rules, sort, order, req.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("创建智能播放列表失败: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("获取智能播放列表ID失败: %v", err)
+	}
+
+	return ss.GetSmartPlaylistForUser(int(id), userID)
+}
+
+// UpdateSmartPlaylist 更新智能播放列表的名称、公开状态、规则、排序和数量限制
+func (ss *SmartPlaylistService) UpdateSmartPlaylist(playlistID, userID int, req *model.SmartPlaylistRequest) (*SmartPlaylist, error) {
+	if err := ss.checkOwner(playlistID, userID); err != nil {
+		return nil, err
+	}
+	rules, sort, order, err := validateSmartPlaylist(req)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ss.db.Exec(`
+		UPDATE smart_playlists
+		SET name = ?, is_public = ?, rules = ?, sort = ?, sort_order = ?, limit_count = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, strings.TrimSpace(req.Name), req.IsPublic, rules, sort, order, req.Limit, playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("更新智能播放列表失败: %v", err)
+	}
+
+	return ss.GetSmartPlaylistForUser(playlistID, userID)
+}
+
+// DeleteSmartPlaylist 删除智能播放列表
+func (ss *SmartPlaylistService) DeleteSmartPlaylist(playlistID, userID int) error {
+	if err := ss.checkOwner(playlistID, userID); err != nil {
+		return err
+	}
+
+	if _, err := ss.db.Exec("DELETE FROM smart_playlists WHERE id = ?", playlistID); err != nil {
+		return fmt.Errorf("删除智能播放列表失败: %v", err)
+	}
+	return nil
+}
+
+// checkOwner 检查智能播放列表是否属于该用户
+func (ss *SmartPlaylistService) checkOwner(playlistID, userID int) error {
+	playlist, err := ss.GetSmartPlaylistForUser(playlistID, userID)
+	if err != nil {
+		return err
+	}
+	if playlist.Role != PlaylistRoleOwner {
+		return ErrPlaylistForbidden
+	}
+	return nil
+}
+
+// GetSmartPlaylistSongs 按规则生成智能播放列表的歌曲
+// 歌曲没有条目ID，OrderIndex 为歌曲在结果中的位置，AddedAt 为歌曲入库时间
+func (ss *SmartPlaylistService) GetSmartPlaylistSongs(playlist *SmartPlaylist) ([]*PlaylistSong, error) {
+	where, args, err := compileSmartRules(playlist.Rules, playlist.UserID)
+	if err != nil {
+		return nil, err
+	}
+	orderBy, err := compileSmartOrder(playlist.Sort, playlist.Order)
+	if err != nil {
+		return nil, err
+	}
+	limit := playlist.Limit
+	if limit <= 0 || limit > maxSmartPlaylistSongs {
+		limit = maxSmartPlaylistSongs
+	}
+
+	query := `
+		SELECT s.id, COALESCE(s.title, ''), COALESCE(s.artist, ''), COALESCE(s.duration, 0), s.created_at
+		FROM songs s
+		LEFT JOIN user_song_stats us ON us.song_id = s.id AND us.user_id = ?
+		WHERE s.is_deleted = 0 AND s.is_missing = 0 AND (` + where + `)
+		ORDER BY ` + orderBy + `
+		LIMIT ?
+	`
+	queryArgs := append([]interface{}{playlist.UserID}, args...)
+	rows, err := ss.db.Query(query, append(queryArgs, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("查询智能播放列表歌曲失败: %v", err)
+	}
+	defer rows.Close()
+
+	songs := []*PlaylistSong{}
+	for rows.Next() {
+		song := PlaylistSong{PlaylistID: playlist.ID, OrderIndex: len(songs)}
+		if err := rows.Scan(&song.SongID, &song.Title, &song.Artist, &song.Duration, &song.AddedAt); err != nil {
+			return nil, fmt.Errorf("扫描歌曲数据失败: %v", err)
+		}
+		songs = append(songs, &song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("扫描歌曲数据失败: %v", err)
+	}
+
+	return songs, nil
+}
+
+// validateSmartPlaylist 校验请求中的规则和排序方式，返回规则 JSON 及规范化后的排序字段和方向
+func validateSmartPlaylist(req *model.SmartPlaylistRequest) (string, string, string, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return "", "", "", errors.New("播放列表名称不能为空")
+	}
+	if _, _, err := compileSmartRules(req.Rules, 0); err != nil {
+		return "", "", "", err
+	}
+
+	sort, order := req.Sort, req.Order
+	if sort == "" {
+		sort = "artist"
+	}
+	if order == "" {
+		order = "asc"
+	}
+	if _, err := compileSmartOrder(sort, order); err != nil {
+		return "", "", "", err
+	}
+
+	rules, err := json.Marshal(req.Rules)
+	if err != nil {
+		return "", "", "", fmt.Errorf("序列化规则失败: %v", err)
+	}
+	return string(rules), sort, order, nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"melogo/internal/config"
+	"melogo/internal/utils"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TranscodeFormat 描述一种转码输出格式
+type TranscodeFormat struct {
+	Name           string
+	Extension      string
+	ContentType    string
+	DefaultBitRate int // kbps
+}
+
+// transcodeFormats 支持的转码输出格式
+var transcodeFormats = map[string]TranscodeFormat{
+	"mp3":  {Name: "mp3", Extension: ".mp3", ContentType: "audio/mpeg", DefaultBitRate: 192},
+	"opus": {Name: "opus", Extension: ".opus", ContentType: "audio/ogg", DefaultBitRate: 128},
+	"aac":  {Name: "aac", Extension: ".aac", ContentType: "audio/aac", DefaultBitRate: 160},
+}
+
+// GetTranscodeFormat 根据名称获取转码格式
+func GetTranscodeFormat(name string) (TranscodeFormat, bool) {
+	format, ok := transcodeFormats[strings.ToLower(name)]
+	return format, ok
+}
+
+// Transcoder 音频转码器，转码结果缓存在磁盘上并按LRU淘汰
+type Transcoder struct {
+	commands      map[string]string
+	defaultFormat string
+	cacheDir      string
+	maxCacheBytes int64
+	logger        *utils.Logger
+	mu            sync.Mutex
+}
+
+var transcoder *Transcoder
+
+// NewTranscoder 创建转码器实例
+func NewTranscoder(cfg *config.Config) *Transcoder {
+	t := &Transcoder{
+		commands:      cfg.Music.TranscodeCommands,
+		defaultFormat: cfg.Music.TranscodeDefaultFormat,
+		cacheDir:      cfg.Music.TranscodeCacheDir,
+		maxCacheBytes: int64(cfg.Music.TranscodeCacheSize) * 1024 * 1024,
+		logger:        utils.NewLogger(),
+	}
+	transcoder = t
+	return t
+}
+
+// GetTranscoder 获取全局转码器实例
+func GetTranscoder() *Transcoder {
+	return transcoder
+}
+
+// DefaultFormat 返回仅限制码率时使用的默认输出格式
+func (t *Transcoder) DefaultFormat() string {
+	return t.defaultFormat
+}
+
+// CanTranscode 检查是否配置了指定格式的转码命令
+func (t *Transcoder) CanTranscode(format string) bool {
+	return strings.TrimSpace(t.commands[format]) != ""
+}
+
+// CacheKey 生成缓存文件名，源文件修改后缓存自然失效
+func (t *Transcoder) CacheKey(songID int, format TranscodeFormat, bitRate int, modTime time.Time) string {
+	return fmt.Sprintf("%d-%s-%d-%d%s", songID, format.Name, bitRate, modTime.Unix(), format.Extension)
+}
+
+// Lookup 查找缓存的转码结果，命中时刷新访问时间
+func (t *Transcoder) Lookup(key string) (string, bool) {
+	path := filepath.Join(t.cacheDir, key)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return path, true
+}
+
+// TranscodeStream 正在进行的转码输出，读取的同时写入缓存临时文件
+type TranscodeStream struct {
+	t       *Transcoder
+	cmd     *exec.Cmd
+	stdout  io.ReadCloser
+	tmp     *os.File
+	reader  io.Reader
+	key     string
+	aborted bool
+}
+
+// Transcode 启动转码进程，ctx 取消时进程会被终止
+func (t *Transcoder) Transcode(ctx context.Context, inputPath string, format TranscodeFormat, bitRate int, key string) (*TranscodeStream, error) {
+	args, err := buildTranscodeArgs(t.commands[format.Name], inputPath, bitRate)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcode pipe: %v", err)
+	}
+
+	if err := os.MkdirAll(t.cacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create transcode cache directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(t.cacheDir, ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcode cache file: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to start transcoder: %v", err)
+	}
+
+	t.logger.Infof("Transcoding %s to %s at %dkbps", inputPath, format.Name, bitRate)
+	return &TranscodeStream{
+		t:      t,
+		cmd:    cmd,
+		stdout: stdout,
+		tmp:    tmp,
+		reader: io.TeeReader(stdout, tmp),
+		key:    key,
+	}, nil
+}
+
+// Read 读取转码输出
+func (s *TranscodeStream) Read(p []byte) (int, error) {
+	return s.reader.Read(p)
+}
+
+// Abort 标记转码结果不完整，Close 时不会写入缓存
+func (s *TranscodeStream) Abort() {
+	s.aborted = true
+}
+
+// Close 读完剩余输出并等待进程结束，成功时将结果放入缓存
+func (s *TranscodeStream) Close() error {
+	var copyErr error
+	if !s.aborted {
+		_, copyErr = io.Copy(io.Discard, s.reader)
+	} else {
+		s.stdout.Close()
+	}
+	waitErr := s.cmd.Wait()
+	s.tmp.Close()
+
+	if s.aborted || copyErr != nil || waitErr != nil {
+		os.Remove(s.tmp.Name())
+		if waitErr != nil && !s.aborted {
+			return fmt.Errorf("transcoder exited with error: %v", waitErr)
+		}
+		return copyErr
+	}
+
+	return s.t.store(s.tmp.Name(), s.key)
+}
+
+// store 将完成的临时文件放入缓存并执行淘汰
+func (t *Transcoder) store(tmpPath, key string) error {
+	if info, err := os.Stat(tmpPath); err != nil || info.Size() == 0 {
+		os.Remove(tmpPath)
+		return errors.New("transcoder produced no output")
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(t.cacheDir, key)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to store transcoded file: %v", err)
+	}
+
+	t.evict()
+	return nil
+}
+
+// evict 按最近访问时间淘汰缓存，直到总大小不超过上限
+func (t *Transcoder) evict() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, err := os.ReadDir(t.cacheDir)
+	if err != nil {
+		t.logger.Errorf("Failed to read transcode cache: %v", err)
+		return
+	}
+
+	type cacheEntry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cacheEntry
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cacheEntry{
+			path:    filepath.Join(t.cacheDir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		total += info.Size()
+	}
+
+	if total <= t.maxCacheBytes {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, file := range files {
+		if total <= t.maxCacheBytes {
+			break
+		}
+		if err := os.Remove(file.path); err != nil {
+			t.logger.Warningf("Failed to evict transcode cache file %s: %v", file.path, err)
+			continue
+		}
+		total -= file.size
+	}
+}
+
+// EstimateTranscodedSize 根据时长和码率估算转码输出的字节数（含少量容器开销）
+func EstimateTranscodedSize(duration, bitRate int) int64 {
+	payload := int64(duration) * int64(bitRate) * 1000 / 8
+	return payload + payload/50 + 4096
+}
+
+// buildTranscodeArgs 将命令模板拆分为参数，替换 %s（输入文件）和 %b（码率）
+// 不经过shell执行，文件名中的特殊字符不会被解释
+func buildTranscodeArgs(template, inputPath string, bitRate int) ([]string, error) {
+	fields := strings.Fields(template)
+	if len(fields) == 0 {
+		return nil, errors.New("transcode command not configured")
+	}
+
+	args := make([]string, len(fields))
+	for i, field := range fields {
+		field = strings.ReplaceAll(field, "%b", strconv.Itoa(bitRate))
+		field = strings.ReplaceAll(field, "%s", inputPath)
+		args[i] = field
+	}
+	return args, nil
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"io"
+	"melogo/internal/utils"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newStubTranscoder 创建使用桩命令代替编码器的转码器
+func newStubTranscoder(t *testing.T, command string, maxCacheBytes int64) *Transcoder {
+	t.Helper()
+	for _, name := range []string{"cat", "false", "true"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s not available: %v", name, err)
+		}
+	}
+	return &Transcoder{
+		commands:      map[string]string{"mp3": command},
+		defaultFormat: "mp3",
+		cacheDir:      filepath.Join(t.TempDir(), "cache"),
+		maxCacheBytes: maxCacheBytes,
+		logger:        utils.NewLogger(),
+	}
+}
+
+func writeSource(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "source file.flac")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTranscodeStreamsOutputAndCaches(t *testing.T) {
+	tr := newStubTranscoder(t, "cat %s", 1<<20)
+	source := writeSource(t, "encoded audio data")
+	format, _ := GetTranscodeFormat("mp3")
+	key := tr.CacheKey(1, format, 128, time.Unix(1700000000, 0))
+
+	stream, err := tr.Transcode(context.Background(), source, format, 128, key)
+	if err != nil {
+		t.Fatalf("Transcode: %v", err)
+	}
+	got, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if string(got) != "encoded audio data" {
+		t.Fatalf("stream output = %q", got)
+	}
+
+	cached, ok := tr.Lookup(key)
+	if !ok {
+		t.Fatal("finished transcode was not cached")
+	}
+	data, err := os.ReadFile(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "encoded audio data" {
+		t.Fatalf("cached output = %q", data)
+	}
+}
+
+func TestTranscodeAbortedIsNotCached(t *testing.T) {
+	tr := newStubTranscoder(t, "cat %s", 1<<20)
+	source := writeSource(t, "partial")
+	format, _ := GetTranscodeFormat("mp3")
+	key := "aborted.mp3"
+
+	stream, err := tr.Transcode(context.Background(), source, format, 128, key)
+	if err != nil {
+		t.Fatalf("Transcode: %v", err)
+	}
+	stream.Abort()
+	stream.Close()
+
+	if _, ok := tr.Lookup(key); ok {
+		t.Fatal("aborted transcode was cached")
+	}
+	assertNoTempFiles(t, tr.cacheDir)
+}
+
+func TestTranscodeFailureIsNotCached(t *testing.T) {
+	for name, command := range map[string]string{
+		"exit error": "false %s",
+		"no output":  "true %s",
+	} {
+		t.Run(name, func(t *testing.T) {
+			tr := newStubTranscoder(t, command, 1<<20)
+			source := writeSource(t, "data")
+			format, _ := GetTranscodeFormat("mp3")
+			key := "failed.mp3"
+
+			stream, err := tr.Transcode(context.Background(), source, format, 128, key)
+			if err != nil {
+				t.Fatalf("Transcode: %v", err)
+			}
+			io.Copy(io.Discard, stream)
+			if err := stream.Close(); err == nil {
+				t.Fatal("Close returned no error for a failed transcode")
+			}
+
+			if _, ok := tr.Lookup(key); ok {
+				t.Fatal("failed transcode was cached")
+			}
+			assertNoTempFiles(t, tr.cacheDir)
+		})
+	}
+}
+
+func TestTranscodeEvictsLeastRecentlyUsed(t *testing.T) {
+	tr := newStubTranscoder(t, "cat %s", 1<<20)
+	format, _ := GetTranscodeFormat("mp3")
+
+	for _, key := range []string{"old.mp3", "new.mp3"} {
+		stream, err := tr.Transcode(context.Background(), writeSource(t, "123456"), format, 128, key)
+		if err != nil {
+			t.Fatalf("Transcode: %v", err)
+		}
+		if err := stream.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(tr.cacheDir, "old.mp3"), past, past)
+	tr.maxCacheBytes = 10
+	tr.evict()
+
+	if _, err := os.Stat(filepath.Join(tr.cacheDir, "old.mp3")); !os.IsNotExist(err) {
+		t.Fatal("least recently used entry was not evicted")
+	}
+	if _, err := os.Stat(filepath.Join(tr.cacheDir, "new.mp3")); err != nil {
+		t.Fatalf("most recently used entry was evicted: %v", err)
+	}
+}
+
+func TestBuildTranscodeArgs(t *testing.T) {
+	args, err := buildTranscodeArgs("ffmpeg -i %s -b:a %bk -f mp3 -", "/music/a b;rm -rf.flac", 192)
+	if err != nil {
+		t.Fatalf("buildTranscodeArgs: %v", err)
+	}
+	want := []string{"ffmpeg", "-i", "/music/a b;rm -rf.flac", "-b:a", "192k", "-f", "mp3", "-"}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("args = %q, want %q", args, want)
+	}
+
+	if _, err := buildTranscodeArgs("   ", "/music/a.flac", 192); err == nil {
+		t.Fatal("empty command template returned no error")
+	}
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, ".tmp-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Fatalf("temporary files left behind: %v", matches)
+	}
+}
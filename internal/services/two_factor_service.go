@@ -0,0 +1,479 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"math/big"
+	"melogo/internal/config"
+	"melogo/internal/model"
+	"melogo/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+var (
+	// ErrInvalidTwoFactorCode 验证码或恢复码错误，或验证码已经使用过
+	ErrInvalidTwoFactorCode = errors.New("验证码错误")
+	// ErrTwoFactorNotEnabled 用户尚未启用两步验证
+	ErrTwoFactorNotEnabled = errors.New("尚未启用两步验证")
+	// ErrTwoFactorAlreadyEnabled 用户已经启用两步验证
+	ErrTwoFactorAlreadyEnabled = errors.New("已经启用两步验证")
+	// ErrTwoFactorSetupNotStarted 启用前需要先生成密钥
+	ErrTwoFactorSetupNotStarted = errors.New("请先生成两步验证密钥")
+	// ErrTwoFactorRequired 服务器要求管理员启用两步验证
+	ErrTwoFactorRequired = errors.New("管理员账号必须启用两步验证")
+	// ErrInvalidPreAuthToken 预认证令牌不存在、已过期或尝试次数过多
+	ErrInvalidPreAuthToken = errors.New("验证已过期，请重新登录")
+)
+
+const (
+	// totpIssuer 验证器应用中显示的服务名称
+	totpIssuer = "MeloGo"
+	// totpPeriod 验证码的时间步长（秒），totpSkew 允许前后各偏差的时间步数
+	totpPeriod = 30
+	totpSkew   = 1
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet 恢复码字符集，去掉了容易混淆的 0、1、i、l、o
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	// preAuthTTL 预认证令牌的有效期，preAuthMaxAttempts 每个令牌允许的验证码错误次数
+	preAuthTTL         = 5 * time.Minute
+	preAuthMaxAttempts = 5
+	// challengeVerify 登录时验证已启用的两步验证，challengeSetup 登录时先完成被要求的两步验证设置
+	challengeVerify = "verify"
+	challengeSetup  = "setup"
+)
+
+// totpOptions 与大多数验证器应用兼容的 TOTP 参数
+var totpOptions = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// TwoFactorService TOTP 两步验证服务：密钥设置、验证码和恢复码校验以及登录时的预认证令牌
+type TwoFactorService struct {
+	db           *sql.DB
+	requireAdmin bool
+	logger       *utils.Logger
+}
+
+var twoFactorService *TwoFactorService
+
+// NewTwoFactorService 创建两步验证服务实例
+func NewTwoFactorService(cfg *config.Config, db *sql.DB) *TwoFactorService {
+	service := &TwoFactorService{
+		db:           db,
+		requireAdmin: cfg.Auth.RequireAdmin2FA,
+		logger:       utils.NewLogger(),
+	}
+	twoFactorService = service
+	return service
+}
+
+// GetTwoFactorService 获取全局两步验证服务实例
+func GetTwoFactorService() *TwoFactorService {
+	return twoFactorService
+}
+
+// IsRequired 服务器要求管理员启用两步验证时返回 true
+func (ts *TwoFactorService) IsRequired(user *model.User) bool {
+	return ts.requireAdmin && user.IsAdmin == 1
+}
+
+// Status 获取用户的两步验证状态
+func (ts *TwoFactorService) Status(userID int) (*model.TwoFactorStatus, error) {
+	var user model.User
+	var remaining int
+	err := ts.db.QueryRow(`
+		SELECT u.is_admin, u.totp_enabled,
+			(SELECT COUNT(*) FROM recovery_codes r WHERE r.user_id = u.id AND r.used_at IS NULL)
+		FROM users u
+		WHERE u.id = ?
+	`, userID).Scan(&user.IsAdmin, &user.TwoFactorEnabled, &remaining)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询两步验证状态失败: %v", err)
+	}
+
+	return &model.TwoFactorStatus{
+		Enabled:                user.TwoFactorEnabled == 1,
+		Required:               ts.IsRequired(&user),
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// BeginSetup 生成新的 TOTP 密钥，用验证码确认（Enable）后才会启用；重复调用会替换尚未确认的密钥
+func (ts *TwoFactorService) BeginSetup(userID int) (*model.TwoFactorSetup, error) {
+	var username string
+	var enabled int
+	err := ts.db.QueryRow("SELECT username, totp_enabled FROM users WHERE id = ?", userID).Scan(&username, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询用户失败: %v", err)
+	}
+	if enabled == 1 {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: username,
+		Period:      totpOptions.Period,
+		Digits:      totpOptions.Digits,
+		Algorithm:   totpOptions.Algorithm,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成两步验证密钥失败: %v", err)
+	}
+	encrypted, err := utils.EncryptString(key.Secret())
+	if err != nil {
+		return nil, fmt.Errorf("加密两步验证密钥失败: %v", err)
+	}
+	if _, err := ts.db.Exec(
+		"UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ? AND totp_enabled = 0",
+		encrypted, userID,
+	); err != nil {
+		return nil, fmt.Errorf("保存两步验证密钥失败: %v", err)
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, fmt.Errorf("生成二维码失败: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("生成二维码失败: %v", err)
+	}
+
+	return &model.TwoFactorSetup{
+		Secret:     key.Secret(),
+		OTPAuthURL: key.URL(),
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// Enable 使用验证器中的验证码确认密钥并启用两步验证，返回新生成的恢复码
+func (ts *TwoFactorService) Enable(userID int, code string) ([]string, error) {
+	secret, enabled, _, err := ts.totpSecret(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if secret == "" {
+		return nil, ErrTwoFactorSetupNotStarted
+	}
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = 1, totp_last_step = ? WHERE id = ?", step, userID); err != nil {
+		return nil, fmt.Errorf("启用两步验证失败: %v", err)
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return codes, nil
+}
+
+// Disable 验证当前密码和验证码（或恢复码）后关闭两步验证，被要求启用两步验证的管理员不能关闭
+func (ts *TwoFactorService) Disable(userID int, password, code string) error {
+	var user model.User
+	err := ts.db.QueryRow("SELECT password_hash, is_admin FROM users WHERE id = ?", userID).Scan(&user.Password, &user.IsAdmin)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("查询用户失败: %v", err)
+	}
+	if ts.IsRequired(&user) {
+		return ErrTwoFactorRequired
+	}
+	if err := utils.VerifyPassword(user.Password, password); err != nil {
+		return ErrWrongPassword
+	}
+	if err := ts.Verify(userID, code); err != nil {
+		return err
+	}
+	return ts.Reset(userID)
+}
+
+// Reset 关闭用户的两步验证并删除恢复码，管理员可以为丢失验证器的用户重置
+func (ts *TwoFactorService) Reset(userID int) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0 WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("关闭两步验证失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrUserNotFound
+	}
+	for _, stmt := range []string{
+		"DELETE FROM recovery_codes WHERE user_id = ?",
+		"DELETE FROM login_challenges WHERE user_id = ?",
+	} {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return fmt.Errorf("关闭两步验证失败: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes 验证验证码后生成新的恢复码，旧的恢复码全部失效
+func (ts *TwoFactorService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	if err := ts.Verify(userID, code); err != nil {
+		return nil, err
+	}
+
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return codes, nil
+}
+
+// Verify 校验 6 位验证码或恢复码；每个验证码只能使用一次，恢复码使用后失效
+func (ts *TwoFactorService) Verify(userID int, code string) error {
+	secret, enabled, lastStep, err := ts.totpSecret(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) == int(totpOptions.Digits) {
+		step, ok := matchTOTP(secret, code, time.Now())
+		if !ok || step <= lastStep {
+			return ErrInvalidTwoFactorCode
+		}
+		// 只允许时间步前进，防止同一个验证码被重放
+		result, err := ts.db.Exec(
+			"UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?",
+			step, userID, step,
+		)
+		if err != nil {
+			return fmt.Errorf("更新两步验证状态失败: %v", err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	result, err := ts.db.Exec(
+		"UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		dbTime(time.Now()), userID, utils.HashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return fmt.Errorf("校验恢复码失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	ts.logger.Infof("User %d logged in with a recovery code", userID)
+	return nil
+}
+
+// totpSecret 读取并解密用户的 TOTP 密钥，尚未生成密钥时返回空字符串
+func (ts *TwoFactorService) totpSecret(userID int) (string, bool, int64, error) {
+	var encrypted sql.NullString
+	var enabled int
+	var lastStep int64
+	err := ts.db.QueryRow(
+		"SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ?", userID,
+	).Scan(&encrypted, &enabled, &lastStep)
+	if err == sql.ErrNoRows {
+		return "", false, 0, ErrUserNotFound
+	}
+	if err != nil {
+		return "", false, 0, fmt.Errorf("查询两步验证密钥失败: %v", err)
+	}
+	if !encrypted.Valid || encrypted.String == "" {
+		return "", enabled == 1, lastStep, nil
+	}
+
+	secret, err := utils.DecryptString(encrypted.String)
+	if err != nil {
+		return "", false, 0, fmt.Errorf("解密两步验证密钥失败: %v", err)
+	}
+	return secret, enabled == 1, lastStep, nil
+}
+
+// matchTOTP 在允许的时间偏差内查找与验证码匹配的时间步
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	for skew := -totpSkew; skew <= totpSkew; skew++ {
+		t := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, t, totpOptions)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return t.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// replaceRecoveryCodes 删除用户的旧恢复码并生成新的恢复码，只保存摘要
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, fmt.Errorf("删除旧恢复码失败: %v", err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("生成恢复码失败: %v", err)
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, utils.HashToken(normalizeRecoveryCode(code)),
+		); err != nil {
+			return nil, fmt.Errorf("保存恢复码失败: %v", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode 生成 xxxxx-xxxxx 格式的随机恢复码
+func generateRecoveryCode() (string, error) {
+	var sb strings.Builder
+	size := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			sb.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// normalizeRecoveryCode 忽略恢复码的大小写、空格和连字符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// CreateChallenge 密码验证通过后创建预认证令牌，setup 为 true 表示需要先完成两步验证设置
+func (ts *TwoFactorService) CreateChallenge(userID int, setup bool) (*model.TwoFactorChallenge, error) {
+	now := time.Now()
+	if _, err := ts.db.Exec("DELETE FROM login_challenges WHERE expires_at <= ?", dbTime(now)); err != nil {
+		ts.logger.Warningf("Failed to clean up login challenges: %v", err)
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("生成预认证令牌失败: %v", err)
+	}
+	purpose := challengeVerify
+	if setup {
+		purpose = challengeSetup
+	}
+	if _, err := ts.db.Exec(
+		"INSERT INTO login_challenges (user_id, token_hash, purpose, expires_at) VALUES (?, ?, ?, ?)",
+		userID, utils.HashToken(token), purpose, dbTime(now.Add(preAuthTTL)),
+	); err != nil {
+		return nil, fmt.Errorf("保存预认证令牌失败: %v", err)
+	}
+
+	return &model.TwoFactorChallenge{
+		TwoFactorRequired:      !setup,
+		TwoFactorSetupRequired: setup,
+		PreAuthToken:           token,
+		ExpiresIn:              int(preAuthTTL / time.Second),
+	}, nil
+}
+
+// Challenge 查找有效的预认证令牌，返回用户ID以及是否需要先完成两步验证设置
+func (ts *TwoFactorService) Challenge(token string) (int, bool, error) {
+	var userID int
+	var purpose string
+	err := ts.db.QueryRow(`
+		SELECT c.user_id, c.purpose
+		FROM login_challenges c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.token_hash = ? AND c.expires_at > ? AND c.attempts < ? AND u.is_disabled = 0
+	`, utils.HashToken(token), dbTime(time.Now()), preAuthMaxAttempts).Scan(&userID, &purpose)
+	if err == sql.ErrNoRows {
+		return 0, false, ErrInvalidPreAuthToken
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("查询预认证令牌失败: %v", err)
+	}
+	return userID, purpose == challengeSetup, nil
+}
+
+// ChallengeFailed 记录一次验证码错误，达到次数上限后令牌失效
+func (ts *TwoFactorService) ChallengeFailed(token string) {
+	if _, err := ts.db.Exec(
+		"UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ?", utils.HashToken(token),
+	); err != nil {
+		ts.logger.Warningf("Failed to record two-factor failure: %v", err)
+	}
+}
+
+// CompleteChallenge 两步验证通过后删除预认证令牌，令牌已被使用时返回 ErrInvalidPreAuthToken
+func (ts *TwoFactorService) CompleteChallenge(token string) error {
+	result, err := ts.db.Exec("DELETE FROM login_challenges WHERE token_hash = ?", utils.HashToken(token))
+	if err != nil {
+		return fmt.Errorf("删除预认证令牌失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrInvalidPreAuthToken
+	}
+	return nil
+}
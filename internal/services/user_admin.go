@@ -0,0 +1,218 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"melogo/internal/model"
+	"melogo/internal/utils"
+	"strings"
+	"time"
+)
+
+// otherActiveAdmin 除当前用户外仍有未禁用的管理员，需要传入用户ID
+const otherActiveAdmin = `EXISTS (SELECT 1 FROM users o WHERE o.is_admin = 1 AND o.is_disabled = 0 AND o.id != ?)`
+
+// userDataStatements 删除用户时清理的个人数据，需要传入用户ID
+var userDataStatements = []string{
+	"DELETE FROM playlist_collaborators WHERE user_id = ?",
+	"DELETE FROM playlist_followers WHERE user_id = ?",
+	"DELETE FROM smart_playlists WHERE user_id = ?",
+	"DELETE FROM favorites WHERE user_id = ?",
+	"DELETE FROM search_history WHERE user_id = ?",
+	"DELETE FROM scrobble_queue WHERE account_id IN (SELECT id FROM scrobble_accounts WHERE user_id = ?)",
+	"DELETE FROM scrobble_accounts WHERE user_id = ?",
+	"DELETE FROM play_queue_items WHERE user_id = ?",
+	"DELETE FROM play_queues WHERE user_id = ?",
+	"DELETE FROM user_song_stats WHERE user_id = ?",
+	"DELETE FROM play_events WHERE user_id = ?",
+	"DELETE FROM sessions WHERE user_id = ?",
+	"DELETE FROM api_keys WHERE user_id = ?",
+	"DELETE FROM recovery_codes WHERE user_id = ?",
+	"DELETE FROM login_challenges WHERE user_id = ?",
+}
+
+// ListUsers 分页获取用户列表，query 不为空时按用户名或邮箱过滤
+func (us *UserService) ListUsers(query string, limit, offset int) ([]model.User, int, error) {
+	where := "1 = 1"
+	args := []interface{}{}
+	if query = strings.TrimSpace(query); query != "" {
+		where = `(username LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\')`
+		pattern := "%" + escapeLike(query) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	var total int
+	if err := us.db.QueryRow("SELECT COUNT(*) FROM users WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询用户总数失败: %v", err)
+	}
+
+	rows, err := us.db.Query(`
+		SELECT id, username, email, avatar, COALESCE(max_bitrate, 0), is_admin, is_disabled, totp_enabled, created_at, updated_at
+		FROM users
+		WHERE `+where+`
+		ORDER BY id
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询用户列表失败: %v", err)
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		var user model.User
+		var email, avatar sql.NullString
+		err := rows.Scan(
+			&user.ID, &user.Username, &email, &avatar, &user.MaxBitRate,
+			&user.IsAdmin, &user.IsDisabled, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取用户失败: %v", err)
+		}
+		user.Email = email.String
+		user.Avatar = avatar.String
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// CreateUser 管理员创建用户
+func (us *UserService) CreateUser(username, email, password string, isAdmin bool) (*model.User, error) {
+	return us.createUser(username, email, password, isAdmin)
+}
+
+// SetUserAdmin 设置或取消管理员，不能取消最后一个管理员
+func (us *UserService) SetUserAdmin(id int, isAdmin bool) error {
+	if isAdmin {
+		return us.updateUserFlag(id, "UPDATE users SET is_admin = 1, updated_at = ? WHERE id = ?", time.Now(), id)
+	}
+	return us.updateUserFlag(id,
+		"UPDATE users SET is_admin = 0, updated_at = ? WHERE id = ? AND (is_admin = 0 OR "+otherActiveAdmin+")",
+		time.Now(), id, id,
+	)
+}
+
+// SetUserDisabled 禁用或启用用户，不能禁用最后一个管理员
+func (us *UserService) SetUserDisabled(id int, disabled bool) error {
+	if !disabled {
+		return us.updateUserFlag(id, "UPDATE users SET is_disabled = 0, updated_at = ? WHERE id = ?", time.Now(), id)
+	}
+	return us.updateUserFlag(id,
+		"UPDATE users SET is_disabled = 1, updated_at = ? WHERE id = ? AND (is_admin = 0 OR "+otherActiveAdmin+")",
+		time.Now(), id, id,
+	)
+}
+
+// updateUserFlag 执行带最后管理员检查的更新，没有更新任何行时区分用户不存在和最后管理员
+func (us *UserService) updateUserFlag(id int, query string, args ...interface{}) error {
+	result, err := us.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("更新用户失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+
+	var count int
+	if err := us.db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", id).Scan(&count); err != nil {
+		return fmt.Errorf("查询用户失败: %v", err)
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	return ErrLastAdmin
+}
+
+// ResetPassword 管理员重置用户密码，删除用户的 Subsonic 密码并让用户在所有设备上重新登录
+func (us *UserService) ResetPassword(id int, password string) error {
+	var username string
+	err := us.db.QueryRow("SELECT username FROM users WHERE id = ?", id).Scan(&username)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("查询用户失败: %v", err)
+	}
+	if err := utils.ValidatePassword(password, username); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("密码加密失败: %v", err)
+	}
+
+	result, err := us.db.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?", hashedPassword, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("重置密码失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrUserNotFound
+	}
+
+	// 重置密码通常意味着账号可能已泄露，同时删除 Subsonic 密码
+	if err := us.DeleteSubsonicPassword(id); err != nil {
+		return err
+	}
+
+	if _, err := us.db.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", dbTime(time.Now()), id); err != nil {
+		return fmt.Errorf("吊销用户会话失败: %v", err)
+	}
+	return nil
+}
+
+// DeleteUser 删除用户及其播放列表、收藏、播放记录等个人数据，不能删除最后一个管理员
+func (us *UserService) DeleteUser(id int) error {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	var isAdmin int
+	var hasOtherAdmin bool
+	err = tx.QueryRow("SELECT is_admin, "+otherActiveAdmin+" FROM users WHERE id = ?", id, id).Scan(&isAdmin, &hasOtherAdmin)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("查询用户失败: %v", err)
+	}
+	if isAdmin == 1 && !hasOtherAdmin {
+		return ErrLastAdmin
+	}
+
+	rows, err := tx.Query("SELECT id FROM playlists WHERE user_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("查询用户播放列表失败: %v", err)
+	}
+	var playlistIDs []int
+	for rows.Next() {
+		var playlistID int
+		if err := rows.Scan(&playlistID); err != nil {
+			rows.Close()
+			return fmt.Errorf("读取用户播放列表失败: %v", err)
+		}
+		playlistIDs = append(playlistIDs, playlistID)
+	}
+	rows.Close()
+	for _, playlistID := range playlistIDs {
+		if err := deletePlaylistRows(tx, playlistID); err != nil {
+			return err
+		}
+	}
+
+	for _, stmt := range userDataStatements {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return fmt.Errorf("删除用户数据失败: %v", err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", id); err != nil {
+		return fmt.Errorf("删除用户失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
@@ -6,9 +6,29 @@ import (
 	"fmt"
 	"melogo/internal/model"
 	"melogo/internal/utils"
+	"sync"
 	"time"
 )
 
+var (
+	// ErrUserNotFound 用户不存在
+	ErrUserNotFound = errors.New("用户不存在")
+	// ErrUserDisabled 用户已被管理员禁用
+	ErrUserDisabled = errors.New("账号已被禁用")
+	// ErrLastAdmin 操作会使系统中没有可用的管理员
+	ErrLastAdmin = errors.New("不能取消、禁用或删除最后一个管理员")
+	// ErrWrongPassword 修改密码时当前密码错误
+	ErrWrongPassword = errors.New("当前密码错误")
+	// ErrNoSubsonicPassword 用户还没有生成 Subsonic 密码
+	ErrNoSubsonicPassword = errors.New("尚未生成Subsonic密码")
+)
+
+// dummyPasswordHash 用户不存在时用于比较的密码哈希，使响应时间与用户存在时一致，避免暴露用户名是否存在
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := utils.HashPassword("melogo-dummy-password")
+	return hash
+})
+
 // UserService 用户服务
 type UserService struct {
 	db *sql.DB
@@ -19,8 +39,18 @@ func NewUserService(db *sql.DB) *UserService {
 	return &UserService{db: db}
 }
 
-// Register 用户注册
+// Register 用户注册，第一个注册的用户成为管理员
 func (us *UserService) Register(username, email, password string) (*model.User, error) {
+	userCount, err := us.GetUserCount()
+	if err != nil {
+		return nil, fmt.Errorf("检查用户数量失败: %v", err)
+	}
+
+	return us.createUser(username, email, password, userCount == 0)
+}
+
+// createUser 检查用户名和邮箱后创建用户
+func (us *UserService) createUser(username, email, password string, admin bool) (*model.User, error) {
 	// 检查用户名是否已存在
 	exists, err := us.UsernameExists(username)
 	if err != nil {
@@ -41,15 +71,12 @@ func (us *UserService) Register(username, email, password string) (*model.User,
 		}
 	}
 
-	// 检查是否是第一个注册的用户，如果是则设为管理员
-	userCount, err := us.GetUserCount()
-	if err != nil {
-		return nil, fmt.Errorf("检查用户数量失败: %v", err)
+	if err := utils.ValidatePassword(password, username); err != nil {
+		return nil, err
 	}
 
 	isAdmin := 0
-	if userCount == 0 {
-		// 第一个注册的用户设为管理员
+	if admin {
 		isAdmin = 1
 	}
 
@@ -64,7 +91,7 @@ func (us *UserService) Register(username, email, password string) (*model.User,
 		INSERT INTO users (username, password_hash, email, is_admin, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?)
 	`
-	result, err := us.db.Exec(query, username, hashedPassword, email, isAdmin, time.Now(), time.Now())
+	result, err := us.db.Exec(query, username, hashedPassword, emailValue(email), isAdmin, time.Now(), time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("创建用户失败: %v", err)
 	}
@@ -88,36 +115,35 @@ func (us *UserService) Register(username, email, password string) (*model.User,
 	return user, nil
 }
 
-// Login 用户登录
-func (us *UserService) Login(username, password string) (*model.User, string, error) {
+// Login 验证用户名和密码，令牌由 SessionService 为登录会话签发
+func (us *UserService) Login(username, password string) (*model.User, error) {
 	// 根据用户名查询用户
 	user, err := us.GetUserByUsername(username)
 	if err != nil {
-		return nil, "", errors.New("用户名或密码错误")
+		// 用户不存在时同样执行一次密码比较
+		utils.VerifyPassword(dummyPasswordHash(), password)
+		return nil, errors.New("用户名或密码错误")
 	}
 
 	// 验证密码
 	err = utils.VerifyPassword(user.Password, password)
 	if err != nil {
-		return nil, "", errors.New("用户名或密码错误")
+		return nil, errors.New("用户名或密码错误")
 	}
-
-	// 生成JWT token
-	token, err := utils.GenerateToken(user.ID, user.Username)
-	if err != nil {
-		return nil, "", fmt.Errorf("生成token失败: %v", err)
+	if user.IsDisabled == 1 {
+		return nil, ErrUserDisabled
 	}
 
 	// 清空密码字段，避免返回给前端
 	user.Password = ""
 
-	return user, token, nil
+	return user, nil
 }
 
 // GetUserByID 根据ID获取用户信息
 func (us *UserService) GetUserByID(id int) (*model.User, error) {
 	query := `
-		SELECT id, username, email, avatar, is_admin, created_at, updated_at
+		SELECT id, username, email, avatar, COALESCE(max_bitrate, 0), is_admin, is_disabled, totp_enabled, created_at, updated_at
 		FROM users
 		WHERE id = ?
 	`
@@ -128,7 +154,10 @@ func (us *UserService) GetUserByID(id int) (*model.User, error) {
 		&user.Username,
 		&email,
 		&avatar,
+		&user.MaxBitRate,
 		&user.IsAdmin,
+		&user.IsDisabled,
+		&user.TwoFactorEnabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -153,19 +182,21 @@ func (us *UserService) GetUserByID(id int) (*model.User, error) {
 // GetUserByUsername 根据用户名获取用户信息（包含密码hash）
 func (us *UserService) GetUserByUsername(username string) (*model.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, avatar, is_admin, created_at, updated_at
+		SELECT id, username, email, password_hash, avatar, is_admin, is_disabled, totp_enabled, created_at, updated_at
 		FROM users
 		WHERE username = ?
 	`
 	var user model.User
-	var avatar sql.NullString
+	var email, avatar sql.NullString
 	err := us.db.QueryRow(query, username).Scan(
 		&user.ID,
 		&user.Username,
-		&user.Email,
+		&email,
 		&user.Password,
 		&avatar,
 		&user.IsAdmin,
+		&user.IsDisabled,
+		&user.TwoFactorEnabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -177,6 +208,9 @@ func (us *UserService) GetUserByUsername(username string) (*model.User, error) {
 	}
 
 	// 处理NULL值
+	if email.Valid {
+		user.Email = email.String
+	}
 	if avatar.Valid {
 		user.Avatar = avatar.String
 	}
@@ -195,6 +229,14 @@ func (us *UserService) UsernameExists(username string) (bool, error) {
 	return count > 0, nil
 }
 
+// emailValue 空邮箱保存为 NULL，避免多个未填写邮箱的用户违反唯一约束
+func emailValue(email string) interface{} {
+	if email == "" {
+		return nil
+	}
+	return email
+}
+
 // EmailExists 检查邮箱是否存在
 func (us *UserService) EmailExists(email string) (bool, error) {
 	var count int
@@ -224,13 +266,31 @@ func (us *UserService) UpdateUser(id int, email, avatar string) error {
 		SET email = ?, avatar = ?, updated_at = ?
 		WHERE id = ?
 	`
-	_, err := us.db.Exec(query, email, avatar, time.Now(), id)
+	_, err := us.db.Exec(query, emailValue(email), avatar, time.Now(), id)
 	if err != nil {
 		return fmt.Errorf("更新用户信息失败: %v", err)
 	}
 	return nil
 }
 
+// UpdateMaxBitRate 更新用户默认的最大播放码率（kbps，0表示不限制）
+func (us *UserService) UpdateMaxBitRate(id, maxBitRate int) error {
+	if maxBitRate < 0 {
+		return errors.New("码率不能为负数")
+	}
+
+	query := `
+		UPDATE users
+		SET max_bitrate = ?, updated_at = ?
+		WHERE id = ?
+	`
+	_, err := us.db.Exec(query, maxBitRate, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("更新码率限制失败: %v", err)
+	}
+	return nil
+}
+
 // UpdateUserAvatarData 更新用户头像数据(BLOB)
 func (us *UserService) UpdateUserAvatarData(id int, avatarData []byte) error {
 	query := `
@@ -262,3 +322,98 @@ func (us *UserService) GetUserAvatarData(id int) ([]byte, error) {
 	}
 	return avatarData, nil
 }
+
+// ChangePassword 验证当前密码后修改密码，并退出除当前会话外的所有设备；单独生成的 Subsonic 密码保持不变
+func (us *UserService) ChangePassword(id int, currentPassword, newPassword string, currentSessionID int) error {
+	var username, passwordHash string
+	err := us.db.QueryRow("SELECT username, password_hash FROM users WHERE id = ?", id).Scan(&username, &passwordHash)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("查询用户失败: %v", err)
+	}
+
+	if err := utils.VerifyPassword(passwordHash, currentPassword); err != nil {
+		return ErrWrongPassword
+	}
+	if newPassword == currentPassword {
+		return fmt.Errorf("%w: 不能与当前密码相同", utils.ErrWeakPassword)
+	}
+	if err := utils.ValidatePassword(newPassword, username); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("密码加密失败: %v", err)
+	}
+	if _, err := us.db.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?", hashedPassword, time.Now(), id); err != nil {
+		return fmt.Errorf("修改密码失败: %v", err)
+	}
+
+	_, err = us.db.Exec(
+		"UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id != ? AND revoked_at IS NULL",
+		dbTime(time.Now()), id, currentSessionID,
+	)
+	if err != nil {
+		return fmt.Errorf("吊销其他会话失败: %v", err)
+	}
+	return nil
+}
+
+// GenerateSubsonicPassword 生成新的随机 Subsonic 密码并加密保存，替换旧密码；
+// token+salt 认证需要服务器知道明文，因此不使用账号密码，明文只在生成时返回一次
+func (us *UserService) GenerateSubsonicPassword(id int) (string, error) {
+	password, err := utils.RandomToken(18)
+	if err != nil {
+		return "", fmt.Errorf("生成Subsonic密码失败: %v", err)
+	}
+	encrypted, err := utils.EncryptString(password)
+	if err != nil {
+		return "", fmt.Errorf("加密密码失败: %v", err)
+	}
+
+	result, err := us.db.Exec("UPDATE users SET subsonic_password = ? WHERE id = ?", encrypted, id)
+	if err != nil {
+		return "", fmt.Errorf("更新Subsonic密码失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return "", ErrUserNotFound
+	}
+	return password, nil
+}
+
+// DeleteSubsonicPassword 删除用户的 Subsonic 密码
+func (us *UserService) DeleteSubsonicPassword(id int) error {
+	if _, err := us.db.Exec("UPDATE users SET subsonic_password = NULL WHERE id = ?", id); err != nil {
+		return fmt.Errorf("删除Subsonic密码失败: %v", err)
+	}
+	return nil
+}
+
+// HasSubsonicPassword 用户是否已经生成 Subsonic 密码
+func (us *UserService) HasSubsonicPassword(id int) (bool, error) {
+	_, err := us.GetSubsonicPassword(id)
+	if errors.Is(err, ErrNoSubsonicPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetSubsonicPassword 获取解密后的Subsonic认证密码
+func (us *UserService) GetSubsonicPassword(id int) (string, error) {
+	var encrypted sql.NullString
+	err := us.db.QueryRow("SELECT subsonic_password FROM users WHERE id = ?", id).Scan(&encrypted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+	if !encrypted.Valid || encrypted.String == "" {
+		return "", ErrNoSubsonicPassword
+	}
+
+	return utils.DecryptString(encrypted.String)
+}
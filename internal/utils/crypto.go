@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// encryptionKey will be derived from config
+var encryptionKey []byte
+
+// legacyEncryptionKey 旧版本由 JWT 密钥派生的加密密钥，只用于解密升级前保存的数据
+var legacyEncryptionKey []byte
+
+// SetEncryptionKey 设置可逆加密使用的密钥（由配置中的 ENCRYPTION_KEY 派生）
+func SetEncryptionKey(secret string) {
+	sum := sha256.Sum256([]byte(secret))
+	encryptionKey = sum[:]
+}
+
+// SetLegacyEncryptionKey 设置旧版本使用的加密密钥，解密失败时回退使用，便于用 ReencryptString 迁移旧数据
+func SetLegacyEncryptionKey(secret string) {
+	sum := sha256.Sum256([]byte(secret))
+	legacyEncryptionKey = sum[:]
+}
+
+// EncryptString 使用AES-GCM加密字符串，返回base64编码的密文
+func EncryptString(plaintext string) (string, error) {
+	if len(encryptionKey) == 0 {
+		return "", errors.New("encryption key not set")
+	}
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString 解密EncryptString生成的密文，当前密钥无法解密时尝试旧版本的密钥
+func DecryptString(ciphertext string) (string, error) {
+	plaintext, _, err := decryptString(ciphertext)
+	return plaintext, err
+}
+
+// ReencryptString 将旧版本密钥加密的密文改用当前密钥加密；changed 为 false 表示已经使用当前密钥
+func ReencryptString(ciphertext string) (string, bool, error) {
+	plaintext, legacy, err := decryptString(ciphertext)
+	if err != nil || !legacy {
+		return ciphertext, false, err
+	}
+	reencrypted, err := EncryptString(plaintext)
+	if err != nil {
+		return ciphertext, false, err
+	}
+	return reencrypted, true, nil
+}
+
+// decryptString 依次使用当前密钥和旧版本的密钥解密，legacy 表示使用了旧版本的密钥
+func decryptString(ciphertext string) (string, bool, error) {
+	if len(encryptionKey) == 0 {
+		return "", false, errors.New("encryption key not set")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", false, err
+	}
+
+	plaintext, err := openWithKey(encryptionKey, data)
+	if err == nil {
+		return plaintext, false, nil
+	}
+	if len(legacyEncryptionKey) > 0 {
+		if plaintext, legacyErr := openWithKey(legacyEncryptionKey, data); legacyErr == nil {
+			return plaintext, true, nil
+		}
+	}
+	return "", false, err
+}
+
+// openWithKey 使用指定密钥解密 AES-GCM 密文
+func openWithKey(key, data []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// RandomToken 生成指定字节数的随机令牌，返回URL安全的base64编码
+func RandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken 计算令牌的SHA-256摘要，数据库中只保存摘要
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
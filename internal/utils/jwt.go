@@ -12,22 +12,28 @@ var jwtSecret []byte
 
 // Claims 定义JWT claims结构
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID int    `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成JWT token
-func GenerateToken(userID int, username string) (string, error) {
-	// 设置token过期时间为24小时
-	expirationTime := time.Now().Add(24 * time.Hour)
+// GenerateToken 为登录会话生成访问token，jti用于单独吊销该token
+func GenerateToken(userID int, username string, sessionID int, ttl time.Duration) (string, *Claims, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
 
+	now := time.Now()
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    "melogo",
 		},
 	}
@@ -36,10 +42,10 @@ func GenerateToken(userID int, username string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return tokenString, nil
+	return tokenString, claims, nil
 }
 
 // ParseToken 解析JWT token
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// audioContentTypes 音频扩展名与MIME类型的对应关系
+var audioContentTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wma":  "audio/x-ms-wma",
+	".aif":  "audio/aiff",
+	".aiff": "audio/aiff",
+}
+
+// AudioContentType 根据文件扩展名返回音频的MIME类型
+func AudioContentType(filePath string) string {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if contentType, ok := audioContentTypes[ext]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// audioCodecs 音频扩展名与编码格式的对应关系
+var audioCodecs = map[string]string{
+	".mp3":  "mp3",
+	".flac": "flac",
+	".wav":  "pcm",
+	".m4a":  "aac",
+	".aac":  "aac",
+	".ogg":  "vorbis",
+	".oga":  "vorbis",
+	".opus": "opus",
+	".wma":  "wma",
+	".aif":  "pcm",
+	".aiff": "pcm",
+}
+
+// AudioCodec 根据文件扩展名和码率（kbps）推断音频编码格式，无法识别时返回空字符串
+func AudioCodec(filePath string, bitRate int) string {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	// m4a 容器可能是 AAC 或 ALAC，码率超出 AAC 常见范围时视为无损的 ALAC
+	if ext == ".m4a" && bitRate > 512 {
+		return "alac"
+	}
+	return audioCodecs[ext]
+}
@@ -1,9 +1,77 @@
 package utils
 
 import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// maxPasswordBytes bcrypt 只使用密码的前 72 个字节
+const maxPasswordBytes = 72
+
+// ErrWeakPassword 新密码不符合密码策略
+var ErrWeakPassword = errors.New("密码不符合要求")
+
+//go:embed data/breached_passwords.txt
+var breachedPasswordList string
+
+var (
+	passwordMinLength     = 8
+	passwordCheckBreached = true
+
+	breachedPasswords     map[string]struct{}
+	breachedPasswordsOnce sync.Once
+)
+
+// SetPasswordPolicy 设置新密码的最小长度以及是否检查常见和已泄露的密码
+func SetPasswordPolicy(minLength int, checkBreached bool) {
+	passwordMinLength = minLength
+	passwordCheckBreached = checkBreached
+}
+
+// PasswordMinLength 返回新密码的最小长度
+func PasswordMinLength() int {
+	return passwordMinLength
+}
+
+// ValidatePassword 检查新密码是否符合密码策略，不符合时返回包装了 ErrWeakPassword 的错误
+func ValidatePassword(password, username string) error {
+	if utf8.RuneCountInString(password) < passwordMinLength {
+		return fmt.Errorf("%w: 长度至少为 %d 个字符", ErrWeakPassword, passwordMinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: 长度不能超过 %d 个字节", ErrWeakPassword, maxPasswordBytes)
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		return fmt.Errorf("%w: 不能与用户名相同", ErrWeakPassword)
+	}
+	if passwordCheckBreached && isBreachedPassword(password) {
+		return fmt.Errorf("%w: 该密码过于常见或已在数据泄露中出现", ErrWeakPassword)
+	}
+	return nil
+}
+
+// isBreachedPassword 检查密码是否在内置的常见及已泄露密码列表中（不区分大小写）
+func isBreachedPassword(password string) bool {
+	breachedPasswordsOnce.Do(func() {
+		breachedPasswords = make(map[string]struct{})
+		for _, line := range strings.Split(breachedPasswordList, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			breachedPasswords[line] = struct{}{}
+		}
+	})
+	_, found := breachedPasswords[strings.ToLower(password)]
+	return found
+}
+
 // HashPassword 使用bcrypt加密密码
 func HashPassword(password string) (string, error) {
 	// 使用默认成本参数（10）
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathOutsideBase 路径超出了允许访问的目录
+var ErrPathOutsideBase = errors.New("path escapes base directory")
+
+// SafeJoin 将相对路径拼接到基础目录下，拒绝绝对路径以及通过 ".." 跳出基础目录的路径
+func SafeJoin(baseDir, relPath string) (string, error) {
+	if relPath == "" {
+		return "", errors.New("empty path")
+	}
+	if filepath.IsAbs(relPath) || filepath.VolumeName(relPath) != "" {
+		return "", ErrPathOutsideBase
+	}
+
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return "", err
+	}
+	joined := filepath.Join(base, relPath)
+
+	rel, err := filepath.Rel(base, joined)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrPathOutsideBase
+	}
+
+	return joined, nil
+}
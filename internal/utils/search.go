@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gosimple/unidecode"
+)
+
+// lrcTagPattern 匹配LRC歌词中的时间轴和元信息标签
+var lrcTagPattern = regexp.MustCompile(`\[[^\]]*\]`)
+
+// isCJK 判断字符是否为中日韩文字（汉字、假名、谚文）
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// splitCJK 转为小写，并在每个中日韩字符两侧加空格，使全文索引按单字切分
+func splitCJK(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if isCJK(r) {
+			b.WriteByte(' ')
+			b.WriteRune(r)
+			b.WriteByte(' ')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// NormalizeSearchText 生成用于全文索引的文本：
+// 中日韩字符按单字切分，并附加拉丁转写（拼音、罗马字等），
+// 每段连续的中日韩文字还会附加一个不带空格的转写，如 "周杰伦" 附加 "zhou jie lun" 和 "zhoujielun"，
+// 以便使用拉丁字母输入搜索
+func NormalizeSearchText(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	parts := []string{splitCJK(s)}
+
+	// 连续的中日韩文字
+	var runs []string
+	var run []rune
+	hasNonASCII := false
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			hasNonASCII = true
+		}
+		if isCJK(r) {
+			run = append(run, r)
+			continue
+		}
+		if len(run) > 0 {
+			runs = append(runs, string(run))
+			run = nil
+		}
+	}
+	if len(run) > 0 {
+		runs = append(runs, string(run))
+	}
+
+	if hasNonASCII {
+		parts = append(parts, strings.ToLower(unidecode.Unidecode(s)))
+	}
+	for _, r := range runs {
+		parts = append(parts, strings.ToLower(strings.Join(strings.Fields(unidecode.Unidecode(r)), "")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// LyricsSearchText 去掉LRC歌词的时间轴和元信息标签，返回用于全文索引的文本
+func LyricsSearchText(lrc string) string {
+	lines := strings.Split(strings.ReplaceAll(lrc, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(lrcTagPattern.ReplaceAllString(line, ""))
+	}
+	return NormalizeSearchText(strings.Join(strings.Fields(strings.Join(lines, " ")), " "))
+}
+
+// BuildFTSQuery 将用户输入转换为 FTS5 查询：按与索引相同的规则切分，连续的中日韩字符作为短语，
+// 每个词或短语均按前缀匹配并以 AND 连接；输入中没有可搜索的词时返回空字符串
+func BuildFTSQuery(query string) string {
+	// 去掉 FTS5 语法字符，只保留字母和数字
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r) {
+			return r
+		}
+		return ' '
+	}, query)
+
+	var terms, phrase []string
+	flushPhrase := func() {
+		if len(phrase) > 0 {
+			terms = append(terms, `"`+strings.Join(phrase, " ")+`"*`)
+			phrase = nil
+		}
+	}
+	for _, token := range strings.Fields(splitCJK(cleaned)) {
+		if r := []rune(token); len(r) == 1 && isCJK(r[0]) {
+			phrase = append(phrase, token)
+			continue
+		}
+		flushPhrase()
+		terms = append(terms, `"`+token+`"*`)
+	}
+	flushPhrase()
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"melogo/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewSubsonicResponse 创建状态为ok的Subsonic响应
+func NewSubsonicResponse() *model.SubsonicResponse {
+	return &model.SubsonicResponse{
+		Xmlns:         "http://subsonic.org/restapi",
+		Status:        "ok",
+		Version:       model.SubsonicAPIVersion,
+		Type:          model.SubsonicServerType,
+		ServerVersion: "0.0.1",
+		OpenSubsonic:  true,
+	}
+}
+
+// SendSubsonic 按请求的格式（f=xml|json|jsonp）输出Subsonic响应
+func SendSubsonic(c *gin.Context, resp *model.SubsonicResponse) {
+	switch SubsonicParam(c, "f") {
+	case "json":
+		c.JSON(http.StatusOK, gin.H{"subsonic-response": resp})
+	case "jsonp":
+		callback := SubsonicParam(c, "callback")
+		if callback == "" {
+			c.JSON(http.StatusOK, gin.H{"subsonic-response": resp})
+			return
+		}
+		c.JSONP(http.StatusOK, gin.H{"subsonic-response": resp})
+	default:
+		c.XML(http.StatusOK, resp)
+	}
+}
+
+// SendSubsonicError 输出Subsonic错误响应（Subsonic协议要求HTTP状态码始终为200）
+func SendSubsonicError(c *gin.Context, code int, message string) {
+	resp := NewSubsonicResponse()
+	resp.Status = "failed"
+	resp.Error = &model.SubsonicError{Code: code, Message: message}
+	SendSubsonic(c, resp)
+}
+
+// SubsonicParam 从查询参数或表单中读取Subsonic参数
+func SubsonicParam(c *gin.Context, key string) string {
+	if value := c.Query(key); value != "" {
+		return value
+	}
+	return c.PostForm(key)
+}
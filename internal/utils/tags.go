@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"strings"
+)
+
+// SplitTagValues 按分隔符拆分多值标签（如 "Artist A; Artist B"、"A feat. B"），
+// 分隔符不区分大小写，结果去除首尾空白和括号，并按不区分大小写的方式去重，保持原有顺序
+func SplitTagValues(values []string, separators []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+
+	for _, value := range values {
+		parts := []string{value}
+		for _, sep := range separators {
+			var next []string
+			for _, part := range parts {
+				next = append(next, splitFold(part, sep)...)
+			}
+			parts = next
+		}
+
+		for _, part := range parts {
+			part = strings.Trim(part, " \t()[]")
+			key := strings.ToLower(part)
+			if part == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// splitFold 不区分大小写地按分隔符拆分字符串
+func splitFold(s, sep string) []string {
+	lower := strings.ToLower(s)
+	lowerSep := strings.ToLower(sep)
+	if sep == "" {
+		return []string{s}
+	}
+	// 转换大小写可能改变字节长度，此时无法按位置对应，退回区分大小写的拆分
+	if len(lower) != len(s) || len(lowerSep) != len(sep) {
+		return strings.Split(s, sep)
+	}
+
+	var parts []string
+	for {
+		i := strings.Index(lower, lowerSep)
+		if i < 0 {
+			break
+		}
+		parts = append(parts, s[:i])
+		s, lower = s[i+len(sep):], lower[i+len(lowerSep):]
+	}
+	return append(parts, s)
+}
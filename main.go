@@ -47,6 +47,27 @@ func main() {
 		cfg = config.LoadConfig()
 	}
 
+	// 子命令
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "migrate":
+			os.Exit(runMigrateCommand(cfg, flag.Args()[1:]))
+		default:
+			logger.Errorf("Unknown command: %s", flag.Arg(0))
+			os.Exit(2)
+		}
+	}
+
+	// 可逆加密的密钥必须单独配置，不能使用默认值或 JWT 密钥
+	if cfg.Auth.EncryptionKey == "" {
+		logger.Errorf("ENCRYPTION_KEY is not set, generate one with `openssl rand -base64 32`")
+		os.Exit(1)
+	}
+	if cfg.Auth.EncryptionKey == cfg.Auth.JWTSecret {
+		logger.Errorf("ENCRYPTION_KEY must be different from JWT_SECRET")
+		os.Exit(1)
+	}
+
 	// 初始化数据库
 	if err := services.InitDatabase(cfg); err != nil {
 		logger.Errorf("Failed to initialize database: %v", err)
@@ -56,6 +77,17 @@ func main() {
 	// 初始化JWT密钥
 	utils.SetJWTSecret(cfg.Auth.JWTSecret)
 
+	// 初始化加密密钥，并将旧版本用 JWT 密钥加密的数据改用新密钥加密
+	utils.SetEncryptionKey(cfg.Auth.EncryptionKey)
+	utils.SetLegacyEncryptionKey(cfg.Auth.JWTSecret)
+	if err := services.ReencryptSecrets(services.DB); err != nil {
+		logger.Errorf("Failed to re-encrypt stored secrets: %v", err)
+		os.Exit(1)
+	}
+
+	// 初始化密码策略
+	utils.SetPasswordPolicy(cfg.Auth.PasswordMinLength, cfg.Auth.PasswordCheckBreached)
+
 	// 初始化i18n
 	localesFS, err := fs.Sub(localeFiles, "web/locales")
 	if err != nil {
@@ -70,12 +102,46 @@ func main() {
 	// 初始化handler
 	handler.InitUserHandler(cfg)
 
+	// 初始化登录会话服务
+	handler.InitSessionHandler(services.NewSessionService(cfg, services.DB))
+
+	// 初始化API密钥服务
+	handler.InitAPIKeyHandler(services.NewAPIKeyService(services.DB))
+
+	// 初始化两步验证服务
+	handler.InitTwoFactorHandler(services.NewTwoFactorService(cfg, services.DB))
+
 	// 初始化播放列表服务
-	handler.InitPlaylistHandler(services.NewPlaylistService(services.DB))
+	handler.InitPlaylistHandler(services.NewPlaylistService(cfg, services.DB))
+
+	// 初始化智能播放列表服务
+	handler.InitSmartPlaylistHandler(services.NewSmartPlaylistService(services.DB))
 
 	// 初始化收藏服务
 	handler.InitFavoriteHandler(services.NewFavoriteService(services.DB))
 
+	// 初始化曲库浏览处理器
+	handler.InitLibraryHandler(services.NewLibraryService(services.DB))
+
+	// 初始化搜索服务
+	handler.InitSearchHandler(services.NewSearchService(services.DB))
+
+	// 初始化外部播放记录服务，启动后台提交任务
+	scrobbleService := services.NewScrobbleService(cfg, services.DB)
+	scrobbleService.Start()
+	handler.InitScrobbleHandler(scrobbleService)
+
+	// 初始化播放记录服务
+	playHistoryService := services.NewPlayHistoryService(services.DB)
+	playHistoryService.AddListener(scrobbleService)
+	handler.InitPlayHistoryHandler(playHistoryService)
+
+	// 初始化播放队列服务
+	handler.InitPlayQueueHandler(services.NewPlayQueueService(services.DB))
+
+	// 初始化转码服务
+	handler.InitStreamHandler(services.NewTranscoder(cfg))
+
 	// 创建音乐扫描器
 	scanner := services.NewMusicScanner(cfg, services.DB)
 
@@ -92,6 +158,12 @@ func main() {
 	// 创建Gin引擎
 	r := gin.Default()
 
+	// 只信任配置的反向代理提供的 X-Forwarded-For，否则客户端可以伪造IP绕过按IP的登录限制
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Errorf("Invalid TRUSTED_PROXIES: %v", err)
+		os.Exit(1)
+	}
+
 	// 注册i18n中间件
 	r.Use(i18n.Middleware())
 
@@ -224,5 +296,8 @@ func main() {
 	// 停止音乐扫描服务
 	scanner.Stop()
 
+	// 停止外部播放记录提交任务
+	scrobbleService.Stop()
+
 	logger.Info("Server exited")
 }
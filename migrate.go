@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"melogo/internal/config"
+	"melogo/internal/services"
+	"os"
+)
+
+// migrateUsage migrate 子命令的用法说明
+const migrateUsage = "Usage: melogo [-f .env] migrate status|up|down"
+
+// runMigrateCommand 执行 migrate 子命令，返回进程退出码
+func runMigrateCommand(cfg *config.Config, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err := services.OpenDatabase(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer services.DB.Close()
+
+	switch args[0] {
+	case "status":
+		states, err := services.MigrationStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migration status: %v\n", err)
+			return 1
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-40s  %s\n", state.Version, state.Name, applied)
+		}
+
+	case "up":
+		count, err := services.MigrateUp()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Applied %d migration(s)\n", count)
+
+	case "down":
+		migration, err := services.MigrateDown()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Rollback failed: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Rolled back migration %d: %s\n", migration.Version, migration.Name)
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -337,4 +337,59 @@ function addCommonStyles() {
 }
 
 // Initialize styles when DOM is loaded
-document.addEventListener('DOMContentLoaded', addCommonStyles);
\ No newline at end of file
+document.addEventListener('DOMContentLoaded', addCommonStyles);
+// 7. Access token renewal
+// 访问令牌有效期较短：API 返回 401 时用刷新令牌 Cookie 换取新令牌并重试一次
+(function () {
+    const originalFetch = window.fetch.bind(window);
+    let refreshing = null;
+
+    // 同时失败的请求共用一次刷新，避免旧刷新令牌被重复使用
+    function refreshAccessToken() {
+        if (!refreshing) {
+            refreshing = originalFetch('/api/v1/refresh', { method: 'POST', credentials: 'same-origin' })
+                .then(response => response.ok ? response.json() : null)
+                .then(data => {
+                    if (data && data.token) {
+                        localStorage.setItem('token', data.token);
+                        return data.token;
+                    }
+                    return null;
+                })
+                .catch(() => null)
+                .finally(() => {
+                    refreshing = null;
+                });
+        }
+        return refreshing;
+    }
+
+    // 页面加载时读取的 token 可能已经刷新过，发送前替换为最新的 token
+    function withCurrentToken(init) {
+        const token = localStorage.getItem('token');
+        if (!token || !init || !init.headers) {
+            return init;
+        }
+        const headers = new Headers(init.headers);
+        const auth = headers.get('Authorization');
+        if (auth && auth.startsWith('Bearer ') && auth !== 'Bearer ' + token) {
+            headers.set('Authorization', 'Bearer ' + token);
+            return Object.assign({}, init, { headers: headers });
+        }
+        return init;
+    }
+
+    window.fetch = async function (input, init) {
+        const path = new URL(typeof input === 'string' ? input : input.url, window.location.origin).pathname;
+        const response = await originalFetch(input, withCurrentToken(init));
+        if (response.status !== 401 || !path.startsWith('/api/v1/') || /^\/api\/v1\/(login|register|refresh)$/.test(path)) {
+            return response;
+        }
+
+        const token = await refreshAccessToken();
+        if (!token) {
+            return response;
+        }
+        return originalFetch(input, withCurrentToken(init));
+    };
+})();